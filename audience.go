@@ -0,0 +1,140 @@
+package tokendiscovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// AudienceAny is the audience that the WLCG Common JWT Profile defines for tokens that every relying party must accept
+const AudienceAny = "https://wlcg.cern.ch/jwt/v1/any"
+
+// ErrNoMatchingAudience indicates that a token was skipped because its aud claim does not include the audience required
+// with WithRequiredAudience or FindTokenForAudience. If no token qualifies, the error returned by discovery wraps both
+// it and ErrNoTokenFound, and lists the audiences of the tokens that were found.
+var ErrNoMatchingAudience = errors.New("token audience does not match")
+
+// WithRequiredAudience makes discovery skip tokens whose aud claim includes neither aud nor AudienceAny, in the same
+// way as WithSkipExpired, so that a service holding several audience-scoped tokens gets the one meant for it. The aud
+// claim may be a string or a list of strings. WithoutAnyAudience disables accepting AudienceAny. Tokens that are not
+// JWTs are skipped. Tokens are NOT verified, as described for ParseClaims.
+func WithRequiredAudience(aud string) Option {
+	return func(d *Discoverer) error {
+		if aud == "" {
+			return fmt.Errorf("%w: audience cannot be empty", ErrInvalidOption)
+		}
+		d.requiredAudience = aud
+		return nil
+	}
+}
+
+// WithoutAnyAudience makes WithRequiredAudience and FindTokenForAudience only accept tokens whose aud claim includes
+// the audience requested, and not those for AudienceAny
+func WithoutAnyAudience() Option {
+	return func(d *Discoverer) error {
+		d.noAnyAudience = true
+		return nil
+	}
+}
+
+// HasAudience reports whether the aud claim of c, a string or a list of strings, includes aud or AudienceAny
+func (c Claims) HasAudience(aud string) bool {
+	auds := c.Audience()
+	return slices.Contains(auds, aud) || slices.Contains(auds, AudienceAny)
+}
+
+// FindTokenForAudience is like FindToken, but only accepts tokens whose aud claim includes aud or AudienceAny, as
+// described for WithRequiredAudience
+func FindTokenForAudience(aud string) ([]byte, error) {
+	return defaultDiscoverer.FindTokenForAudience(aud)
+}
+
+// FindTokenForAudienceContext is like FindTokenForAudience, but abandons discovery when ctx is done. In that case, the
+// returned error wraps ctx.Err().
+func FindTokenForAudienceContext(ctx context.Context, aud string) ([]byte, error) {
+	return defaultDiscoverer.FindTokenForAudienceContext(ctx, aud)
+}
+
+// FindTokenForAudience is like the package-level FindTokenForAudience, but uses the discovery procedure as configured
+// on d
+func (d *Discoverer) FindTokenForAudience(aud string) ([]byte, error) {
+	return d.FindTokenForAudienceContext(context.Background(), aud)
+}
+
+// FindTokenForAudienceContext is like FindTokenForAudience, but abandons discovery when ctx is done
+func (d *Discoverer) FindTokenForAudienceContext(ctx context.Context, aud string) ([]byte, error) {
+	if aud == "" {
+		return nil, fmt.Errorf("%w: audience cannot be empty", ErrInvalidOption)
+	}
+	scoped := *d
+	scoped.requiredAudience = aud
+	return scoped.FindTokenContext(ctx)
+}
+
+// audienceError records that a token was skipped because its aud claim does not include the required audience
+type audienceError struct {
+	required string
+	seen     []string
+}
+
+func (e *audienceError) Error() string {
+	if len(e.seen) == 0 {
+		return fmt.Sprintf("%s %q: token has no aud claim", ErrNoMatchingAudience, e.required)
+	}
+	return fmt.Sprintf("%s %q: token is for %s", ErrNoMatchingAudience, e.required, quoteAll(e.seen))
+}
+
+func (e *audienceError) Unwrap() error { return ErrNoMatchingAudience }
+
+// checkAudience returns an error wrapping ErrNoMatchingAudience if tok should be skipped according to
+// WithRequiredAudience
+func (d *Discoverer) checkAudience(tok []byte) error {
+	if d.requiredAudience == "" {
+		return nil
+	}
+	claims, err := parseClaimsCached(tok)
+	if err != nil {
+		return fmt.Errorf("%w %q: %w", ErrNoMatchingAudience, d.requiredAudience, err)
+	}
+	if d.noAnyAudience && slices.Contains(claims.Audience(), d.requiredAudience) ||
+		!d.noAnyAudience && claims.HasAudience(d.requiredAudience) {
+		return nil
+	}
+	return &audienceError{required: d.requiredAudience, seen: claims.Audience()}
+}
+
+// audienceMismatchError returns the error summarizing the audiences of the tokens in rejected skipped by checkAudience,
+// for discovery to return when no token qualified. It returns nil if no token was skipped for its audience.
+func (d *Discoverer) audienceMismatchError(rejected []error) error {
+	var mismatched bool
+	var seen []string
+	for _, err := range rejected {
+		mismatched = mismatched || errors.Is(err, ErrNoMatchingAudience)
+		var aerr *audienceError
+		if errors.As(err, &aerr) {
+			for _, aud := range aerr.seen {
+				if !slices.Contains(seen, aud) {
+					seen = append(seen, aud)
+				}
+			}
+		}
+	}
+	switch {
+	case !mismatched:
+		return nil
+	case len(seen) == 0:
+		return fmt.Errorf("%w %q: no token with an aud claim was found", ErrNoMatchingAudience, d.requiredAudience)
+	}
+	return fmt.Errorf("%w %q: the audiences found were %s", ErrNoMatchingAudience, d.requiredAudience, quoteAll(seen))
+}
+
+// quoteAll returns strs quoted and separated by commas
+func quoteAll(strs []string) string {
+	quoted := make([]string, 0, len(strs))
+	for _, s := range strs {
+		quoted = append(quoted, fmt.Sprintf("%q", s))
+	}
+	return strings.Join(quoted, ", ")
+}
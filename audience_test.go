@@ -0,0 +1,153 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestFindTokenForAudience(t *testing.T) {
+	const storage = "https://storage.example:1094"
+	single := makeJWT(t, map[string]any{"aud": storage})
+	multi := makeJWT(t, map[string]any{"aud": []string{"https://other.example", storage}})
+	wildcard := makeJWT(t, map[string]any{"aud": disc.AudienceAny})
+	other := makeJWT(t, map[string]any{"aud": "https://other.example"})
+	otherList := makeJWT(t, map[string]any{"aud": []string{"https://compute.example", "https://other.example"}})
+	noAud := makeJWT(t, map[string]any{"sub": "user"})
+
+	type testCase struct {
+		description   string
+		envToken      string
+		fileToken     string
+		expectedToken string
+		expectedErr   error
+	}
+
+	testCases := []testCase{
+		{"Single audience in env", single, other, single, nil},
+		{"Multiple audiences in env", multi, other, multi, nil},
+		{"Wildcard audience in env", wildcard, other, wildcard, nil},
+		{"Other audience in env, single audience in file", other, single, single, nil},
+		{"No aud claim in env, multiple audiences in file", noAud, multi, multi, nil},
+		{"Opaque token in env, wildcard audience in file", "opaque_token", wildcard, wildcard, nil},
+		{"No matching audience", other, otherList, "", disc.ErrNoMatchingAudience},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				d, err := disc.New(
+					disc.WithEnvMap(map[string]string{"BEARER_TOKEN": tc.envToken, "BEARER_TOKEN_FILE": "/home/user/token"}),
+					disc.WithFS(fstest.MapFS{"home/user/token": {Data: []byte(tc.fileToken + "\n")}}),
+				)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, err := d.FindTokenForAudience(storage)
+				if tc.expectedErr != nil {
+					if !errors.Is(err, tc.expectedErr) || !errors.Is(err, disc.ErrNoTokenFound) {
+						t.Fatalf("Expected error wrapping %s and %s, got %v", tc.expectedErr, disc.ErrNoTokenFound, err)
+					}
+					msg := err.Error()
+					for _, aud := range []string{"https://other.example", "https://compute.example"} {
+						if !strings.Contains(msg, aud) {
+							t.Errorf("Expected error to list audience %s, got %v", aud, err)
+						}
+					}
+					if strings.Contains(msg, tc.envToken) || strings.Contains(msg, tc.fileToken) {
+						t.Errorf("Expected error not to include the tokens, got %v", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if string(tok) != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, tok)
+				}
+
+				// WithRequiredAudience finds the same token
+				d, err = disc.New(
+					disc.WithEnvMap(map[string]string{"BEARER_TOKEN": tc.envToken, "BEARER_TOKEN_FILE": "/home/user/token"}),
+					disc.WithFS(fstest.MapFS{"home/user/token": {Data: []byte(tc.fileToken + "\n")}}),
+					disc.WithRequiredAudience(storage),
+				)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				if tok, err := d.FindToken(); err != nil || string(tok) != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %s, got %s (%v)", tc.expectedToken, tok, err)
+				}
+			},
+		)
+	}
+}
+
+func TestAudienceAny(t *testing.T) {
+	anyAud := makeJWT(t, map[string]any{"aud": disc.AudienceAny})
+	anyInList := makeJWT(t, map[string]any{"aud": []string{"https://other.example", disc.AudienceAny}})
+	specific := makeJWT(t, map[string]any{"aud": "https://storage.example:1094"})
+
+	type testCase struct {
+		description   string
+		envToken      string
+		fileToken     string
+		requested     string
+		noAny         bool
+		expectedToken string
+	}
+
+	testCases := []testCase{
+		{"Any audience matches a storage endpoint", anyAud, specific, "https://storage.example:1094", false, anyAud},
+		{"Any audience matches a compute endpoint", anyAud, specific, "https://ce.example:9619", false, anyAud},
+		{"Any audience in a list", anyInList, specific, "https://ce.example:9619", false, anyInList},
+		{"Any audience disabled falls through", anyAud, specific, "https://storage.example:1094", true, specific},
+		{"Any audience in a list disabled", anyInList, specific, "https://storage.example:1094", true, specific},
+		{"Any audience disabled, exact match", anyInList, specific, "https://other.example", true, anyInList},
+		{"Any audience disabled, no match", anyAud, specific, "https://ce.example:9619", true, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := []disc.Option{
+					disc.WithEnvMap(map[string]string{"BEARER_TOKEN": tc.envToken, "BEARER_TOKEN_FILE": "/home/user/token"}),
+					disc.WithFS(fstest.MapFS{"home/user/token": {Data: []byte(tc.fileToken + "\n")}}),
+				}
+				if tc.noAny {
+					opts = append(opts, disc.WithoutAnyAudience())
+				}
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, err := d.FindTokenForAudience(tc.requested)
+				if tc.expectedToken == "" {
+					if !errors.Is(err, disc.ErrNoMatchingAudience) {
+						t.Errorf("Expected error %s, got %v", disc.ErrNoMatchingAudience, err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if string(tok) != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, tok)
+				}
+
+				claims, err := disc.ParseClaims([]byte(tc.envToken))
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if !tc.noAny && !claims.HasAudience(tc.requested) {
+					t.Errorf("Expected HasAudience(%q) to return true", tc.requested)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,103 @@
+package tokendiscovery_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestBearerPrefixStripping(t *testing.T) {
+	type testCase struct {
+		description    string
+		env            map[string]string
+		fsys           fstest.MapFS
+		opts           []disc.Option
+		expectedToken  string
+		expectedSource disc.Source
+		expectedWarn   bool
+	}
+
+	testCases := []testCase{
+		{
+			"BEARER_TOKEN with prefix",
+			map[string]string{"BEARER_TOKEN": "Bearer eyJ.abc.def"},
+			fstest.MapFS{},
+			nil,
+			"eyJ.abc.def",
+			disc.SourceBearerTokenEnv,
+			true,
+		},
+		{
+			"BEARER_TOKEN_FILE with lower-case prefix",
+			map[string]string{"BEARER_TOKEN_FILE": "/home/user/token"},
+			fstest.MapFS{"home/user/token": {Data: []byte("bearer\teyJ.abc.def\n")}},
+			nil,
+			"eyJ.abc.def",
+			disc.SourceBearerTokenFile,
+			true,
+		},
+		{
+			"Fallback with prefix",
+			map[string]string{},
+			fstest.MapFS{"tmp/bt_u4242": {Data: []byte("BEARER eyJ.abc.def")}},
+			nil,
+			"eyJ.abc.def",
+			disc.SourceTmpFallback,
+			true,
+		},
+		{
+			"Prefix only falls through",
+			map[string]string{"BEARER_TOKEN_FILE": "/home/user/token"},
+			fstest.MapFS{"home/user/token": {Data: []byte("Bearer\n")}, "tmp/bt_u4242": {Data: []byte("tmp_token")}},
+			nil,
+			"tmp_token",
+			disc.SourceTmpFallback,
+			false,
+		},
+		{
+			"Token starting with bearer is kept",
+			map[string]string{"BEARER_TOKEN": "bearerish"},
+			fstest.MapFS{},
+			nil,
+			"bearerish",
+			disc.SourceBearerTokenEnv,
+			false,
+		},
+		{
+			"Stripping disabled",
+			map[string]string{"BEARER_TOKEN": "Bearer eyJ.abc.def"},
+			fstest.MapFS{},
+			[]disc.Option{disc.WithoutBearerPrefixStripping()},
+			"Bearer eyJ.abc.def",
+			disc.SourceBearerTokenEnv,
+			false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := append([]disc.Option{disc.WithEnvMap(tc.env), disc.WithFS(tc.fsys), disc.WithUID("4242")}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				res, err := d.Discover()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if string(res.Bytes()) != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, string(res.Bytes()))
+				}
+				if res.Source() != tc.expectedSource {
+					t.Errorf("Token sources do not match. Expected %s, got %s", tc.expectedSource, res.Source())
+				}
+				if warned := len(res.Warnings()) > 0; warned != tc.expectedWarn {
+					t.Errorf("Expected warning to be %t, got warnings %q", tc.expectedWarn, res.Warnings())
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,97 @@
+package tokendiscovery
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+)
+
+// CachedDiscovery shares the token found by discovery between requests, as done by NewTransport, running discovery
+// again once the token is older than the rediscovery interval, has expired, or was rejected. Callers are given copies
+// of the token, so that the token it replaces can be wiped. Callers do not wait for discovery beyond the end of their
+// context, even when discovery started for another caller is still running. A CachedDiscovery is safe for concurrent
+// use.
+type CachedDiscovery struct {
+	d        *Discoverer
+	interval time.Duration
+
+	// sem is held, rather than a mutex, while discovery runs, so that callers can stop waiting for it when their
+	// context ends. It guards token and discoveredAt.
+	sem          chan struct{}
+	token        Result
+	discoveredAt time.Time
+
+	// rejected is a token that was rejected, which is not reused. It is guarded by mu rather than sem, so that a token
+	// can be invalidated without waiting for discovery.
+	mu       sync.Mutex
+	rejected []byte
+}
+
+// NewCachedDiscovery returns a CachedDiscovery running discovery with d, or the default discovery procedure if d is
+// nil, and reusing tokens for interval. An interval of 0 or less runs discovery for every call to Token.
+func NewCachedDiscovery(d *Discoverer, interval time.Duration) *CachedDiscovery {
+	if d == nil {
+		d = defaultDiscoverer
+	}
+	return &CachedDiscovery{d: d, interval: max(interval, 0), sem: make(chan struct{}, 1)}
+}
+
+// Token returns a copy of the token to send a request with under ctx, running discovery if the token last found is too
+// old, has expired, or was invalidated. If ctx ends before discovery does, the returned error is ctx.Err().
+func (c *CachedDiscovery) Token(ctx context.Context) ([]byte, error) {
+	select {
+	case c.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if !c.discoveredAt.IsZero() && time.Since(c.discoveredAt) < c.interval {
+		expired, err := c.token.NeedsRefresh(0)
+		if tok := c.token.Trimmed(); (err != nil || !expired) && !c.isRejected(tok) {
+			<-c.sem
+			return tok, nil
+		}
+	}
+
+	// Discovery runs apart, so that the caller can return once ctx ends even if a step ignores it
+	done := make(chan cachedDiscovery, 1)
+	go func() {
+		defer func() { <-c.sem }()
+		res, err := c.d.DiscoverContext(ctx)
+		if err != nil {
+			done <- cachedDiscovery{err: err}
+			return
+		}
+		c.token.Wipe()
+		c.token, c.discoveredAt = res, time.Now()
+		done <- cachedDiscovery{tok: res.Trimmed()}
+	}()
+	select {
+	case r := <-done:
+		return r.tok, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Invalidate prevents tok, a token returned by Token that a server rejected, from being returned again, so that the
+// next call to Token runs discovery
+func (c *CachedDiscovery) Invalidate(tok []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.rejected)
+	c.rejected = append(c.rejected[:0], tok...)
+}
+
+// isRejected reports whether tok was invalidated
+func (c *CachedDiscovery) isRejected(tok []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rejected != nil && bytes.Equal(c.rejected, tok)
+}
+
+// cachedDiscovery is the outcome of discovery run by a CachedDiscovery
+type cachedDiscovery struct {
+	tok []byte
+	err error
+}
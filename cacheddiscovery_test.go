@@ -0,0 +1,55 @@
+package tokendiscovery_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestCachedDiscovery(t *testing.T) {
+	type testCase struct {
+		description     string
+		interval        time.Duration
+		invalidate      bool
+		expectedLookups int32
+	}
+
+	testCases := []testCase{
+		{"Token reused", time.Hour, false, 1},
+		{"Invalidated token not reused", time.Hour, true, 3},
+		{"Zero interval", 0, false, 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				step := &rotatingStep{token: "token"}
+				d, err := disc.New(disc.WithSteps(step))
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				c := disc.NewCachedDiscovery(d, tc.interval)
+				for range 3 {
+					tok, err := c.Token(context.Background())
+					if err != nil {
+						t.Fatalf("Expected nil error, got %v", err)
+					}
+					if string(tok) != "token" {
+						t.Errorf("Token strings do not match.  Expected token, got %s", tok)
+					}
+					if tc.invalidate {
+						c.Invalidate(tok)
+					}
+					// Callers are given copies, which they may scrub
+					clear(tok)
+				}
+				if n := step.lookups.Load(); n != tc.expectedLookups {
+					t.Errorf("Expected %d discoveries, got %d", tc.expectedLookups, n)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,315 @@
+package tokendiscovery
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// ErrNotAJWT indicates that a token could not be parsed as a JWT
+var ErrNotAJWT = errors.New("token is not a JWT")
+
+// Claims holds the claims in the payload of a JWT, as returned by ParseClaims. Numbers are held as json.Number. The
+// claims are NOT verified: anyone can create a token with any claims, so they must not be used for authorization
+// decisions, only to inspect a token, for example to see when it expires.
+type Claims map[string]any
+
+// ParseClaims decodes the claims in the payload of tok, a JWT, WITHOUT verifying its signature, as described for
+// Claims. Segments may be base64url-encoded with or without padding. If tok is not a JWT, the returned error wraps
+// ErrNotAJWT.
+func ParseClaims(tok []byte) (Claims, error) {
+	header, payload, _, err := splitJWT(tok)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decodeSegment(header); err != nil {
+		return nil, fmt.Errorf("%w: invalid header: %w", ErrNotAJWT, err)
+	}
+	claims, err := decodeSegment(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid payload: %w", ErrNotAJWT, err)
+	}
+	return claims, nil
+}
+
+// splitJWT splits tok, with surrounding whitespace removed, into its three dot-separated segments
+func splitJWT(tok []byte) (header, payload, signature []byte, err error) {
+	tok = bytes.TrimSpace(tok)
+	header, rest, ok := bytes.Cut(tok, []byte("."))
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("%w: no header segment", ErrNotAJWT)
+	}
+	payload, signature, ok = bytes.Cut(rest, []byte("."))
+	if !ok || bytes.IndexByte(signature, '.') >= 0 {
+		return nil, nil, nil, fmt.Errorf("%w: not three dot-separated segments", ErrNotAJWT)
+	}
+	return header, payload, signature, nil
+}
+
+// decodeSegment decodes a base64url-encoded JSON object from a JWT
+func decodeSegment(seg []byte) (map[string]any, error) {
+	raw := make([]byte, base64.RawURLEncoding.DecodedLen(len(seg)))
+	n, err := base64.RawURLEncoding.Decode(raw, bytes.TrimRight(seg, "="))
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw[:n]))
+	dec.UseNumber()
+	var obj map[string]any
+	if err := dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, errors.New("not a JSON object")
+	}
+	if dec.More() {
+		return nil, errors.New("trailing data after JSON object")
+	}
+	return obj, nil
+}
+
+// String returns the claim named key if it is a string, or the empty string
+func (c Claims) String(key string) string {
+	s, _ := c[key].(string)
+	return s
+}
+
+// Issuer returns the iss claim
+func (c Claims) Issuer() string { return c.String("iss") }
+
+// Subject returns the sub claim
+func (c Claims) Subject() string { return c.String("sub") }
+
+// Audience returns the aud claim, which may be a single string or a list of them
+func (c Claims) Audience() []string { return c.Strings("aud") }
+
+// Scope returns the scope claim, split at spaces. Some issuers send a list of scopes instead, which is accepted too.
+func (c Claims) Scope() []string {
+	var scope []string
+	for _, s := range c.Strings("scope") {
+		scope = append(scope, strings.Fields(s)...)
+	}
+	return scope
+}
+
+// Strings returns the claim named key as a list of strings, if it is a string or a list of strings. A claim that is a
+// list is returned without any elements that are not strings.
+func (c Claims) Strings(key string) []string {
+	switch v := c[key].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var ss []string
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				ss = append(ss, s)
+			}
+		}
+		return ss
+	case []string:
+		return v
+	}
+	return nil
+}
+
+// Time returns the claim named key as a time, if it is a number of seconds since the Unix epoch, as the exp, iat, and
+// nbf claims are
+func (c Claims) Time(key string) (time.Time, bool) {
+	secs, ok := numericClaim(c[key])
+	if !ok {
+		return time.Time{}, false
+	}
+	whole, frac := math.Modf(secs)
+	return time.Unix(int64(whole), int64(frac*1e9)), true
+}
+
+// Expiry returns the time in the exp claim
+func (c Claims) Expiry() (time.Time, bool) { return c.Time("exp") }
+
+// IssuedAt returns the time in the iat claim
+func (c Claims) IssuedAt() (time.Time, bool) { return c.Time("iat") }
+
+// NotBefore returns the time in the nbf claim
+func (c Claims) NotBefore() (time.Time, bool) { return c.Time("nbf") }
+
+// numericClaim returns the value of a claim that is a number, as decoded by ParseClaims or set by a caller
+func numericClaim(v any) (float64, bool) {
+	var f float64
+	switch n := v.(type) {
+	case json.Number:
+		var err error
+		if f, err = n.Float64(); err != nil {
+			return 0, false
+		}
+	case float64:
+		f = n
+	case int:
+		f = float64(n)
+	case int64:
+		f = float64(n)
+	default:
+		return 0, false
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) || math.Abs(f) > math.MaxInt64/2 {
+		return 0, false
+	}
+	return f, true
+}
+
+// WLCGClaims holds the claims of the WLCG Common JWT Profile, as returned by Claims.AsWLCG. Like Claims, they are NOT
+// verified. Times that are missing from the token are zero.
+type WLCGClaims struct {
+	Iss        string
+	Sub        string
+	Aud        []string
+	Exp        time.Time
+	Iat        time.Time
+	Nbf        time.Time
+	Jti        string
+	Scope      []string
+	WLCGVer    string
+	WLCGGroups []string
+	// Extra holds the claims not covered by the other fields
+	Extra map[string]any
+}
+
+// wlcgClaimNames are the claims held by the named fields of WLCGClaims
+var wlcgClaimNames = map[string]bool{
+	"iss": true, "sub": true, "aud": true, "exp": true, "iat": true, "nbf": true, "jti": true, "scope": true,
+	"wlcg.ver": true, "wlcg.groups": true,
+}
+
+// AsWLCG returns the claims in c of the WLCG Common JWT Profile. Claims of unexpected types are left zero, and claims
+// the profile does not define are kept in Extra. DecodeWLCG reports such claims instead.
+func (c Claims) AsWLCG() WLCGClaims {
+	w := WLCGClaims{
+		Iss:        c.Issuer(),
+		Sub:        c.Subject(),
+		Aud:        c.Audience(),
+		Jti:        c.String("jti"),
+		Scope:      c.Scope(),
+		WLCGVer:    c.String("wlcg.ver"),
+		WLCGGroups: c.Groups(),
+	}
+	w.Exp, _ = c.Expiry()
+	w.Iat, _ = c.IssuedAt()
+	w.Nbf, _ = c.NotBefore()
+	if v, ok := c["wlcg.ver"].(json.Number); ok {
+		// Some issuers send the version as a number
+		w.WLCGVer = v.String()
+	}
+	for key, val := range c {
+		if !wlcgClaimNames[key] {
+			if w.Extra == nil {
+				w.Extra = make(map[string]any)
+			}
+			w.Extra[key] = val
+		}
+	}
+	return w
+}
+
+// ErrInvalidClaim indicates that a claim of a token is not of the type the WLCG Common JWT Profile defines for it
+var ErrInvalidClaim = errors.New("invalid claim")
+
+// wlcgClaimTypes are the types DecodeWLCG accepts for the claims of the WLCG Common JWT Profile
+var wlcgClaimTypes = []struct {
+	name  string
+	shape string
+	valid func(any) bool
+}{
+	{"iss", "a string", isString},
+	{"sub", "a string", isString},
+	{"aud", "a string or a list of strings", isStringOrStrings},
+	{"exp", "a number", isNumber},
+	{"iat", "a number", isNumber},
+	{"nbf", "a number", isNumber},
+	{"jti", "a string", isString},
+	{"scope", "a string or a list of strings", isStringOrStrings},
+	{"wlcg.ver", "a string or a number", func(v any) bool { return isString(v) || isNumber(v) }},
+	{"wlcg.groups", "a string or a list of strings", isStringOrStrings},
+}
+
+// DecodeWLCG is like AsWLCG, but returns an error wrapping ErrInvalidClaim and naming the claim if a claim of the
+// profile is not of the type it defines. The variants issuers are known to send are accepted: aud, scope and
+// wlcg.groups may be a string or a list of strings, and times and wlcg.ver may be integers or decimals. Null claims
+// are treated as missing.
+func (c Claims) DecodeWLCG() (WLCGClaims, error) {
+	for _, ct := range wlcgClaimTypes {
+		if v := c[ct.name]; v != nil && !ct.valid(v) {
+			return WLCGClaims{}, fmt.Errorf("%w %q: expected %s, got %s", ErrInvalidClaim, ct.name, ct.shape, jsonKind(v))
+		}
+	}
+	return c.AsWLCG(), nil
+}
+
+// ParseWLCGClaims decodes the claims in the payload of tok, a JWT, as ParseClaims does, and returns those of the WLCG
+// Common JWT Profile, as DecodeWLCG does. Like Claims, they are NOT verified.
+func ParseWLCGClaims(tok []byte) (WLCGClaims, error) {
+	claims, err := ParseClaims(tok)
+	if err != nil {
+		return WLCGClaims{}, err
+	}
+	return claims.DecodeWLCG()
+}
+
+// isString reports whether v is a string
+func isString(v any) bool {
+	_, ok := v.(string)
+	return ok
+}
+
+// isNumber reports whether v is a number that can be used as a time
+func isNumber(v any) bool {
+	_, ok := numericClaim(v)
+	return ok
+}
+
+// isStringOrStrings reports whether v is a string or a list of strings
+func isStringOrStrings(v any) bool {
+	switch v := v.(type) {
+	case string, []string:
+		return true
+	case []any:
+		for _, e := range v {
+			if _, ok := e.(string); !ok {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// jsonKind describes the type of v, a value decoded from JSON, for error messages. The value itself is not included,
+// since claims can identify a user.
+func jsonKind(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case json.Number, float64, int, int64:
+		if _, ok := numericClaim(v); !ok {
+			return "an out-of-range number"
+		}
+		return "a number"
+	case []any:
+		for _, e := range v {
+			if _, ok := e.(string); !ok {
+				return "a list containing " + jsonKind(e)
+			}
+		}
+		return "a list of strings"
+	case map[string]any:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", v)
+}
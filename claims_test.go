@@ -0,0 +1,376 @@
+package tokendiscovery_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+// encodeJWT builds an unsigned JWT with the given header and payload, base64url-encoded with or without padding
+func encodeJWT(header, payload string, padded bool) []byte {
+	enc := base64.RawURLEncoding
+	if padded {
+		enc = base64.URLEncoding
+	}
+	return []byte(enc.EncodeToString([]byte(header)) + "." + enc.EncodeToString([]byte(payload)) + ".c2lnbmF0dXJl")
+}
+
+func TestParseClaims(t *testing.T) {
+	const header = `{"alg":"RS256","typ":"JWT"}`
+
+	type testCase struct {
+		description      string
+		tok              []byte
+		expectedIssuer   string
+		expectedSubject  string
+		expectedAudience []string
+		expectedScope    []string
+		expectedExpiry   time.Time
+	}
+
+	testCases := []testCase{
+		{
+			"Typical WLCG token",
+			encodeJWT(header, `{"iss":"https://wlcg.example/","sub":"user","aud":"https://wlcg.cern.ch/jwt/v1/any","scope":"storage.read:/ compute.create","exp":1700000000}`, false),
+			"https://wlcg.example/",
+			"user",
+			[]string{"https://wlcg.cern.ch/jwt/v1/any"},
+			[]string{"storage.read:/", "compute.create"},
+			time.Unix(1700000000, 0),
+		},
+		{
+			"Padded encoding",
+			encodeJWT(header, `{"iss":"a","sub":"b"}`, true),
+			"a",
+			"b",
+			nil,
+			nil,
+			time.Time{},
+		},
+		{
+			"Audience list and fractional expiry",
+			encodeJWT(header, `{"aud":["one","two",3],"exp":1700000000.5}`, false),
+			"",
+			"",
+			[]string{"one", "two"},
+			nil,
+			time.Unix(1700000000, 5e8),
+		},
+		{
+			"Claims of unexpected types",
+			encodeJWT(header, `{"iss":42,"sub":null,"aud":{"x":1},"scope":7,"exp":"tomorrow"}`, false),
+			"",
+			"",
+			nil,
+			nil,
+			time.Time{},
+		},
+		{
+			"Surrounding whitespace",
+			append(append([]byte(" "), encodeJWT(header, `{"sub":"user"}`, false)...), '\n'),
+			"",
+			"user",
+			nil,
+			nil,
+			time.Time{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				claims, err := disc.ParseClaims(tc.tok)
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if claims.Issuer() != tc.expectedIssuer {
+					t.Errorf("Issuers do not match.  Expected %q, got %q", tc.expectedIssuer, claims.Issuer())
+				}
+				if claims.Subject() != tc.expectedSubject {
+					t.Errorf("Subjects do not match.  Expected %q, got %q", tc.expectedSubject, claims.Subject())
+				}
+				if !reflect.DeepEqual(claims.Audience(), tc.expectedAudience) {
+					t.Errorf("Audiences do not match.  Expected %q, got %q", tc.expectedAudience, claims.Audience())
+				}
+				if !reflect.DeepEqual(claims.Scope(), tc.expectedScope) {
+					t.Errorf("Scopes do not match.  Expected %q, got %q", tc.expectedScope, claims.Scope())
+				}
+				exp, ok := claims.Expiry()
+				if ok != !tc.expectedExpiry.IsZero() || !exp.Equal(tc.expectedExpiry) {
+					t.Errorf("Expiry times do not match.  Expected %s, got %s (%t)", tc.expectedExpiry, exp, ok)
+				}
+			},
+		)
+	}
+}
+
+func TestParseClaimsNotAJWT(t *testing.T) {
+	const header = `{"alg":"none"}`
+
+	type testCase struct {
+		description string
+		tok         []byte
+	}
+
+	testCases := []testCase{
+		{"Empty", nil},
+		{"Opaque token", []byte("opaque_token")},
+		{"Two segments", []byte("eyJhbGciOiJub25lIn0.e30")},
+		{"Four segments", []byte("eyJhbGciOiJub25lIn0.e30.c2ln.c2ln")},
+		{"Only dots", []byte("..")},
+		{"Invalid base64", []byte("eyJhbGciOiJub25lIn0.!!!.c2ln")},
+		{"Payload is not JSON", encodeJWT(header, "not json", false)},
+		{"Payload is a JSON array", encodeJWT(header, `[1,2]`, false)},
+		{"Payload is JSON null", encodeJWT(header, `null`, false)},
+		{"Payload has trailing data", encodeJWT(header, `{}{}`, false)},
+		{"Header is not JSON", encodeJWT("garbage", `{}`, false)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				if _, err := disc.ParseClaims(tc.tok); !errors.Is(err, disc.ErrNotAJWT) {
+					t.Errorf("Expected error %s, got %v", disc.ErrNotAJWT, err)
+				}
+			},
+		)
+	}
+}
+
+func FuzzParseClaims(f *testing.F) {
+	f.Add([]byte("eyJhbGciOiJub25lIn0.eyJleHAiOjE3MDAwMDAwMDB9."))
+	f.Add([]byte("opaque_token"))
+	f.Add(encodeJWT(`{}`, `{"exp":1e308,"aud":[null]}`, true))
+	f.Fuzz(func(t *testing.T, tok []byte) {
+		claims, err := disc.ParseClaims(tok)
+		if err != nil {
+			if !errors.Is(err, disc.ErrNotAJWT) {
+				t.Errorf("Expected error %s, got %v", disc.ErrNotAJWT, err)
+			}
+			return
+		}
+		claims.Audience()
+		claims.Scope()
+		claims.Expiry()
+		claims.IssuedAt()
+		claims.NotBefore()
+	})
+}
+
+func TestAsWLCG(t *testing.T) {
+	const header = `{"alg":"RS256","kid":"rsa1","typ":"JWT"}`
+	issued := time.Unix(1700000000, 0)
+
+	type testCase struct {
+		description string
+		claims      func() (disc.Claims, error)
+		expected    disc.WLCGClaims
+	}
+
+	testCases := []testCase{
+		{
+			"INDIGO IAM access token",
+			func() (disc.Claims, error) {
+				return disc.ParseClaims(encodeJWT(header, `{
+					"wlcg.ver": "1.0",
+					"sub": "e4f1c6d2-1f0a-4b7e-9d39-5d6a1c2b3e4f",
+					"aud": "https://wlcg.cern.ch/jwt/v1/any",
+					"nbf": 1700000000,
+					"scope": "storage.read:/ storage.modify:/home wlcg.groups",
+					"iss": "https://wlcg.cloud.cnaf.infn.it/",
+					"exp": 1700003600,
+					"iat": 1700000000,
+					"jti": "0c2e9c1e-5b1f-4a52-8d0e-7e1f2a3b4c5d",
+					"client_id": "5d6a1c2b",
+					"wlcg.groups": ["/wlcg", "/wlcg/xfers"]
+				}`, false))
+			},
+			disc.WLCGClaims{
+				Iss:        "https://wlcg.cloud.cnaf.infn.it/",
+				Sub:        "e4f1c6d2-1f0a-4b7e-9d39-5d6a1c2b3e4f",
+				Aud:        []string{"https://wlcg.cern.ch/jwt/v1/any"},
+				Exp:        issued.Add(time.Hour),
+				Iat:        issued,
+				Nbf:        issued,
+				Jti:        "0c2e9c1e-5b1f-4a52-8d0e-7e1f2a3b4c5d",
+				Scope:      []string{"storage.read:/", "storage.modify:/home", "wlcg.groups"},
+				WLCGVer:    "1.0",
+				WLCGGroups: []string{"/wlcg", "/wlcg/xfers"},
+				Extra:      map[string]any{"client_id": "5d6a1c2b"},
+			},
+		},
+		{
+			"CILogon token",
+			func() (disc.Claims, error) {
+				return disc.ParseClaims(encodeJWT(header, `{
+					"wlcg.ver": 1.0,
+					"aud": ["ANY", "https://fermicloud.example:8443"],
+					"ver": "scitoken:2.0",
+					"nbf": 1700000000,
+					"iat": 1700000000,
+					"exp": 1700010800,
+					"iss": "https://cilogon.org/fermilab",
+					"jti": "https://cilogon.org/oauth2/7a1b2c3d",
+					"sub": "fermilab@cilogon.org",
+					"scope": "compute.create compute.read storage.create:/fermilab/users/user",
+					"wlcg.groups": "/fermilab"
+				}`, true))
+			},
+			disc.WLCGClaims{
+				Iss:        "https://cilogon.org/fermilab",
+				Sub:        "fermilab@cilogon.org",
+				Aud:        []string{"ANY", "https://fermicloud.example:8443"},
+				Exp:        issued.Add(3 * time.Hour),
+				Iat:        issued,
+				Nbf:        issued,
+				Jti:        "https://cilogon.org/oauth2/7a1b2c3d",
+				Scope:      []string{"compute.create", "compute.read", "storage.create:/fermilab/users/user"},
+				WLCGVer:    "1.0",
+				WLCGGroups: []string{"/fermilab"},
+				Extra:      map[string]any{"ver": "scitoken:2.0"},
+			},
+		},
+		{
+			"Timestamps of assorted numeric types",
+			func() (disc.Claims, error) {
+				return disc.Claims{"exp": float64(1700003600), "iat": 1700000000, "nbf": json.Number("1700000000")}, nil
+			},
+			disc.WLCGClaims{
+				Exp: issued.Add(time.Hour),
+				Iat: issued,
+				Nbf: issued,
+			},
+		},
+		{
+			"EGI Check-in token",
+			func() (disc.Claims, error) {
+				return disc.ParseClaims(encodeJWT(header, `{
+					"exp": 1700003600.0,
+					"iat": 1700000000,
+					"auth_time": 1699999990,
+					"jti": "8f1c2d3e-4a5b-6c7d-8e9f-0a1b2c3d4e5f",
+					"iss": "https://aai.egi.eu/auth/realms/egi",
+					"aud": ["egi-client", "https://storage.example"],
+					"sub": "0123456789abcdef@egi.eu",
+					"typ": "Bearer",
+					"azp": "egi-client",
+					"scope": "openid profile eduperson_entitlement",
+					"eduperson_entitlement": ["urn:mace:egi.eu:group:vo.example:role=member#aai.egi.eu"]
+				}`, false))
+			},
+			disc.WLCGClaims{
+				Iss:   "https://aai.egi.eu/auth/realms/egi",
+				Sub:   "0123456789abcdef@egi.eu",
+				Aud:   []string{"egi-client", "https://storage.example"},
+				Exp:   issued.Add(time.Hour),
+				Iat:   issued,
+				Jti:   "8f1c2d3e-4a5b-6c7d-8e9f-0a1b2c3d4e5f",
+				Scope: []string{"openid", "profile", "eduperson_entitlement"},
+				Extra: map[string]any{
+					"auth_time":             json.Number("1699999990"),
+					"typ":                   "Bearer",
+					"azp":                   "egi-client",
+					"eduperson_entitlement": []any{"urn:mace:egi.eu:group:vo.example:role=member#aai.egi.eu"},
+				},
+			},
+		},
+		{
+			"Scope as a list, fractional times, null claims",
+			func() (disc.Claims, error) {
+				return disc.ParseClaims(encodeJWT(header, `{
+					"iss": "https://issuer.example",
+					"sub": null,
+					"scope": ["storage.read:/", "storage.create:/data openid"],
+					"exp": 1.7000036e9,
+					"iat": 1700000000.5
+				}`, false))
+			},
+			disc.WLCGClaims{
+				Iss:   "https://issuer.example",
+				Exp:   issued.Add(time.Hour),
+				Iat:   issued.Add(500 * time.Millisecond),
+				Scope: []string{"storage.read:/", "storage.create:/data", "openid"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				claims, err := tc.claims()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if w := claims.AsWLCG(); !reflect.DeepEqual(w, tc.expected) {
+					t.Errorf("Claims do not match.  Expected %+v, got %+v", tc.expected, w)
+				}
+				w, err := claims.DecodeWLCG()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if !reflect.DeepEqual(w, tc.expected) {
+					t.Errorf("Decoded claims do not match.  Expected %+v, got %+v", tc.expected, w)
+				}
+			},
+		)
+	}
+}
+
+func TestDecodeWLCGInvalid(t *testing.T) {
+	type testCase struct {
+		description string
+		payload     string
+		expectedMsg string
+	}
+
+	testCases := []testCase{
+		{"Numeric aud", `{"aud": 42}`, `"aud": expected a string or a list of strings, got a number`},
+		{"aud list with a number", `{"aud": ["https://storage.example", 42]}`, `"aud": expected a string or a list of strings, got a list containing a number`},
+		{"String exp", `{"exp": "1700003600"}`, `"exp": expected a number, got a string`},
+		{"Huge exp", `{"exp": 1e300}`, `"exp": expected a number, got an out-of-range number`},
+		{"Object scope", `{"scope": {"storage.read": "/"}}`, `"scope": expected a string or a list of strings, got an object`},
+		{"Numeric iss", `{"iss": 1}`, `"iss": expected a string, got a number`},
+		{"Boolean groups", `{"wlcg.groups": true}`, `"wlcg.groups": expected a string or a list of strings, got a boolean`},
+		{"List version", `{"wlcg.ver": ["1.0"]}`, `"wlcg.ver": expected a string or a number, got a list of strings`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				_, err := disc.ParseWLCGClaims(encodeJWT(`{"alg":"RS256"}`, tc.payload, false))
+				if !errors.Is(err, disc.ErrInvalidClaim) {
+					t.Fatalf("Expected error %s, got %v", disc.ErrInvalidClaim, err)
+				}
+				if !strings.Contains(err.Error(), tc.expectedMsg) {
+					t.Errorf("Error messages do not match.  Expected %q in %q", tc.expectedMsg, err)
+				}
+			},
+		)
+	}
+}
+
+func FuzzParseWLCGClaims(f *testing.F) {
+	f.Add(encodeJWT(`{}`, `{"aud":["a",1],"exp":1.5,"scope":["storage.read:/"]}`, false))
+	f.Add(encodeJWT(`{}`, `{"wlcg.ver":1.0,"wlcg.groups":"/wlcg","iat":-1e18}`, false))
+	f.Add([]byte("opaque_token"))
+	f.Fuzz(func(t *testing.T, tok []byte) {
+		w, err := disc.ParseWLCGClaims(tok)
+		if err != nil {
+			if !errors.Is(err, disc.ErrNotAJWT) && !errors.Is(err, disc.ErrInvalidClaim) {
+				t.Errorf("Expected error %s or %s, got %v", disc.ErrNotAJWT, disc.ErrInvalidClaim, err)
+			}
+			return
+		}
+		w.ParsedScopes()
+	})
+}
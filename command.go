@@ -0,0 +1,120 @@
+package tokendiscovery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// defaultCommandTimeout bounds how long discovery waits for the command configured with WithCommandSource
+const defaultCommandTimeout = 30 * time.Second
+
+// commandWaitDelay bounds how long discovery waits for the output of the token command to be closed once the command
+// has exited or been killed, since processes it started in the background may keep it open
+const commandWaitDelay = time.Second
+
+// WithCommandSource adds a step, after all others, that runs the helper command name with args and takes the token from
+// its standard output, much like a git credential helper. The output is treated like the value of BEARER_TOKEN. If the
+// command fails, times out, or prints nothing, the failure is recorded and discovery ends as if the step were not
+// there. Since the command runs with the privileges of the calling process, it is never run unless this option is
+// given.
+func WithCommandSource(name string, args ...string) Option {
+	return func(d *Discoverer) error {
+		if name == "" {
+			return fmt.Errorf("%w: token command cannot be empty", ErrInvalidOption)
+		}
+		d.command = append([]string{name}, args...)
+		return nil
+	}
+}
+
+// WithCommandTimeout sets how long discovery waits for the command configured with WithCommandSource, 30 seconds by
+// default. The command is killed when the timeout expires, along with the processes it started on platforms with
+// process groups. Output of more than the size set with WithMaxTokenSize fails the step.
+func WithCommandTimeout(timeout time.Duration) Option {
+	return func(d *Discoverer) error {
+		if timeout <= 0 {
+			return fmt.Errorf("%w: token command timeout must be positive", ErrInvalidOption)
+		}
+		d.commandTimeout = timeout
+		return nil
+	}
+}
+
+// commandStep takes the token from the output of a helper command
+type commandStep struct{}
+
+func (commandStep) Name() string { return SourceCommand.String() }
+
+func (commandStep) Lookup(ctx context.Context, _ Environ, fsys FileReader) (Result, error) {
+	d := stepDiscoverer(fsys)
+	if len(d.command) == 0 {
+		return Result{}, SkipStep(nil)
+	}
+
+	tok, err := d.commandToken(ctx)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return Result{}, fmt.Errorf("token discovery abandoned: %w", ctxErr)
+		}
+		return Result{}, SkipStep(&DiscoveryError{Step: SourceCommand, Err: fmt.Errorf("token command %s: %w", d.command[0], err)})
+	}
+	return Result{token: tok, source: SourceCommand}, nil
+}
+
+// commandToken runs the configured command and returns its trimmed standard output
+func (d *Discoverer) commandToken(ctx context.Context) ([]byte, error) {
+	timeout := d.commandTimeout
+	if timeout == 0 {
+		timeout = defaultCommandTimeout
+	}
+	limit := d.maxTokenSize
+	if limit == 0 {
+		limit = defaultMaxTokenSize
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	d.debug("running token command", "command", d.command[0])
+	cmd := exec.CommandContext(ctx, d.command[0], d.command[1:]...)
+	killProcessGroupOnCancel(cmd)
+	cmd.WaitDelay = commandWaitDelay
+	out := &limitedBuffer{limit: limit}
+	cmd.Stdout = out
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("timed out after %s: %w", timeout, ctx.Err())
+	}
+	// A command that succeeded but left a background process holding its output open still produced a token
+	if err != nil && !errors.Is(err, exec.ErrWaitDelay) {
+		return nil, err
+	}
+	if out.exceeded {
+		return nil, fmt.Errorf("%w: command output is larger than %d bytes", ErrTokenTooLarge, limit)
+	}
+	tok := bytes.TrimSpace(out.buf.Bytes())
+	if len(tok) == 0 {
+		return nil, errors.New("command produced no output")
+	}
+	return tok, nil
+}
+
+// limitedBuffer keeps up to limit bytes written to it, and discards the rest, so that a command printing endlessly
+// neither exhausts memory nor blocks on a full pipe
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	limit    int64
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - int64(b.buf.Len()); int64(len(p)) > room {
+		b.buf.Write(p[:max(room, 0)])
+		b.exceeded = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
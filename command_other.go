@@ -0,0 +1,9 @@
+//go:build !unix
+
+package tokendiscovery
+
+import "os/exec"
+
+// killProcessGroupOnCancel does nothing on platforms without process groups, where cancelling cmd kills the token
+// command alone. Its output is still abandoned after commandWaitDelay.
+func killProcessGroupOnCancel(*exec.Cmd) {}
@@ -0,0 +1,189 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+// TestCommandHelper is not a real test. It is run as a token helper command by helperCommand, and behaves as told by
+// the arguments after "--".
+func TestCommandHelper(t *testing.T) {
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	if len(args) < 2 {
+		return
+	}
+	switch args[1] {
+	case "print":
+		fmt.Println(args[2])
+	case "fail":
+		os.Exit(3)
+	case "hang":
+		time.Sleep(time.Minute)
+	case "linger":
+		time.Sleep(5 * time.Second)
+	case "orphan":
+		// Start a process sharing the output of this one that outlives it, like "sh -c 'sleep 5 &'"
+		cmd := exec.Command(os.Args[0], "-test.run=^TestCommandHelper$", "--", "linger")
+		cmd.Stdout = os.Stdout
+		if err := cmd.Start(); err != nil {
+			os.Exit(4)
+		}
+		if len(args) > 2 {
+			fmt.Println(args[2])
+			os.Exit(0)
+		}
+		time.Sleep(time.Minute)
+	case "large":
+		fmt.Println(strings.Repeat("a", 4096))
+	}
+	os.Exit(0)
+}
+
+// helperCommand returns an option that makes the test binary itself the token command, running TestCommandHelper
+func helperCommand(args ...string) disc.Option {
+	return disc.WithCommandSource(os.Args[0], append([]string{"-test.run=^TestCommandHelper$", "--"}, args...)...)
+}
+
+func TestWithCommandSource(t *testing.T) {
+	fsys := fstest.MapFS{
+		"tmp/bt_u4242": {Data: []byte("tmp_token")},
+	}
+
+	type testCase struct {
+		description    string
+		env            map[string]string
+		opts           []disc.Option
+		expectedTok    string
+		expectedSource disc.Source
+	}
+
+	testCases := []testCase{
+		{
+			"Command output is used when nothing else is found",
+			nil,
+			[]disc.Option{helperCommand("print", "  command_token  ")},
+			"command_token",
+			disc.SourceCommand,
+		},
+		{
+			"Static token takes precedence",
+			map[string]string{"BEARER_TOKEN": "env_token"},
+			[]disc.Option{helperCommand("print", "command_token")},
+			"env_token",
+			disc.SourceBearerTokenEnv,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := append([]disc.Option{disc.WithEnvMap(tc.env), disc.WithFS(fstest.MapFS{}), disc.WithUID("4242")}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				res, err := d.Discover()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %s", err)
+				}
+				if string(res.Bytes()) != tc.expectedTok {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedTok, res.Bytes())
+				}
+				if res.Source() != tc.expectedSource {
+					t.Errorf("Token sources do not match. Expected source %s, got %s", tc.expectedSource, res.Source())
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"Fallback file takes precedence",
+		func(t *testing.T) {
+			d, err := disc.New(disc.WithEnvMap(nil), disc.WithFS(fsys), disc.WithUID("4242"), helperCommand("print", "command_token"))
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			res, err := d.Discover()
+			if err != nil {
+				t.Fatalf("Expected nil error, got %s", err)
+			}
+			if res.Source() != disc.SourceTmpFallback {
+				t.Errorf("Token sources do not match. Expected source %s, got %s", disc.SourceTmpFallback, res.Source())
+			}
+		},
+	)
+
+	failureCases := []struct {
+		description    string
+		opts           []disc.Option
+		expectedReason string
+	}{
+		{"Non-zero exit", []disc.Option{helperCommand("fail")}, "exit status 3"},
+		{"Empty output", []disc.Option{helperCommand("print", " ")}, "no output"},
+		{"Timeout", []disc.Option{helperCommand("hang"), disc.WithCommandTimeout(100 * time.Millisecond)}, "timed out"},
+		{
+			"Timeout with background process",
+			[]disc.Option{helperCommand("orphan"), disc.WithCommandTimeout(500 * time.Millisecond)},
+			"timed out",
+		},
+		{"Output too large", []disc.Option{helperCommand("large"), disc.WithMaxTokenSize(1024)}, "larger than 1024 bytes"},
+		{"Missing command", []disc.Option{disc.WithCommandSource("/nonexistent/token-helper")}, "token-helper"},
+	}
+
+	for _, tc := range failureCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := append([]disc.Option{disc.WithEnvMap(nil), disc.WithFS(fstest.MapFS{}), disc.WithUID("4242")}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				start := time.Now()
+				_, err = d.Discover()
+				if !errors.Is(err, disc.ErrNoTokenFound) {
+					t.Fatalf("Expected error %s, got %v", disc.ErrNoTokenFound, err)
+				}
+				if !strings.Contains(err.Error(), tc.expectedReason) {
+					t.Errorf("Expected error to contain %q, got %s", tc.expectedReason, err)
+				}
+				if elapsed := time.Since(start); elapsed > 4*time.Second {
+					t.Errorf("Expected discovery to end soon after the timeout, took %s", elapsed)
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"Background process left running",
+		func(t *testing.T) {
+			d, err := disc.New(disc.WithEnvMap(nil), disc.WithFS(fstest.MapFS{}), disc.WithUID("4242"), helperCommand("orphan", "command_token"))
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			start := time.Now()
+			res, err := d.Discover()
+			if err != nil {
+				t.Fatalf("Expected nil error, got %s", err)
+			}
+			if string(res.Bytes()) != "command_token" {
+				t.Errorf("Token strings do not match.  Expected command_token, got %s", res.Bytes())
+			}
+			if elapsed := time.Since(start); elapsed > 4*time.Second {
+				t.Errorf("Expected discovery not to wait for the background process, took %s", elapsed)
+			}
+		},
+	)
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package tokendiscovery
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroupOnCancel makes cmd start in its own process group, and makes cancelling it kill the whole group, so
+// that processes started by the token command in the background do not outlive the timeout
+func killProcessGroupOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,60 @@
+package tokendiscovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultCondorCredName is the name of the token file read from the HTCondor credentials directory by default
+const DefaultCondorCredName = "scitokens.use"
+
+// WithCondorCreds adds a step, after step 2, that reads the token from the HTCondor credentials directory named by the
+// _CONDOR_CREDS environment variable, where credmon places tokens as <name>.use files. The token is read from
+// $_CONDOR_CREDS/name, or $_CONDOR_CREDS/scitokens.use if name is empty. If the variable is unset, or the directory or
+// file is missing or empty, discovery continues with the next step.
+func WithCondorCreds(name string) Option {
+	return func(d *Discoverer) error {
+		if name == "" {
+			name = DefaultCondorCredName
+		}
+		if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+			return fmt.Errorf("%w: HTCondor credential name %q is not a plain file name", ErrInvalidOption, name)
+		}
+		d.condorCredName = name
+		return nil
+	}
+}
+
+// condorCredsStep reads the token from the HTCondor credentials directory
+type condorCredsStep struct{}
+
+func (condorCredsStep) Name() string { return SourceCondorCreds.String() }
+
+func (condorCredsStep) Lookup(ctx context.Context, env Environ, fsys FileReader) (Result, error) {
+	d := stepDiscoverer(fsys)
+	if d.skipEnvironmentSources() {
+		return Result{}, SkipStep(nil)
+	}
+	credsDir := lookupValue(env, "_CONDOR_CREDS")
+	if credsDir == "" {
+		return Result{}, envUnset(SourceCondorCreds, "_CONDOR_CREDS")
+	}
+	name := d.condorCredName
+	if name == "" {
+		name = DefaultCondorCredName
+	}
+
+	fname := filepath.Join(credsDir, name)
+	tok, err := fsys.ReadTokenFile(ctx, fname)
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, ErrEmptyToken):
+		return Result{}, SkipStep(&DiscoveryError{Step: SourceCondorCreds, Path: fname, Err: err})
+	case err != nil:
+		return Result{}, d.readFailure(SourceCondorCreds, fname, err)
+	}
+	return Result{token: tok, path: fname, source: SourceCondorCreds}, nil
+}
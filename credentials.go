@@ -0,0 +1,61 @@
+package tokendiscovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultCredentialName is the name of the systemd credential read by WithCredentialsDirectory by default
+const DefaultCredentialName = "bearer_token"
+
+// WithCredentialsDirectory adds a step, after step 2, that reads the token from a systemd credential when the
+// CREDENTIALS_DIRECTORY environment variable is set, as it is for services using LoadCredential=. The credential is
+// read from $CREDENTIALS_DIRECTORY/name, or $CREDENTIALS_DIRECTORY/bearer_token if name is empty, and is treated like
+// the file named by BEARER_TOKEN_FILE: if it is empty, discovery continues with the next step. If the credential does
+// not exist, discovery also continues.
+func WithCredentialsDirectory(name string) Option {
+	return func(d *Discoverer) error {
+		if name == "" {
+			name = DefaultCredentialName
+		}
+		if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+			return fmt.Errorf("%w: credential name %q is not a plain file name", ErrInvalidOption, name)
+		}
+		d.credentialName = name
+		return nil
+	}
+}
+
+// credentialsDirectoryStep reads the token from a systemd credential
+type credentialsDirectoryStep struct{}
+
+func (credentialsDirectoryStep) Name() string { return SourceCredentialsDirectory.String() }
+
+func (credentialsDirectoryStep) Lookup(ctx context.Context, env Environ, fsys FileReader) (Result, error) {
+	d := stepDiscoverer(fsys)
+	if d.skipEnvironmentSources() {
+		return Result{}, SkipStep(nil)
+	}
+	credsDir := lookupValue(env, "CREDENTIALS_DIRECTORY")
+	if credsDir == "" {
+		return Result{}, envUnset(SourceCredentialsDirectory, "CREDENTIALS_DIRECTORY")
+	}
+	name := d.credentialName
+	if name == "" {
+		name = DefaultCredentialName
+	}
+
+	fname := filepath.Join(credsDir, name)
+	tok, err := fsys.ReadTokenFile(ctx, fname)
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, ErrEmptyToken):
+		return Result{}, SkipStep(&DiscoveryError{Step: SourceCredentialsDirectory, Path: fname, Err: err})
+	case err != nil:
+		return Result{}, d.readFailure(SourceCredentialsDirectory, fname, err)
+	}
+	return Result{token: tok, path: fname, source: SourceCredentialsDirectory}, nil
+}
@@ -0,0 +1,123 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestWithCredentialsDirectory(t *testing.T) {
+	fsys := fstest.MapFS{
+		"run/credentials/svc/bearer_token": {Data: []byte("cred_token\n")},
+		"run/credentials/svc/wlcg":         {Data: []byte("named_cred_token")},
+		"run/credentials/svc/empty":        {Data: []byte("")},
+		"home/user/token":                  {Data: []byte("file_token")},
+		"run/user/4242/bt_u4242":           {Data: []byte("xdg_token")},
+		"tmp/bt_u4242":                     {Data: []byte("tmp_token")},
+	}
+
+	type testCase struct {
+		description    string
+		env            map[string]string
+		opts           []disc.Option
+		expectedTok    string
+		expectedPath   string
+		expectedSource disc.Source
+	}
+
+	testCases := []testCase{
+		{
+			"Default ignores CREDENTIALS_DIRECTORY",
+			map[string]string{"CREDENTIALS_DIRECTORY": "/run/credentials/svc"},
+			nil,
+			"tmp_token",
+			"/tmp/bt_u4242",
+			disc.SourceTmpFallback,
+		},
+		{
+			"Default credential name",
+			map[string]string{"CREDENTIALS_DIRECTORY": "/run/credentials/svc", "XDG_RUNTIME_DIR": "/run/user/4242"},
+			[]disc.Option{disc.WithCredentialsDirectory("")},
+			"cred_token",
+			"/run/credentials/svc/bearer_token",
+			disc.SourceCredentialsDirectory,
+		},
+		{
+			"Configured credential name",
+			map[string]string{"CREDENTIALS_DIRECTORY": "/run/credentials/svc"},
+			[]disc.Option{disc.WithCredentialsDirectory("wlcg")},
+			"named_cred_token",
+			"/run/credentials/svc/wlcg",
+			disc.SourceCredentialsDirectory,
+		},
+		{
+			"BEARER_TOKEN_FILE takes precedence",
+			map[string]string{"CREDENTIALS_DIRECTORY": "/run/credentials/svc", "BEARER_TOKEN_FILE": "/home/user/token"},
+			[]disc.Option{disc.WithCredentialsDirectory("")},
+			"file_token",
+			"/home/user/token",
+			disc.SourceBearerTokenFile,
+		},
+		{
+			"Empty credential falls through",
+			map[string]string{"CREDENTIALS_DIRECTORY": "/run/credentials/svc", "XDG_RUNTIME_DIR": "/run/user/4242"},
+			[]disc.Option{disc.WithCredentialsDirectory("empty")},
+			"xdg_token",
+			"/run/user/4242/bt_u4242",
+			disc.SourceXDGRuntimeDir,
+		},
+		{
+			"Missing credential falls through",
+			map[string]string{"CREDENTIALS_DIRECTORY": "/run/credentials/svc"},
+			[]disc.Option{disc.WithCredentialsDirectory("missing")},
+			"tmp_token",
+			"/tmp/bt_u4242",
+			disc.SourceTmpFallback,
+		},
+		{
+			"CREDENTIALS_DIRECTORY unset",
+			map[string]string{},
+			[]disc.Option{disc.WithCredentialsDirectory("")},
+			"tmp_token",
+			"/tmp/bt_u4242",
+			disc.SourceTmpFallback,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := append([]disc.Option{disc.WithEnvMap(tc.env), disc.WithFS(fsys), disc.WithUID("4242")}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				res, err := d.Discover()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %s", err)
+				}
+				if string(res.Bytes()) != tc.expectedTok {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedTok, res.Bytes())
+				}
+				if res.Path() != tc.expectedPath {
+					t.Errorf("Token paths do not match. Expected path %s, got %s", tc.expectedPath, res.Path())
+				}
+				if res.Source() != tc.expectedSource {
+					t.Errorf("Token sources do not match. Expected source %s, got %s", tc.expectedSource, res.Source())
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"Invalid credential name",
+		func(t *testing.T) {
+			if _, err := disc.New(disc.WithCredentialsDirectory("../token")); !errors.Is(err, disc.ErrInvalidOption) {
+				t.Errorf("Expected error %s, got %v", disc.ErrInvalidOption, err)
+			}
+		},
+	)
+}
@@ -0,0 +1,176 @@
+package tokendiscovery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// Report describes the environment and files consulted by discovery, for troubleshooting. It never contains token
+// contents: tokens are only identified by their Fingerprint.
+type Report struct {
+	// UID is the uid whose token files are consulted
+	UID string
+	// UIDError is the reason UID could not be determined, if it could not
+	UIDError error
+	// EnvVars describes the environment variables discovery depends on
+	EnvVars []EnvVarReport
+	// Files describes the token files discovery would read, in order
+	Files []FileReport
+}
+
+// EnvVarReport describes an environment variable consulted by discovery
+type EnvVarReport struct {
+	Name string
+	Set  bool
+	// Value is the value of the variable, unless it holds a token, in which case it is empty
+	Value string
+	// Fingerprint identifies the token held by the variable, if it does
+	Fingerprint string
+}
+
+// FileReport describes a token file that discovery would read
+type FileReport struct {
+	Location Location
+	// Exists reports whether the file exists. If it does not, or cannot be examined, Err says why.
+	Exists  bool
+	Err     error
+	Size    int64
+	Mode    fs.FileMode
+	ModTime time.Time
+	// Owner is the uid of the owner of the file, if it is known
+	Owner string
+	// IsJWT reports whether the token in the file is a JWT
+	IsJWT bool
+	// Fingerprint identifies the token in the file, if it could be read
+	Fingerprint string
+	// ReadError is the reason the token could not be read from an existing file, if it could not
+	ReadError error
+}
+
+// Diagnose examines the environment and the files consulted by the WLCG Bearer Token Discovery procedure and returns a
+// Report describing them, for support requests about tokens that cannot be found or are rejected. The Report, and its
+// String rendering, identify tokens only by fingerprint, so they can be shared.
+func Diagnose() (Report, error) {
+	return defaultDiscoverer.Diagnose()
+}
+
+// Diagnose is like the package-level Diagnose, but uses the discovery procedure as configured on d
+func (d *Discoverer) Diagnose() (Report, error) {
+	var r Report
+	r.UID, r.UIDError = d.currentUID()
+
+	if !d.skipEnvironmentSources() {
+		for _, key := range d.tokenEnvVars() {
+			val, set := d.lookupEnv(key)
+			ev := EnvVarReport{Name: key, Set: set}
+			if tok := bytes.TrimSpace([]byte(val)); len(tok) > 0 {
+				ev.Fingerprint = Fingerprint(tok)
+			}
+			r.EnvVars = append(r.EnvVars, ev)
+		}
+		for _, key := range d.tokenFileEnvVars() {
+			val, set := d.lookupEnv(key)
+			r.EnvVars = append(r.EnvVars, EnvVarReport{Name: key, Set: set, Value: val})
+		}
+	}
+	val, set := d.lookupEnv("XDG_RUNTIME_DIR")
+	r.EnvVars = append(r.EnvVars, EnvVarReport{Name: "XDG_RUNTIME_DIR", Set: set, Value: val})
+
+	if r.UIDError != nil {
+		// The locations of the remaining token files depend on the uid
+		return r, nil
+	}
+	locations, err := d.PlannedLocations()
+	if err != nil {
+		return r, err
+	}
+	for _, l := range locations {
+		if l.Path == "" || l.Source == SourceOIDCAgent {
+			continue
+		}
+		r.Files = append(r.Files, d.diagnoseFile(l))
+	}
+	return r, nil
+}
+
+// diagnoseFile examines the token file at l
+func (d *Discoverer) diagnoseFile(l Location) FileReport {
+	f := FileReport{Location: l}
+	info, err := d.stat(l.Path)
+	if err != nil {
+		f.Err = err
+		return f
+	}
+	f.Exists = true
+	f.Size = info.Size()
+	f.Mode = info.Mode()
+	f.ModTime = info.ModTime()
+	if owner, ok := d.fileOwner(info); ok {
+		f.Owner = owner
+	}
+	if info.IsDir() {
+		return f
+	}
+	tok, err := d.ReadTokenFile(context.Background(), l.Path)
+	if err != nil {
+		f.ReadError = err
+		return f
+	}
+	f.IsJWT = isJWT(tok)
+	f.Fingerprint = Fingerprint(tok)
+	return f
+}
+
+// String renders r as text, one line per environment variable and file
+func (r Report) String() string {
+	var b strings.Builder
+	if r.UIDError != nil {
+		fmt.Fprintf(&b, "uid: unknown (%s)\n", r.UIDError)
+	} else {
+		fmt.Fprintf(&b, "uid: %s\n", r.UID)
+	}
+	for _, ev := range r.EnvVars {
+		switch {
+		case !ev.Set:
+			fmt.Fprintf(&b, "%s: not set\n", ev.Name)
+		case ev.Fingerprint != "":
+			fmt.Fprintf(&b, "%s: set (redacted, fingerprint %s)\n", ev.Name, ev.Fingerprint)
+		default:
+			fmt.Fprintf(&b, "%s: %q\n", ev.Name, ev.Value)
+		}
+	}
+	for _, f := range r.Files {
+		fmt.Fprintf(&b, "%s: ", f.Location)
+		if !f.Exists {
+			fmt.Fprintf(&b, "does not exist (%s)\n", f.Err)
+			continue
+		}
+		owner := f.Owner
+		if owner == "" {
+			owner = "unknown"
+		}
+		fmt.Fprintf(&b, "size %d, mode %s, owner %s, modified %s", f.Size, f.Mode, owner, f.ModTime.Format(time.RFC3339))
+		switch {
+		case f.ReadError != nil:
+			fmt.Fprintf(&b, ", unreadable (%s)", f.ReadError)
+		case f.Fingerprint != "":
+			kind := "opaque token"
+			if f.IsJWT {
+				kind = "JWT"
+			}
+			fmt.Fprintf(&b, ", %s, fingerprint %s", kind, f.Fingerprint)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// isJWT reports whether tok has the form of a JWT, as described for ParseClaims. The signature is not verified.
+func isJWT(tok []byte) bool {
+	_, err := ParseClaims(tok)
+	return err == nil
+}
@@ -0,0 +1,408 @@
+package tokendiscovery
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrInvalidOption indicates that a Discoverer or Verifier could not be constructed because of an invalid or
+// contradictory option
+var ErrInvalidOption = errors.New("invalid discovery option")
+
+// defaultTokenFilePrefix is the prefix of the bt_u$ID filename consulted in steps 3 and 4 of the WLCG Bearer Token
+// Discovery procedure
+const defaultTokenFilePrefix = "bt_u"
+
+// Discoverer locates bearer tokens following the WLCG Bearer Token Discovery procedure. A Discoverer is configured once
+// using New and can then be used repeatedly, and concurrently, to find tokens.
+type Discoverer struct {
+	steps       []Step
+	lookupEnv   Environ
+	fsys        fs.FS
+	noOSFS      bool
+	fallbackDir string
+	fallbackSet bool
+	honorTMPDIR bool
+	noFallback  bool
+	uid         string
+	lookupUser  func() (string, error)
+	getuid      func() int
+	geteuid     func() int
+	resolvedUID *uidCache
+	fileOwner   func(fs.FileInfo) (string, bool)
+	skipEnv     bool
+	skipSetuid  bool
+
+	implicitRuntimeDir  string
+	credentialName      string
+	kubernetesTokenPath string
+	condorCredName      string
+	oidcAgentAccount    string
+	oidcAgentTimeout    time.Duration
+	command             []string
+	commandTimeout      time.Duration
+	fileList            bool
+	tokenEnvNames       []string
+	tokenFileEnvNames   []string
+	tokenFilePrefix     string
+	maxTokenSize        int64
+	wholeFile           bool
+	rawContents         bool
+	keepTokenResponse   bool
+	validateSyntax      bool
+	keepBearerPrefix    bool
+	strictSpec          bool
+	tokenName           string
+	namedFallback       bool
+	fatalPermissions    bool
+	followSymlinks      bool
+	skipOwnerCheck      bool
+	logger              *slog.Logger
+
+	permissionPolicy        PermissionPolicy
+	insecurePermissionsHook func(path string, mode fs.FileMode)
+	readAttempts            int
+	readBackoff             time.Duration
+	pollInterval            time.Duration
+	pollJitter              time.Duration
+	maxPollAttempts         int
+	fileLocking             bool
+	lockWait                time.Duration
+	fifoTimeout             time.Duration
+	expandPaths             bool
+	lookupHome              func(uid string) (string, error)
+	clock                   func() time.Time
+	skipExpired             bool
+	minLifetime             time.Duration
+	allowUnknownExpiry      bool
+	leeway                  time.Duration
+	leewaySet               bool
+	requiredAudience        string
+	allowedIssuers          []string
+	requiredSubject         string
+	subjectPrefix           bool
+	requiredScopes          []string
+	requiredProfile         string
+	noAnyAudience           bool
+	requireJWT              bool
+	requiredType            string
+	allowLegacyType         bool
+	verifier                *Verifier
+	validationOptions       ValidationOptions
+	maxTokenAge             time.Duration
+	allowUnknownAge         bool
+}
+
+// Option configures a Discoverer. Options are applied in order by New, and return an error if the setting is invalid.
+type Option func(*Discoverer) error
+
+// New returns a Discoverer configured by the given options. With no options, the Discoverer behaves exactly like the
+// package-level FindToken and FindTokenAndFile functions.
+func New(opts ...Option) (*Discoverer, error) {
+	d := newDefaultDiscoverer()
+	for _, opt := range opts {
+		if err := opt(d); err != nil {
+			return nil, err
+		}
+	}
+	if err := d.validate(); err != nil {
+		return nil, err
+	}
+	d.addOptionalSteps()
+	return d, nil
+}
+
+func newDefaultDiscoverer() *Discoverer {
+	return &Discoverer{
+		steps:       StandardSteps(),
+		lookupEnv:   os.LookupEnv,
+		fallbackDir: defaultFallbackDirectory(),
+		lookupUser:  currentUserID,
+		lookupHome:  userHomeDir,
+		getuid:      os.Getuid,
+		geteuid:     os.Geteuid,
+		resolvedUID: &uidCache{},
+		fileOwner:   fileOwner,
+		noOSFS:      !hasOSFilesystem,
+	}
+}
+
+// addOptionalSteps inserts the steps enabled by options into the discovery chain
+func (d *Discoverer) addOptionalSteps() {
+	if d.oidcAgentAccount != "" {
+		d.steps = insertAfter(d.steps, oidcAgentStep{}, bearerTokenEnvStep{})
+	}
+	if d.credentialName != "" {
+		d.steps = insertAfter(d.steps, credentialsDirectoryStep{}, bearerTokenFileStep{})
+	}
+	if d.condorCredName != "" {
+		d.steps = insertAfter(d.steps, condorCredsStep{}, bearerTokenFileStep{})
+	}
+	if d.implicitRuntimeDir != "" {
+		d.steps = insertBefore(d.steps, implicitRuntimeDirStep{}, tmpFallbackStep{})
+	}
+	if d.kubernetesTokenPath != "" {
+		d.steps = insertBefore(d.steps, KubernetesTokenStep(d.kubernetesTokenPath), tmpFallbackStep{})
+	}
+	if len(d.command) > 0 {
+		d.steps = append(d.steps, commandStep{})
+	}
+}
+
+// validate checks the combination of settings on d after all options have been applied
+func (d *Discoverer) validate() error {
+	if !filepath.IsAbs(d.fallbackDir) {
+		return fmt.Errorf("%w: fallback directory %q is not an absolute path", ErrInvalidOption, d.fallbackDir)
+	}
+	if d.fallbackSet && d.honorTMPDIR {
+		return fmt.Errorf("%w: WithFallbackDir and WithTMPDIRFallback cannot be used together", ErrInvalidOption)
+	}
+	if d.noFallback && (d.fallbackSet || d.honorTMPDIR) {
+		return fmt.Errorf("%w: the fallback directory cannot be configured when the fallback step is disabled", ErrInvalidOption)
+	}
+	return nil
+}
+
+// WithFallbackDir sets the directory used in step 4 of the discovery procedure in place of /tmp, or on Windows, in
+// place of the temporary directory returned by os.TempDir. The directory must be given as an absolute path.
+func WithFallbackDir(dir string) Option {
+	return func(d *Discoverer) error {
+		if dir == "" {
+			return fmt.Errorf("%w: fallback directory cannot be empty", ErrInvalidOption)
+		}
+		d.fallbackDir = filepath.Clean(dir)
+		d.fallbackSet = true
+		return nil
+	}
+}
+
+// WithTMPDIRFallback makes step 4 of the discovery procedure use the directory named by the TMPDIR environment
+// variable, as os.TempDir does, instead of /tmp. Batch systems often point TMPDIR at a job-private scratch directory.
+// If TMPDIR is unset or not an absolute path, /tmp is used. Note that the WLCG Bearer Token Discovery specification
+// calls for /tmp, so this option is off by default.
+func WithTMPDIRFallback() Option {
+	return func(d *Discoverer) error {
+		d.honorTMPDIR = true
+		return nil
+	}
+}
+
+// WithUID sets the user ID used to build the bt_u$ID filename in steps 3 and 4 of the discovery procedure, instead of
+// the ID of the current user. This lets privileged services locate token files belonging to other users. Since steps 1
+// and 2 read the environment of the calling process rather than that of the target user, such services will usually
+// want to combine this with WithoutEnvironmentSources.
+func WithUID(uid string) Option {
+	return func(d *Discoverer) error {
+		if uid == "" {
+			return fmt.Errorf("%w: uid cannot be empty", ErrInvalidOption)
+		}
+		if strings.ContainsAny(uid, `/\`) {
+			return fmt.Errorf("%w: uid %q contains a path separator", ErrInvalidOption, uid)
+		}
+		if d.uid != "" && d.uid != uid {
+			return fmt.Errorf("%w: uid %q conflicts with previously set uid %q", ErrInvalidOption, uid, d.uid)
+		}
+		d.uid = uid
+		return nil
+	}
+}
+
+// WithoutEnvironmentSources skips steps 1 and 2 of the discovery procedure, so that the BEARER_TOKEN and
+// BEARER_TOKEN_FILE environment variables are ignored and only the bt_u$ID files are consulted
+func WithoutEnvironmentSources() Option {
+	return func(d *Discoverer) error {
+		d.skipEnv = true
+		return nil
+	}
+}
+
+// Environ looks up the value of an environment variable. It has the same semantics as os.LookupEnv.
+type Environ func(key string) (string, bool)
+
+// WithEnviron sets the function used to look up the BEARER_TOKEN, BEARER_TOKEN_FILE, and XDG_RUNTIME_DIR environment
+// variables. By default, the process environment is consulted through os.LookupEnv.
+func WithEnviron(lookupEnv Environ) Option {
+	return func(d *Discoverer) error {
+		if lookupEnv == nil {
+			return fmt.Errorf("%w: environment lookup function cannot be nil", ErrInvalidOption)
+		}
+		d.lookupEnv = lookupEnv
+		return nil
+	}
+}
+
+// WithEnvMap makes discovery read environment variables from env instead of the process environment. The map is copied,
+// so later changes to env do not affect the Discoverer.
+func WithEnvMap(env map[string]string) Option {
+	envCopy := make(map[string]string, len(env))
+	for k, v := range env {
+		envCopy[k] = v
+	}
+	return WithEnviron(func(key string) (string, bool) {
+		val, ok := envCopy[key]
+		return val, ok
+	})
+}
+
+// WithTokenEnvVar replaces the BEARER_TOKEN environment variable consulted in step 1 of the discovery procedure with
+// names, which are consulted in order until one is set to a non-empty value. To honor legacy names alongside the
+// standard one, include BEARER_TOKEN in names, for example WithTokenEnvVar("SCITOKEN", "BEARER_TOKEN").
+func WithTokenEnvVar(names ...string) Option {
+	return func(d *Discoverer) error {
+		if err := validateEnvVarNames(names); err != nil {
+			return err
+		}
+		d.tokenEnvNames = append([]string(nil), names...)
+		return nil
+	}
+}
+
+// WithTokenFileEnvVar replaces the BEARER_TOKEN_FILE environment variable consulted in step 2 of the discovery
+// procedure with names. The first of names that is set to a non-empty value names the token file. As for
+// WithTokenEnvVar, include BEARER_TOKEN_FILE in names to keep honoring it.
+func WithTokenFileEnvVar(names ...string) Option {
+	return func(d *Discoverer) error {
+		if err := validateEnvVarNames(names); err != nil {
+			return err
+		}
+		d.tokenFileEnvNames = append([]string(nil), names...)
+		return nil
+	}
+}
+
+// WithTokenFilePrefix replaces the bt_u prefix of the bt_u$ID filename consulted in steps 3 and 4 of the discovery
+// procedure
+func WithTokenFilePrefix(prefix string) Option {
+	return func(d *Discoverer) error {
+		if prefix == "" {
+			return fmt.Errorf("%w: token file prefix cannot be empty", ErrInvalidOption)
+		}
+		if strings.ContainsAny(prefix, `/\`) {
+			return fmt.Errorf("%w: token file prefix %q contains a path separator", ErrInvalidOption, prefix)
+		}
+		d.tokenFilePrefix = prefix
+		return nil
+	}
+}
+
+// validateEnvVarNames checks that names is a non-empty list of environment variable names
+func validateEnvVarNames(names []string) error {
+	if len(names) == 0 {
+		return fmt.Errorf("%w: at least one environment variable name is required", ErrInvalidOption)
+	}
+	for _, name := range names {
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			return fmt.Errorf("%w: %q is not a valid environment variable name", ErrInvalidOption, name)
+		}
+	}
+	return nil
+}
+
+// WithLogger sets a logger that receives debug messages about each step of the discovery procedure. Token contents are
+// never logged.
+func WithLogger(logger *slog.Logger) Option {
+	return func(d *Discoverer) error {
+		if logger == nil {
+			return fmt.Errorf("%w: logger cannot be nil", ErrInvalidOption)
+		}
+		d.logger = logger
+		return nil
+	}
+}
+
+// WithSetuidDetection makes discovery behave as if WithoutEnvironmentSources were given whenever the process is running
+// setuid, that is, when its real and effective uids differ. In a setuid program, the environment is controlled by the
+// invoking user, so trusting BEARER_TOKEN or BEARER_TOKEN_FILE from it is a privilege-escalation hazard. In that case,
+// the bt_u$ID files are those of the effective user, unless a uid is set with WithUID.
+func WithSetuidDetection() Option {
+	return func(d *Discoverer) error {
+		d.skipSetuid = true
+		return nil
+	}
+}
+
+// WithoutTmpFallback skips step 4 of the discovery procedure. Since /tmp is world-writable, any local user can create
+// /tmp/bt_u$ID for a user that does not have a token yet, so security-sensitive services may not want to trust it. When
+// the earlier steps do not produce a token, discovery fails with ErrFallbackDisabled.
+func WithoutTmpFallback() Option {
+	return func(d *Discoverer) error {
+		d.noFallback = true
+		return nil
+	}
+}
+
+// WithFatalPermissionErrors makes discovery fail as soon as a token file exists but cannot be read because of its
+// permissions, instead of continuing with the next step. The returned error then wraps ErrPermissionDenied, but not
+// ErrNoTokenFound.
+func WithFatalPermissionErrors() Option {
+	return func(d *Discoverer) error {
+		d.fatalPermissions = true
+		return nil
+	}
+}
+
+// WithStrictSpec makes discovery stop at the first source that is set, as the WLCG Bearer Token Discovery specification
+// reads literally, instead of falling through to later steps when the source turns out to be unusable. Discovery then
+// fails with an error wrapping ErrNoTokenFound, and describing the source, if BEARER_TOKEN is set but empty, if
+// BEARER_TOKEN_FILE is set but empty, or names a file that is missing or empty, or if $XDG_RUNTIME_DIR/bt_u$ID is
+// empty. By default, discovery is lenient and continues with the next step in all those cases except a missing file,
+// which always ends discovery, as the specification requires.
+//
+// The strict mode matches the reference procedure of the specification, published at
+// https://github.com/WLCG-AuthZ-WG/bearer-token-discovery, where the first source that is set is the token, whatever it
+// holds. The lenient default matches the original implementation of this package, that is FindToken as it behaved
+// before this option was added, so that existing callers see no change.
+func WithStrictSpec() Option {
+	return func(d *Discoverer) error {
+		d.strictSpec = true
+		return nil
+	}
+}
+
+// runningSetuid reports whether the real and effective uids of the process differ
+func (d *Discoverer) runningSetuid() bool {
+	return d.getuid() != d.geteuid()
+}
+
+// skipEnvironmentSources reports whether steps 1 and 2 of the discovery procedure should be skipped
+func (d *Discoverer) skipEnvironmentSources() bool {
+	return d.skipEnv || (d.skipSetuid && d.runningSetuid())
+}
+
+// fallbackDirectory returns the directory consulted in step 4 of the discovery procedure
+func (d *Discoverer) fallbackDirectory() string {
+	if d.honorTMPDIR {
+		if tmpDir := d.getenv("TMPDIR"); filepath.IsAbs(tmpDir) {
+			return filepath.Clean(tmpDir)
+		}
+	}
+	return d.fallbackDir
+}
+
+// getenv returns the value of the environment variable named by key, or the empty string if it is not set
+func (d *Discoverer) getenv(key string) string {
+	val, _ := d.lookupEnv(key)
+	return val
+}
+
+// warn records a warning on res, and logs it to the configured logger, if there is one
+func (d *Discoverer) warn(res *Result, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	res.warnings = append(res.warnings, msg)
+	if d.logger != nil {
+		d.logger.Warn(msg, "source", res.source.String(), "path", res.path)
+	}
+}
+
+// debug logs msg to the configured logger, if there is one
+func (d *Discoverer) debug(msg string, args ...any) {
+	if d.logger != nil {
+		d.logger.Debug(msg, args...)
+	}
+}
@@ -0,0 +1,641 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestNewInvalidOptions(t *testing.T) {
+	type testCase struct {
+		description string
+		opts        []disc.Option
+	}
+
+	testCases := []testCase{
+		{"empty fallback directory", []disc.Option{disc.WithFallbackDir("")}},
+		{"relative fallback directory", []disc.Option{disc.WithFallbackDir("tmp")}},
+		{"empty uid", []disc.Option{disc.WithUID("")}},
+		{"uid with path separator", []disc.Option{disc.WithUID("../1000")}},
+		{"nil logger", []disc.Option{disc.WithLogger(nil)}},
+		{"fallback directory and TMPDIR", []disc.Option{disc.WithFallbackDir("/scratch"), disc.WithTMPDIRFallback()}},
+		{"fallback directory without fallback", []disc.Option{disc.WithFallbackDir("/scratch"), disc.WithoutTmpFallback()}},
+		{"TMPDIR without fallback", []disc.Option{disc.WithTMPDIRFallback(), disc.WithoutTmpFallback()}},
+		{"relative Kubernetes token path", []disc.Option{disc.WithKubernetesTokenPath("secrets/token")}},
+		{"empty oidc-agent account", []disc.Option{disc.WithOIDCAgent("")}},
+		{"zero oidc-agent timeout", []disc.Option{disc.WithOIDCAgentTimeout(0)}},
+		{"empty token command", []disc.Option{disc.WithCommandSource("")}},
+		{"zero token command timeout", []disc.Option{disc.WithCommandTimeout(0)}},
+		{"no token environment variables", []disc.Option{disc.WithTokenEnvVar()}},
+		{"empty token environment variable", []disc.Option{disc.WithTokenEnvVar("SCITOKEN", "")}},
+		{"invalid token file environment variable", []disc.Option{disc.WithTokenFileEnvVar("SCITOKEN=FILE")}},
+		{"empty token file prefix", []disc.Option{disc.WithTokenFilePrefix("")}},
+		{"token file prefix with path separator", []disc.Option{disc.WithTokenFilePrefix("../bt_u")}},
+		{"conflicting uids", []disc.Option{disc.WithUID("1000"), disc.WithUID("1001")}},
+		{"unknown permission policy", []disc.Option{disc.WithPermissionPolicy(disc.PermissionPolicy(42))}},
+		{"nil insecure permissions hook", []disc.Option{disc.WithInsecurePermissionsHook(nil)}},
+		{"zero maximum token size", []disc.Option{disc.WithMaxTokenSize(0)}},
+		{"zero read attempts", []disc.Option{disc.WithReadRetry(0, 0)}},
+		{"negative read retry backoff", []disc.Option{disc.WithReadRetry(3, -1)}},
+		{"zero poll interval", []disc.Option{disc.WithPollInterval(0, 0)}},
+		{"negative poll jitter", []disc.Option{disc.WithPollInterval(1, -1)}},
+		{"zero poll attempts", []disc.Option{disc.WithMaxPollAttempts(0)}},
+		{"negative lock wait", []disc.Option{disc.WithFileLocking(-1)}},
+		{"zero FIFO timeout", []disc.Option{disc.WithFIFOs(0)}},
+		{"nil clock", []disc.Option{disc.WithClock(nil)}},
+		{"non-positive minimum lifetime", []disc.Option{disc.WithMinimumLifetime(0, false)}},
+		{"negative leeway", []disc.Option{disc.WithLeeway(-1)}},
+		{"empty required audience", []disc.Option{disc.WithRequiredAudience("")}},
+		{"no allowed issuers", []disc.Option{disc.WithAllowedIssuers()}},
+		{"empty allowed issuer", []disc.Option{disc.WithAllowedIssuers("https://iam.example", "/")}},
+		{"empty required subject", []disc.Option{disc.WithRequiredSubject("")}},
+		{"empty required subject prefix", []disc.Option{disc.WithRequiredSubjectPrefix("")}},
+		{"no required scopes", []disc.Option{disc.WithRequiredScopes()}},
+		{"required scope with a space", []disc.Option{disc.WithRequiredScopes("storage.read:/ compute.read")}},
+		{"empty required profile", []disc.Option{disc.WithRequiredProfile("")}},
+		{"empty required type", []disc.Option{disc.WithRequiredType("", true)}},
+		{"nil verifier", []disc.Option{disc.WithVerification(nil, disc.ValidationOptions{})}},
+		{"zero maximum token age", []disc.Option{disc.WithMaxTokenAge(0, true)}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				d, err := disc.New(tc.opts...)
+				if !errors.Is(err, disc.ErrInvalidOption) {
+					t.Errorf("Expected error %s, got %v", disc.ErrInvalidOption, err)
+				}
+				if d != nil {
+					t.Error("Expected nil Discoverer for invalid options")
+				}
+			},
+		)
+	}
+}
+
+func TestDiscovererFallbackDirAndUID(t *testing.T) {
+	fallbackDir := t.TempDir()
+	fname := filepath.Join(fallbackDir, "bt_u4242")
+	if err := os.WriteFile(fname, []byte("custom_fallback\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BEARER_TOKEN", "")
+	t.Setenv("BEARER_TOKEN_FILE", "")
+	t.Setenv("XDG_RUNTIME_DIR", "")
+
+	d, err := disc.New(disc.WithFallbackDir(fallbackDir), disc.WithUID("4242"), disc.WithoutOwnershipCheck())
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+
+	// Discovery should be repeatable on the same Discoverer
+	for i := 0; i < 2; i++ {
+		tok, path, err := d.FindTokenAndFile()
+		if err != nil {
+			t.Fatalf("Expected nil error, got %s", err)
+		}
+		if !reflect.DeepEqual(tok, []byte("custom_fallback")) {
+			t.Errorf("Token strings do not match.  Expected %v, got %v", []byte("custom_fallback"), tok)
+		}
+		if path != fname {
+			t.Errorf("Token paths do not match. Expected path %s, got %s", fname, path)
+		}
+	}
+}
+
+func TestDiscovererWithEnvMap(t *testing.T) {
+	t.Parallel()
+
+	const uid = "4242"
+
+	type testCase struct {
+		description  string
+		setupFunc    func(t *testing.T, dir string) map[string]string
+		expectedTok  []byte
+		expectedPath func(dir string) string
+		expectedErr  error
+	}
+
+	writeFile := func(t *testing.T, path, contents string) {
+		if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	noPath := func(string) string { return "" }
+	xdgPath := func(dir string) string { return filepath.Join(dir, "xdg", "bt_u"+uid) }
+	fallbackPath := func(dir string) string { return filepath.Join(dir, "tmp", "bt_u"+uid) }
+
+	testCases := []testCase{
+		{
+			"BEARER_TOKEN defined",
+			func(*testing.T, string) map[string]string {
+				return map[string]string{"BEARER_TOKEN": "42"}
+			},
+			[]byte("42"),
+			noPath,
+			nil,
+		},
+		{
+			"BEARER_TOKEN defined, but empty - should move eventually to fallback",
+			func(t *testing.T, dir string) map[string]string {
+				writeFile(t, fallbackPath(dir), "abcde")
+				return map[string]string{"BEARER_TOKEN": ""}
+			},
+			[]byte("abcde"),
+			fallbackPath,
+			nil,
+		},
+		{
+			"BEARER_TOKEN_FILE defined",
+			func(t *testing.T, dir string) map[string]string {
+				writeFile(t, filepath.Join(dir, "bt_test_file"), " 12345\n")
+				return map[string]string{"BEARER_TOKEN_FILE": filepath.Join(dir, "bt_test_file")}
+			},
+			[]byte("12345"),
+			func(dir string) string { return filepath.Join(dir, "bt_test_file") },
+			nil,
+		},
+		{
+			"BEARER_TOKEN_FILE defined with file that doesn't exist",
+			func(t *testing.T, dir string) map[string]string {
+				return map[string]string{"BEARER_TOKEN_FILE": filepath.Join(dir, "bt_test_file")}
+			},
+			nil,
+			noPath,
+			disc.ErrNoTokenFound,
+		},
+		{
+			"XDG_RUNTIME_DIR defined, token file exists",
+			func(t *testing.T, dir string) map[string]string {
+				writeFile(t, xdgPath(dir), "54321")
+				return map[string]string{"XDG_RUNTIME_DIR": filepath.Join(dir, "xdg")}
+			},
+			[]byte("54321"),
+			xdgPath,
+			nil,
+		},
+		{
+			"XDG_RUNTIME_DIR defined, token file is empty - should move to next case",
+			func(t *testing.T, dir string) map[string]string {
+				writeFile(t, xdgPath(dir), "")
+				writeFile(t, fallbackPath(dir), "xdg_fallthrough")
+				return map[string]string{"XDG_RUNTIME_DIR": filepath.Join(dir, "xdg")}
+			},
+			[]byte("xdg_fallthrough"),
+			fallbackPath,
+			nil,
+		},
+		{
+			"Fallback case, but token isn't there",
+			func(*testing.T, string) map[string]string {
+				return map[string]string{}
+			},
+			nil,
+			noPath,
+			disc.ErrNoTokenFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				t.Parallel()
+				dir := t.TempDir()
+				for _, sub := range []string{"xdg", "tmp"} {
+					if err := os.Mkdir(filepath.Join(dir, sub), 0700); err != nil {
+						t.Fatal(err)
+					}
+				}
+				env := tc.setupFunc(t, dir)
+
+				d, err := disc.New(
+					disc.WithEnvMap(env),
+					disc.WithFallbackDir(filepath.Join(dir, "tmp")),
+					disc.WithUID(uid),
+					disc.WithoutOwnershipCheck(),
+				)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, path, err := d.FindTokenAndFile()
+				if !reflect.DeepEqual(tok, tc.expectedTok) {
+					t.Errorf("Token strings do not match.  Expected %v, got %v", tc.expectedTok, tok)
+				}
+				if path != tc.expectedPath(dir) {
+					t.Errorf("Token paths do not match. Expected path %s, got %s", tc.expectedPath(dir), path)
+				}
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("Got different errors: expected %v, got %v", tc.expectedErr, err)
+				}
+			},
+		)
+	}
+}
+
+func TestDiscovererTargetUser(t *testing.T) {
+	curUser, err := user.Current()
+	if err != nil {
+		t.Fatal("Could not get current user from OS")
+	}
+	fallbackDir := t.TempDir()
+	for _, uid := range []string{disc.UserFileID(curUser), "4242"} {
+		if err := os.WriteFile(filepath.Join(fallbackDir, "bt_u"+uid), []byte("token_for_"+uid), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	env := map[string]string{"BEARER_TOKEN": "caller_token"}
+
+	type testCase struct {
+		description  string
+		opts         []disc.Option
+		expectedTok  []byte
+		expectedPath string
+	}
+
+	testCases := []testCase{
+		{
+			"Default uses the current user",
+			[]disc.Option{disc.WithoutEnvironmentSources()},
+			[]byte("token_for_" + disc.UserFileID(curUser)),
+			filepath.Join(fallbackDir, "bt_u"+disc.UserFileID(curUser)),
+		},
+		{
+			"Explicit uid",
+			[]disc.Option{disc.WithUID("4242"), disc.WithoutEnvironmentSources()},
+			[]byte("token_for_4242"),
+			filepath.Join(fallbackDir, "bt_u4242"),
+		},
+		{
+			"Explicit uid still honors environment unless told otherwise",
+			[]disc.Option{disc.WithUID("4242")},
+			[]byte("caller_token"),
+			"",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := append([]disc.Option{disc.WithEnvMap(env), disc.WithFallbackDir(fallbackDir), disc.WithoutOwnershipCheck()}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, path, err := d.FindTokenAndFile()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %s", err)
+				}
+				if !reflect.DeepEqual(tok, tc.expectedTok) {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedTok, tok)
+				}
+				if path != tc.expectedPath {
+					t.Errorf("Token paths do not match. Expected path %s, got %s", tc.expectedPath, path)
+				}
+			},
+		)
+	}
+}
+
+func TestDiscovererTargetUserPermissionDenied(t *testing.T) {
+	d, err := disc.New(
+		disc.WithEnvMap(map[string]string{}),
+		disc.WithFS(errFS{fs.ErrPermission}),
+		disc.WithUID("4242"),
+		disc.WithoutEnvironmentSources(),
+	)
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	_, _, err = d.FindTokenAndFile()
+	if !errors.Is(err, disc.ErrPermissionDenied) {
+		t.Errorf("Expected error to wrap %s, got %v", disc.ErrPermissionDenied, err)
+	}
+	if !errors.Is(err, disc.ErrNoTokenFound) {
+		t.Errorf("Expected unreadable token files to be skipped, and error to wrap %s, got %v", disc.ErrNoTokenFound, err)
+	}
+	if expected := "bt_u4242"; err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error to name the token file %s, got %v", expected, err)
+	}
+}
+
+func TestDiscovererFallbackDirectory(t *testing.T) {
+	fsys := fstest.MapFS{
+		"tmp/bt_u4242":         {Data: []byte("tmp_token")},
+		"scratch/bt_u4242":     {Data: []byte("scratch_token")},
+		"scratch/job/bt_u4242": {Data: []byte("job_token")},
+	}
+
+	type testCase struct {
+		description  string
+		env          map[string]string
+		opts         []disc.Option
+		expectedTok  []byte
+		expectedPath string
+	}
+
+	testCases := []testCase{
+		{
+			"Default is /tmp, even if TMPDIR is set",
+			map[string]string{"TMPDIR": "/scratch/job"},
+			nil,
+			[]byte("tmp_token"),
+			"/tmp/bt_u4242",
+		},
+		{
+			"Custom fallback directory",
+			map[string]string{"TMPDIR": "/scratch/job"},
+			[]disc.Option{disc.WithFallbackDir("/scratch")},
+			[]byte("scratch_token"),
+			"/scratch/bt_u4242",
+		},
+		{
+			"TMPDIR honored",
+			map[string]string{"TMPDIR": "/scratch/job"},
+			[]disc.Option{disc.WithTMPDIRFallback()},
+			[]byte("job_token"),
+			"/scratch/job/bt_u4242",
+		},
+		{
+			"TMPDIR honored but unset",
+			map[string]string{},
+			[]disc.Option{disc.WithTMPDIRFallback()},
+			[]byte("tmp_token"),
+			"/tmp/bt_u4242",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := append([]disc.Option{disc.WithEnvMap(tc.env), disc.WithFS(fsys), disc.WithUID("4242")}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, path, err := d.FindTokenAndFile()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %s", err)
+				}
+				if !reflect.DeepEqual(tok, tc.expectedTok) {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedTok, tok)
+				}
+				if path != tc.expectedPath {
+					t.Errorf("Token paths do not match. Expected path %s, got %s", tc.expectedPath, path)
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"Error names the chosen directory",
+		func(t *testing.T) {
+			d, err := disc.New(
+				disc.WithEnvMap(map[string]string{"TMPDIR": "/scratch/other"}),
+				disc.WithFS(fsys),
+				disc.WithUID("4242"),
+				disc.WithTMPDIRFallback(),
+			)
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			_, err = d.FindToken()
+			if !errors.Is(err, disc.ErrNoTokenFound) {
+				t.Errorf("Expected error %s, got %v", disc.ErrNoTokenFound, err)
+			}
+			if err == nil || !strings.Contains(err.Error(), "/scratch/other/bt_u4242") {
+				t.Errorf("Expected error to name /scratch/other/bt_u4242, got %v", err)
+			}
+		},
+	)
+}
+
+func TestDiscovererWithoutTmpFallback(t *testing.T) {
+	fsys := fstest.MapFS{
+		"tmp/bt_u4242":           {Data: []byte("planted_token")},
+		"run/user/4242/bt_u4242": {Data: []byte("xdg_token")},
+	}
+
+	t.Run(
+		"Token only in /tmp is ignored",
+		func(t *testing.T) {
+			d, err := disc.New(disc.WithEnvMap(map[string]string{}), disc.WithFS(fsys), disc.WithUID("4242"), disc.WithoutTmpFallback())
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			tok, path, err := d.FindTokenAndFile()
+			if tok != nil || path != "" {
+				t.Errorf("Expected no token, got %s from %s", tok, path)
+			}
+			if !errors.Is(err, disc.ErrFallbackDisabled) {
+				t.Errorf("Expected error %s, got %v", disc.ErrFallbackDisabled, err)
+			}
+			if !errors.Is(err, disc.ErrNoTokenFound) {
+				t.Errorf("Expected error %s, got %v", disc.ErrNoTokenFound, err)
+			}
+		},
+	)
+
+	t.Run(
+		"Earlier steps still work",
+		func(t *testing.T) {
+			d, err := disc.New(
+				disc.WithEnvMap(map[string]string{"XDG_RUNTIME_DIR": "/run/user/4242"}),
+				disc.WithFS(fsys),
+				disc.WithUID("4242"),
+				disc.WithoutTmpFallback(),
+			)
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			tok, err := d.FindToken()
+			if err != nil {
+				t.Fatalf("Expected nil error, got %s", err)
+			}
+			if string(tok) != "xdg_token" {
+				t.Errorf("Token strings do not match.  Expected xdg_token, got %s", tok)
+			}
+		},
+	)
+}
+
+func TestDiscovererFileOnly(t *testing.T) {
+	fsys := fstest.MapFS{
+		"home/user/token":        {Data: []byte("file_token")},
+		"run/user/4242/bt_u4242": {Data: []byte("xdg_token")},
+		"run/user/4242/bt_u0":    {Data: []byte("euid_token")},
+	}
+	env := map[string]string{
+		"BEARER_TOKEN":      "env_token",
+		"BEARER_TOKEN_FILE": "/home/user/token",
+		"XDG_RUNTIME_DIR":   "/run/user/4242",
+	}
+	runAs := func(uid, euid int) []disc.Option {
+		return []disc.Option{disc.WithGetuid(func() int { return uid }), disc.WithGeteuid(func() int { return euid })}
+	}
+
+	type testCase struct {
+		description string
+		opts        []disc.Option
+		expectedTok []byte
+	}
+
+	testCases := []testCase{
+		{
+			"Default honors the environment",
+			[]disc.Option{disc.WithUID("4242")},
+			[]byte("env_token"),
+		},
+		{
+			"WithoutEnvironmentSources ignores BEARER_TOKEN and BEARER_TOKEN_FILE",
+			[]disc.Option{disc.WithUID("4242"), disc.WithoutEnvironmentSources()},
+			[]byte("xdg_token"),
+		},
+		{
+			"Setuid detection, not running setuid",
+			append(runAs(4242, 4242), disc.WithUID("4242"), disc.WithSetuidDetection()),
+			[]byte("env_token"),
+		},
+		{
+			"Setuid detection, running setuid",
+			append(runAs(4242, 0), disc.WithUID("4242"), disc.WithSetuidDetection()),
+			[]byte("xdg_token"),
+		},
+		{
+			"Setuid detection, running setuid, uses effective uid",
+			append(runAs(4242, 0), disc.WithSetuidDetection()),
+			[]byte("euid_token"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := append([]disc.Option{disc.WithEnvMap(env), disc.WithFS(fsys)}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, err := d.FindToken()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %s", err)
+				}
+				if !reflect.DeepEqual(tok, tc.expectedTok) {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedTok, tok)
+				}
+			},
+		)
+	}
+}
+
+func TestDiscovererEnvVarNames(t *testing.T) {
+	fsys := fstest.MapFS{
+		"home/user/scitoken":           {Data: []byte("scitoken_file_token")},
+		"home/user/token":              {Data: []byte("file_token")},
+		"run/user/4242/bt_u4242":       {Data: []byte("xdg_token")},
+		"run/user/4242/scitoken_u4242": {Data: []byte("xdg_scitoken")},
+		"tmp/scitoken_u4242":           {Data: []byte("tmp_scitoken")},
+	}
+
+	type testCase struct {
+		description  string
+		env          map[string]string
+		opts         []disc.Option
+		expectedTok  []byte
+		expectedPath string
+	}
+
+	testCases := []testCase{
+		{
+			"Renamed token variable",
+			map[string]string{"BEARER_TOKEN": "env_token", "SCITOKEN": "scitoken"},
+			[]disc.Option{disc.WithTokenEnvVar("SCITOKEN")},
+			[]byte("scitoken"),
+			"",
+		},
+		{
+			"Renamed token variable ignores BEARER_TOKEN",
+			map[string]string{"BEARER_TOKEN": "env_token", "BEARER_TOKEN_FILE": "/home/user/token"},
+			[]disc.Option{disc.WithTokenEnvVar("SCITOKEN")},
+			[]byte("file_token"),
+			"/home/user/token",
+		},
+		{
+			"Fully renamed variables",
+			map[string]string{"BEARER_TOKEN_FILE": "/home/user/token", "SCITOKEN_FILE": "/home/user/scitoken"},
+			[]disc.Option{disc.WithTokenEnvVar("SCITOKEN"), disc.WithTokenFileEnvVar("SCITOKEN_FILE")},
+			[]byte("scitoken_file_token"),
+			"/home/user/scitoken",
+		},
+		{
+			"Alias checked first",
+			map[string]string{"BEARER_TOKEN": "env_token", "SCITOKEN": "scitoken"},
+			[]disc.Option{disc.WithTokenEnvVar("SCITOKEN", "BEARER_TOKEN")},
+			[]byte("scitoken"),
+			"",
+		},
+		{
+			"Standard name honored in alias mode",
+			map[string]string{"BEARER_TOKEN": "env_token"},
+			[]disc.Option{disc.WithTokenEnvVar("SCITOKEN", "BEARER_TOKEN")},
+			[]byte("env_token"),
+			"",
+		},
+		{
+			"Standard file name honored in alias mode",
+			map[string]string{"BEARER_TOKEN_FILE": "/home/user/token"},
+			[]disc.Option{disc.WithTokenFileEnvVar("SCITOKEN_FILE", "BEARER_TOKEN_FILE")},
+			[]byte("file_token"),
+			"/home/user/token",
+		},
+		{
+			"Renamed file prefix in XDG_RUNTIME_DIR",
+			map[string]string{"XDG_RUNTIME_DIR": "/run/user/4242"},
+			[]disc.Option{disc.WithTokenFilePrefix("scitoken_u")},
+			[]byte("xdg_scitoken"),
+			"/run/user/4242/scitoken_u4242",
+		},
+		{
+			"Renamed file prefix in fallback directory",
+			nil,
+			[]disc.Option{disc.WithTokenFilePrefix("scitoken_u")},
+			[]byte("tmp_scitoken"),
+			"/tmp/scitoken_u4242",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := append([]disc.Option{disc.WithEnvMap(tc.env), disc.WithFS(fsys), disc.WithUID("4242")}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, path, err := d.FindTokenAndFile()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %s", err)
+				}
+				if !reflect.DeepEqual(tok, tc.expectedTok) {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedTok, tok)
+				}
+				if path != tc.expectedPath {
+					t.Errorf("Token paths do not match. Expected path %s, got %s", tc.expectedPath, path)
+				}
+			},
+		)
+	}
+}
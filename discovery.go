@@ -2,95 +2,502 @@ package tokendiscovery
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"os"
-	"os/user"
-	"path/filepath"
+	"io/fs"
 	"strings"
+	"unsafe"
 )
 
-// ErrNoTokenFound indicates that the WLCG Bearer Token Discovery procedure failed to find a suitable bearer token
+// ErrNoTokenFound indicates that the WLCG Bearer Token Discovery procedure failed to find a suitable bearer token. The
+// error returned by discovery in that case wraps ErrNoTokenFound, and lists why each step consulted did not produce a
+// token.
 var ErrNoTokenFound = errors.New("no token found using WLCG Bearer Token Discovery procedure")
 
-// FindToken follows the WLCG Bearer Token Discovery procedure to locate a bearer token on the user's machine
+// ErrBearerTokenFileMissing indicates that BEARER_TOKEN_FILE names a file that does not exist. As the WLCG Bearer Token
+// Discovery procedure requires, discovery ends there. It wraps ErrNoTokenFound, and the error returned by discovery
+// names the missing file.
+var ErrBearerTokenFileMissing error = &missingFileError{"BEARER_TOKEN_FILE is set but the token file does not exist"}
+
+// ErrXDGTokenFileMissing indicates that XDG_RUNTIME_DIR is set but $XDG_RUNTIME_DIR/bt_u$ID does not exist. As the WLCG
+// Bearer Token Discovery procedure requires, discovery ends there. It wraps ErrNoTokenFound, and the error returned by
+// discovery names the missing file.
+var ErrXDGTokenFileMissing error = &missingFileError{"XDG_RUNTIME_DIR is set but the token file does not exist"}
+
+// missingFileError is the type of the errors for token files whose absence ends discovery
+type missingFileError struct {
+	msg string
+}
+
+func (e *missingFileError) Error() string { return e.msg }
+
+func (e *missingFileError) Unwrap() error { return ErrNoTokenFound }
+
+// tokenFileMissing returns the error ending discovery because the token file at path, which must exist, does not. err
+// is the error from reading the file.
+func tokenFileMissing(source Source, path string, sentinel error, err error) error {
+	return endDiscovery(source, path, fmt.Errorf("%w: %w", sentinel, err))
+}
+
+// endDiscovery returns the error ending discovery without a token because step source failed with err
+func endDiscovery(source Source, path string, err error) error {
+	return &noTokenError{[]error{&DiscoveryError{Step: source, Path: path, Err: err}}}
+}
+
+// ErrEmptyToken indicates that a token file exists but is empty or only contains whitespace, as when a token has not
+// been written yet. Steps that find an empty file are skipped, and if no step finds a token, the error returned by
+// discovery wraps both ErrEmptyToken and ErrNoTokenFound.
+var ErrEmptyToken = errors.New("token file has no data")
+
+// ErrPermissionDenied indicates that a token file exists but could not be read because of its permissions, as when
+// /tmp/bt_u$ID was written by root. Since the token file is not usable by the caller either way, the step is skipped
+// and discovery continues with the next one, unless WithFatalPermissionErrors is given. If no step produces a token,
+// the error returned by discovery wraps both it and ErrNoTokenFound, and names the unreadable file.
+var ErrPermissionDenied = errors.New("token file is not readable")
+
+// ErrTokenTooLarge indicates that a token file was not read because it is larger than the limit set with
+// WithMaxTokenSize, 1 MiB by default
+var ErrTokenTooLarge = errors.New("token file is too large")
+
+// ErrLooksLikeCertificate indicates that a token file starts with a PEM header, as X.509 certificates and proxies do.
+// Pointing BEARER_TOKEN_FILE at a proxy is a common mistake, which would otherwise only show as an authentication
+// failure at the server.
+var ErrLooksLikeCertificate = errors.New("file appears to contain an X.509 certificate/proxy, not a bearer token")
+
+// ErrFallbackDisabled indicates that the fallback step was not attempted because it was disabled with
+// WithoutTmpFallback. When no token is found, the error returned by discovery wraps both it and ErrNoTokenFound.
+var ErrFallbackDisabled = errors.New("fallback step is disabled")
+
+// defaultDiscoverer backs the package-level functions
+var defaultDiscoverer = newDefaultDiscoverer()
+
+// FindToken follows the WLCG Bearer Token Discovery procedure to locate a bearer token on the user's machine. The
+// returned slice is always a private copy owned by the caller; it never aliases memory held by the package.
 func FindToken() ([]byte, error) {
-	tok, _, err := FindTokenAndFile()
-	return tok, err
+	return defaultDiscoverer.FindToken()
 }
 
-// FindTokenAndFile follows the WLCG Bearer Token Discovery procedure to locate a bearer token on the user's machine. It returns a byte slice of the token contents, a string indicating the path to the file containing the token, if applicable, and an error value indicating success or failure.
+// FindTokenContext is like FindToken, but abandons discovery when ctx is done. In that case, the returned error wraps
+// ctx.Err().
+func FindTokenContext(ctx context.Context) ([]byte, error) {
+	return defaultDiscoverer.FindTokenContext(ctx)
+}
+
+// FindTokenString is like FindToken, but returns the token as a string, ready to be used in an Authorization header.
+// Unlike the slice returned by FindToken, the string cannot be wiped from memory with WipeBytes.
+func FindTokenString() (string, error) {
+	return defaultDiscoverer.FindTokenString()
+}
+
+// FindTokenStringContext is like FindTokenString, but abandons discovery when ctx is done. In that case, the returned
+// error wraps ctx.Err().
+func FindTokenStringContext(ctx context.Context) (string, error) {
+	return defaultDiscoverer.FindTokenStringContext(ctx)
+}
+
+// FindTokenAndFile follows the WLCG Bearer Token Discovery procedure to locate a bearer token on the user's machine. It
+// returns a byte slice of the token contents, a string indicating the path to the file containing the token, if
+// applicable, and an error value indicating success or failure.
 func FindTokenAndFile() ([]byte, string, error) {
-	// 1. If the BEARER_TOKEN environment variable is set, then the value is taken to be the token contents.
-	if retVal := strings.TrimSpace(os.Getenv("BEARER_TOKEN")); retVal != "" {
-		return []byte(retVal), "", nil
+	return defaultDiscoverer.FindTokenAndFile()
+}
+
+// FindTokenAndFileContext is like FindTokenAndFile, but abandons discovery, including any token file read in progress,
+// when ctx is done. In that case, the returned error wraps ctx.Err().
+func FindTokenAndFileContext(ctx context.Context) ([]byte, string, error) {
+	return defaultDiscoverer.FindTokenAndFileContext(ctx)
+}
+
+// FindToken follows the WLCG Bearer Token Discovery procedure, as configured on d, to locate a bearer token
+func (d *Discoverer) FindToken() ([]byte, error) {
+	return d.FindTokenContext(context.Background())
+}
+
+// FindTokenContext is like FindToken, but abandons discovery when ctx is done
+func (d *Discoverer) FindTokenContext(ctx context.Context) ([]byte, error) {
+	tok, _, err := d.FindTokenAndFileContext(ctx)
+	return tok, err
+}
+
+// FindTokenString is like FindToken, but returns the token as a string
+func (d *Discoverer) FindTokenString() (string, error) {
+	return d.FindTokenStringContext(context.Background())
+}
+
+// FindTokenStringContext is like FindTokenString, but abandons discovery when ctx is done
+func (d *Discoverer) FindTokenStringContext(ctx context.Context) (string, error) {
+	res, err := d.DiscoverContext(ctx)
+	if err != nil {
+		return "", err
 	}
+	// res is private to this call, so its buffer can back the string without a copy
+	return unsafeString(res.token), nil
+}
 
-	// 2. If the BEARER_TOKEN_FILE environment variable is set, then its value is interpreted as a filename. The contents of the specified file are taken to be the token contents.
-	if fname := os.Getenv("BEARER_TOKEN_FILE"); fname != "" {
-		tok, err := readTokenFile(fname)
+// FindTokenAndFile follows the WLCG Bearer Token Discovery procedure, as configured on d, to locate a bearer token. Its
+// return values are the same as those of the package-level FindTokenAndFile.
+func (d *Discoverer) FindTokenAndFile() ([]byte, string, error) {
+	return d.FindTokenAndFileContext(context.Background())
+}
+
+// FindTokenAndFileContext is like FindTokenAndFile, but abandons discovery, including any token file read in progress,
+// when ctx is done
+func (d *Discoverer) FindTokenAndFileContext(ctx context.Context) ([]byte, string, error) {
+	res, err := d.DiscoverContext(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	return res.token, res.path, nil
+}
+
+// Discover follows the WLCG Bearer Token Discovery procedure to locate a bearer token on the user's machine, and
+// returns a Result describing the token that was found
+func Discover() (Result, error) {
+	return defaultDiscoverer.Discover()
+}
+
+// DiscoverContext is like Discover, but abandons discovery when ctx is done. In that case, the returned error wraps
+// ctx.Err().
+func DiscoverContext(ctx context.Context) (Result, error) {
+	return defaultDiscoverer.DiscoverContext(ctx)
+}
+
+// Discover follows the WLCG Bearer Token Discovery procedure, as configured on d, and returns a Result describing the
+// token that was found
+func (d *Discoverer) Discover() (Result, error) {
+	return d.DiscoverContext(context.Background())
+}
+
+// DiscoverContext is like Discover, but abandons discovery, including any token file read in progress, when ctx is done
+func (d *Discoverer) DiscoverContext(ctx context.Context) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, fmt.Errorf("token discovery abandoned: %w", err)
+	}
+	res, err := d.discover(ctx)
+	if err != nil && d.tokenName != "" && d.namedFallback && errors.Is(err, ErrNoTokenFound) {
+		return d.discoverNamedFallback(ctx, err)
+	}
+	return res, err
+}
+
+// discover runs the discovery steps of d in order
+func (d *Discoverer) discover(ctx context.Context) (Result, error) {
+	var skipped, rejected []error
+	for _, step := range d.steps {
+		res, err := d.runStep(ctx, step)
+		if errors.Is(err, ErrSkipStep) {
+			if isRejected(err) {
+				rejected = append(rejected, err)
+			}
+			if err != ErrSkipStep {
+				skipped = append(skipped, err)
+			}
+			continue
+		}
+		if err != nil {
+			return Result{}, err
+		}
+		for _, err := range rejected {
+			d.warn(&res, "skipped token: %s", errors.Unwrap(err))
+		}
+		return res, nil
+	}
+	skipped = append(skipped, d.rejectionErrors(rejected)...)
+	return Result{}, &noTokenError{skipped}
+}
+
+// DiscoverAll is like Discover, but runs every step of the discovery procedure instead of stopping at the first one
+// that finds a token, and returns all the tokens found, in order of precedence. This shows which tokens are available,
+// for debugging or to choose among them. If any step fails, or finds an empty or unreadable token, the returned error
+// wraps the failure of each such step, even if other steps found tokens. If no step finds a token, the error wraps
+// ErrNoTokenFound.
+func DiscoverAll() ([]Result, error) {
+	return defaultDiscoverer.DiscoverAll()
+}
+
+// DiscoverAllContext is like DiscoverAll, but abandons discovery when ctx is done. In that case, the returned error
+// wraps ctx.Err().
+func DiscoverAllContext(ctx context.Context) ([]Result, error) {
+	return defaultDiscoverer.DiscoverAllContext(ctx)
+}
+
+// DiscoverAll is like the package-level DiscoverAll, but uses the discovery procedure as configured on d
+func (d *Discoverer) DiscoverAll() ([]Result, error) {
+	return d.DiscoverAllContext(context.Background())
+}
+
+// DiscoverAllContext is like DiscoverAll, but abandons discovery when ctx is done
+func (d *Discoverer) DiscoverAllContext(ctx context.Context) ([]Result, error) {
+	var results []Result
+	var failed listError
+	for _, step := range d.steps {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("token discovery abandoned: %w", err)
+		}
+		res, err := d.runStep(ctx, step)
 		switch {
-		case os.IsNotExist(err):
-			return nil, "", ErrNoTokenFound
-		case errors.Is(err, errEmptyToken):
-			// Do nothing - pass
+		case err == ErrSkipStep, errors.Is(err, errUnset):
+		case errors.Is(err, ErrSkipStep):
+			failed = append(failed, stepFailure(step, err))
+		case err != nil && ctx.Err() != nil:
+			return nil, err
+		case errors.Is(err, ErrNoTokenFound):
+			// Steps 2 and 3 end discovery when a token file is missing, but here the missing file is just recorded
+			failed = append(failed, skipReasons(err)...)
 		case err != nil:
-			return nil, "", fmt.Errorf("cannot read token file located at %s: %w", fname, err)
+			failed = append(failed, stepFailure(step, err))
 		default:
-			return tok, fname, nil
+			results = append(results, res)
 		}
 	}
+	if len(results) == 0 {
+		return nil, &noTokenError{failed}
+	}
+	if len(failed) > 0 {
+		return results, fmt.Errorf("some discovery steps failed: %w", failed)
+	}
+	return results, nil
+}
 
-	// 3. If the XDG_RUNTIME_DIR environment variable is set, then take the token from the contents of $XDG_RUNTIME_DIR/bt_u$ID.
-	curUser, err := user.Current()
-	if err != nil {
-		return nil, "", errors.New("could not get current user from OS")
+// stepFailure returns err, the failure of step, identifying the step if err does not already
+func stepFailure(step Step, err error) error {
+	var discErr *DiscoveryError
+	if errors.As(err, &discErr) {
+		return err
 	}
+	return fmt.Errorf("%s: %w", step.Name(), err)
+}
 
-	if xdgDir := os.Getenv("XDG_RUNTIME_DIR"); xdgDir != "" {
-		fname := filepath.Join(xdgDir, fmt.Sprintf("bt_u%s", curUser.Uid))
-		tok, err := readTokenFile(fname)
-		switch {
-		case os.IsNotExist(err):
-			return nil, "", ErrNoTokenFound
-		case errors.Is(err, errEmptyToken):
-			// Do nothing - pass
-		case err != nil:
-			return nil, "", fmt.Errorf("cannot read token file located at %s: %w", fname, err)
-		default:
-			return tok, fname, nil
+// runStep runs step, and completes the Result it returns. A step that returns an empty token is treated as skipped.
+func (d *Discoverer) runStep(ctx context.Context, step Step) (Result, error) {
+	if d.noFilesystem() && readsFiles(step) {
+		d.debug("skipping discovery step, no filesystem available", "step", step.Name())
+		return Result{}, ErrSkipStep
+	}
+	d.debug("running discovery step", "step", step.Name())
+	stepCtx, warnings := withWarnings(ctx)
+	res, err := step.Lookup(stepCtx, d.lookupEnv, d)
+	if err == nil {
+		for _, msg := range warnings.messages() {
+			d.warn(&res, "%s", msg)
+		}
+		res.rewritten = warnings.isRewritten()
+	}
+	if err == nil && !d.keepBearerPrefix && !d.rawContents {
+		if tok, ok := stripBearerPrefix(res.token); ok {
+			res.token = tok
+			res.rewritten = true
+			d.warn(&res, "removed %q prefix from token found by discovery step %s", bearerScheme+" ", step.Name())
 		}
 	}
+	if err == nil && len(bytes.TrimSpace(res.token)) == 0 {
+		err = SkipStep(fmt.Errorf("discovery step %s returned an empty token", step.Name()))
+	}
+	if errors.Is(err, ErrSkipStep) {
+		d.debug("discovery step did not produce a token", "step", step.Name(), "reason", err)
+		return Result{}, err
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	if res.source == SourceUnknown {
+		res.source = SourceCustom
+	}
+	if d.validateSyntax {
+		if err := checkTokenSyntax(bytes.TrimSpace(res.token)); err != nil {
+			d.debug("discovery step found a malformed token", "step", step.Name(), "path", res.path, "reason", err)
+			return Result{}, SkipStep(&DiscoveryError{Step: res.source, Path: res.path, Err: err})
+		}
+	}
+	if err := d.checkRequirements(ctx, bytes.TrimSpace(res.token)); err != nil {
+		d.debug("discovery step found an unsuitable token", "step", step.Name(), "path", res.path, "reason", err)
+		return Result{}, SkipStep(&DiscoveryError{Step: res.source, Path: res.path, Err: err})
+	}
+	res.step = step.Name()
+	res.cache = &resultCache{}
+	res.now = d.now
+	d.debug("discovery step found a token", "step", step.Name(), "path", res.path)
+	return res, nil
+}
+
+// DiscoveryError records the failure of a step of the discovery procedure. Every error returned by discovery because a
+// step failed wraps a *DiscoveryError for that step, as do the reasons recorded for skipped steps, so the step and the
+// file involved can be retrieved with errors.As. When a step ends discovery without a token, Err wraps ErrNoTokenFound.
+type DiscoveryError struct {
+	// Step is the step that failed
+	Step Source
+	// Path is the token file involved, if any
+	Path string
+	// Err is the underlying error
+	Err error
+}
+
+func (e *DiscoveryError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Step, e.Err)
+}
+
+func (e *DiscoveryError) Unwrap() error { return e.Err }
+
+// noTokenError is returned when no discovery step produced a token. It wraps ErrNoTokenFound, as well as the reasons
+// the steps were skipped.
+type noTokenError struct {
+	skipped []error
+}
+
+func (e *noTokenError) Error() string {
+	if len(e.skipped) == 0 {
+		return ErrNoTokenFound.Error()
+	}
+	reasons := make([]string, 0, len(e.skipped))
+	for _, err := range e.skipped {
+		reasons = append(reasons, err.Error())
+	}
+	return fmt.Sprintf("%s: %s", ErrNoTokenFound, strings.Join(reasons, "; "))
+}
+
+func (e *noTokenError) Unwrap() []error {
+	return append([]error{ErrNoTokenFound}, e.skipped...)
+}
+
+// skipReasons returns the reasons recorded in err, an error wrapping ErrNoTokenFound, for steps not producing a token
+func skipReasons(err error) []error {
+	var noToken *noTokenError
+	if errors.As(err, &noToken) {
+		return noToken.skipped
+	}
+	if err == ErrNoTokenFound {
+		return nil
+	}
+	return []error{err}
+}
 
-	// 4. Otherwise, take the token from /tmp/bt_u$ID
-	fname := filepath.Join("/tmp", fmt.Sprintf("bt_u%s", curUser.Uid))
-	tok, err := readTokenFile(fname)
-	switch {
-	case (os.IsNotExist(err) || errors.Is(err, errEmptyToken)):
-		return nil, "", ErrNoTokenFound
-	case err != nil:
-		return nil, "", fmt.Errorf("cannot read token file located at %s: %w", fname, err)
+// unsafeString returns a string that shares memory with b. b must never be modified afterwards.
+func unsafeString(b []byte) string {
+	if len(b) == 0 {
+		return ""
 	}
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
+
+// ReadTokenFile reads the token file at path as discovery does. It returns the first line of the file that is neither
+// blank nor a comment starting with #, with surrounding whitespace and any leading UTF-8 byte order mark removed. If
+// the file has no such line, the returned error wraps ErrEmptyToken; if the token contains a NUL byte, the returned
+// error wraps ErrMalformedToken; if the file cannot be read because of its permissions, the returned error wraps
+// ErrPermissionDenied; if the file starts with a PEM header, as certificates and proxies do, the returned error wraps
+// ErrLooksLikeCertificate.
+func ReadTokenFile(ctx context.Context, path string) ([]byte, error) {
+	return defaultDiscoverer.ReadTokenFile(ctx, path)
+}
 
-	return tok, fname, nil
+// ReadTokenFile reads the token file at path as discovery would, applying the settings of d. Like the package-level
+// ReadTokenFile, it returns the first line of the file that is neither blank nor a comment starting with #, or the
+// access_token of a JSON token response, unless changed by WithWholeFileContents, WithRawContents or
+// WithoutTokenResponseExtraction. If there is no token, the returned error wraps ErrEmptyToken. Under the
+// PermissionsReject policy, a file whose mode grants access to other users fails with an error wrapping
+// ErrInsecurePermissions.
+func (d *Discoverer) ReadTokenFile(ctx context.Context, path string) ([]byte, error) {
+	return d.readTokenFile(ctx, path, true)
 }
 
-func readTokenFile(path string) ([]byte, error) {
-	tok, err := os.ReadFile(path)
+// readTokenFile is like ReadTokenFile, but if followSymlinks is false, fails with an error wrapping ErrSymlinkRejected
+// if path names a symlink
+func (d *Discoverer) readTokenFile(ctx context.Context, path string, followSymlinks bool) ([]byte, error) {
+	d.debug("reading token file", "path", path)
+	tok, err := d.readFile(ctx, path, followSymlinks)
+	if errors.Is(err, fs.ErrPermission) {
+		return nil, fmt.Errorf("%w: %w", ErrPermissionDenied, err)
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	retTok := normalizeTokenFile(tok)
+	if isPEM(retTok) {
+		return nil, fmt.Errorf("%s: %w", path, ErrLooksLikeCertificate)
+	}
+	var fromResponse bool
+	if !d.keepTokenResponse && !d.rawContents {
+		var accessToken []byte
+		if accessToken, fromResponse = accessTokenFromResponse(retTok); fromResponse {
+			retTok = accessToken
+			addWarning(ctx, "used access_token from JSON token response in %s", path)
+		}
+	}
+	if !fromResponse && !d.wholeFile && !d.rawContents {
+		retTok = firstTokenLine(retTok)
+	}
+	if i := bytes.IndexByte(retTok, 0); i >= 0 {
+		return nil, fmt.Errorf("%w: %s contains a NUL byte at offset %d", ErrMalformedToken, path, i)
+	}
+
 	// Handle empty token case
-	retTok := bytes.TrimSpace(tok)
 	if len(retTok) == 0 {
-		return nil, errEmptyToken
+		return nil, fmt.Errorf("%s: %w", path, ErrEmptyToken)
+	}
+	if err := d.checkPermissions(path); err != nil {
+		return nil, err
 	}
 
+	if d.rawContents {
+		return tok, nil
+	}
+	if !bytes.Equal(retTok, bytes.TrimSpace(tok)) {
+		markRewritten(ctx)
+	}
 	return retTok, nil
 }
 
-var (
-	errEmptyToken = errors.New("token file has no data")
-	errReadToken  = errors.New("cannot read token file")
-)
+// normalizeTokenFile returns the contents of a token file with surrounding whitespace removed, and line endings
+// normalized by normalizeLineEndings
+func normalizeTokenFile(tok []byte) []byte {
+	return bytes.TrimSpace(normalizeLineEndings(tok))
+}
+
+// normalizeLineEndings returns the contents of a token file with any leading byte order mark removed, and CRLF and CR
+// line endings replaced by LF, since editors on Windows may add both
+func normalizeLineEndings(tok []byte) []byte {
+	tok = bytes.TrimPrefix(tok, utf8BOM)
+	if bytes.IndexByte(tok, '\r') >= 0 {
+		tok = bytes.ReplaceAll(bytes.ReplaceAll(tok, []byte("\r\n"), []byte("\n")), []byte("\r"), []byte("\n"))
+	}
+	return tok
+}
+
+// isPEM reports whether contents starts with a PEM header line, such as -----BEGIN CERTIFICATE-----
+func isPEM(contents []byte) bool {
+	const begin, end = "-----BEGIN ", "-----"
+	line, _, _ := bytes.Cut(contents, []byte("\n"))
+	line = bytes.TrimSpace(line)
+	if !bytes.HasPrefix(line, []byte(begin)) || !bytes.HasSuffix(line, []byte(end)) {
+		return false
+	}
+	label := line[len(begin) : len(line)-len(end)]
+	if len(label) == 0 {
+		return false
+	}
+	for _, b := range label {
+		if (b < 'A' || b > 'Z') && (b < '0' || b > '9') && b != ' ' {
+			return false
+		}
+	}
+	return true
+}
+
+// firstTokenLine returns the first line of tok that is neither blank nor a comment starting with #, with surrounding
+// whitespace removed, or nil if there is none
+func firstTokenLine(tok []byte) []byte {
+	for len(tok) > 0 {
+		var line []byte
+		line, tok, _ = bytes.Cut(tok, []byte("\n"))
+		if line = bytes.TrimSpace(line); len(line) > 0 && line[0] != '#' {
+			return line
+		}
+	}
+	return nil
+}
+
+// utf8BOM is the byte order mark some editors write at the start of UTF-8 files
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+var errReadToken = errors.New("cannot read token file")
@@ -1,13 +1,18 @@
 package tokendiscovery_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/user"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
 )
@@ -19,15 +24,17 @@ func TestFindTokenAndFile(t *testing.T) {
 		t.Error("Could not get current user from OS")
 	}
 	bearerTokenFile := filepath.Join(tokenFileTempDir, "bt_test_file")
-	xdgTokenFile := filepath.Join(tokenFileTempDir, fmt.Sprintf("bt_u%s", curUser.Uid))
-	fallthroughTokenFile := filepath.Join("/tmp", fmt.Sprintf("bt_u%s", curUser.Uid))
+	xdgTokenFile := filepath.Join(tokenFileTempDir, fmt.Sprintf("bt_u%s", disc.UserFileID(curUser)))
+	fallthroughTokenFile := filepath.Join(disc.DefaultFallbackDirectory(), fmt.Sprintf("bt_u%s", disc.UserFileID(curUser)))
 
 	type testCase struct {
-		description  string
-		setupFunc    func(*testing.T)
-		expectedTok  []byte
-		expectedPath string
-		expectedErr  error
+		description    string
+		setupFunc      func(*testing.T)
+		expectedTok    []byte
+		expectedPath   string
+		expectedSource disc.Source
+		expectedErr    error
+		expectedCause  error
 	}
 
 	testCases := []testCase{
@@ -38,6 +45,8 @@ func TestFindTokenAndFile(t *testing.T) {
 			},
 			[]byte("42"),
 			"",
+			disc.SourceBearerTokenEnv,
+			nil,
 			nil,
 		},
 		{
@@ -47,6 +56,8 @@ func TestFindTokenAndFile(t *testing.T) {
 			},
 			[]byte("4 2"),
 			"",
+			disc.SourceBearerTokenEnv,
+			nil,
 			nil,
 		},
 		{
@@ -58,6 +69,8 @@ func TestFindTokenAndFile(t *testing.T) {
 			},
 			[]byte("abcde"),
 			fallthroughTokenFile,
+			disc.SourceTmpFallback,
+			nil,
 			nil,
 		},
 		{
@@ -68,6 +81,8 @@ func TestFindTokenAndFile(t *testing.T) {
 			},
 			[]byte("12345"),
 			bearerTokenFile,
+			disc.SourceBearerTokenFile,
+			nil,
 			nil,
 		},
 		{
@@ -78,6 +93,8 @@ func TestFindTokenAndFile(t *testing.T) {
 			},
 			[]byte("12  345"),
 			bearerTokenFile,
+			disc.SourceBearerTokenFile,
+			nil,
 			nil,
 		},
 		{
@@ -88,7 +105,9 @@ func TestFindTokenAndFile(t *testing.T) {
 			},
 			nil,
 			"",
-			errors.New("value for BEARER_TOKEN_FILE is set but the file does not exist on the filesystem"),
+			disc.SourceUnknown,
+			disc.ErrBearerTokenFileMissing,
+			fs.ErrNotExist,
 		},
 		{
 			"BEARER_TOKEN_FILE defined, but empty - should fall through",
@@ -100,6 +119,8 @@ func TestFindTokenAndFile(t *testing.T) {
 			},
 			[]byte("btf_fallthrough"),
 			fallthroughTokenFile,
+			disc.SourceTmpFallback,
+			nil,
 			nil,
 		},
 		{
@@ -110,6 +131,8 @@ func TestFindTokenAndFile(t *testing.T) {
 			},
 			[]byte("54321"),
 			xdgTokenFile,
+			disc.SourceXDGRuntimeDir,
+			nil,
 			nil,
 		},
 		{
@@ -120,6 +143,8 @@ func TestFindTokenAndFile(t *testing.T) {
 			},
 			[]byte("543 21"),
 			xdgTokenFile,
+			disc.SourceXDGRuntimeDir,
+			nil,
 			nil,
 		},
 		{
@@ -130,13 +155,15 @@ func TestFindTokenAndFile(t *testing.T) {
 			},
 			nil,
 			"",
-			errors.New("XDG_RUNTIME_DIR is set but the token file does not exist on the filesystem"),
+			disc.SourceUnknown,
+			disc.ErrXDGTokenFileMissing,
+			fs.ErrNotExist,
 		},
 		{
 			"XDG_RUNTIME_DIR defined, token file is empty - should move to next case",
 			func(t *testing.T) {
 				tempDir3 := t.TempDir()
-				fname := filepath.Join(tempDir3, fmt.Sprintf("bt_u%s", curUser.Uid))
+				fname := filepath.Join(tempDir3, fmt.Sprintf("bt_u%s", disc.UserFileID(curUser)))
 				os.WriteFile(fname, []byte(""), 0600)
 				os.WriteFile(fallthroughTokenFile, []byte("xdg_fallthrough"), 0600)
 				t.Setenv("XDG_RUNTIME_DIR", tempDir3)
@@ -144,6 +171,8 @@ func TestFindTokenAndFile(t *testing.T) {
 			},
 			[]byte("xdg_fallthrough"),
 			fallthroughTokenFile,
+			disc.SourceTmpFallback,
+			nil,
 			nil,
 		},
 		{
@@ -154,6 +183,8 @@ func TestFindTokenAndFile(t *testing.T) {
 			},
 			[]byte("56789"),
 			fallthroughTokenFile,
+			disc.SourceTmpFallback,
+			nil,
 			nil,
 		},
 		{
@@ -164,6 +195,8 @@ func TestFindTokenAndFile(t *testing.T) {
 			},
 			[]byte("5678 9"),
 			fallthroughTokenFile,
+			disc.SourceTmpFallback,
+			nil,
 			nil,
 		},
 		{
@@ -174,7 +207,9 @@ func TestFindTokenAndFile(t *testing.T) {
 			},
 			nil,
 			"",
-			disc.ErrNoTokenFound,
+			disc.SourceUnknown,
+			disc.ErrEmptyToken,
+			nil,
 		},
 		{
 			"Fallback case, but token isn't there",
@@ -183,28 +218,713 @@ func TestFindTokenAndFile(t *testing.T) {
 			},
 			nil,
 			"",
+			disc.SourceUnknown,
+			disc.ErrNoTokenFound,
+			fs.ErrNotExist,
+		},
+	}
+
+	d, err := disc.New()
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	// Only Discover reports the source of the token, so the other finders are not checked for it
+	finders := []struct {
+		name        string
+		find        func() ([]byte, string, disc.Source, error)
+		checkSource bool
+	}{
+		{"package-level", func() ([]byte, string, disc.Source, error) {
+			tok, path, err := disc.FindTokenAndFile()
+			return tok, path, disc.SourceUnknown, err
+		}, false},
+		{"Discoverer", func() ([]byte, string, disc.Source, error) {
+			tok, path, err := d.FindTokenAndFile()
+			return tok, path, disc.SourceUnknown, err
+		}, false},
+		{"Discover", func() ([]byte, string, disc.Source, error) {
+			res, err := d.Discover()
+			return res.Bytes(), res.Path(), res.Source(), err
+		}, true},
+	}
+
+	for _, finder := range finders {
+		for _, tc := range testCases {
+			t.Run(
+				finder.name+"/"+tc.description,
+				func(t *testing.T) {
+					tc.setupFunc(t)
+					tok, path, source, err := finder.find()
+					if !reflect.DeepEqual(tok, tc.expectedTok) {
+						t.Errorf("Token strings do not match.  Expected %v, got %v", tc.expectedTok, tok)
+					}
+					if path != tc.expectedPath {
+						t.Errorf("Token paths do not match. Expected path %s, got %s", tc.expectedPath, path)
+					}
+					if finder.checkSource && source != tc.expectedSource {
+						t.Errorf("Token sources do not match. Expected source %s, got %s", tc.expectedSource, source)
+					}
+					if !errors.Is(err, tc.expectedErr) {
+						t.Errorf("Got different errors: expected %v, got %v", tc.expectedErr, err)
+					}
+					if tc.expectedErr != nil && !errors.Is(err, disc.ErrNoTokenFound) {
+						t.Errorf("Expected error to wrap %s, got %v", disc.ErrNoTokenFound, err)
+					}
+					if tc.expectedCause != nil && !errors.Is(err, tc.expectedCause) {
+						t.Errorf("Expected error to wrap the underlying cause %v, got %v", tc.expectedCause, err)
+					}
+				},
+			)
+		}
+	}
+}
+
+// blockingFS is an fs.FS whose Open blocks until unblock is closed, simulating a hung network filesystem
+type blockingFS struct{ unblock chan struct{} }
+
+func (b blockingFS) Open(name string) (fs.File, error) {
+	<-b.unblock
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func TestFindTokenAndFileContext(t *testing.T) {
+	unblock := make(chan struct{})
+	t.Cleanup(func() { close(unblock) })
+
+	d, err := disc.New(
+		disc.WithEnvMap(map[string]string{"BEARER_TOKEN_FILE": "/nfs/token"}),
+		disc.WithFS(blockingFS{unblock}),
+		disc.WithUID("1000"),
+	)
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+
+	t.Run(
+		"Deadline exceeded while reading a hung file",
+		func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			tok, _, err := d.FindTokenAndFileContext(ctx)
+			if tok != nil {
+				t.Errorf("Expected nil token, got %v", tok)
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Expected error to wrap %s, got %v", context.DeadlineExceeded, err)
+			}
+			if errors.Is(err, disc.ErrNoTokenFound) {
+				t.Errorf("Expected timeout not to be reported as %s", disc.ErrNoTokenFound)
+			}
+		},
+	)
+	t.Run(
+		"Context already canceled",
+		func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err := d.FindTokenContext(ctx)
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Expected error to wrap %s, got %v", context.Canceled, err)
+			}
+		},
+	)
+	t.Run(
+		"Package-level function with a live context",
+		func(t *testing.T) {
+			t.Setenv("BEARER_TOKEN", "42")
+			tok, err := disc.FindTokenContext(context.Background())
+			if err != nil {
+				t.Errorf("Expected nil error, got %s", err)
+			}
+			if string(tok) != "42" {
+				t.Errorf("Expected token 42, got %s", tok)
+			}
+		},
+	)
+}
+
+func TestFindTokenString(t *testing.T) {
+	tempDir := t.TempDir()
+	tokenFile := filepath.Join(tempDir, "bt_test_file")
+	if err := os.WriteFile(tokenFile, []byte("  abc.def.ghi\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	d, err := disc.New(disc.WithEnvMap(map[string]string{"BEARER_TOKEN_FILE": tokenFile}))
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+
+	tokString, err := d.FindTokenString()
+	if err != nil {
+		t.Fatalf("Expected nil error, got %s", err)
+	}
+	if tokString != "abc.def.ghi" {
+		t.Errorf("Token strings do not match.  Expected abc.def.ghi, got %s", tokString)
+	}
+
+	// Mutating a slice returned by FindToken must not affect the string, or any later discovery
+	tok, err := d.FindToken()
+	if err != nil {
+		t.Fatalf("Expected nil error, got %s", err)
+	}
+	for i := range tok {
+		tok[i] = 'X'
+	}
+	if tokString != "abc.def.ghi" {
+		t.Errorf("Mutating the FindToken result changed an earlier FindTokenString result: got %s", tokString)
+	}
+	tok2, err := d.FindToken()
+	if err != nil {
+		t.Fatalf("Expected nil error, got %s", err)
+	}
+	if string(tok2) != "abc.def.ghi" {
+		t.Errorf("Mutating the FindToken result changed a later result: got %s", tok2)
+	}
+}
+
+func TestReadTokenFileNormalization(t *testing.T) {
+	type testCase struct {
+		description   string
+		contents      string
+		wholeFile     bool
+		expectedToken string
+		expectedErr   error
+	}
+
+	testCases := []testCase{
+		{"Plain token", "eyJ.abc.def\n", false, "eyJ.abc.def", nil},
+		{"Byte order mark", "\xef\xbb\xbfeyJ.abc.def\n", false, "eyJ.abc.def", nil},
+		{"CRLF line ending", "eyJ.abc.def\r\n", false, "eyJ.abc.def", nil},
+		{"Byte order mark and CRLF line ending", "\xef\xbb\xbfeyJ.abc.def\r\n", false, "eyJ.abc.def", nil},
+		{"Interior CRLF and CR", "line1\r\nline2\rline3\r\n", true, "line1\nline2\nline3", nil},
+		{"Byte order mark only", "\xef\xbb\xbf\r\n", false, "", disc.ErrEmptyToken},
+		{"Interior NUL byte", "eyJ.abc\x00.def", false, "", disc.ErrMalformedToken},
+		{"Comment then token", "# written by credmon\n\neyJ.abc.def\n", false, "eyJ.abc.def", nil},
+		{"Token then garbage", "eyJ.abc.def\neyJ.old.token\n", false, "eyJ.abc.def", nil},
+		{"Blank lines only", "\n  \n\t\n", false, "", disc.ErrEmptyToken},
+		{"Comments only", "# no token yet\n", false, "", disc.ErrEmptyToken},
+		{"Whole file", "eyJ.abc.def\n# comment\n", true, "eyJ.abc.def\n# comment", nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := []disc.Option{disc.WithFS(fstest.MapFS{"home/user/token": {Data: []byte(tc.contents)}})}
+				if tc.wholeFile {
+					opts = append(opts, disc.WithWholeFileContents())
+				}
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, err := d.ReadTokenFile(context.Background(), "/home/user/token")
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("Got different errors: expected %v, got %v", tc.expectedErr, err)
+				}
+				if string(tok) != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %q, got %q", tc.expectedToken, string(tok))
+				}
+			},
+		)
+	}
+}
+
+func TestEmptyTokenFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"home/user/empty":        {Data: []byte("")},
+		"home/user/blank":        {Data: []byte(" \n\t")},
+		"run/user/4242/bt_u4242": {Data: []byte("\n")},
+	}
+
+	type testCase struct {
+		description   string
+		env           map[string]string
+		expectedEmpty bool
+	}
+
+	testCases := []testCase{
+		{"BEARER_TOKEN_FILE is empty", map[string]string{"BEARER_TOKEN_FILE": "/home/user/empty"}, true},
+		{"BEARER_TOKEN_FILE only contains whitespace", map[string]string{"BEARER_TOKEN_FILE": "/home/user/blank"}, true},
+		{"XDG_RUNTIME_DIR token file is empty", map[string]string{"XDG_RUNTIME_DIR": "/run/user/4242"}, true},
+		{"BEARER_TOKEN is empty", map[string]string{"BEARER_TOKEN": ""}, false},
+		{"No token anywhere", nil, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				d, err := disc.New(disc.WithEnvMap(tc.env), disc.WithFS(fsys), disc.WithUID("4242"))
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				_, err = d.FindToken()
+				if !errors.Is(err, disc.ErrNoTokenFound) {
+					t.Errorf("Expected error %s, got %v", disc.ErrNoTokenFound, err)
+				}
+				if errors.Is(err, disc.ErrEmptyToken) != tc.expectedEmpty {
+					t.Errorf("Expected errors.Is(err, ErrEmptyToken) to be %t, got error %v", tc.expectedEmpty, err)
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"ReadTokenFile",
+		func(t *testing.T) {
+			emptyFile := filepath.Join(t.TempDir(), "empty")
+			if err := os.WriteFile(emptyFile, []byte("\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := disc.ReadTokenFile(context.Background(), emptyFile); !errors.Is(err, disc.ErrEmptyToken) {
+				t.Errorf("Expected error %s, got %v", disc.ErrEmptyToken, err)
+			}
+			if _, err := disc.ReadTokenFile(context.Background(), emptyFile+".missing"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Expected error %s, got %v", fs.ErrNotExist, err)
+			}
+		},
+	)
+}
+
+func TestMissingTokenFile(t *testing.T) {
+	type testCase struct {
+		description  string
+		env          map[string]string
+		expectedErr  error
+		expectedStep disc.Source
+		expectedPath string
+	}
+
+	testCases := []testCase{
+		{
+			"BEARER_TOKEN_FILE",
+			map[string]string{"BEARER_TOKEN_FILE": "/home/user/missing"},
+			disc.ErrBearerTokenFileMissing,
+			disc.SourceBearerTokenFile,
+			"/home/user/missing",
+		},
+		{
+			"XDG_RUNTIME_DIR",
+			map[string]string{"XDG_RUNTIME_DIR": "/run/user/4242"},
+			disc.ErrXDGTokenFileMissing,
+			disc.SourceXDGRuntimeDir,
+			filepath.Join("/run/user/4242", "bt_u4242"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				d, err := disc.New(disc.WithEnvMap(tc.env), disc.WithFS(fstest.MapFS{}), disc.WithUID("4242"))
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				_, err = d.FindToken()
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("Expected error %s, got %v", tc.expectedErr, err)
+				}
+				if !errors.Is(err, disc.ErrNoTokenFound) {
+					t.Errorf("Expected error %s, got %v", disc.ErrNoTokenFound, err)
+				}
+				if err != nil && !strings.Contains(err.Error(), tc.expectedPath) {
+					t.Errorf("Expected error to name the missing file %s, got %s", tc.expectedPath, err)
+				}
+				var discErr *disc.DiscoveryError
+				if !errors.As(err, &discErr) {
+					t.Fatalf("Expected a *DiscoveryError in the error chain, got %v", err)
+				}
+				if discErr.Step != tc.expectedStep {
+					t.Errorf("DiscoveryError steps do not match. Expected %s, got %s", tc.expectedStep, discErr.Step)
+				}
+				if discErr.Path != tc.expectedPath {
+					t.Errorf("DiscoveryError paths do not match. Expected %s, got %s", tc.expectedPath, discErr.Path)
+				}
+				if !errors.Is(discErr, disc.ErrNoTokenFound) {
+					t.Errorf("Expected DiscoveryError to wrap %s, got %v", disc.ErrNoTokenFound, discErr)
+				}
+			},
+		)
+	}
+
+	if !errors.Is(disc.ErrBearerTokenFileMissing, disc.ErrNoTokenFound) || !errors.Is(disc.ErrXDGTokenFileMissing, disc.ErrNoTokenFound) {
+		t.Errorf("Expected missing token file errors to wrap %s", disc.ErrNoTokenFound)
+	}
+}
+
+// deniedFS is an fstest.MapFS in which the files named in denied cannot be opened for lack of permission
+type deniedFS struct {
+	files  fstest.MapFS
+	denied map[string]bool
+}
+
+func (d deniedFS) Open(name string) (fs.File, error) {
+	if d.denied[name] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return d.files.Open(name)
+}
+
+func TestPermissionDenied(t *testing.T) {
+	fsys := deniedFS{
+		fstest.MapFS{
+			"home/user/token":        {Data: []byte("file_token")},
+			"run/user/4242/bt_u4242": {Data: []byte("xdg_token")},
+			"tmp/bt_u4242":           {Data: []byte("tmp_token")},
+		},
+		map[string]bool{"home/user/token": true, "run/user/4242/bt_u4242": true, "tmp/bt_u4242": true},
+	}
+	readable := fstest.MapFS{"run/user/4242/bt_u4242": {Data: []byte("xdg_token")}}
+
+	type testCase struct {
+		description       string
+		env               map[string]string
+		fsys              fs.FS
+		opts              []disc.Option
+		expectedToken     string
+		expectedNoToken   bool
+		expectedErrorPath string
+	}
+
+	testCases := []testCase{
+		{
+			"Unreadable BEARER_TOKEN_FILE falls through",
+			map[string]string{"BEARER_TOKEN_FILE": "/home/user/token", "XDG_RUNTIME_DIR": "/run/user/4242"},
+			deniedFS{readable, map[string]bool{"home/user/token": true}},
+			nil,
+			"xdg_token",
+			false,
+			"",
+		},
+		{
+			"All token files unreadable",
+			map[string]string{"BEARER_TOKEN_FILE": "/home/user/token", "XDG_RUNTIME_DIR": "/run/user/4242"},
+			fsys,
+			nil,
+			"",
+			true,
+			"/tmp/bt_u4242",
+		},
+		{
+			"Permission errors are fatal",
+			map[string]string{"BEARER_TOKEN_FILE": "/home/user/token", "XDG_RUNTIME_DIR": "/run/user/4242"},
+			deniedFS{readable, map[string]bool{"home/user/token": true}},
+			[]disc.Option{disc.WithFatalPermissionErrors()},
+			"",
+			false,
+			"/home/user/token",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := append([]disc.Option{disc.WithEnvMap(tc.env), disc.WithFS(tc.fsys), disc.WithUID("4242")}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, err := d.FindToken()
+				if tc.expectedErrorPath == "" {
+					if err != nil {
+						t.Fatalf("Expected nil error, got %v", err)
+					}
+					if string(tok) != tc.expectedToken {
+						t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, string(tok))
+					}
+					return
+				}
+				if !errors.Is(err, disc.ErrPermissionDenied) {
+					t.Errorf("Expected error %s, got %v", disc.ErrPermissionDenied, err)
+				}
+				if errors.Is(err, disc.ErrNoTokenFound) != tc.expectedNoToken {
+					t.Errorf("Expected wrapping %s to be %t, got %v", disc.ErrNoTokenFound, tc.expectedNoToken, err)
+				}
+				if err != nil && !strings.Contains(err.Error(), filepath.FromSlash(tc.expectedErrorPath)) {
+					t.Errorf("Expected error to name the unreadable file %s, got %s", tc.expectedErrorPath, err)
+				}
+			},
+		)
+	}
+}
+
+func TestUnusablePaths(t *testing.T) {
+	files := fstest.MapFS{
+		"run/user/4242":      {Data: []byte("not a directory")},
+		"home/user/tokens/a": {Data: []byte("file_token")},
+		"scratch/bt_u4242":   {Data: []byte("tmp_token")},
+		"empty/.placeholder": {Data: []byte{}},
+	}
+
+	type testCase struct {
+		description     string
+		env             map[string]string
+		expectedMessage string
+	}
+
+	testCases := []testCase{
+		{
+			"XDG_RUNTIME_DIR is a file",
+			map[string]string{"XDG_RUNTIME_DIR": "/run/user/4242"},
+			"/run/user/4242 is not a directory",
+		},
+		{
+			"XDG_RUNTIME_DIR is blank",
+			map[string]string{"XDG_RUNTIME_DIR": " \t"},
+			`value " \t" is blank`,
+		},
+		{
+			"XDG_RUNTIME_DIR contains a NUL byte",
+			map[string]string{"XDG_RUNTIME_DIR": "/run/user\x00/4242"},
+			"contains a NUL byte",
+		},
+		{
+			"BEARER_TOKEN_FILE is a directory",
+			map[string]string{"BEARER_TOKEN_FILE": "/home/user/tokens"},
+			"/home/user/tokens is a directory",
+		},
+		{
+			"BEARER_TOKEN_FILE is blank",
+			map[string]string{"BEARER_TOKEN_FILE": "  "},
+			`value "  " is blank`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				d, err := disc.New(disc.WithEnvMap(tc.env), disc.WithFS(files), disc.WithUID("4242"), disc.WithFallbackDir("/scratch"))
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, err := d.FindToken()
+				if err != nil {
+					t.Fatalf("Expected discovery to fall back to the fallback directory, got %v", err)
+				}
+				if string(tok) != "tmp_token" {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", "tmp_token", string(tok))
+				}
+
+				d, err = disc.New(disc.WithEnvMap(tc.env), disc.WithFS(files), disc.WithUID("4242"), disc.WithFallbackDir("/empty"))
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				_, err = d.FindToken()
+				if !errors.Is(err, disc.ErrNoTokenFound) {
+					t.Fatalf("Expected error %s, got %v", disc.ErrNoTokenFound, err)
+				}
+				if !strings.Contains(err.Error(), filepath.FromSlash(tc.expectedMessage)) {
+					t.Errorf("Expected error to mention %q, got %s", tc.expectedMessage, err)
+				}
+			},
+		)
+	}
+}
+
+func TestXDGRuntimeDirIsFile(t *testing.T) {
+	dir := t.TempDir()
+	xdgDir := filepath.Join(dir, "runtime")
+	if err := os.WriteFile(xdgDir, []byte("not a directory"), 0o600); err != nil {
+		t.Fatalf("Could not create file: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bt_u4242"), []byte("tmp_token"), 0o600); err != nil {
+		t.Fatalf("Could not create token file: %s", err)
+	}
+
+	d, err := disc.New(
+		disc.WithEnvMap(map[string]string{"XDG_RUNTIME_DIR": xdgDir}),
+		disc.WithUID("4242"),
+		disc.WithoutOwnershipCheck(),
+		disc.WithFallbackDir(dir),
+	)
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	tok, err := d.FindToken()
+	if err != nil {
+		t.Fatalf("Expected discovery to fall back to the fallback directory, got %v", err)
+	}
+	if string(tok) != "tmp_token" {
+		t.Errorf("Token strings do not match.  Expected %s, got %s", "tmp_token", string(tok))
+	}
+}
+
+func TestNoTokenFoundMessage(t *testing.T) {
+	fsys := fstest.MapFS{
+		"run/user/4242/bt_u4242": {Data: []byte("  \n")},
+	}
+
+	type testCase struct {
+		description string
+		env         map[string]string
+		expected    []string
+	}
+
+	testCases := []testCase{
+		{
+			"Empty environment",
+			nil,
+			[]string{"BEARER_TOKEN: not set", "BEARER_TOKEN_FILE: not set", "XDG_RUNTIME_DIR: not set", "/tmp/bt_u4242"},
+		},
+		{
+			"Empty XDG_RUNTIME_DIR token file",
+			map[string]string{"BEARER_TOKEN": " ", "XDG_RUNTIME_DIR": "/run/user/4242"},
+			[]string{"BEARER_TOKEN: not set", "BEARER_TOKEN_FILE: not set", "/run/user/4242/bt_u4242: token file has no data", "/tmp/bt_u4242"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				d, err := disc.New(disc.WithEnvMap(tc.env), disc.WithFS(fsys), disc.WithUID("4242"))
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				_, err = d.FindToken()
+				if !errors.Is(err, disc.ErrNoTokenFound) {
+					t.Fatalf("Expected error %s, got %v", disc.ErrNoTokenFound, err)
+				}
+				for _, location := range tc.expected {
+					if !strings.Contains(err.Error(), filepath.FromSlash(location)) {
+						t.Errorf("Expected error to mention %q, got %s", location, err)
+					}
+				}
+			},
+		)
+	}
+}
+
+func TestDiscoverAll(t *testing.T) {
+	fsys := fstest.MapFS{
+		"run/user/4242/bt_u4242": {Data: []byte("xdg_token")},
+		"tmp/bt_u4242":           {Data: []byte("tmp_token")},
+		"home/user/empty":        {Data: []byte("\n")},
+	}
+
+	type expected struct {
+		tok    string
+		source disc.Source
+		path   string
+	}
+
+	type testCase struct {
+		description     string
+		env             map[string]string
+		expectedResults []expected
+		expectedErr     error
+		expectFailures  bool
+	}
+
+	testCases := []testCase{
+		{
+			"All sources present",
+			map[string]string{"BEARER_TOKEN": "env_token", "XDG_RUNTIME_DIR": "/run/user/4242"},
+			[]expected{
+				{"env_token", disc.SourceBearerTokenEnv, ""},
+				{"xdg_token", disc.SourceXDGRuntimeDir, "/run/user/4242/bt_u4242"},
+				{"tmp_token", disc.SourceTmpFallback, "/tmp/bt_u4242"},
+			},
+			nil,
+			false,
+		},
+		{
+			"Empty and missing files are recorded",
+			map[string]string{"BEARER_TOKEN_FILE": "/home/user/empty", "XDG_RUNTIME_DIR": "/run/user/missing"},
+			[]expected{
+				{"tmp_token", disc.SourceTmpFallback, "/tmp/bt_u4242"},
+			},
+			nil,
+			true,
+		},
+		{
+			"Nothing found",
+			map[string]string{"BEARER_TOKEN_FILE": "/home/user/empty", "TMPDIR": "/missing"},
+			nil,
 			disc.ErrNoTokenFound,
+			true,
 		},
 	}
+
 	for _, tc := range testCases {
 		t.Run(
 			tc.description,
 			func(t *testing.T) {
-				tc.setupFunc(t)
-				tok, path, err := disc.FindTokenAndFile()
-				if !reflect.DeepEqual(tok, tc.expectedTok) {
-					t.Errorf("Token strings do not match.  Expected %v, got %v", tc.expectedTok, tok)
+				opts := []disc.Option{disc.WithEnvMap(tc.env), disc.WithFS(fsys), disc.WithUID("4242")}
+				if tc.expectedErr != nil {
+					opts = append(opts, disc.WithTMPDIRFallback())
+				}
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				results, err := d.DiscoverAll()
+				if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+					t.Errorf("Expected error %s, got %v", tc.expectedErr, err)
 				}
-				if path != tc.expectedPath {
-					t.Errorf("Token paths do not match. Expected path %s, got %s", tc.expectedPath, path)
+				if tc.expectFailures && err == nil {
+					t.Errorf("Expected error recording the failed steps, got nil")
 				}
-				if tc.expectedErr != nil && err == nil {
-					t.Error("Expected non-nil error, but got nil")
-					if !errors.Is(tc.expectedErr, err) {
-						t.Errorf("Got different errors: expected %s, got %s", tc.expectedErr, err)
+				if !tc.expectFailures && err != nil {
+					t.Errorf("Expected nil error, got %s", err)
+				}
+				if tc.expectFailures && err != nil && !strings.Contains(err.Error(), "/home/user/empty") {
+					t.Errorf("Expected error to mention the empty token file, got %s", err)
+				}
+
+				if len(results) != len(tc.expectedResults) {
+					t.Fatalf("Expected %d results, got %d: %v", len(tc.expectedResults), len(results), results)
+				}
+				for i, res := range results {
+					exp := tc.expectedResults[i]
+					if string(res.Bytes()) != exp.tok {
+						t.Errorf("Token strings do not match for result %d.  Expected %s, got %s", i, exp.tok, res.Bytes())
+					}
+					if res.Source() != exp.source {
+						t.Errorf("Token sources do not match for result %d. Expected source %s, got %s", i, exp.source, res.Source())
+					}
+					if res.Path() != exp.path {
+						t.Errorf("Token paths do not match for result %d. Expected path %s, got %s", i, exp.path, res.Path())
 					}
 				}
 			},
 		)
 	}
 }
+
+func benchmarkDiscoverer(b *testing.B) *disc.Discoverer {
+	tokenFile := filepath.Join(b.TempDir(), "bt_test_file")
+	if err := os.WriteFile(tokenFile, []byte("abc.def.ghi\n"), 0600); err != nil {
+		b.Fatal(err)
+	}
+	d, err := disc.New(disc.WithEnvMap(map[string]string{"BEARER_TOKEN_FILE": tokenFile}))
+	if err != nil {
+		b.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	return d
+}
+
+func BenchmarkFindToken(b *testing.B) {
+	d := benchmarkDiscoverer(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := d.FindToken(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFindTokenString(b *testing.B) {
+	d := benchmarkDiscoverer(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := d.FindTokenString(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package tokendiscovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// GrantTypeTokenExchange is the grant type of RFC 8693 token exchange requests
+const GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// Token type identifiers of RFC 8693, for ExchangeRequest.RequestedTokenType and ExchangeResult.IssuedTokenType
+const (
+	TokenTypeAccessToken  = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeRefreshToken = "urn:ietf:params:oauth:token-type:refresh_token"
+	TokenTypeJWT          = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// ErrInvalidTokenResponse indicates that the token endpoint of an issuer answered a request with a response that is
+// not a valid token response
+var ErrInvalidTokenResponse = errors.New("invalid token response")
+
+// OAuthError is an error response of an OAuth endpoint, such as the token endpoint of an issuer rejecting an exchange
+// with invalid_grant. It wraps ErrUnexpectedStatus.
+type OAuthError struct {
+	// Status is the HTTP status of the response, such as 400 Bad Request
+	Status string
+	// Code is the error code, such as invalid_grant or invalid_scope
+	Code string
+	// Description is the error_description of the response, if any
+	Description string
+	// URI is the error_uri of the response, if any
+	URI string
+}
+
+func (e *OAuthError) Error() string {
+	msg := fmt.Sprintf("%s: %s: %s", ErrUnexpectedStatus, e.Status, e.Code)
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	return msg
+}
+
+func (e *OAuthError) Unwrap() error { return ErrUnexpectedStatus }
+
+// oauthErrorFrom returns the OAuth error response in the body of resp, or nil if it has none
+func oauthErrorFrom(resp *http.Response) *OAuthError {
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxMetadataSize))
+	if err != nil {
+		return nil
+	}
+	var body struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+		ErrorURI         string `json:"error_uri"`
+	}
+	if json.Unmarshal(data, &body) != nil || body.Error == "" {
+		return nil
+	}
+	return &OAuthError{Status: resp.Status, Code: body.Error, Description: body.ErrorDescription, URI: body.ErrorURI}
+}
+
+// ExchangeRequest describes the token Exchange asks for
+type ExchangeRequest struct {
+	// Audience is the service the new token is for, if it is to be restricted to one
+	Audience string
+	// Scopes are the scopes of the new token, which must not exceed those of the subject token, such as
+	// storage.read:/data to downscope a token with storage.read:/. If empty, the issuer decides.
+	Scopes []string
+	// RequestedTokenType is the type of the new token, such as TokenTypeRefreshToken, or the choice of the issuer if
+	// empty
+	RequestedTokenType string
+	// Client identifies the client to the token endpoint, if its ID is set
+	Client ClientCredentials
+	// HTTPClient is used for the request, or http.DefaultClient if it is nil
+	HTTPClient *http.Client
+}
+
+// ExchangeResult is the token response of a successful Exchange. Formatting it does not reveal the token.
+type ExchangeResult struct {
+	AccessToken     []byte
+	IssuedTokenType string
+	// TokenType is how the token is used, normally Bearer
+	TokenType string
+	// ExpiresIn is how long the token is valid after it was issued, or 0 if the issuer does not say
+	ExpiresIn time.Duration
+	// Scope holds the scopes of the token, if they differ from those requested
+	Scope []string
+}
+
+// String describes r without revealing the token
+func (r ExchangeResult) String() string {
+	return fmt.Sprintf("%s token (%s), expires in %s", r.TokenType, r.IssuedTokenType, r.ExpiresIn)
+}
+
+// GoString implements fmt.GoStringer so that formatting an ExchangeResult with %#v does not reveal the token
+func (r ExchangeResult) GoString() string {
+	return fmt.Sprintf("tokendiscovery.ExchangeResult{IssuedTokenType: %q, TokenType: %q, ExpiresIn: %s, Scope: %q}",
+		r.IssuedTokenType, r.TokenType, r.ExpiresIn, r.Scope)
+}
+
+// Exchange trades subjectToken, an access token such as one found by discovery, for a new one described by req, with
+// the RFC 8693 token exchange grant at tokenEndpoint, which can be found in the IssuerMetadata of the issuer. This is
+// typically used to downscope a broad token before handing it to another service, such as a transfer agent. If the
+// issuer rejects the exchange, the returned error is an *OAuthError, which gives the reason, such as invalid_grant; if
+// the request fails, the returned error wraps ErrIssuerUnreachable; and if the response is not a valid token
+// response, ErrInvalidTokenResponse. Tokens never appear in errors.
+func Exchange(ctx context.Context, tokenEndpoint string, subjectToken []byte, req ExchangeRequest) (ExchangeResult,
+	error) {
+	form := url.Values{
+		"grant_type":         {GrantTypeTokenExchange},
+		"subject_token":      {string(bytes.TrimSpace(subjectToken))},
+		"subject_token_type": {TokenTypeAccessToken},
+	}
+	if req.Audience != "" {
+		form.Set("audience", req.Audience)
+	}
+	if len(req.Scopes) > 0 {
+		form.Set("scope", strings.Join(req.Scopes, " "))
+	}
+	if req.RequestedTokenType != "" {
+		form.Set("requested_token_type", req.RequestedTokenType)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return ExchangeResult{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpReq.Header.Set("Accept", "application/json")
+	if req.Client.ID != "" {
+		// RFC 6749 requires the credentials to be form-encoded before they are combined
+		httpReq.SetBasicAuth(url.QueryEscape(req.Client.ID), url.QueryEscape(req.Client.Secret))
+	}
+	client := req.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	data, err := do(client, httpReq)
+	if err != nil {
+		return ExchangeResult{}, err
+	}
+
+	var resp struct {
+		AccessToken     string      `json:"access_token"`
+		IssuedTokenType string      `json:"issued_token_type"`
+		TokenType       string      `json:"token_type"`
+		ExpiresIn       json.Number `json:"expires_in"`
+		Scope           string      `json:"scope"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return ExchangeResult{}, fmt.Errorf("%w from %s: %w", ErrInvalidTokenResponse, httpReq.URL.Redacted(), err)
+	}
+	if resp.AccessToken == "" {
+		return ExchangeResult{}, fmt.Errorf("%w from %s: no access_token", ErrInvalidTokenResponse,
+			httpReq.URL.Redacted())
+	}
+	res := ExchangeResult{
+		AccessToken:     []byte(resp.AccessToken),
+		IssuedTokenType: resp.IssuedTokenType,
+		TokenType:       resp.TokenType,
+		Scope:           strings.Fields(resp.Scope),
+	}
+	if resp.ExpiresIn != "" {
+		secs, err := resp.ExpiresIn.Int64()
+		if err != nil || secs < 0 || secs > math.MaxInt64/int64(time.Second) {
+			return ExchangeResult{}, fmt.Errorf("%w from %s: invalid expires_in %s", ErrInvalidTokenResponse,
+				httpReq.URL.Redacted(), resp.ExpiresIn)
+		}
+		res.ExpiresIn = time.Duration(secs) * time.Second
+	}
+	return res, nil
+}
@@ -0,0 +1,126 @@
+package tokendiscovery_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestExchange(t *testing.T) {
+	const subjectToken = "eyJhbGciOiJub25lIn0.eyJzdWIiOiJ1c2VyIn0.c2ln"
+	// responses holds the token response for each audience requested
+	responses := map[string]struct {
+		status int
+		body   string
+	}{
+		"https://fts.example": {http.StatusOK, `{"access_token":"downscoped","issued_token_type":"` +
+			disc.TokenTypeAccessToken + `","token_type":"Bearer","expires_in":1200,"scope":"storage.read:/data"}`},
+		"https://denied.example":    {http.StatusBadRequest, `{"error":"invalid_grant","error_description":"subject token expired"}`},
+		"https://html.example":      {http.StatusOK, `<html>login</html>`},
+		"https://notoken.example":   {http.StatusOK, `{"token_type":"Bearer"}`},
+		"https://badexpiry.example": {http.StatusOK, `{"access_token":"downscoped","expires_in":-5}`},
+		"https://broken.example":    {http.StatusInternalServerError, `<html>oops</html>`},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "transfer-client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error":"invalid_client"}`)
+			return
+		}
+		if r.PostFormValue("grant_type") != disc.GrantTypeTokenExchange ||
+			r.PostFormValue("subject_token") != subjectToken ||
+			r.PostFormValue("subject_token_type") != disc.TokenTypeAccessToken ||
+			r.PostFormValue("scope") != "storage.read:/data compute.read" ||
+			r.PostFormValue("requested_token_type") != disc.TokenTypeAccessToken {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"invalid_request"}`)
+			return
+		}
+		resp := responses[r.PostFormValue("audience")]
+		w.WriteHeader(resp.status)
+		io.WriteString(w, resp.body)
+	}))
+	t.Cleanup(srv.Close)
+
+	request := func(audience string) disc.ExchangeRequest {
+		return disc.ExchangeRequest{
+			Audience:           audience,
+			Scopes:             []string{"storage.read:/data", "compute.read"},
+			RequestedTokenType: disc.TokenTypeAccessToken,
+			Client:             disc.ClientCredentials{ID: "transfer-client", Secret: "secret"},
+			HTTPClient:         srv.Client(),
+		}
+	}
+
+	type testCase struct {
+		description string
+		req         disc.ExchangeRequest
+		expectedErr error
+		oauthCode   string
+	}
+
+	unauthorized := request("https://fts.example")
+	unauthorized.Client.Secret = "wrong"
+	testCases := []testCase{
+		{"Success", request("https://fts.example"), nil, ""},
+		{"Invalid grant", request("https://denied.example"), disc.ErrUnexpectedStatus, "invalid_grant"},
+		{"Invalid client", unauthorized, disc.ErrUnexpectedStatus, "invalid_client"},
+		{"Not JSON", request("https://html.example"), disc.ErrInvalidTokenResponse, ""},
+		{"No access token", request("https://notoken.example"), disc.ErrInvalidTokenResponse, ""},
+		{"Negative expiry", request("https://badexpiry.example"), disc.ErrInvalidTokenResponse, ""},
+		{"Server error", request("https://broken.example"), disc.ErrUnexpectedStatus, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				res, err := disc.Exchange(context.Background(), srv.URL, []byte(subjectToken+"\n"), tc.req)
+				if !errors.Is(err, tc.expectedErr) {
+					t.Fatalf("Errors do not match.  Expected %v, got %v", tc.expectedErr, err)
+				}
+				var oauthErr *disc.OAuthError
+				if errors.As(err, &oauthErr) != (tc.oauthCode != "") {
+					t.Fatalf("Expected OAuth error %q, got %v", tc.oauthCode, err)
+				}
+				if oauthErr != nil && oauthErr.Code != tc.oauthCode {
+					t.Errorf("OAuth error codes do not match.  Expected %s, got %s", tc.oauthCode, oauthErr.Code)
+				}
+				if err != nil {
+					if strings.Contains(err.Error(), subjectToken) {
+						t.Errorf("Error contains the token: %s", err)
+					}
+					return
+				}
+				if string(res.AccessToken) != "downscoped" {
+					t.Errorf("Token strings do not match.  Expected downscoped, got %s", res.AccessToken)
+				}
+				if res.IssuedTokenType != disc.TokenTypeAccessToken || res.TokenType != "Bearer" {
+					t.Errorf("Token types do not match.  Expected %s and Bearer, got %s and %s", disc.TokenTypeAccessToken,
+						res.IssuedTokenType, res.TokenType)
+				}
+				if res.ExpiresIn != 20*time.Minute {
+					t.Errorf("Lifetimes do not match.  Expected %s, got %s", 20*time.Minute, res.ExpiresIn)
+				}
+				if !slices.Equal(res.Scope, []string{"storage.read:/data"}) {
+					t.Errorf("Scopes do not match.  Expected [storage.read:/data], got %q", res.Scope)
+				}
+				for _, rendered := range []string{fmt.Sprint(res), fmt.Sprintf("%#v", res)} {
+					if strings.Contains(rendered, "downscoped") {
+						t.Errorf("Formatted result contains the token: %s", rendered)
+					}
+				}
+			},
+		)
+	}
+}
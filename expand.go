@@ -0,0 +1,83 @@
+package tokendiscovery
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUndefinedVariable indicates that a path could not be expanded as described for WithPathExpansion because it
+// refers to an environment variable that is not set
+var ErrUndefinedVariable = errors.New("path refers to an undefined environment variable")
+
+// WithPathExpansion makes step 2 of the discovery procedure expand the value of BEARER_TOKEN_FILE as a shell would, for
+// values set where the shell does not expand them, such as inside quotes. A leading ~/ is replaced with the home
+// directory of the target user, and $VAR and ${VAR} are replaced with the values of the environment variables, taken
+// from the same source as BEARER_TOKEN_FILE. If a variable is not set, the step fails with an error wrapping
+// ErrUndefinedVariable that names it, and discovery continues with the next step.
+func WithPathExpansion() Option {
+	return func(d *Discoverer) error {
+		d.expandPaths = true
+		return nil
+	}
+}
+
+// expandPath expands val as described for WithPathExpansion
+func (d *Discoverer) expandPath(val string, env Environ) (string, error) {
+	var home string
+	if rest, ok := cutTilde(val); ok {
+		var err error
+		if home, err = d.homeDir(env); err != nil {
+			return "", fmt.Errorf("cannot expand ~ in %q: %w", val, err)
+		}
+		val = rest
+	}
+
+	var undefined []string
+	expanded := os.Expand(val, func(key string) string {
+		v, ok := env(key)
+		if !ok {
+			undefined = append(undefined, key)
+		}
+		return v
+	})
+	if len(undefined) > 0 {
+		return "", fmt.Errorf("%w: cannot expand %q: %s not set", ErrUndefinedVariable, val, strings.Join(undefined, ", "))
+	}
+	if home != "" {
+		expanded = filepath.Join(home, expanded)
+	}
+	return expanded, nil
+}
+
+// cutTilde returns path without its leading ~ and path separator, and reports whether path started with them or was
+// just ~
+func cutTilde(path string) (string, bool) {
+	if path == "~" {
+		return "", true
+	}
+	if len(path) < 2 || path[0] != '~' || !os.IsPathSeparator(path[1]) {
+		return path, false
+	}
+	return path[2:], true
+}
+
+// homeDir returns the home directory of the target user: from HOME if the target is the current user, or from the user
+// database
+func (d *Discoverer) homeDir(env Environ) (string, error) {
+	if d.uid == "" {
+		if home := lookupValue(env, "HOME"); home != "" {
+			return home, nil
+		}
+	}
+	home, err := d.lookupHome(d.uid)
+	if err != nil {
+		return "", err
+	}
+	if home == "" {
+		return "", errors.New("home directory is not known")
+	}
+	return home, nil
+}
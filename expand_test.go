@@ -0,0 +1,144 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"os/user"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestPathExpansion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"home/user/tokens/bt":     {Data: []byte("home_token")},
+		"home/other/tokens/bt":    {Data: []byte("other_token")},
+		"data/exp/tokens/prod/bt": {Data: []byte("nested_token")},
+		"tmp/bt_u4242":            {Data: []byte("tmp_token")},
+	}
+	homes := map[string]string{"4242": "/home/other"}
+	lookupHome := func(uid string) (string, error) {
+		if home, ok := homes[uid]; ok {
+			return home, nil
+		}
+		return "", errors.New("unknown user")
+	}
+
+	type testCase struct {
+		description   string
+		env           map[string]string
+		expand        bool
+		opts          []disc.Option
+		expectedToken string
+		expectedPath  string
+		expectedErr   string
+	}
+
+	testCases := []testCase{
+		{
+			"Tilde resolves against HOME",
+			map[string]string{"BEARER_TOKEN_FILE": "~/tokens/bt", "HOME": "/home/user"},
+			true,
+			nil,
+			"home_token",
+			"/home/user/tokens/bt",
+			"",
+		},
+		{
+			"Tilde resolves against the home directory of the target user",
+			map[string]string{"BEARER_TOKEN_FILE": "~/tokens/bt", "HOME": "/home/user"},
+			true,
+			[]disc.Option{disc.WithUID("4242")},
+			"other_token",
+			"/home/other/tokens/bt",
+			"",
+		},
+		{
+			"HOME variable",
+			map[string]string{"BEARER_TOKEN_FILE": "$HOME/tokens/bt", "HOME": "/home/user"},
+			true,
+			nil,
+			"home_token",
+			"/home/user/tokens/bt",
+			"",
+		},
+		{
+			"Several variables, with and without braces",
+			map[string]string{"BEARER_TOKEN_FILE": "${EXP_DATA}/tokens/$STAGE/bt", "EXP_DATA": "/data/exp", "STAGE": "prod"},
+			true,
+			nil,
+			"nested_token",
+			"/data/exp/tokens/prod/bt",
+			"",
+		},
+		{
+			"Undefined variable",
+			map[string]string{"BEARER_TOKEN_FILE": "${EXP_DATA}/tokens/$STAGE/bt", "EXP_DATA": "/data/exp"},
+			true,
+			nil,
+			"tmp_token",
+			"/tmp/bt_u4242",
+			"",
+		},
+		{
+			"Undefined variable with strict spec",
+			map[string]string{"BEARER_TOKEN_FILE": "$TOKEN_DIR/bt"},
+			true,
+			[]disc.Option{disc.WithStrictSpec()},
+			"",
+			"",
+			"TOKEN_DIR not set",
+		},
+		{
+			"No expansion without WithPathExpansion",
+			map[string]string{"BEARER_TOKEN_FILE": "~/tokens/bt", "HOME": "/home/user"},
+			false,
+			nil,
+			"",
+			"",
+			"~/tokens/bt",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := []disc.Option{
+					disc.WithEnvMap(tc.env),
+					disc.WithFS(fsys),
+					disc.WithUserLookup(func() (*user.User, error) { return &user.User{Uid: "4242"}, nil }),
+					disc.WithHomeLookup(lookupHome),
+				}
+				if tc.expand {
+					opts = append(opts, disc.WithPathExpansion())
+				}
+				opts = append(opts, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				res, err := d.Discover()
+				if tc.expectedToken == "" {
+					if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+						t.Errorf("Expected error containing %q, got %v", tc.expectedErr, err)
+					}
+					if tc.expand && !errors.Is(err, disc.ErrUndefinedVariable) {
+						t.Errorf("Expected error %s, got %v", disc.ErrUndefinedVariable, err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if string(res.Bytes()) != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, res.Bytes())
+				}
+				if res.Path() != tc.expectedPath {
+					t.Errorf("Token paths do not match. Expected path %s, got %s", tc.expectedPath, res.Path())
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,153 @@
+package tokendiscovery
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTokenExpired indicates that a token was skipped by a Discoverer configured with WithSkipExpired because it has
+// expired
+var ErrTokenExpired = errors.New("token has expired")
+
+// ErrAllTokensExpired indicates that a Discoverer configured with WithSkipExpired found no token other than expired
+// ones. The error returned by discovery in that case wraps both it and ErrNoTokenFound.
+var ErrAllTokensExpired = errors.New("all tokens found have expired")
+
+// ErrTokenNotYetValid indicates that the nbf claim of a token is in the future
+var ErrTokenNotYetValid = errors.New("token is not yet valid")
+
+// ErrIssuedInFuture indicates that the iat claim of a token is in the future
+var ErrIssuedInFuture = errors.New("token is issued in the future")
+
+// ErrTokenLifetimeTooShort indicates that a token was skipped by a Discoverer configured with WithMinimumLifetime
+// because it expires too soon. If no token qualifies, the error returned by discovery wraps both it and
+// ErrNoTokenFound.
+var ErrTokenLifetimeTooShort = errors.New("token lifetime is too short")
+
+// WithSkipExpired makes discovery skip tokens that have expired according to their exp claim, allowing for the leeway
+// set with WithLeeway, as if they were empty, and continue with the next step, so that a stale BEARER_TOKEN does not
+// shadow a fresh token file. Tokens are NOT verified, as described for ParseClaims, and tokens whose expiry is not
+// known, such as those that are not JWTs, are never skipped. Each skipped token is recorded in the warnings of the
+// Result eventually found, or in the returned error if none is.
+func WithSkipExpired() Option {
+	return func(d *Discoverer) error {
+		d.skipExpired = true
+		return nil
+	}
+}
+
+// WithMinimumLifetime makes discovery skip tokens that expire less than min from now according to their exp claim,
+// allowing for the leeway set with WithLeeway, in the same way as WithSkipExpired, so that long-running jobs do not
+// start with a token about to expire. allowUnknown sets whether tokens whose expiry is not known, such as those that
+// are not JWTs, are accepted or skipped.
+func WithMinimumLifetime(min time.Duration, allowUnknown bool) Option {
+	return func(d *Discoverer) error {
+		if min <= 0 {
+			return fmt.Errorf("%w: minimum lifetime must be positive", ErrInvalidOption)
+		}
+		d.minLifetime = min
+		d.allowUnknownExpiry = allowUnknown
+		return nil
+	}
+}
+
+// CheckValidity returns an error wrapping ErrTokenExpired if tok, a JWT, has expired at now according to its exp claim,
+// one wrapping ErrTokenNotYetValid if its nbf claim is after now, or one wrapping ErrIssuedInFuture if its iat claim is
+// after now, tolerating clock skew of up to leeway in each case. Claims that are missing, and tokens that are not JWTs,
+// are not checked. The token is NOT verified, as described for ParseClaims.
+func CheckValidity(tok []byte, now time.Time, leeway time.Duration) error {
+	claims, err := parseClaimsCached(tok)
+	if err != nil {
+		return nil
+	}
+	return claims.checkTimes(now, leeway)
+}
+
+// checkTimes checks the exp, nbf and iat claims of c as described for CheckValidity
+func (c Claims) checkTimes(now time.Time, leeway time.Duration) error {
+	if exp, ok := c.Expiry(); ok && !exp.Add(leeway).After(now) {
+		return fmt.Errorf("%w at %s", ErrTokenExpired, exp.UTC().Format(time.RFC3339))
+	}
+	if nbf, ok := c.NotBefore(); ok && nbf.Add(-leeway).After(now) {
+		return fmt.Errorf("%w until %s", ErrTokenNotYetValid, nbf.UTC().Format(time.RFC3339))
+	}
+	if iat, ok := c.IssuedAt(); ok && iat.Add(-leeway).After(now) {
+		return fmt.Errorf("%w: issued at %s", ErrIssuedInFuture, iat.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// CheckValidity is like the package-level CheckValidity, using the clock set with WithClock and the leeway set with
+// WithLeeway
+func (d *Discoverer) CheckValidity(tok []byte) error {
+	return CheckValidity(tok, d.now(), d.clockLeeway())
+}
+
+// lifetimeError records that a token was skipped because its remaining lifetime is shorter than required
+type lifetimeError struct {
+	remaining time.Duration
+	min       time.Duration
+	unknown   bool
+}
+
+func (e *lifetimeError) Error() string {
+	if e.unknown {
+		return fmt.Sprintf("%s: %s", ErrTokenLifetimeTooShort, ErrExpiryUnknown)
+	}
+	return fmt.Sprintf("%s: %s remaining, %s required", ErrTokenLifetimeTooShort, e.remaining.Round(time.Second), e.min)
+}
+
+func (e *lifetimeError) Unwrap() []error {
+	if e.unknown {
+		return []error{ErrTokenLifetimeTooShort, ErrExpiryUnknown}
+	}
+	return []error{ErrTokenLifetimeTooShort}
+}
+
+// checkExpiry returns an error wrapping ErrTokenExpired or ErrTokenLifetimeTooShort if tok should be skipped according
+// to WithSkipExpired or WithMinimumLifetime
+func (d *Discoverer) checkExpiry(tok []byte) error {
+	if !d.skipExpired && d.minLifetime == 0 {
+		return nil
+	}
+	exp, ok := tokenExpiry(tok)
+	if !ok {
+		if d.minLifetime > 0 && !d.allowUnknownExpiry {
+			return &lifetimeError{min: d.minLifetime, unknown: true}
+		}
+		return nil
+	}
+	now := d.now()
+	if d.skipExpired && !exp.Add(d.clockLeeway()).After(now) {
+		return fmt.Errorf("%w at %s", ErrTokenExpired, exp.UTC().Format(time.RFC3339))
+	}
+	if remaining := exp.Sub(now); remaining+d.clockLeeway() < d.minLifetime {
+		return &lifetimeError{remaining: remaining, min: d.minLifetime}
+	}
+	return nil
+}
+
+// rejectedTokensError returns the error summarizing why the tokens in rejected skipped by checkExpiry were skipped, for
+// discovery to return when no token qualified. It returns nil if no token was skipped for its expiry.
+func rejectedTokensError(rejected []error) error {
+	var best *lifetimeError
+	var expired bool
+	for _, err := range rejected {
+		expired = expired || errors.Is(err, ErrTokenExpired)
+		var lerr *lifetimeError
+		if errors.As(err, &lerr) && (best == nil || best.unknown || !lerr.unknown && lerr.remaining > best.remaining) {
+			best = lerr
+		}
+	}
+	switch {
+	case best != nil && best.unknown:
+		return fmt.Errorf("%w: no token with a known expiry was found", ErrTokenLifetimeTooShort)
+	case best != nil:
+		return fmt.Errorf("%w: the longest remaining lifetime found was %s, but %s is required", ErrTokenLifetimeTooShort,
+			best.remaining.Round(time.Second), best.min)
+	case expired:
+		return ErrAllTokensExpired
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestSkipExpired(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	expired := makeJWT(t, map[string]any{"exp": now.Add(-time.Hour).Unix()})
+	valid := makeJWT(t, map[string]any{"exp": now.Add(time.Hour).Unix()})
+
+	type testCase struct {
+		description      string
+		env              map[string]string
+		files            fstest.MapFS
+		expectedToken    string
+		expectedWarnings int
+		expectedErr      error
+	}
+
+	testCases := []testCase{
+		{
+			"Expired env token, valid file token",
+			map[string]string{"BEARER_TOKEN": expired, "BEARER_TOKEN_FILE": "/home/user/token"},
+			fstest.MapFS{"home/user/token": {Data: []byte(valid + "\n")}},
+			valid,
+			1,
+			nil,
+		},
+		{
+			"Valid env token",
+			map[string]string{"BEARER_TOKEN": valid},
+			nil,
+			valid,
+			0,
+			nil,
+		},
+		{
+			"Opaque token is never skipped",
+			map[string]string{"BEARER_TOKEN": "opaque_token"},
+			nil,
+			"opaque_token",
+			0,
+			nil,
+		},
+		{
+			"All tokens expired",
+			map[string]string{"BEARER_TOKEN": expired, "BEARER_TOKEN_FILE": "/home/user/token"},
+			fstest.MapFS{"home/user/token": {Data: []byte(expired + "\n")}},
+			"",
+			0,
+			disc.ErrAllTokensExpired,
+		},
+		{
+			"No token at all",
+			map[string]string{},
+			nil,
+			"",
+			0,
+			disc.ErrNoTokenFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				d, err := disc.New(
+					disc.WithEnvMap(tc.env),
+					disc.WithFS(tc.files),
+					disc.WithClock(func() time.Time { return now }),
+					disc.WithSkipExpired(),
+				)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				res, err := d.Discover()
+				if tc.expectedErr != nil {
+					if !errors.Is(err, tc.expectedErr) || !errors.Is(err, disc.ErrNoTokenFound) {
+						t.Errorf("Expected error wrapping %s and %s, got %v", tc.expectedErr, disc.ErrNoTokenFound, err)
+					}
+					if tc.expectedErr == disc.ErrNoTokenFound && errors.Is(err, disc.ErrAllTokensExpired) {
+						t.Errorf("Expected error not to wrap %s, got %v", disc.ErrAllTokensExpired, err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if tok := string(res.Bytes()); tok != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, tok)
+				}
+				warnings := res.Warnings()
+				if len(warnings) != tc.expectedWarnings {
+					t.Errorf("Expected %d warnings, got %q", tc.expectedWarnings, warnings)
+				}
+				for _, w := range warnings {
+					if !strings.Contains(w, "expired") {
+						t.Errorf("Expected warning about an expired token, got %q", w)
+					}
+				}
+			},
+		)
+	}
+}
+
+func TestMinimumLifetime(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	const minLifetime = time.Hour
+	barelyMisses := makeJWT(t, map[string]any{"exp": now.Add(minLifetime - time.Second).Unix()})
+	barelyPasses := makeJWT(t, map[string]any{"exp": now.Add(minLifetime).Unix()})
+	fileEnv := map[string]string{"BEARER_TOKEN_FILE": "/home/user/token"}
+
+	type testCase struct {
+		description   string
+		env           map[string]string
+		fileToken     string
+		allowUnknown  bool
+		expectedToken string
+		expectedErr   error
+	}
+
+	testCases := []testCase{
+		{
+			"Barely misses, falls through to file",
+			map[string]string{"BEARER_TOKEN": barelyMisses, "BEARER_TOKEN_FILE": "/home/user/token"},
+			barelyPasses,
+			false,
+			barelyPasses,
+			nil,
+		},
+		{"Barely passes", map[string]string{"BEARER_TOKEN": barelyPasses}, "", false, barelyPasses, nil},
+		{"Barely misses", fileEnv, barelyMisses, false, "", disc.ErrTokenLifetimeTooShort},
+		{"Unknown expiry allowed", fileEnv, "opaque_token", true, "opaque_token", nil},
+		{"Unknown expiry rejected", fileEnv, "opaque_token", false, "", disc.ErrExpiryUnknown},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				d, err := disc.New(
+					disc.WithEnvMap(tc.env),
+					disc.WithFS(fstest.MapFS{"home/user/token": {Data: []byte(tc.fileToken + "\n")}}),
+					disc.WithClock(func() time.Time { return now }),
+					disc.WithMinimumLifetime(minLifetime, tc.allowUnknown),
+					disc.WithLeeway(0),
+				)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				res, err := d.Discover()
+				if tc.expectedErr != nil {
+					if !errors.Is(err, tc.expectedErr) || !errors.Is(err, disc.ErrNoTokenFound) {
+						t.Fatalf("Expected error wrapping %s and %s, got %v", tc.expectedErr, disc.ErrNoTokenFound, err)
+					}
+					if tc.expectedErr == disc.ErrTokenLifetimeTooShort && !strings.Contains(err.Error(), "59m59s") {
+						t.Errorf("Expected error to name the remaining lifetime of 59m59s, got %v", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if tok := string(res.Bytes()); tok != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, tok)
+				}
+			},
+		)
+	}
+}
+
+func TestLeeway(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	recentlyExpired := makeJWT(t, map[string]any{"exp": now.Add(-30 * time.Second).Unix()})
+	notYetValid := makeJWT(t, map[string]any{"nbf": now.Add(30 * time.Second).Unix()})
+
+	type testCase struct {
+		description string
+		tok         string
+		opts        []disc.Option
+		expectedErr error
+	}
+
+	testCases := []testCase{
+		{"Expired by 30s, default leeway", recentlyExpired, nil, nil},
+		{"Expired by 30s, no leeway", recentlyExpired, []disc.Option{disc.WithLeeway(0)}, disc.ErrTokenExpired},
+		{"Valid in 30s, default leeway", notYetValid, nil, nil},
+		{"Valid in 30s, no leeway", notYetValid, []disc.Option{disc.WithLeeway(0)}, disc.ErrTokenNotYetValid},
+		{"Expired by 30s, leeway of 10s", recentlyExpired, []disc.Option{disc.WithLeeway(10 * time.Second)}, disc.ErrTokenExpired},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := append([]disc.Option{
+					disc.WithEnvMap(map[string]string{"BEARER_TOKEN": tc.tok}),
+					disc.WithClock(func() time.Time { return now }),
+				}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				if err := d.CheckValidity([]byte(tc.tok)); !errors.Is(err, tc.expectedErr) {
+					t.Errorf("Expected error %v, got %v", tc.expectedErr, err)
+				}
+
+				// Discovery with WithSkipExpired applies the same leeway to exp
+				if tc.tok != recentlyExpired {
+					return
+				}
+				d, err = disc.New(append(opts, disc.WithSkipExpired())...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				_, err = d.Discover()
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("Expected error %v, got %v", tc.expectedErr, err)
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"Standalone helper",
+		func(t *testing.T) {
+			if err := disc.CheckValidity([]byte(recentlyExpired), now, disc.DefaultLeeway); err != nil {
+				t.Errorf("Expected nil error, got %v", err)
+			}
+			if err := disc.CheckValidity([]byte(recentlyExpired), now, 0); !errors.Is(err, disc.ErrTokenExpired) {
+				t.Errorf("Expected error %s, got %v", disc.ErrTokenExpired, err)
+			}
+			if err := disc.CheckValidity([]byte("opaque_token"), now, 0); err != nil {
+				t.Errorf("Expected nil error, got %v", err)
+			}
+		},
+	)
+}
@@ -0,0 +1,106 @@
+package tokendiscovery
+
+import (
+	"io/fs"
+	"os/user"
+)
+
+// WithUserLookup replaces the function used to look up the current user
+func WithUserLookup(lookupUser func() (*user.User, error)) Option {
+	return func(d *Discoverer) error {
+		d.lookupUser = func() (string, error) {
+			u, err := lookupUser()
+			if err != nil {
+				return "", err
+			}
+			return userFileID(u.Uid), nil
+		}
+		return nil
+	}
+}
+
+// WithoutOSFilesystem makes d behave as on platforms without a filesystem
+func WithoutOSFilesystem() Option {
+	return func(d *Discoverer) error {
+		d.noOSFS = true
+		return nil
+	}
+}
+
+// WithGetuid replaces the function used to get the uid of the process
+func WithGetuid(getuid func() int) Option {
+	return func(d *Discoverer) error {
+		d.getuid = getuid
+		return nil
+	}
+}
+
+// WithGeteuid replaces the function used to get the effective uid of the process
+func WithGeteuid(geteuid func() int) Option {
+	return func(d *Discoverer) error {
+		d.geteuid = geteuid
+		return nil
+	}
+}
+
+// WithImplicitRuntimeDirBase is like WithImplicitRuntimeDir, with base in place of /run/user
+func WithImplicitRuntimeDirBase(base string) Option {
+	return func(d *Discoverer) error {
+		d.implicitRuntimeDir = base
+		return nil
+	}
+}
+
+// WithFileOwner replaces the function used to find the owner of a token file
+func WithFileOwner(fileOwner func(fs.FileInfo) (string, bool)) Option {
+	return func(d *Discoverer) error {
+		d.fileOwner = fileOwner
+		return nil
+	}
+}
+
+// DefaultFallbackDirectory is the fallback directory of the platform
+var DefaultFallbackDirectory = defaultFallbackDirectory
+
+// UserFileID returns the identifier of u in the bt_u$ID filename on the platform
+func UserFileID(u *user.User) string {
+	return userFileID(u.Uid)
+}
+
+// WithHomeLookup replaces the function used to look up the home directory of a user by uid
+func WithHomeLookup(lookupHome func(uid string) (string, error)) Option {
+	return func(d *Discoverer) error {
+		d.lookupHome = lookupHome
+		return nil
+	}
+}
+
+// TokenBuffer returns the token held by r itself, rather than a copy
+func (r Result) TokenBuffer() []byte {
+	return r.token
+}
+
+// TokenCacheLen returns the number of tokens held by the cache of parsed claims
+func TokenCacheLen() int {
+	tokenCache.mu.Lock()
+	defer tokenCache.mu.Unlock()
+	return len(tokenCache.entries)
+}
+
+// BearerErrorCode returns the error parameter of the Bearer challenge in a WWW-Authenticate header value
+var BearerErrorCode = bearerErrorCode
+
+// PinnedKeys returns the keys for tok of a Verifier made by NewVerifierFromJWKSFile
+func (v *Verifier) PinnedKeys(tok []byte) (*JWKSet, error) {
+	return v.pinnedKeys(tok)
+}
+
+// MetadataCacheLen returns the number of entries held by the cache of issuer metadata
+func MetadataCacheLen() int {
+	metadataCache.Lock()
+	defer metadataCache.Unlock()
+	return len(metadataCache.entries)
+}
+
+// MetadataCacheSize is the number of entries kept by the cache of issuer metadata
+const MetadataCacheSize = metadataCacheSize
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package tokendiscovery
+
+import "errors"
+
+// canReadFIFOs reports whether FIFOs can be read as described for WithFIFOs
+const canReadFIFOs = false
+
+func (d *Discoverer) readFIFO(string, int64) ([]byte, error) {
+	return nil, errors.New("reading FIFOs is not supported on this platform")
+}
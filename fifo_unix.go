@@ -0,0 +1,58 @@
+//go:build unix
+
+package tokendiscovery
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+)
+
+// canReadFIFOs reports whether FIFOs can be read as described for WithFIFOs
+const canReadFIFOs = true
+
+// fifoPollInterval is how often a FIFO without a writer is checked for one
+const fifoPollInterval = 10 * time.Millisecond
+
+// readFIFO reads a token from the named FIFO, waiting up to d.fifoTimeout for a writer to write it and close the FIFO.
+// The FIFO is opened without blocking, since a blocking open would wait for a writer without a timeout.
+func (d *Discoverer) readFIFO(name string, limit int64) ([]byte, error) {
+	f, err := os.OpenFile(name, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	deadline := time.Now().Add(d.fifoTimeout)
+	if err := f.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	var b []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := f.Read(buf)
+		b = append(b, buf[:n]...)
+		if int64(len(b)) > limit {
+			return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrTokenTooLarge, name, limit)
+		}
+		switch {
+		case err == nil:
+		case errors.Is(err, os.ErrDeadlineExceeded):
+			return nil, fmt.Errorf("%w: %s, after %s", ErrFIFOTimeout, name, d.fifoTimeout)
+		case err == io.EOF && len(b) > 0:
+			// The writer has written the token and closed the FIFO
+			return b, nil
+		case err == io.EOF:
+			// No writer has opened the FIFO yet
+			if !time.Now().Before(deadline) {
+				return nil, fmt.Errorf("%w: %s, after %s", ErrFIFOTimeout, name, d.fifoTimeout)
+			}
+			time.Sleep(min(fifoPollInterval, time.Until(deadline)))
+		default:
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,121 @@
+//go:build unix && !aix && !solaris
+
+package tokendiscovery_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestFIFOTokenFile(t *testing.T) {
+	type testCase struct {
+		description   string
+		env           func(dir string) map[string]string
+		opts          []disc.Option
+		writeFIFO     bool
+		expectedToken string
+		expectedErr   error
+	}
+
+	testCases := []testCase{
+		{
+			"FIFO in fallback directory is skipped",
+			func(string) map[string]string { return map[string]string{} },
+			nil,
+			false,
+			"",
+			disc.ErrNotRegularFile,
+		},
+		{
+			"FIFO named by BEARER_TOKEN_FILE falls through to fallback directory",
+			func(dir string) map[string]string {
+				return map[string]string{"BEARER_TOKEN_FILE": filepath.Join(dir, "tmp", "bt_u4242")}
+			},
+			nil,
+			false,
+			"",
+			disc.ErrNotRegularFile,
+		},
+		{
+			"FIFO read with WithFIFOs",
+			func(string) map[string]string { return map[string]string{} },
+			[]disc.Option{disc.WithFIFOs(10 * time.Second)},
+			true,
+			"fifo_token",
+			nil,
+		},
+		{
+			"FIFO without writer times out with WithFIFOs",
+			func(string) map[string]string { return map[string]string{} },
+			[]disc.Option{disc.WithFIFOs(50 * time.Millisecond)},
+			false,
+			"",
+			disc.ErrFIFOTimeout,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				dir := t.TempDir()
+				tmpDir := filepath.Join(dir, "tmp")
+				if err := os.Mkdir(tmpDir, 0o700); err != nil {
+					t.Fatalf("Could not create directory: %s", err)
+				}
+				fifo := filepath.Join(tmpDir, "bt_u4242")
+				if err := syscall.Mkfifo(fifo, 0o600); err != nil {
+					t.Skipf("Could not create FIFO: %s", err)
+				}
+				if tc.writeFIFO {
+					go func() {
+						// Opening for writing blocks until discovery opens the FIFO for reading
+						f, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						defer f.Close()
+						f.Write([]byte("fifo_token\n"))
+					}()
+				}
+
+				opts := append([]disc.Option{
+					disc.WithEnvMap(tc.env(dir)),
+					disc.WithFallbackDir(tmpDir),
+					disc.WithUID("4242"),
+					disc.WithoutOwnershipCheck(),
+				}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+				defer cancel()
+				tok, err := d.FindTokenContext(ctx)
+				if errors.Is(err, context.DeadlineExceeded) {
+					t.Fatal("Discovery blocked reading the FIFO")
+				}
+				if tc.expectedErr != nil {
+					if !errors.Is(err, tc.expectedErr) {
+						t.Errorf("Expected error %s, got %v", tc.expectedErr, err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if string(tok) != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, string(tok))
+				}
+			},
+		)
+	}
+}
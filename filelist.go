@@ -0,0 +1,68 @@
+package tokendiscovery
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// WithFileList makes step 2 of the discovery procedure treat the value of BEARER_TOKEN_FILE as a list of filenames,
+// separated by the OS path list separator (a colon on Unix), as for PATH. The files are tried in order, and the first
+// one that exists, is readable, and is not empty supplies the token. If none of the files exist, discovery fails as it
+// does for a single missing file; if some are merely empty or unreadable, discovery continues with the next step.
+func WithFileList() Option {
+	return func(d *Discoverer) error {
+		d.fileList = true
+		return nil
+	}
+}
+
+// lookupFileList reads the token from the first usable file in list, a value of BEARER_TOKEN_FILE split as described
+// for WithFileList
+func lookupFileList(ctx context.Context, list string, fsys FileReader) (Result, error) {
+	d := stepDiscoverer(fsys)
+	var skipped listError
+	allMissing := true
+	for _, fname := range filepath.SplitList(list) {
+		if fname == "" {
+			continue
+		}
+		tok, err := fsys.ReadTokenFile(ctx, fname)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			skipped = append(skipped, err)
+			continue
+		case errors.Is(err, ErrEmptyToken):
+			skipped = append(skipped, err)
+			allMissing = false
+			continue
+		case errors.Is(err, ErrPermissionDenied) && !d.fatalPermissions, errors.Is(err, ErrInsecurePermissions),
+			errors.Is(err, ErrMalformedToken), errors.Is(err, ErrNotRegularFile):
+			skipped = append(skipped, err)
+			allMissing = false
+			continue
+		case err != nil:
+			return Result{}, d.readFailure(SourceBearerTokenFile, fname, err)
+		}
+		return Result{token: tok, path: fname, source: SourceBearerTokenFile}, nil
+	}
+	if allMissing {
+		return Result{}, tokenFileMissing(SourceBearerTokenFile, list, ErrBearerTokenFileMissing, skipped)
+	}
+	return Result{}, SkipStep(&DiscoveryError{Step: SourceBearerTokenFile, Path: list, Err: skipped})
+}
+
+// listError reports several errors on one line
+type listError []error
+
+func (e listError) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e listError) Unwrap() []error { return e }
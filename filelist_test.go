@@ -0,0 +1,121 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestWithFileList(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/token":      {Data: []byte("a_token")},
+		"b/token":      {Data: []byte("b_token\n")},
+		"empty":        {Data: []byte("\n")},
+		"tmp/bt_u4242": {Data: []byte("tmp_token")},
+	}
+	list := func(paths ...string) string { return strings.Join(paths, string(filepath.ListSeparator)) }
+
+	type testCase struct {
+		description  string
+		opts         []disc.Option
+		tokenFile    string
+		expectedTok  string
+		expectedPath string
+		expectedErr  error
+	}
+
+	testCases := []testCase{
+		{
+			"First valid entry wins",
+			[]disc.Option{disc.WithFileList()},
+			list("/a/token", "/b/token"),
+			"a_token",
+			"/a/token",
+			nil,
+		},
+		{
+			"Missing entry is skipped",
+			[]disc.Option{disc.WithFileList()},
+			list("/missing", "/b/token", "/a/token"),
+			"b_token",
+			"/b/token",
+			nil,
+		},
+		{
+			"Empty entry is skipped",
+			[]disc.Option{disc.WithFileList()},
+			list("/empty", "/missing", "/a/token"),
+			"a_token",
+			"/a/token",
+			nil,
+		},
+		{
+			"Blank list elements are ignored",
+			[]disc.Option{disc.WithFileList()},
+			list("", "/b/token"),
+			"b_token",
+			"/b/token",
+			nil,
+		},
+		{
+			"Single path",
+			[]disc.Option{disc.WithFileList()},
+			"/a/token",
+			"a_token",
+			"/a/token",
+			nil,
+		},
+		{
+			"Only empty and missing entries fall through",
+			[]disc.Option{disc.WithFileList()},
+			list("/missing", "/empty"),
+			"tmp_token",
+			"/tmp/bt_u4242",
+			nil,
+		},
+		{
+			"Only missing entries",
+			[]disc.Option{disc.WithFileList()},
+			list("/missing", "/also/missing"),
+			"",
+			"",
+			disc.ErrNoTokenFound,
+		},
+		{
+			"Without WithFileList the value is a single path",
+			nil,
+			list("/a/token", "/b/token"),
+			"",
+			"",
+			disc.ErrNoTokenFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				env := map[string]string{"BEARER_TOKEN_FILE": tc.tokenFile}
+				opts := append([]disc.Option{disc.WithEnvMap(env), disc.WithFS(fsys), disc.WithUID("4242")}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, path, err := d.FindTokenAndFile()
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("Expected error %v, got %v", tc.expectedErr, err)
+				}
+				if string(tok) != tc.expectedTok {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedTok, tok)
+				}
+				if path != tc.expectedPath {
+					t.Errorf("Token paths do not match. Expected path %s, got %s", tc.expectedPath, path)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,116 @@
+package tokendiscovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// rejectedError records that a token was skipped because it does not meet a requirement set on the Discoverer, such as
+// WithRequiredAudience
+type rejectedError struct {
+	err error
+}
+
+func (e *rejectedError) Error() string { return e.err.Error() }
+
+func (e *rejectedError) Unwrap() error { return e.err }
+
+// checkRequirements returns a *rejectedError if tok does not meet every requirement set on d. Verification, which may
+// need the network, comes last.
+func (d *Discoverer) checkRequirements(ctx context.Context, tok []byte) error {
+	checks := []func([]byte) error{
+		d.checkJWT,
+		d.checkExpiry,
+		d.checkMaxAge,
+		d.checkAudience,
+		d.checkIssuer,
+		d.checkSubject,
+		d.checkScopes,
+		d.checkProfile,
+		d.checkType,
+	}
+	for _, check := range checks {
+		if err := check(tok); err != nil {
+			return &rejectedError{err}
+		}
+	}
+	if err := d.checkVerification(ctx, tok); err != nil {
+		return &rejectedError{err}
+	}
+	return nil
+}
+
+// claimError records that a token was skipped because a claim or header parameter does not have the value required on
+// the Discoverer. It wraps sentinel, such as ErrNoTrustedIssuer.
+type claimError struct {
+	sentinel error
+	// claim names what was checked, such as "iss claim" or "typ header"
+	claim string
+	// value is the value found, or the empty string if tok had none
+	value string
+}
+
+func (e *claimError) Error() string {
+	if e.value == "" {
+		return fmt.Sprintf("%s: token has no %s", e.sentinel, e.claim)
+	}
+	return fmt.Sprintf("%s: %q", e.sentinel, e.value)
+}
+
+func (e *claimError) Unwrap() error { return e.sentinel }
+
+// claimMismatchError returns the error summarizing the values found in the tokens in rejected that were skipped with a
+// claimError wrapping sentinel, for discovery to return when no token qualified. want describes the value required, if
+// any, and found introduces the list of values, as in "the issuers rejected". It returns nil if no token was skipped
+// for sentinel.
+func claimMismatchError(rejected []error, sentinel error, claim, want, found string) error {
+	var mismatched bool
+	var seen []string
+	for _, err := range rejected {
+		mismatched = mismatched || errors.Is(err, sentinel)
+		var cerr *claimError
+		if errors.As(err, &cerr) && cerr.sentinel == sentinel && cerr.value != "" && !slices.Contains(seen, cerr.value) {
+			seen = append(seen, cerr.value)
+		}
+	}
+	if want != "" {
+		want = " " + want
+	}
+	switch {
+	case !mismatched:
+		return nil
+	case len(seen) == 0:
+		return fmt.Errorf("%w%s: no token with a %s was found", sentinel, want, claim)
+	}
+	return fmt.Errorf("%w%s: %s were %s", sentinel, want, found, quoteAll(seen))
+}
+
+// isRejected reports whether err records a token skipped by checkRequirements
+func isRejected(err error) bool {
+	var rerr *rejectedError
+	return errors.As(err, &rerr)
+}
+
+// rejectionErrors returns the errors summarizing why the tokens in rejected were skipped by checkRequirements, for
+// discovery to return when no token qualified
+func (d *Discoverer) rejectionErrors(rejected []error) []error {
+	var errs []error
+	summaries := []func([]error) error{
+		rejectedTokensError,
+		tokenAgeError,
+		d.audienceMismatchError,
+		d.untrustedIssuerError,
+		d.subjectMismatchError,
+		d.missingScopesError,
+		d.profileMismatchError,
+		d.typeMismatchError,
+	}
+	for _, summarize := range summaries {
+		if err := summarize(rejected); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,41 @@
+package tokendiscovery
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+)
+
+// fingerprintBytes is the number of bytes of the SHA-256 digest of a token kept in its Fingerprint
+const fingerprintBytes = 8
+
+// Fingerprint identifies tok without revealing it, for logging and detecting changes: it returns the first 8 bytes of
+// the SHA-256 digest of tok, with surrounding whitespace removed, in hex. Tokens read with and without trimming
+// therefore have the same fingerprint.
+func Fingerprint(tok []byte) string {
+	return FullFingerprint(tok)[:2*fingerprintBytes]
+}
+
+// FullFingerprint is like Fingerprint, but returns the whole SHA-256 digest, for callers that need to rule out
+// collisions
+func FullFingerprint(tok []byte) string {
+	sum := sha256.Sum256(bytes.TrimSpace(tok))
+	return hex.EncodeToString(sum[:])
+}
+
+// TokensEqual reports whether a and b are the same token. The comparison takes the same time wherever a and b differ,
+// so that it does not reveal a token to an attacker who can time it. Only their lengths may be revealed.
+func TokensEqual(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
+
+// Fingerprint returns the Fingerprint of the token. It is computed the first time it is needed, and shared by copies of
+// r.
+func (r Result) Fingerprint() string {
+	if r.cache == nil {
+		return Fingerprint(r.token)
+	}
+	r.cache.fingerprintOnce.Do(func() { r.cache.fingerprint = Fingerprint(r.token) })
+	return r.cache.fingerprint
+}
@@ -0,0 +1,127 @@
+package tokendiscovery_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestFingerprint(t *testing.T) {
+	const tok = "eyJhbGciOiJub25lIn0.eyJzdWIiOiJ1c2VyIn0."
+	expected := disc.Fingerprint([]byte(tok))
+	if len(expected) != 16 {
+		t.Errorf("Expected a fingerprint of 16 hex digits, got %q", expected)
+	}
+	if full := disc.FullFingerprint([]byte(tok)); len(full) != 64 || !strings.HasPrefix(full, expected) {
+		t.Errorf("Expected a full fingerprint of 64 hex digits starting with %s, got %q", expected, full)
+	}
+
+	type testCase struct {
+		description string
+		tok         string
+	}
+
+	testCases := []testCase{
+		{"Trimmed token", tok},
+		{"Trailing newline", tok + "\n"},
+		{"Surrounding whitespace", " \t" + tok + "\r\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				if fp := disc.Fingerprint([]byte(tc.tok)); fp != expected {
+					t.Errorf("Fingerprints do not match.  Expected %s, got %s", expected, fp)
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"Different tokens",
+		func(t *testing.T) {
+			if fp := disc.Fingerprint([]byte(tok + "x")); fp == expected {
+				t.Errorf("Expected different tokens to have different fingerprints, got %s for both", fp)
+			}
+		},
+	)
+
+	t.Run(
+		"Result fingerprint",
+		func(t *testing.T) {
+			for _, opts := range [][]disc.Option{nil, {disc.WithRawContents()}} {
+				opts = append([]disc.Option{
+					disc.WithEnvMap(map[string]string{"BEARER_TOKEN_FILE": "/home/user/token"}),
+					disc.WithFS(fstest.MapFS{"home/user/token": {Data: []byte(tok + "\n")}}),
+				}, opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				res, err := d.Discover()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				for i := 0; i < 2; i++ {
+					if fp := res.Fingerprint(); fp != expected {
+						t.Errorf("Fingerprints do not match.  Expected %s, got %s", expected, fp)
+					}
+				}
+			}
+		},
+	)
+}
+
+func TestTokensEqual(t *testing.T) {
+	type testCase struct {
+		description string
+		a, b        []byte
+		expected    bool
+	}
+
+	testCases := []testCase{
+		{"Equal", []byte("abc"), []byte("abc"), true},
+		{"Different", []byte("abc"), []byte("abd"), false},
+		{"Different lengths", []byte("abc"), []byte("abcd"), false},
+		{"Both empty", []byte{}, nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				if equal := disc.TokensEqual(tc.a, tc.b); equal != tc.expected {
+					t.Errorf("Expected TokensEqual to return %t, got %t", tc.expected, equal)
+				}
+			},
+		)
+	}
+}
+
+// BenchmarkTokensEqual compares tokens that differ in their first and in their last byte. The two should take the same
+// time.
+func BenchmarkTokensEqual(b *testing.B) {
+	tok := bytes.Repeat([]byte("a"), 4096)
+	differFirst := append([]byte("b"), tok[1:]...)
+	differLast := append(append([]byte(nil), tok[:len(tok)-1]...), 'b')
+
+	for _, bc := range []struct {
+		description string
+		other       []byte
+	}{
+		{"DifferFirst", differFirst},
+		{"DifferLast", differLast},
+	} {
+		b.Run(bc.description, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if disc.TokensEqual(tok, bc.other) {
+					b.Fatal("Expected tokens to differ")
+				}
+			}
+		})
+	}
+}
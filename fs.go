@@ -0,0 +1,199 @@
+package tokendiscovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// WithFS makes discovery read every token file through fsys instead of the OS filesystem. Paths produced by discovery,
+// such as $XDG_RUNTIME_DIR/bt_u$ID or /tmp/bt_u$ID, are mapped onto fsys by treating the root of fsys as the filesystem
+// root: /tmp/bt_u1000 is opened as tmp/bt_u1000 within fsys. Relative paths are resolved against the same root. Paths
+// returned to the caller are always the unmapped ones.
+//
+// On platforms without a filesystem, such as js/wasm in a browser, the steps that read token files are skipped unless
+// WithFS is given, so that by default only BEARER_TOKEN is consulted.
+func WithFS(fsys fs.FS) Option {
+	return func(d *Discoverer) error {
+		if fsys == nil {
+			return fmt.Errorf("%w: filesystem cannot be nil", ErrInvalidOption)
+		}
+		d.fsys = fsys
+		return nil
+	}
+}
+
+// defaultMaxTokenSize is the size of the largest token file read by default. Real tokens are a few kilobytes at most.
+const defaultMaxTokenSize = 1 << 20
+
+// WithMaxTokenSize sets the size in bytes of the largest token file discovery reads. Larger files fail to read with an
+// error wrapping ErrTokenTooLarge, so that pointing BEARER_TOKEN_FILE at a huge file does not exhaust memory. The
+// default is 1 MiB.
+func WithMaxTokenSize(size int64) Option {
+	return func(d *Discoverer) error {
+		if size <= 0 {
+			return fmt.Errorf("%w: maximum token size must be positive", ErrInvalidOption)
+		}
+		d.maxTokenSize = size
+		return nil
+	}
+}
+
+// WithWholeFileContents makes discovery use the whole contents of token files, with surrounding whitespace removed and
+// CRLF and CR line endings replaced by LF, as the token. By default, only the first line of a token file that is
+// neither blank nor a comment starting with # is used, since some tools add comments to token files or append new
+// tokens to old ones.
+func WithWholeFileContents() Option {
+	return func(d *Discoverer) error {
+		d.wholeFile = true
+		return nil
+	}
+}
+
+// WithRawContents makes discovery return tokens exactly as found, without removing surrounding whitespace or otherwise
+// changing them, for callers that compare the token against the file it came from, or handle token formats where
+// whitespace may matter. Token files and environment variables containing only whitespace are still treated as empty.
+// Result.Trimmed returns the token with surrounding whitespace removed.
+func WithRawContents() Option {
+	return func(d *Discoverer) error {
+		d.rawContents = true
+		return nil
+	}
+}
+
+// noFilesystem reports whether there is no filesystem to read token files from, neither an injected fs.FS nor that of
+// the OS. In that case, only the steps that do not read files are run.
+func (d *Discoverer) noFilesystem() bool {
+	return d.noOSFS && d.fsys == nil
+}
+
+// readsFiles reports whether step is one of the standard steps that read token files
+func readsFiles(step Step) bool {
+	switch step.(type) {
+	case bearerTokenFileStep, xdgRuntimeDirStep, tmpFallbackStep, implicitRuntimeDirStep, credentialsDirectoryStep,
+		condorCredsStep, kubernetesStep:
+		return true
+	}
+	return false
+}
+
+// fsPath maps the OS path name onto the root of an injected fs.FS
+func fsPath(name string) string {
+	name = filepath.ToSlash(strings.TrimPrefix(name, filepath.VolumeName(name)))
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// readFileOnce reads the named file from the OS filesystem, or from the injected fs.FS if there is one. Since a read
+// can block indefinitely (for example, on a hung network filesystem), the read is abandoned if ctx is done before it
+// completes, and ctx.Err() is returned. If followSymlinks is false, a symlink at name is not followed, as described for
+// WithFollowSymlinks.
+func (d *Discoverer) readFileOnce(ctx context.Context, name string, followSymlinks bool) ([]byte, error) {
+	if ctx.Done() == nil {
+		return d.readFileBlocking(name, followSymlinks)
+	}
+
+	type readResult struct {
+		b   []byte
+		err error
+	}
+	// Buffered so that an abandoned read can still deliver its result and let the goroutine exit
+	resultChan := make(chan readResult, 1)
+	go func() {
+		b, err := d.readFileBlocking(name, followSymlinks)
+		resultChan <- readResult{b, err}
+	}()
+
+	select {
+	case r := <-resultChan:
+		return r.b, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (d *Discoverer) readFileBlocking(name string, followSymlinks bool) ([]byte, error) {
+	limit := d.maxTokenSize
+	if limit == 0 {
+		limit = defaultMaxTokenSize
+	}
+	isFIFO, err := d.checkRegularFile(name, followSymlinks)
+	if err != nil {
+		return nil, err
+	}
+	if isFIFO {
+		return d.readFIFO(name, limit)
+	}
+	f, err := d.open(name, followSymlinks)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if osFile, ok := f.(*os.File); ok && d.fileLocking {
+		unlock, err := d.lockShared(osFile)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+	before, statErr := f.Stat()
+	b, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return nil, withOSPath(err, name)
+	}
+	if int64(len(b)) > limit {
+		return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrTokenTooLarge, name, limit)
+	}
+	if statErr == nil {
+		if after, err := f.Stat(); err == nil && !sameVersion(before, after) {
+			return b, errFileChanged
+		}
+	}
+	return b, nil
+}
+
+// open opens the named file for reading from the OS filesystem, or from the injected fs.FS if there is one
+func (d *Discoverer) open(name string, followSymlinks bool) (fs.File, error) {
+	if d.fsys == nil {
+		if !followSymlinks {
+			return openRejectingSymlinks(name)
+		}
+		return os.Open(name)
+	}
+	f, err := d.fsys.Open(fsPath(name))
+	if err != nil {
+		return nil, withOSPath(err, name)
+	}
+	return f, nil
+}
+
+// stat returns information about the named file from the OS filesystem, or from the injected fs.FS if there is one
+func (d *Discoverer) stat(name string) (fs.FileInfo, error) {
+	if d.fsys == nil {
+		return os.Stat(name)
+	}
+	info, err := fs.Stat(d.fsys, fsPath(name))
+	if err != nil {
+		return nil, withOSPath(err, name)
+	}
+	return info, nil
+}
+
+// withOSPath returns err, an error from the injected fs.FS, with the OS path name in place of the mapped one, so that
+// errors read the same regardless of the filesystem in use
+func withOSPath(err error, name string) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		pathErr.Path = name
+	}
+	return err
+}
@@ -0,0 +1,6 @@
+//go:build !js
+
+package tokendiscovery
+
+// hasOSFilesystem reports whether token files can be read from the filesystem of the OS
+const hasOSFilesystem = true
@@ -0,0 +1,212 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestDiscovererWithFS(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		description  string
+		env          map[string]string
+		fsys         fstest.MapFS
+		expectedTok  []byte
+		expectedPath string
+		expectedErr  error
+	}
+
+	testCases := []testCase{
+		{
+			"BEARER_TOKEN_FILE defined",
+			map[string]string{"BEARER_TOKEN_FILE": "/home/user/token"},
+			fstest.MapFS{"home/user/token": {Data: []byte("12345\n")}},
+			[]byte("12345"),
+			"/home/user/token",
+			nil,
+		},
+		{
+			"BEARER_TOKEN_FILE defined with file that doesn't exist",
+			map[string]string{"BEARER_TOKEN_FILE": "/home/user/token"},
+			fstest.MapFS{"tmp/bt_u1000": {Data: []byte("56789")}},
+			nil,
+			"",
+			disc.ErrNoTokenFound,
+		},
+		{
+			"BEARER_TOKEN_FILE defined, but empty - should fall through",
+			map[string]string{"BEARER_TOKEN_FILE": "/home/user/token"},
+			fstest.MapFS{
+				"home/user/token": {Data: []byte("")},
+				"tmp/bt_u1000":    {Data: []byte("btf_fallthrough")},
+			},
+			[]byte("btf_fallthrough"),
+			"/tmp/bt_u1000",
+			nil,
+		},
+		{
+			"XDG_RUNTIME_DIR defined, token file exists",
+			map[string]string{"XDG_RUNTIME_DIR": "/run/user/1000"},
+			fstest.MapFS{"run/user/1000/bt_u1000": {Data: []byte(" 54321 ")}},
+			[]byte("54321"),
+			"/run/user/1000/bt_u1000",
+			nil,
+		},
+		{
+			"XDG_RUNTIME_DIR defined, token file does not exist",
+			map[string]string{"XDG_RUNTIME_DIR": "/run/user/1000"},
+			fstest.MapFS{"tmp/bt_u1000": {Data: []byte("56789")}},
+			nil,
+			"",
+			disc.ErrNoTokenFound,
+		},
+		{
+			"XDG_RUNTIME_DIR defined, token file is empty - should move to next case",
+			map[string]string{"XDG_RUNTIME_DIR": "/run/user/1000"},
+			fstest.MapFS{
+				"run/user/1000/bt_u1000": {Data: []byte("")},
+				"tmp/bt_u1000":           {Data: []byte("xdg_fallthrough")},
+			},
+			[]byte("xdg_fallthrough"),
+			"/tmp/bt_u1000",
+			nil,
+		},
+		{
+			"Fallback - token in /tmp/bt_u1000",
+			map[string]string{},
+			fstest.MapFS{"tmp/bt_u1000": {Data: []byte("56789")}},
+			[]byte("56789"),
+			"/tmp/bt_u1000",
+			nil,
+		},
+		{
+			"Fallback case, but token isn't there",
+			map[string]string{},
+			fstest.MapFS{},
+			nil,
+			"",
+			disc.ErrNoTokenFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				t.Parallel()
+				d, err := disc.New(disc.WithEnvMap(tc.env), disc.WithFS(tc.fsys), disc.WithUID("1000"))
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, path, err := d.FindTokenAndFile()
+				if !reflect.DeepEqual(tok, tc.expectedTok) {
+					t.Errorf("Token strings do not match.  Expected %v, got %v", tc.expectedTok, tok)
+				}
+				if path != tc.expectedPath {
+					t.Errorf("Token paths do not match. Expected path %s, got %s", tc.expectedPath, path)
+				}
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("Got different errors: expected %v, got %v", tc.expectedErr, err)
+				}
+			},
+		)
+	}
+}
+
+// errFS is an fs.FS whose every Open fails with err
+type errFS struct{ err error }
+
+func (e errFS) Open(name string) (fs.File, error) {
+	return nil, &fs.PathError{Op: "open", Path: name, Err: e.err}
+}
+
+var errIO = errors.New("input/output error")
+
+func TestDiscovererWithFSReadError(t *testing.T) {
+	d, err := disc.New(
+		disc.WithEnvMap(map[string]string{"BEARER_TOKEN_FILE": "/home/user/token"}),
+		disc.WithFS(errFS{errIO}),
+		disc.WithUID("1000"),
+	)
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	_, _, err = d.FindTokenAndFile()
+	if !errors.Is(err, errIO) {
+		t.Errorf("Expected error to wrap %s, got %v", errIO, err)
+	}
+	if errors.Is(err, disc.ErrNoTokenFound) {
+		t.Errorf("Expected read error not to be reported as %s", disc.ErrNoTokenFound)
+	}
+	var discErr *disc.DiscoveryError
+	if !errors.As(err, &discErr) {
+		t.Fatalf("Expected a *DiscoveryError in the error chain, got %v", err)
+	}
+	if discErr.Step != disc.SourceBearerTokenFile || discErr.Path != "/home/user/token" {
+		t.Errorf("Expected DiscoveryError for %s at /home/user/token, got %s at %s", disc.SourceBearerTokenFile, discErr.Step, discErr.Path)
+	}
+}
+
+func TestMaxTokenSize(t *testing.T) {
+	const limit = 16
+
+	type testCase struct {
+		description string
+		env         map[string]string
+		size        int
+		expectedErr error
+	}
+
+	testCases := []testCase{
+		{"Just under the limit", map[string]string{"BEARER_TOKEN_FILE": "/home/user/token"}, limit - 1, nil},
+		{"Exactly at the limit", map[string]string{"BEARER_TOKEN_FILE": "/home/user/token"}, limit, nil},
+		{"Over the limit", map[string]string{"BEARER_TOKEN_FILE": "/home/user/token"}, limit + 1, disc.ErrTokenTooLarge},
+		{"Over the limit in _CONDOR_CREDS", map[string]string{"_CONDOR_CREDS": "/home/user"}, limit + 1, disc.ErrTokenTooLarge},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				contents := strings.Repeat("x", tc.size)
+				fsys := fstest.MapFS{
+					"home/user/token":         {Data: []byte(contents)},
+					"home/user/scitokens.use": {Data: []byte(contents)},
+				}
+				d, err := disc.New(
+					disc.WithEnvMap(tc.env),
+					disc.WithFS(fsys),
+					disc.WithUID("1000"),
+					disc.WithCondorCreds(""),
+					disc.WithMaxTokenSize(limit),
+				)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, err := d.FindToken()
+				if tc.expectedErr != nil {
+					if !errors.Is(err, tc.expectedErr) {
+						t.Errorf("Expected error %s, got %v", tc.expectedErr, err)
+					}
+					if tok != nil {
+						t.Errorf("Expected no token, got %d bytes", len(tok))
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if string(tok) != contents {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", contents, string(tok))
+				}
+			},
+		)
+	}
+}
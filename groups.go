@@ -0,0 +1,35 @@
+package tokendiscovery
+
+import "strings"
+
+// Groups returns the wlcg.groups claim, which may be a single string or a list of strings
+func (c Claims) Groups() []string { return c.Strings("wlcg.groups") }
+
+// HasGroup reports whether the wlcg.groups claim of c includes g. Groups are compared case-sensitively, and the leading
+// slash is optional, so cms matches /cms.
+func (c Claims) HasGroup(g string) bool {
+	g = normalizeGroup(g)
+	for _, group := range c.Groups() {
+		if normalizeGroup(group) == g {
+			return true
+		}
+	}
+	return false
+}
+
+// HasGroupOrParent is like HasGroup, but also reports true if the wlcg.groups claim of c includes a subgroup of g,
+// since membership in a group such as /cms/producers implies membership in its parent /cms
+func (c Claims) HasGroupOrParent(g string) bool {
+	g = normalizeGroup(g)
+	for _, group := range c.Groups() {
+		if group = normalizeGroup(group); group == g || g == "/" || strings.HasPrefix(group, g+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeGroup returns g with a single leading slash and no trailing slashes
+func normalizeGroup(g string) string {
+	return "/" + strings.Trim(g, "/")
+}
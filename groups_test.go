@@ -0,0 +1,63 @@
+package tokendiscovery_test
+
+import (
+	"reflect"
+	"testing"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestGroups(t *testing.T) {
+	nested := disc.Claims{"wlcg.groups": []any{"/cms", "/cms/producers/mc", "/atlas/"}}
+	single := disc.Claims{"wlcg.groups": "/dune/production"}
+	absent := disc.Claims{"sub": "user"}
+
+	type testCase struct {
+		description           string
+		claims                disc.Claims
+		group                 string
+		expectedHasGroup      bool
+		expectedGroupOrParent bool
+	}
+
+	testCases := []testCase{
+		{"Exact group", nested, "/cms", true, true},
+		{"Exact nested group", nested, "/cms/producers/mc", true, true},
+		{"Parent of nested group", nested, "/cms/producers", false, true},
+		{"Child of member group", nested, "/cms/producers/mc/test", false, false},
+		{"Sibling sharing a prefix string", nested, "/cms/prod", false, false},
+		{"Without leading slash", nested, "cms/producers/mc", true, true},
+		{"Trailing slash in claim", nested, "/atlas", true, true},
+		{"Trailing slash in requirement", nested, "/atlas/", true, true},
+		{"Case sensitive", nested, "/CMS", false, false},
+		{"Single string claim", single, "/dune/production", true, true},
+		{"Parent of single string claim", single, "dune", false, true},
+		{"Absent claim", absent, "/cms", false, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				if has := tc.claims.HasGroup(tc.group); has != tc.expectedHasGroup {
+					t.Errorf("Expected HasGroup(%q) to return %t, got %t", tc.group, tc.expectedHasGroup, has)
+				}
+				if has := tc.claims.HasGroupOrParent(tc.group); has != tc.expectedGroupOrParent {
+					t.Errorf("Expected HasGroupOrParent(%q) to return %t, got %t", tc.group, tc.expectedGroupOrParent, has)
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"Groups",
+		func(t *testing.T) {
+			if groups := single.Groups(); !reflect.DeepEqual(groups, []string{"/dune/production"}) {
+				t.Errorf("Groups do not match.  Expected [/dune/production], got %q", groups)
+			}
+			if groups := absent.Groups(); groups != nil {
+				t.Errorf("Expected no groups, got %q", groups)
+			}
+		},
+	)
+}
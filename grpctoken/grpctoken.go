@@ -0,0 +1,122 @@
+// Package grpctoken provides gRPC credentials backed by the WLCG Bearer Token Discovery procedure. It is a module of
+// its own, so that users of the discovery package alone do not depend on gRPC.
+package grpctoken
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+// Option configures NewPerRPCCredentials and NewInterceptors
+type Option func(*config)
+
+// config is the configuration set by Options
+type config struct {
+	interval         time.Duration
+	retryAll         bool
+	idempotentMethod map[string]bool
+}
+
+// newConfig returns the configuration set by opts
+func newConfig(opts []Option) *config {
+	c := &config{interval: disc.DefaultRediscoveryInterval, idempotentMethod: make(map[string]bool)}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithRediscoveryInterval sets how long a discovered token is reused before discovery runs again, to pick up tokens
+// that were renewed. It defaults to tokendiscovery.DefaultRediscoveryInterval. 0 runs discovery for every call.
+func WithRediscoveryInterval(interval time.Duration) Option {
+	return func(c *config) {
+		c.interval = max(interval, 0)
+	}
+}
+
+// perRPCCredentials is the credentials.PerRPCCredentials returned by NewPerRPCCredentials
+type perRPCCredentials struct {
+	cache      *disc.CachedDiscovery
+	requireTLS bool
+}
+
+// NewPerRPCCredentials returns credentials.PerRPCCredentials sending an "authorization: Bearer" header holding the
+// token found by d, or by the default discovery procedure if d is nil, with every call. The token is reused for
+// tokendiscovery.DefaultRediscoveryInterval, or until it expires, before discovery runs again for a call. If requireTLS
+// is true, the token is only sent over connections with privacy and integrity protection, such as TLS.
+//
+// If no token can be found, the call fails with codes.Unauthenticated, or with codes.DeadlineExceeded or codes.Canceled
+// if its context ends first. Calls do not wait for discovery beyond the end of their context.
+func NewPerRPCCredentials(d *disc.Discoverer, requireTLS bool, opts ...Option) credentials.PerRPCCredentials {
+	return &perRPCCredentials{cache: disc.NewCachedDiscovery(d, newConfig(opts).interval), requireTLS: requireTLS}
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials
+func (p *perRPCCredentials) GetRequestMetadata(ctx context.Context, _ ...string) (map[string]string, error) {
+	if p.requireTLS {
+		ri, _ := credentials.RequestInfoFromContext(ctx)
+		if err := credentials.CheckSecurityLevel(ri.AuthInfo, credentials.PrivacyAndIntegrity); err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "cannot send a bearer token: %v", err)
+		}
+	}
+	tok, err := token(ctx, p.cache)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"authorization": authorization(tok)}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials
+func (p *perRPCCredentials) RequireTransportSecurity() bool {
+	return p.requireTLS
+}
+
+// token returns the token to send with a call under ctx from cache. It returns a *discoveryError if no token was found
+// before ctx ended.
+func token(ctx context.Context, cache *disc.CachedDiscovery) ([]byte, error) {
+	tok, err := cache.Token(ctx)
+	if err != nil {
+		return nil, &discoveryError{err}
+	}
+	return tok, nil
+}
+
+// authorization returns the value of the authorization header for tok
+func authorization(tok []byte) string {
+	return "Bearer " + string(tok)
+}
+
+// discoveryError indicates that no token could be found for a call. It wraps the reason, and carries the gRPC status
+// the call fails with.
+type discoveryError struct {
+	err error
+}
+
+// Error implements error
+func (e *discoveryError) Error() string {
+	return "could not find a bearer token: " + e.err.Error()
+}
+
+// Unwrap returns the reason no token could be found
+func (e *discoveryError) Unwrap() error {
+	return e.err
+}
+
+// GRPCStatus returns the status of the call, which is codes.Unauthenticated unless its context ended
+func (e *discoveryError) GRPCStatus() *status.Status {
+	code := codes.Unauthenticated
+	switch {
+	case errors.Is(e.err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(e.err, context.Canceled):
+		code = codes.Canceled
+	}
+	return status.New(code, e.Error())
+}
@@ -0,0 +1,306 @@
+package grpctoken_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+	"github.com/shreyb/wlcg-bearer-token-discovery-go/grpctoken"
+)
+
+// rotatingStep is a step whose token can be changed, and that counts how often it runs. While block is set, lookups
+// wait for it to be closed, ignoring their context.
+type rotatingStep struct {
+	mu      sync.Mutex
+	token   string
+	block   chan struct{}
+	lookups atomic.Int32
+}
+
+func (r *rotatingStep) Name() string { return "rotating" }
+
+func (r *rotatingStep) Lookup(context.Context, disc.Environ, disc.FileReader) (disc.Result, error) {
+	r.lookups.Add(1)
+	r.mu.Lock()
+	block := r.block
+	r.mu.Unlock()
+	if block != nil {
+		<-block
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.token == "" {
+		return disc.Result{}, disc.ErrSkipStep
+	}
+	return disc.NewResult([]byte(r.token), ""), nil
+}
+
+func (r *rotatingStep) set(tok string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.token = tok
+}
+
+// echoServer is a gRPC health server that sends the authorization header of each call back in its echo-authorization
+// response header, and counts calls
+type echoServer struct {
+	lis   *bufconn.Listener
+	calls atomic.Int32
+}
+
+// newEchoServer starts an echoServer, failing calls for which reject, if it is not nil, returns an error
+func newEchoServer(t *testing.T, reject func(authorization string) error) *echoServer {
+	s := &echoServer{lis: bufconn.Listen(1 << 20)}
+	echo := func(ctx context.Context) error {
+		s.calls.Add(1)
+		md, _ := metadata.FromIncomingContext(ctx)
+		auth := strings.Join(md.Get("authorization"), ",")
+		grpc.SetHeader(ctx, metadata.Pairs("echo-authorization", auth))
+		if reject != nil {
+			return reject(auth)
+		}
+		return nil
+	}
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(
+			func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				if err := echo(ctx); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			},
+		),
+		grpc.StreamInterceptor(
+			func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if err := echo(ss.Context()); err != nil {
+					return err
+				}
+				return handler(srv, ss)
+			},
+		),
+	)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(s.lis)
+	t.Cleanup(srv.Stop)
+	return s
+}
+
+// dial returns a health client connected to s without transport security, with opts
+func (s *echoServer) dial(t *testing.T, opts ...grpc.DialOption) healthpb.HealthClient {
+	t.Helper()
+	opts = append(
+		[]grpc.DialOption{
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return s.lis.DialContext(ctx)
+			}),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		},
+		opts...,
+	)
+	conn, err := grpc.NewClient("passthrough:///bufconn", opts...)
+	if err != nil {
+		t.Fatalf("Could not create gRPC client: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+// check makes a health check call with client, and returns the authorization header received by the server
+func check(ctx context.Context, client healthpb.HealthClient) (string, error) {
+	var header metadata.MD
+	_, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Header(&header))
+	return strings.Join(header.Get("echo-authorization"), ","), err
+}
+
+func TestNewPerRPCCredentials(t *testing.T) {
+	type testCase struct {
+		description     string
+		opts            []grpctoken.Option
+		expectedHeader  string
+		expectedLookups int32
+	}
+
+	testCases := []testCase{
+		{"Token reused", nil, "Bearer first_token", 1},
+		{
+			"Discovery for every call",
+			[]grpctoken.Option{grpctoken.WithRediscoveryInterval(0)},
+			"Bearer second_token",
+			2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				step := &rotatingStep{token: "first_token"}
+				d, err := disc.New(disc.WithSteps(step))
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				creds := grpctoken.NewPerRPCCredentials(d, false, tc.opts...)
+				if creds.RequireTransportSecurity() {
+					t.Error("Expected credentials not to require transport security")
+				}
+				client := newEchoServer(t, nil).dial(t, grpc.WithPerRPCCredentials(creds))
+
+				if got, err := check(context.Background(), client); err != nil || got != "Bearer first_token" {
+					t.Fatalf("Expected Bearer first_token and nil error, got %q and %v", got, err)
+				}
+				step.set("second_token")
+				got, err := check(context.Background(), client)
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if got != tc.expectedHeader {
+					t.Errorf("Authorization headers do not match.  Expected %q, got %q", tc.expectedHeader, got)
+				}
+				if n := step.lookups.Load(); n != tc.expectedLookups {
+					t.Errorf("Expected %d discoveries, got %d", tc.expectedLookups, n)
+				}
+			},
+		)
+	}
+}
+
+func TestNewPerRPCCredentialsNoToken(t *testing.T) {
+	d, err := disc.New(disc.WithEnvMap(nil), disc.WithFS(fstest.MapFS{}), disc.WithUID("4242"))
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	creds := grpctoken.NewPerRPCCredentials(d, false)
+
+	_, err = creds.GetRequestMetadata(context.Background())
+	if !errors.Is(err, disc.ErrNoTokenFound) {
+		t.Errorf("Expected error %s, got %v", disc.ErrNoTokenFound, err)
+	}
+	if code := status.Code(err); code != codes.Unauthenticated {
+		t.Errorf("Status codes do not match.  Expected %s, got %s", codes.Unauthenticated, code)
+	}
+
+	srv := newEchoServer(t, nil)
+	_, err = check(context.Background(), srv.dial(t, grpc.WithPerRPCCredentials(creds)))
+	if code := status.Code(err); code != codes.Unauthenticated {
+		t.Errorf("Status codes do not match.  Expected %s, got %s", codes.Unauthenticated, code)
+	}
+	if n := srv.calls.Load(); n != 0 {
+		t.Errorf("Expected no call to reach the server, got %d", n)
+	}
+}
+
+func TestNewPerRPCCredentialsContext(t *testing.T) {
+	block := make(chan struct{})
+	t.Cleanup(func() { close(block) })
+	step := &rotatingStep{token: "token", block: block}
+	d, err := disc.New(disc.WithSteps(step))
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	client := newEchoServer(t, nil).dial(t, grpc.WithPerRPCCredentials(grpctoken.NewPerRPCCredentials(d, false)))
+
+	// The second call waits for the discovery started by the first, which is still blocked
+	for _, description := range []string{"Blocked discovery", "Waiting for blocked discovery"} {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		start := time.Now()
+		_, err := check(ctx, client)
+		cancel()
+		if code := status.Code(err); code != codes.DeadlineExceeded {
+			t.Errorf("%s: status codes do not match.  Expected %s, got %s", description, codes.DeadlineExceeded, code)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: expected the call to end with its context, took %s", description, elapsed)
+		}
+	}
+	if n := step.lookups.Load(); n != 1 {
+		t.Errorf("Expected 1 discovery, got %d", n)
+	}
+}
+
+// authInfo is the AuthInfo of a connection with a given security level
+type authInfo struct {
+	credentials.CommonAuthInfo
+}
+
+func (authInfo) AuthType() string { return "test" }
+
+func TestNewPerRPCCredentialsRequireTLS(t *testing.T) {
+	type testCase struct {
+		description string
+		requireTLS  bool
+		level       credentials.SecurityLevel
+		expectedErr bool
+	}
+
+	testCases := []testCase{
+		{"TLS required and used", true, credentials.PrivacyAndIntegrity, false},
+		{"TLS required on an insecure connection", true, credentials.NoSecurity, true},
+		{"TLS required on a connection with integrity only", true, credentials.IntegrityOnly, true},
+		{"TLS not required on an insecure connection", false, credentials.NoSecurity, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				step := &rotatingStep{token: "token"}
+				d, err := disc.New(disc.WithSteps(step))
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				creds := grpctoken.NewPerRPCCredentials(d, tc.requireTLS)
+				if creds.RequireTransportSecurity() != tc.requireTLS {
+					t.Errorf("Expected RequireTransportSecurity to return %t", tc.requireTLS)
+				}
+				ctx := credentials.NewContextWithRequestInfo(
+					context.Background(),
+					credentials.RequestInfo{AuthInfo: authInfo{credentials.CommonAuthInfo{SecurityLevel: tc.level}}},
+				)
+				md, err := creds.GetRequestMetadata(ctx)
+				if tc.expectedErr {
+					if code := status.Code(err); code != codes.Unauthenticated {
+						t.Errorf("Status codes do not match.  Expected %s, got %s", codes.Unauthenticated, code)
+					}
+					if n := step.lookups.Load(); n != 0 {
+						t.Errorf("Expected no discovery, got %d", n)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if md["authorization"] != "Bearer token" {
+					t.Errorf("Authorization headers do not match.  Expected %q, got %q", "Bearer token", md["authorization"])
+				}
+			},
+		)
+	}
+
+	// gRPC itself refuses to use credentials requiring TLS without transport security
+	creds := grpctoken.NewPerRPCCredentials(nil, true)
+	_, err := grpc.NewClient(
+		"passthrough:///bufconn",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithPerRPCCredentials(creds),
+	)
+	if err == nil {
+		t.Error("Expected an error creating a client without transport security")
+	}
+}
@@ -0,0 +1,157 @@
+package grpctoken
+
+import (
+	"bytes"
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+// WithIdempotentMethods declares methods, given by full name such as "/grpc.health.v1.Health/Check", idempotent, so
+// that unary calls to them are retried when their token is rejected, as described for NewInterceptors
+func WithIdempotentMethods(methods ...string) Option {
+	return func(c *config) {
+		for _, method := range methods {
+			c.idempotentMethod[method] = true
+		}
+	}
+}
+
+// WithRetryAllMethods has unary calls to any method retried when their token is rejected, as described for
+// NewInterceptors, even if they are not idempotent
+func WithRetryAllMethods() Option {
+	return func(c *config) {
+		c.retryAll = true
+	}
+}
+
+// Interceptors are gRPC client interceptors sending calls with the token found by discovery, and sharing it between
+// calls. They are returned by NewInterceptors.
+type Interceptors struct {
+	cache *disc.CachedDiscovery
+	cfg   *config
+}
+
+// NewInterceptors returns client interceptors sending an "authorization: Bearer" header holding the token found by d,
+// or by the default discovery procedure if d is nil, with every call that does not have one already. The token is
+// reused, and discovery fails calls, as described for NewPerRPCCredentials.
+//
+// Since tokens may be renewed while calls are in flight, a call failing with codes.Unauthenticated invalidates its
+// token, so that discovery runs again for the next call. A unary call to a method declared with WithIdempotentMethods,
+// or to any method with WithRetryAllMethods, is also retried once if discovery then finds a different token before its
+// context ends. Streams are not retried, since messages may already have been exchanged.
+func NewInterceptors(d *disc.Discoverer, opts ...Option) *Interceptors {
+	cfg := newConfig(opts)
+	return &Interceptors{cache: disc.NewCachedDiscovery(d, cfg.interval), cfg: cfg}
+}
+
+// Unary returns the unary client interceptor, to be used with grpc.WithUnaryInterceptor
+func (i *Interceptors) Unary() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		if hasAuthorization(ctx) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		tok, err := token(ctx, i.cache)
+		if err != nil {
+			return err
+		}
+		err = invoker(withAuthorization(ctx, tok), method, req, reply, cc, opts...)
+		if status.Code(err) != codes.Unauthenticated {
+			return err
+		}
+		i.cache.Invalidate(tok)
+		if !i.cfg.retryAll && !i.cfg.idempotentMethod[method] {
+			return err
+		}
+		renewed, rediscoveryErr := token(ctx, i.cache)
+		if rediscoveryErr != nil || bytes.Equal(renewed, tok) {
+			// The rejection is returned, rather than why no other token could be found in time
+			return err
+		}
+		return invoker(withAuthorization(ctx, renewed), method, req, reply, cc, opts...)
+	}
+}
+
+// Stream returns the stream client interceptor, to be used with grpc.WithStreamInterceptor
+func (i *Interceptors) Stream() grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		if hasAuthorization(ctx) {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+		tok, err := token(ctx, i.cache)
+		if err != nil {
+			return nil, err
+		}
+		stream, err := streamer(withAuthorization(ctx, tok), desc, cc, method, opts...)
+		if err != nil {
+			i.checkRejection(tok, err)
+			return nil, err
+		}
+		return &clientStream{ClientStream: stream, i: i, token: tok}, nil
+	}
+}
+
+// checkRejection invalidates tok if err shows that it was rejected
+func (i *Interceptors) checkRejection(tok []byte, err error) {
+	if status.Code(err) == codes.Unauthenticated {
+		i.cache.Invalidate(tok)
+	}
+}
+
+// clientStream is a grpc.ClientStream that invalidates its token if the stream fails with codes.Unauthenticated
+type clientStream struct {
+	grpc.ClientStream
+	i     *Interceptors
+	token []byte
+}
+
+// Header implements grpc.ClientStream
+func (s *clientStream) Header() (metadata.MD, error) {
+	md, err := s.ClientStream.Header()
+	s.i.checkRejection(s.token, err)
+	return md, err
+}
+
+// SendMsg implements grpc.ClientStream
+func (s *clientStream) SendMsg(m any) error {
+	err := s.ClientStream.SendMsg(m)
+	s.i.checkRejection(s.token, err)
+	return err
+}
+
+// RecvMsg implements grpc.ClientStream
+func (s *clientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	s.i.checkRejection(s.token, err)
+	return err
+}
+
+// hasAuthorization reports whether the outgoing metadata of ctx already has an authorization header
+func hasAuthorization(ctx context.Context) bool {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	return len(md.Get("authorization")) > 0
+}
+
+// withAuthorization returns ctx with an authorization header for tok added to its outgoing metadata
+func withAuthorization(ctx context.Context, tok []byte) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", authorization(tok))
+}
@@ -0,0 +1,202 @@
+package grpctoken_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+	"github.com/shreyb/wlcg-bearer-token-discovery-go/grpctoken"
+)
+
+// rejectOldToken returns a function rejecting calls with old_token, after which step produces new_token, and block, if
+// it is not nil, is set on step
+func rejectOldToken(step *rotatingStep, block chan struct{}) func(string) error {
+	return func(auth string) error {
+		if auth != "Bearer old_token" {
+			return nil
+		}
+		step.mu.Lock()
+		step.token, step.block = "new_token", block
+		step.mu.Unlock()
+		return status.Error(codes.Unauthenticated, "token expired")
+	}
+}
+
+// newInterceptorClient returns a health client connected to srv through the interceptors for a Discoverer with step
+func newInterceptorClient(
+	t *testing.T,
+	srv *echoServer,
+	step *rotatingStep,
+	opts ...grpctoken.Option,
+) healthpb.HealthClient {
+	t.Helper()
+	d, err := disc.New(disc.WithSteps(step))
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	i := grpctoken.NewInterceptors(d, opts...)
+	return srv.dial(t, grpc.WithUnaryInterceptor(i.Unary()), grpc.WithStreamInterceptor(i.Stream()))
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	type testCase struct {
+		description   string
+		opts          []grpctoken.Option
+		expectedCode  codes.Code
+		expectedCalls int32
+	}
+
+	testCases := []testCase{
+		{
+			"Idempotent method retried",
+			[]grpctoken.Option{grpctoken.WithIdempotentMethods(healthpb.Health_Check_FullMethodName)},
+			codes.OK,
+			2,
+		},
+		{"All methods retried", []grpctoken.Option{grpctoken.WithRetryAllMethods()}, codes.OK, 2},
+		{
+			"Other method idempotent",
+			[]grpctoken.Option{grpctoken.WithIdempotentMethods(healthpb.Health_List_FullMethodName)},
+			codes.Unauthenticated,
+			1,
+		},
+		{"Not retried by default", nil, codes.Unauthenticated, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				step := &rotatingStep{token: "old_token"}
+				srv := newEchoServer(t, rejectOldToken(step, nil))
+				client := newInterceptorClient(t, srv, step, tc.opts...)
+
+				got, err := check(context.Background(), client)
+				if code := status.Code(err); code != tc.expectedCode {
+					t.Fatalf("Status codes do not match.  Expected %s, got %s (%v)", tc.expectedCode, code, err)
+				}
+				if tc.expectedCode == codes.OK && got != "Bearer new_token" {
+					t.Errorf("Authorization headers do not match.  Expected %q, got %q", "Bearer new_token", got)
+				}
+				if n := srv.calls.Load(); n != tc.expectedCalls {
+					t.Errorf("Expected %d calls, got %d", tc.expectedCalls, n)
+				}
+
+				// Whether or not the call was retried, the rejected token is not reused
+				if got, err := check(context.Background(), client); err != nil || got != "Bearer new_token" {
+					t.Errorf("Expected Bearer new_token and nil error for the next call, got %q and %v", got, err)
+				}
+				if n := step.lookups.Load(); n != 2 {
+					t.Errorf("Expected 2 discoveries, got %d", n)
+				}
+			},
+		)
+	}
+}
+
+func TestUnaryInterceptorSameToken(t *testing.T) {
+	// The server keeps rejecting the token, which discovery finds again
+	step := &rotatingStep{token: "old_token"}
+	srv := newEchoServer(t, func(string) error { return status.Error(codes.Unauthenticated, "token expired") })
+	client := newInterceptorClient(t, srv, step, grpctoken.WithRetryAllMethods())
+	if _, err := check(context.Background(), client); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Status codes do not match.  Expected %s, got %s", codes.Unauthenticated, status.Code(err))
+	}
+	if n := srv.calls.Load(); n != 1 {
+		t.Errorf("Expected 1 call, got %d", n)
+	}
+}
+
+func TestUnaryInterceptorDeadline(t *testing.T) {
+	// Discovery blocks after the first token is rejected, so that the retry would outlast the deadline of the call
+	block := make(chan struct{})
+	t.Cleanup(func() { close(block) })
+	step := &rotatingStep{token: "old_token"}
+	srv := newEchoServer(t, rejectOldToken(step, block))
+	client := newInterceptorClient(t, srv, step, grpctoken.WithRetryAllMethods())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := check(ctx, client)
+	if code := status.Code(err); code != codes.Unauthenticated {
+		t.Errorf("Status codes do not match.  Expected %s, got %s", codes.Unauthenticated, code)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the call to end with its context, took %s", elapsed)
+	}
+	if n := srv.calls.Load(); n != 1 {
+		t.Errorf("Expected 1 call, got %d", n)
+	}
+}
+
+func TestInterceptorsExistingAuthorization(t *testing.T) {
+	step := &rotatingStep{token: "old_token"}
+	srv := newEchoServer(t, nil)
+	client := newInterceptorClient(t, srv, step)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer own_token")
+	got, err := check(ctx, client)
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	if got != "Bearer own_token" {
+		t.Errorf("Authorization headers do not match.  Expected %q, got %q", "Bearer own_token", got)
+	}
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	if n := step.lookups.Load(); n != 0 {
+		t.Errorf("Expected no discovery, got %d", n)
+	}
+}
+
+func TestStreamInterceptor(t *testing.T) {
+	step := &rotatingStep{token: "old_token"}
+	srv := newEchoServer(t, rejectOldToken(step, nil))
+	client := newInterceptorClient(t, srv, step, grpctoken.WithRetryAllMethods())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	// Streams are not retried, even with WithRetryAllMethods
+	if _, err := stream.Recv(); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Status codes do not match.  Expected %s, got %s", codes.Unauthenticated, status.Code(err))
+	}
+	if n := srv.calls.Load(); n != 1 {
+		t.Errorf("Expected 1 call, got %d", n)
+	}
+
+	// The next stream runs discovery again, instead of reusing the rejected token
+	stream, err = client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	header, err := stream.Header()
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	if got := header.Get("echo-authorization"); len(got) != 1 || got[0] != "Bearer new_token" {
+		t.Errorf("Authorization headers do not match.  Expected %q, got %q", "Bearer new_token", got)
+	}
+	if n := step.lookups.Load(); n != 2 {
+		t.Errorf("Expected 2 discoveries, got %d", n)
+	}
+}
@@ -0,0 +1,56 @@
+package tokendiscovery
+
+import "fmt"
+
+// Header holds the JOSE header of a JWT, as returned by ParseHeader. Like Claims, it is NOT verified.
+type Header struct {
+	// Alg is the signing algorithm, such as RS256 or ES256
+	Alg string
+	// Kid identifies the key the token was signed with, if the issuer sets it
+	Kid string
+	// Typ is the media type of the token, such as JWT or at+jwt
+	Typ string
+	// Extra holds the header parameters not covered by the other fields
+	Extra map[string]any
+}
+
+// ParseHeader decodes the header of tok, a JWT, WITHOUT verifying its signature, for example to see which key it was
+// signed with. Segments are decoded as for ParseClaims, and parameters of unexpected types are left zero. If tok is not
+// a JWT, or its header is not a JSON object, the returned error wraps ErrNotAJWT.
+func ParseHeader(tok []byte) (Header, error) {
+	seg, _, _, err := splitJWT(tok)
+	if err != nil {
+		return Header{}, err
+	}
+	params, err := decodeSegment(seg)
+	if err != nil {
+		return Header{}, fmt.Errorf("%w: invalid header: %w", ErrNotAJWT, err)
+	}
+	h := Header{}
+	for key, val := range params {
+		switch key {
+		case "alg":
+			h.Alg, _ = val.(string)
+		case "kid":
+			h.Kid, _ = val.(string)
+		case "typ":
+			h.Typ, _ = val.(string)
+		default:
+			if h.Extra == nil {
+				h.Extra = make(map[string]any)
+			}
+			h.Extra[key] = val
+		}
+	}
+	return h, nil
+}
+
+// Header returns the header of the token of r, as described for ParseHeader. It is parsed the first time it is needed,
+// and the result shared by copies of r.
+func (r Result) Header() (Header, error) {
+	if r.cache == nil {
+		return ParseHeader(r.token)
+	}
+	r.cache.headerOnce.Do(func() { r.cache.header, r.cache.headerErr = ParseHeader(r.token) })
+	return r.cache.header, r.cache.headerErr
+}
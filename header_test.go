@@ -0,0 +1,101 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestParseHeader(t *testing.T) {
+	type testCase struct {
+		description string
+		tok         []byte
+		expected    disc.Header
+	}
+
+	testCases := []testCase{
+		{
+			"RS256",
+			encodeJWT(`{"alg":"RS256","kid":"rsa1","typ":"at+jwt"}`, `{}`, false),
+			disc.Header{Alg: "RS256", Kid: "rsa1", Typ: "at+jwt"},
+		},
+		{
+			"ES256 with extra parameters",
+			encodeJWT(`{"alg":"ES256","kid":"ec-2024","typ":"JWT","jku":"https://iam.example/jwk"}`, `{}`, true),
+			disc.Header{Alg: "ES256", Kid: "ec-2024", Typ: "JWT", Extra: map[string]any{"jku": "https://iam.example/jwk"}},
+		},
+		{
+			"Missing kid",
+			encodeJWT(`{"alg":"RS256"}`, `{}`, false),
+			disc.Header{Alg: "RS256"},
+		},
+		{
+			"Parameter of unexpected type",
+			encodeJWT(`{"alg":256,"kid":"k"}`, `{}`, false),
+			disc.Header{Kid: "k"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				h, err := disc.ParseHeader(tc.tok)
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if !reflect.DeepEqual(h, tc.expected) {
+					t.Errorf("Headers do not match.  Expected %+v, got %+v", tc.expected, h)
+				}
+			},
+		)
+	}
+}
+
+func TestParseHeaderNotAJWT(t *testing.T) {
+	type testCase struct {
+		description string
+		tok         []byte
+	}
+
+	testCases := []testCase{
+		{"Opaque token", []byte("opaque_token")},
+		{"Header is not JSON", encodeJWT("garbage", `{}`, false)},
+		{"Header is a JSON array", encodeJWT(`["RS256"]`, `{}`, false)},
+		{"Header is not base64url", []byte("!!!.e30.c2ln")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				if _, err := disc.ParseHeader(tc.tok); !errors.Is(err, disc.ErrNotAJWT) {
+					t.Errorf("Expected error %s, got %v", disc.ErrNotAJWT, err)
+				}
+			},
+		)
+	}
+}
+
+func TestResultHeader(t *testing.T) {
+	tok := string(encodeJWT(`{"alg":"RS256","kid":"rsa1"}`, `{"sub":"user"}`, false))
+	d, err := disc.New(disc.WithEnvMap(map[string]string{"BEARER_TOKEN": tok}))
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	res, err := d.Discover()
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		h, err := res.Header()
+		if err != nil {
+			t.Fatalf("Expected nil error, got %v", err)
+		}
+		if h.Kid != "rsa1" {
+			t.Errorf("Key IDs do not match.  Expected rsa1, got %s", h.Kid)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package tokendiscovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrTokenInactive indicates that the introspection endpoint of a token issuer reported a token as inactive: expired,
+// revoked, or never issued by it
+var ErrTokenInactive = errors.New("token is not active")
+
+// ClientCredentials identifies an OAuth client to the endpoints of a token issuer, such as its introspection endpoint
+type ClientCredentials struct {
+	ID     string
+	Secret string
+}
+
+// IntrospectionResult holds the response of a token introspection endpoint, as returned by Introspect. Unlike the
+// claims of a JWT, it comes from the issuer itself, so it can be trusted as far as the connection to the issuer can.
+// Times that are missing from the response are zero.
+type IntrospectionResult struct {
+	Active bool
+	Sub    string
+	Aud    []string
+	Exp    time.Time
+	Scope  []string
+	// Claims holds the whole response, including members not covered by the other fields such as iss or client_id
+	Claims Claims
+}
+
+// IntrospectOption configures Introspect
+type IntrospectOption func(*introspectConfig)
+
+// introspectConfig holds the settings of Introspect
+type introspectConfig struct {
+	client *http.Client
+}
+
+// IntrospectHTTPClient sets the HTTP client used by Introspect, http.DefaultClient by default
+func IntrospectHTTPClient(client *http.Client) IntrospectOption {
+	return func(c *introspectConfig) {
+		c.client = client
+	}
+}
+
+// Introspect asks the RFC 7662 introspection endpoint of a token issuer, found for example in the
+// introspection_endpoint of its IssuerMetadata, about tok, authenticating as the client identified by creds. This is
+// the only way to learn the expiry and scopes of opaque tokens, which cannot be parsed with ParseClaims. If the token
+// is inactive, the returned error wraps ErrTokenInactive, and the IntrospectionResult is returned as well. If the
+// request fails, the returned error wraps ErrIssuerUnreachable; and if the response status is not 200 OK, for example
+// because the client is not authorized, ErrUnexpectedStatus, through an *OAuthError if the issuer gives a reason. The
+// token never appears in errors.
+func Introspect(ctx context.Context, introspectionURL string, creds ClientCredentials, tok []byte,
+	opts ...IntrospectOption) (IntrospectionResult, error) {
+	cfg := introspectConfig{client: http.DefaultClient}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.client == nil {
+		cfg.client = http.DefaultClient
+	}
+
+	form := url.Values{
+		"token":           {string(bytes.TrimSpace(tok))},
+		"token_type_hint": {"access_token"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, introspectionURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return IntrospectionResult{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// RFC 6749 requires the credentials to be form-encoded before they are combined
+	req.SetBasicAuth(url.QueryEscape(creds.ID), url.QueryEscape(creds.Secret))
+	data, err := do(cfg.client, req)
+	if err != nil {
+		return IntrospectionResult{}, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var claims Claims
+	if err := dec.Decode(&claims); err != nil || claims == nil {
+		return IntrospectionResult{}, fmt.Errorf("%s: invalid introspection response", req.URL.Redacted())
+	}
+	active, ok := claims["active"].(bool)
+	if !ok {
+		return IntrospectionResult{}, fmt.Errorf("%s: introspection response has no active member",
+			req.URL.Redacted())
+	}
+	res := IntrospectionResult{
+		Active: active,
+		Sub:    claims.Subject(),
+		Aud:    claims.Audience(),
+		Scope:  claims.Scope(),
+		Claims: claims,
+	}
+	res.Exp, _ = claims.Expiry()
+	if !active {
+		return res, ErrTokenInactive
+	}
+	return res, nil
+}
@@ -0,0 +1,103 @@
+package tokendiscovery_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestIntrospect(t *testing.T) {
+	const (
+		clientID     = "storage-client"
+		clientSecret = "s3cr3t:with/reserved"
+		activeTok    = "opaque-active-token"
+		inactiveTok  = "opaque-revoked-token"
+	)
+	exp := time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != clientID || secret != "s3cr3t%3Awith%2Freserved" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		switch r.PostFormValue("token") {
+		case activeTok:
+			io.WriteString(w, `{"active":true,"sub":"user","aud":["https://storage.example"],"exp":1714568400,`+
+				`"scope":"storage.read:/ storage.create:/data","iss":"https://issuer.example"}`)
+		default:
+			io.WriteString(w, `{"active":false}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	creds := disc.ClientCredentials{ID: clientID, Secret: clientSecret}
+
+	type testCase struct {
+		description string
+		creds       disc.ClientCredentials
+		tok         string
+		expectedErr error
+		expected    disc.IntrospectionResult
+	}
+
+	testCases := []testCase{
+		{
+			"Active token",
+			creds,
+			activeTok,
+			nil,
+			disc.IntrospectionResult{
+				Active: true,
+				Sub:    "user",
+				Aud:    []string{"https://storage.example"},
+				Exp:    exp,
+				Scope:  []string{"storage.read:/", "storage.create:/data"},
+			},
+		},
+		{"Inactive token", creds, inactiveTok, disc.ErrTokenInactive, disc.IntrospectionResult{}},
+		{"Unauthorized client", disc.ClientCredentials{ID: clientID, Secret: "wrong"}, activeTok, disc.ErrUnexpectedStatus, disc.IntrospectionResult{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				res, err := disc.Introspect(context.Background(), srv.URL, tc.creds, []byte(tc.tok),
+					disc.IntrospectHTTPClient(srv.Client()))
+				if !errors.Is(err, tc.expectedErr) {
+					t.Fatalf("Errors do not match.  Expected %v, got %v", tc.expectedErr, err)
+				}
+				if err != nil && strings.Contains(err.Error(), tc.tok) {
+					t.Errorf("Error contains the token: %s", err)
+				}
+				if res.Active != tc.expected.Active || res.Sub != tc.expected.Sub || !res.Exp.Equal(tc.expected.Exp) ||
+					!slices.Equal(res.Aud, tc.expected.Aud) || !slices.Equal(res.Scope, tc.expected.Scope) {
+					t.Errorf("Introspection results do not match.  Expected %+v, got %+v", tc.expected, res)
+				}
+				if tc.expected.Active && res.Claims.Issuer() != "https://issuer.example" {
+					t.Errorf("Issuers do not match.  Expected https://issuer.example, got %s", res.Claims.Issuer())
+				}
+			},
+		)
+	}
+}
+
+func TestIntrospectUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	_, err := disc.Introspect(context.Background(), srv.URL, disc.ClientCredentials{}, []byte("tok"))
+	if !errors.Is(err, disc.ErrIssuerUnreachable) {
+		t.Errorf("Errors do not match.  Expected %v, got %v", disc.ErrIssuerUnreachable, err)
+	}
+}
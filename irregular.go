@@ -0,0 +1,58 @@
+package tokendiscovery
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// ErrNotRegularFile indicates that a token file was not read because it is a FIFO, socket, device, or other special
+// file. Reading a FIFO with no writer would block forever, so such files are not read, and the step that found one
+// continues as if the token file were empty, unless WithFIFOs is given.
+var ErrNotRegularFile = errors.New("token file is not a regular file")
+
+// ErrFIFOTimeout indicates that no token was written to a FIFO read with WithFIFOs within the configured timeout
+var ErrFIFOTimeout = errors.New("timed out waiting for token on FIFO")
+
+// WithFIFOs makes discovery read token files that are FIFOs (named pipes), for sites that deliver tokens through them,
+// instead of skipping them as described for ErrNotRegularFile. Discovery waits up to timeout for a writer to write the
+// token and close the FIFO, and fails with an error wrapping ErrFIFOTimeout if none does. FIFOs are only read from the
+// OS filesystem, on Unix.
+func WithFIFOs(timeout time.Duration) Option {
+	return func(d *Discoverer) error {
+		if timeout <= 0 {
+			return fmt.Errorf("%w: FIFO timeout must be positive", ErrInvalidOption)
+		}
+		d.fifoTimeout = timeout
+		return nil
+	}
+}
+
+// checkRegularFile returns an error wrapping ErrNotRegularFile if the named file is a special file, without opening it.
+// Directories and symlinks that are not to be followed are left to be reported when the file is opened. If the file
+// is a FIFO that may be read as described for WithFIFOs, isFIFO is true.
+func (d *Discoverer) checkRegularFile(name string, followSymlinks bool) (isFIFO bool, err error) {
+	var info fs.FileInfo
+	switch {
+	case d.fsys != nil:
+		info, err = fs.Stat(d.fsys, fsPath(name))
+	case followSymlinks:
+		info, err = os.Stat(name)
+	default:
+		info, err = os.Lstat(name)
+	}
+	if err != nil {
+		// Opening the file reports the error
+		return false, nil
+	}
+	mode := info.Mode()
+	switch {
+	case mode.IsRegular(), mode.IsDir(), mode&fs.ModeSymlink != 0:
+		return false, nil
+	case mode&fs.ModeNamedPipe != 0 && d.fifoTimeout > 0 && d.fsys == nil && canReadFIFOs:
+		return true, nil
+	}
+	return false, fmt.Errorf("%w: %s has mode %s", ErrNotRegularFile, name, mode)
+}
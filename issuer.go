@@ -0,0 +1,65 @@
+package tokendiscovery
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrNoTrustedIssuer indicates that a token was skipped because its iss claim is not among those allowed with
+// WithAllowedIssuers. If no token qualifies, the error returned by discovery wraps both it and ErrNoTokenFound, and
+// lists the issuers that were rejected.
+var ErrNoTrustedIssuer = errors.New("token issuer is not trusted")
+
+// WithAllowedIssuers makes discovery skip tokens whose iss claim is not one of issuers, so that a stray token from
+// another issuer is never used. Trailing slashes are ignored when comparing issuers. Tokens that are not JWTs are
+// skipped.
+func WithAllowedIssuers(issuers ...string) Option {
+	return func(d *Discoverer) error {
+		if len(issuers) == 0 {
+			return fmt.Errorf("%w: at least one issuer must be allowed", ErrInvalidOption)
+		}
+		d.allowedIssuers = make([]string, 0, len(issuers))
+		for _, iss := range issuers {
+			if normalizeIssuer(iss) == "" {
+				return fmt.Errorf("%w: issuer cannot be empty", ErrInvalidOption)
+			}
+			d.allowedIssuers = append(d.allowedIssuers, normalizeIssuer(iss))
+		}
+		return nil
+	}
+}
+
+// normalizeIssuer returns iss without trailing slashes, so that https://iam.example/ and https://iam.example compare
+// equal
+func normalizeIssuer(iss string) string {
+	return strings.TrimRight(iss, "/")
+}
+
+// issuerError returns the error recording that a token was skipped because its issuer, iss, is not allowed
+func issuerError(iss string) error {
+	return &claimError{sentinel: ErrNoTrustedIssuer, claim: "iss claim", value: iss}
+}
+
+// checkIssuer returns an error wrapping ErrNoTrustedIssuer if tok should be skipped according to WithAllowedIssuers
+func (d *Discoverer) checkIssuer(tok []byte) error {
+	if len(d.allowedIssuers) == 0 {
+		return nil
+	}
+	claims, err := parseClaimsCached(tok)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNoTrustedIssuer, err)
+	}
+	iss := claims.Issuer()
+	if iss != "" && slices.Contains(d.allowedIssuers, normalizeIssuer(iss)) {
+		return nil
+	}
+	return issuerError(iss)
+}
+
+// untrustedIssuerError returns the error summarizing the issuers of the tokens in rejected skipped by checkIssuer, for
+// discovery to return when no token qualified. It returns nil if no token was skipped for its issuer.
+func (d *Discoverer) untrustedIssuerError(rejected []error) error {
+	return claimMismatchError(rejected, ErrNoTrustedIssuer, "iss claim", "", "the issuers rejected")
+}
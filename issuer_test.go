@@ -0,0 +1,71 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestAllowedIssuers(t *testing.T) {
+	const trusted = "https://iam.experiment.example/"
+	fromTrusted := makeJWT(t, map[string]any{"iss": trusted})
+	fromTrustedNoSlash := makeJWT(t, map[string]any{"iss": "https://iam.experiment.example"})
+	fromOther := makeJWT(t, map[string]any{"iss": "https://other.example/"})
+	fromElsewhere := makeJWT(t, map[string]any{"iss": "https://elsewhere.example"})
+
+	type testCase struct {
+		description   string
+		envToken      string
+		fileToken     string
+		allowed       []string
+		expectedToken string
+		expectedErr   error
+	}
+
+	testCases := []testCase{
+		{"Matching issuer", fromTrusted, fromOther, []string{trusted}, fromTrusted, nil},
+		{"Non-matching issuer falls through", fromOther, fromTrusted, []string{trusted}, fromTrusted, nil},
+		{"Token without trailing slash", fromTrustedNoSlash, fromOther, []string{trusted}, fromTrustedNoSlash, nil},
+		{"Allowed issuer without trailing slash", fromTrusted, fromOther, []string{"https://iam.experiment.example"}, fromTrusted, nil},
+		{"One of several allowed issuers", fromOther, fromTrusted, []string{"https://elsewhere.example", "https://other.example"}, fromOther, nil},
+		{"Opaque token falls through", "opaque_token", fromTrusted, []string{trusted}, fromTrusted, nil},
+		{"No trusted issuer", fromOther, fromElsewhere, []string{trusted}, "", disc.ErrNoTrustedIssuer},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				d, err := disc.New(
+					disc.WithEnvMap(map[string]string{"BEARER_TOKEN": tc.envToken, "BEARER_TOKEN_FILE": "/home/user/token"}),
+					disc.WithFS(fstest.MapFS{"home/user/token": {Data: []byte(tc.fileToken + "\n")}}),
+					disc.WithAllowedIssuers(tc.allowed...),
+				)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, err := d.FindToken()
+				if tc.expectedErr != nil {
+					if !errors.Is(err, tc.expectedErr) || !errors.Is(err, disc.ErrNoTokenFound) {
+						t.Fatalf("Expected error wrapping %s and %s, got %v", tc.expectedErr, disc.ErrNoTokenFound, err)
+					}
+					for _, iss := range []string{"https://other.example/", "https://elsewhere.example"} {
+						if !strings.Contains(err.Error(), iss) {
+							t.Errorf("Expected error to list issuer %s, got %v", iss, err)
+						}
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if string(tok) != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, tok)
+				}
+			},
+		)
+	}
+}
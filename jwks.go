@@ -0,0 +1,174 @@
+package tokendiscovery
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ErrInvalidJWKS indicates that a JSON Web Key Set could not be parsed
+var ErrInvalidJWKS = errors.New("invalid JSON Web Key Set")
+
+// JWKSet is a set of public keys for verifying tokens, as parsed by ParseJWKS. Only RSA and P-256 signing keys are
+// kept.
+type JWKSet struct {
+	keys []jwk
+}
+
+// jwk is a public key of a JWKSet
+type jwk struct {
+	kid string
+	alg string
+	// key is an *rsa.PublicKey or an *ecdsa.PublicKey
+	key crypto.PublicKey
+}
+
+// rawJWK is a JSON Web Key as found in a JWKS document
+type rawJWK struct {
+	Kty string   `json:"kty"`
+	Use string   `json:"use"`
+	Kid string   `json:"kid"`
+	Alg string   `json:"alg"`
+	N   string   `json:"n"`
+	E   string   `json:"e"`
+	Crv string   `json:"crv"`
+	X   string   `json:"x"`
+	Y   string   `json:"y"`
+	X5c []string `json:"x5c"`
+}
+
+// ParseJWKS parses data, a JSON Web Key Set as served by the jwks_uri of a token issuer. Keys other than RSA and P-256
+// EC keys, and keys meant for encryption, are ignored. An RSA key is taken from its n and e parameters, or else from
+// the first certificate of its x5c chain. If data is malformed, or a key cannot be decoded, the returned error wraps
+// ErrInvalidJWKS.
+func ParseJWKS(data []byte) (*JWKSet, error) {
+	var doc struct {
+		Keys []rawJWK `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidJWKS, err)
+	}
+	set := &JWKSet{}
+	for i, raw := range doc.Keys {
+		if raw.Use != "" && raw.Use != "sig" {
+			continue
+		}
+		var key crypto.PublicKey
+		var err error
+		switch {
+		case raw.Kty == "RSA":
+			key, err = raw.rsaKey()
+		case raw.Kty == "EC" && raw.Crv == "P-256":
+			key, err = raw.ecKey()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %d (kid %q): %w", ErrInvalidJWKS, i, raw.Kid, err)
+		}
+		set.keys = append(set.keys, jwk{kid: raw.Kid, alg: raw.Alg, key: key})
+	}
+	return set, nil
+}
+
+// rsaKey returns the RSA public key described by k
+func (k rawJWK) rsaKey() (*rsa.PublicKey, error) {
+	if k.N == "" && k.E == "" && len(k.X5c) > 0 {
+		der, err := base64.StdEncoding.DecodeString(k.X5c[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid x5c: %w", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x5c: %w", err)
+		}
+		key, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("x5c certificate does not hold an RSA key")
+		}
+		return key, nil
+	}
+	n, err := decodeBigInt(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := decodeBigInt(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+	if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+		return nil, errors.New("exponent out of range")
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+// ecKey returns the P-256 public key described by k
+func (k rawJWK) ecKey() (*ecdsa.PublicKey, error) {
+	x, err := decodeBigInt(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x coordinate: %w", err)
+	}
+	y, err := decodeBigInt(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("invalid y coordinate: %w", err)
+	}
+	if x.BitLen() > 256 || y.BitLen() > 256 {
+		return nil, errors.New("coordinates out of range")
+	}
+	// Parsing the point in uncompressed form checks that it is on the curve
+	point := make([]byte, 65)
+	point[0] = 4
+	x.FillBytes(point[1:33])
+	y.FillBytes(point[33:])
+	if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+		return nil, err
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+}
+
+// decodeBigInt decodes a base64url-encoded, big-endian unsigned integer
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Len returns the number of keys in s
+func (s *JWKSet) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.keys)
+}
+
+// lookup returns the key of s identified by kid. If kid is empty, s must hold a single key.
+func (s *JWKSet) lookup(kid string) (jwk, bool) {
+	if s == nil {
+		return jwk{}, false
+	}
+	if kid == "" {
+		if len(s.keys) == 1 {
+			return s.keys[0], true
+		}
+		return jwk{}, false
+	}
+	for _, k := range s.keys {
+		if k.kid == kid {
+			return k, true
+		}
+	}
+	return jwk{}, false
+}
@@ -0,0 +1,84 @@
+package tokendiscovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// DefaultKubernetesTokenPath is the mount location of a projected-volume token used by WithKubernetesTokenPath by
+// default
+const DefaultKubernetesTokenPath = "/var/run/secrets/wlcg/bearer_token"
+
+// kubernetesReadAttempts bounds how many times a token is re-read when the kubelet swaps it out during the read
+const kubernetesReadAttempts = 3
+
+// WithKubernetesTokenPath adds KubernetesTokenStep(path) to the discovery procedure, just before the fallback step. To
+// place the step elsewhere in the chain, use WithSteps instead.
+func WithKubernetesTokenPath(path string) Option {
+	return func(d *Discoverer) error {
+		d.kubernetesTokenPath = path
+		if d.kubernetesTokenPath == "" {
+			d.kubernetesTokenPath = DefaultKubernetesTokenPath
+		}
+		if !filepath.IsAbs(d.kubernetesTokenPath) {
+			return fmt.Errorf("%w: Kubernetes token path %q is not an absolute path", ErrInvalidOption, path)
+		}
+		return nil
+	}
+}
+
+// KubernetesTokenStep returns a Step that reads the token from a Kubernetes projected volume mounted at path, or at
+// DefaultKubernetesTokenPath if path is empty. The kubelet updates projected volumes by atomically swapping the ..data
+// symlink that the token file points through, so the step checks that the file resolves to the same target before and
+// after reading it, and reads it again if it does not. If the file does not exist or is empty, discovery continues with
+// the next step.
+func KubernetesTokenStep(path string) Step {
+	if path == "" {
+		path = DefaultKubernetesTokenPath
+	}
+	return kubernetesStep{path}
+}
+
+// kubernetesStep reads the token from a Kubernetes projected volume
+type kubernetesStep struct {
+	path string
+}
+
+func (kubernetesStep) Name() string { return SourceKubernetes.String() }
+
+func (k kubernetesStep) Lookup(ctx context.Context, _ Environ, fsys FileReader) (Result, error) {
+	d := stepDiscoverer(fsys)
+	for attempt := 1; ; attempt++ {
+		before, err := d.resolveSymlinks(k.path)
+		if err != nil {
+			return Result{}, SkipStep(&DiscoveryError{Step: SourceKubernetes, Path: k.path, Err: err})
+		}
+		tok, err := fsys.ReadTokenFile(ctx, k.path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist), errors.Is(err, ErrEmptyToken):
+			return Result{}, SkipStep(&DiscoveryError{Step: SourceKubernetes, Path: k.path, Err: err})
+		case err != nil:
+			return Result{}, d.readFailure(SourceKubernetes, k.path, err)
+		}
+		after, err := d.resolveSymlinks(k.path)
+		if err == nil && after == before {
+			return Result{token: tok, path: k.path, source: SourceKubernetes}, nil
+		}
+		if attempt == kubernetesReadAttempts {
+			return Result{}, &DiscoveryError{Step: SourceKubernetes, Path: k.path, Err: fmt.Errorf("token file %s kept changing while it was read", k.path)}
+		}
+		d.debug("token file changed while it was read, reading it again", "path", k.path, "before", before, "after", after)
+	}
+}
+
+// resolveSymlinks returns the path the named file resolves to after following symlinks. Since fs.FS does not expose
+// symlinks, a path on an injected filesystem resolves to itself.
+func (d *Discoverer) resolveSymlinks(name string) (string, error) {
+	if d.fsys != nil {
+		return name, nil
+	}
+	return filepath.EvalSymlinks(name)
+}
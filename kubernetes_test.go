@@ -0,0 +1,140 @@
+package tokendiscovery_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+// makeKubeletVolume lays out dir the way the kubelet lays out a projected volume: the token file is a symlink into the
+// ..data symlink, which points at a timestamped directory holding the real file
+func makeKubeletVolume(t *testing.T, dir, version, token string) {
+	t.Helper()
+	writeKubeletVersion(t, dir, version, token)
+	if err := os.Symlink(version, filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..data", "bearer_token"), filepath.Join(dir, "bearer_token")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeKubeletVersion(t *testing.T, dir, version, token string) {
+	t.Helper()
+	if err := os.Mkdir(filepath.Join(dir, version), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, version, "bearer_token"), []byte(token), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// swapKubeletVersion atomically points ..data at version, as the kubelet does when the projected token is updated
+func swapKubeletVersion(t *testing.T, dir, version string) {
+	t.Helper()
+	tmpLink := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(version, tmpLink); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmpLink, filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// swappingReader swaps the kubelet volume to a new version right after the first read completes
+type swappingReader struct {
+	t       *testing.T
+	d       *disc.Discoverer
+	dir     string
+	version string
+	reads   int
+}
+
+func (s *swappingReader) ReadTokenFile(ctx context.Context, path string) ([]byte, error) {
+	tok, err := s.d.ReadTokenFile(ctx, path)
+	s.reads++
+	if s.reads == 1 {
+		swapKubeletVersion(s.t, s.dir, s.version)
+	}
+	return tok, err
+}
+
+func TestKubernetesTokenStep(t *testing.T) {
+	t.Run(
+		"Projected volume token found before fallback",
+		func(t *testing.T) {
+			dir := t.TempDir()
+			makeKubeletVolume(t, dir, "..2024_01_01_00_00_00.1", "kube_token\n")
+			tokenPath := filepath.Join(dir, "bearer_token")
+			fallbackDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(fallbackDir, "bt_u4242"), []byte("tmp_token"), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			d, err := disc.New(
+				disc.WithEnvMap(map[string]string{}),
+				disc.WithUID("4242"),
+				disc.WithoutOwnershipCheck(),
+				disc.WithFallbackDir(fallbackDir),
+				disc.WithKubernetesTokenPath(tokenPath),
+			)
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			res, err := d.Discover()
+			if err != nil {
+				t.Fatalf("Expected nil error, got %s", err)
+			}
+			if string(res.Bytes()) != "kube_token" {
+				t.Errorf("Token strings do not match.  Expected kube_token, got %s", res.Bytes())
+			}
+			if res.Path() != tokenPath {
+				t.Errorf("Token paths do not match. Expected path %s, got %s", tokenPath, res.Path())
+			}
+			if res.Source() != disc.SourceKubernetes {
+				t.Errorf("Token sources do not match. Expected source %s, got %s", disc.SourceKubernetes, res.Source())
+			}
+
+			// Once the volume is gone, discovery falls through
+			if err := os.Remove(tokenPath); err != nil {
+				t.Fatal(err)
+			}
+			res, err = d.Discover()
+			if err != nil {
+				t.Fatalf("Expected nil error, got %s", err)
+			}
+			if res.Source() != disc.SourceTmpFallback {
+				t.Errorf("Token sources do not match. Expected source %s, got %s", disc.SourceTmpFallback, res.Source())
+			}
+		},
+	)
+
+	t.Run(
+		"Token re-read when the kubelet swaps it during the read",
+		func(t *testing.T) {
+			dir := t.TempDir()
+			makeKubeletVolume(t, dir, "..2024_01_01_00_00_00.1", "old_token")
+			writeKubeletVersion(t, dir, "..2024_01_01_01_00_00.2", "new_token")
+
+			d, err := disc.New()
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			reader := &swappingReader{t: t, d: d, dir: dir, version: "..2024_01_01_01_00_00.2"}
+			step := disc.KubernetesTokenStep(filepath.Join(dir, "bearer_token"))
+			res, err := step.Lookup(context.Background(), os.LookupEnv, reader)
+			if err != nil {
+				t.Fatalf("Expected nil error, got %s", err)
+			}
+			if string(res.Bytes()) != "new_token" {
+				t.Errorf("Token strings do not match.  Expected new_token, got %s", res.Bytes())
+			}
+			if reader.reads != 2 {
+				t.Errorf("Expected 2 reads, got %d", reader.reads)
+			}
+		},
+	)
+}
@@ -0,0 +1,57 @@
+package tokendiscovery
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrTokenFileLocked indicates that a token file could not be read with WithFileLocking because another process held
+// an exclusive lock on it for longer than the configured wait
+var ErrTokenFileLocked = errors.New("token file is locked by another process")
+
+// errLockUnsupported is returned by tryLockShared on platforms without flock
+var errLockUnsupported = errors.New("file locking is not supported")
+
+// lockRetryInterval is how often a shared lock on a token file is attempted while another process holds it
+const lockRetryInterval = 10 * time.Millisecond
+
+// WithFileLocking makes discovery take a shared advisory lock (flock) on token files while reading them, for tools
+// such as credmon that rewrite token files in place while holding an exclusive lock. If the lock cannot be taken within
+// wait, the read fails with an error wrapping ErrTokenFileLocked. Files read through WithFS are locked too if the
+// filesystem opens them as *os.File, as os.DirFS does. On platforms without flock, and for other filesystems, such as
+// testing/fstest.MapFS, token files are read without locking.
+func WithFileLocking(wait time.Duration) Option {
+	return func(d *Discoverer) error {
+		if wait < 0 {
+			return fmt.Errorf("%w: lock wait cannot be negative", ErrInvalidOption)
+		}
+		d.fileLocking = true
+		d.lockWait = wait
+		return nil
+	}
+}
+
+// lockShared takes a shared lock on f, waiting up to d.lockWait for an exclusive lock held by another process to be
+// released. The returned function releases the lock.
+func (d *Discoverer) lockShared(f *os.File) (func(), error) {
+	deadline := time.Now().Add(d.lockWait)
+	for {
+		locked, err := tryLockShared(f)
+		if err == errLockUnsupported {
+			d.debug("file locking is not supported", "path", f.Name())
+			return func() {}, nil
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "flock", Path: f.Name(), Err: err}
+		}
+		if locked {
+			return func() { unlock(f) }, nil
+		}
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("%w: %s, after waiting %s", ErrTokenFileLocked, f.Name(), d.lockWait)
+		}
+		time.Sleep(min(lockRetryInterval, time.Until(deadline)))
+	}
+}
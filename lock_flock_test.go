@@ -0,0 +1,131 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package tokendiscovery_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestFileLocking(t *testing.T) {
+	type testCase struct {
+		description   string
+		holdFor       time.Duration
+		wait          time.Duration
+		expectedToken string
+		expectedErr   error
+	}
+
+	testCases := []testCase{
+		{
+			"File is not locked",
+			0,
+			time.Second,
+			"locked_token",
+			nil,
+		},
+		{
+			"Lock released while waiting",
+			100 * time.Millisecond,
+			10 * time.Second,
+			"locked_token",
+			nil,
+		},
+		{
+			"Lock held for longer than the wait",
+			-1,
+			50 * time.Millisecond,
+			"",
+			disc.ErrTokenFileLocked,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				fname := filepath.Join(t.TempDir(), "token")
+				if err := os.WriteFile(fname, []byte("locked_token\n"), 0o600); err != nil {
+					t.Fatalf("Could not create file: %s", err)
+				}
+				if tc.holdFor != 0 {
+					f, err := os.Open(fname)
+					if err != nil {
+						t.Fatalf("Could not open file: %s", err)
+					}
+					defer f.Close()
+					fd := int(f.Fd())
+					if err := syscall.Flock(fd, syscall.LOCK_EX); err != nil {
+						t.Fatalf("Could not lock file: %s", err)
+					}
+					if tc.holdFor > 0 {
+						timer := time.AfterFunc(tc.holdFor, func() { syscall.Flock(fd, syscall.LOCK_UN) })
+						defer timer.Stop()
+					}
+				}
+
+				d, err := disc.New(
+					disc.WithEnvMap(map[string]string{"BEARER_TOKEN_FILE": fname}),
+					disc.WithFileLocking(tc.wait),
+				)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				start := time.Now()
+				tok, err := d.FindToken()
+				if tc.expectedErr != nil {
+					if !errors.Is(err, tc.expectedErr) {
+						t.Errorf("Expected error %s, got %v", tc.expectedErr, err)
+					}
+					if errors.Is(err, disc.ErrNoTokenFound) {
+						t.Errorf("Expected lock failure not to be reported as %s", disc.ErrNoTokenFound)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if string(tok) != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, string(tok))
+				}
+				if elapsed := time.Since(start); tc.holdFor > 0 && elapsed < tc.holdFor {
+					t.Errorf("Expected read to wait for the lock for %s, returned after %s", tc.holdFor, elapsed)
+				}
+			},
+		)
+	}
+}
+
+func TestFileLockingWithFS(t *testing.T) {
+	// Files opened by os.DirFS are *os.File, and so are locked like files read directly
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "token"), []byte("locked_token\n"), 0o600); err != nil {
+		t.Fatalf("Could not create file: %s", err)
+	}
+	f, err := os.Open(filepath.Join(dir, "token"))
+	if err != nil {
+		t.Fatalf("Could not open file: %s", err)
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		t.Fatalf("Could not lock file: %s", err)
+	}
+
+	d, err := disc.New(
+		disc.WithEnvMap(map[string]string{"BEARER_TOKEN_FILE": "/token"}),
+		disc.WithFS(os.DirFS(dir)),
+		disc.WithFileLocking(50*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	if _, err := d.FindToken(); !errors.Is(err, disc.ErrTokenFileLocked) {
+		t.Errorf("Expected error %s, got %v", disc.ErrTokenFileLocked, err)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package tokendiscovery
+
+import "os"
+
+func tryLockShared(*os.File) (bool, error) { return false, errLockUnsupported }
+
+func unlock(*os.File) {}
@@ -0,0 +1,180 @@
+package tokendiscovery
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrCannotWriteToken indicates that a discovered token could not be written to a file
+var ErrCannotWriteToken = errors.New("cannot write token file")
+
+// FindTokenFile follows the WLCG Bearer Token Discovery procedure and returns the path of a file containing the token,
+// for tools that accept a token filename rather than the token itself. If the token was found in a file that only the
+// current user can access, and the file holds nothing but the token, that file's path is returned. Otherwise, including
+// when the token file is readable by group or other, or the token was taken from a JSON token response, a line among
+// others or after a "Bearer " prefix, the token is written to a file readable only by the current user, in
+// $XDG_RUNTIME_DIR if set and os.TempDir() if not, and the path of that file is returned. Repeated calls with an
+// unchanged token reuse the same file.
+func FindTokenFile() (string, error) {
+	return defaultDiscoverer.FindTokenFile()
+}
+
+// FindTokenFileContext is like FindTokenFile, but abandons discovery when ctx is done. In that case, the returned error
+// wraps ctx.Err().
+func FindTokenFileContext(ctx context.Context) (string, error) {
+	return defaultDiscoverer.FindTokenFileContext(ctx)
+}
+
+// FindTokenFile is like the package-level FindTokenFile, but uses the discovery procedure as configured on d
+func (d *Discoverer) FindTokenFile() (string, error) {
+	return d.FindTokenFileContext(context.Background())
+}
+
+// FindTokenFileContext is like FindTokenFile, but abandons discovery when ctx is done
+func (d *Discoverer) FindTokenFileContext(ctx context.Context) (string, error) {
+	res, err := d.DiscoverContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	if res.path != "" && !res.rewritten {
+		private, err := d.isPrivateFile(res.path)
+		if err != nil {
+			return "", err
+		}
+		if private {
+			return res.path, nil
+		}
+		d.debug("copying token file accessible by other users", "path", res.path)
+	} else if res.rewritten {
+		d.debug("copying token that differs from the contents of its file", "path", res.path)
+	}
+
+	dir := d.getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	uid, err := d.currentUID()
+	if err != nil {
+		return "", err
+	}
+	// Name the file after the token's digest so that an unchanged token maps onto the file written previously, and
+	// concurrent callers with different tokens never overwrite each other's files
+	sum := sha256.Sum256(res.token)
+	name := fmt.Sprintf("%s.env-%s", d.tokenFileName(uid), hex.EncodeToString(sum[:8]))
+	return d.writeTokenFile(dir, name, res.token)
+}
+
+// MaterializeToken follows the WLCG Bearer Token Discovery procedure and makes sure the token is available at the
+// standard file location, for programs that only understand the bt_u$ID convention. If the token was not read from a
+// file, as when it came from the BEARER_TOKEN environment variable, oidc-agent, a token command or a step added with
+// WithSteps, it is written with mode 0600 to $XDG_RUNTIME_DIR/bt_u$ID, or to /tmp/bt_u$ID (or the configured fallback
+// directory) if XDG_RUNTIME_DIR is not set, and that path is returned. The write goes through a temporary file and a
+// rename, so concurrent readers never see a partial token, and an existing file with identical contents is left
+// untouched. If the token was already found in a file, that file's path is returned.
+//
+// Failure to write the file is reported with an error wrapping ErrCannotWriteToken, distinct from ErrNoTokenFound.
+func MaterializeToken(ctx context.Context) (string, error) {
+	return defaultDiscoverer.MaterializeToken(ctx)
+}
+
+// MaterializeToken is like the package-level MaterializeToken, but uses the discovery procedure as configured on d
+func (d *Discoverer) MaterializeToken(ctx context.Context) (string, error) {
+	res, err := d.DiscoverContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	if res.path != "" {
+		return res.path, nil
+	}
+
+	dir := d.getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		if d.noFallback {
+			return "", fmt.Errorf("%w: XDG_RUNTIME_DIR is not set and the fallback directory is disabled", ErrCannotWriteToken)
+		}
+		dir = d.fallbackDirectory()
+	}
+	uid, err := d.currentUID()
+	if err != nil {
+		return "", err
+	}
+	return d.writeTokenFile(dir, d.tokenFileName(uid), res.token)
+}
+
+// writeTokenFile writes tok to the file name in dir with mode 0600, and returns its path. The file is written to a
+// temporary file that is renamed into place, so readers never see a partially-written token. If the file already exists
+// with the same contents and is not accessible to other users, it is left untouched.
+func (d *Discoverer) writeTokenFile(dir, name string, tok []byte) (string, error) {
+	if d.fsys != nil {
+		return "", fmt.Errorf("%w: token files cannot be written through an injected filesystem", ErrCannotWriteToken)
+	}
+
+	path := filepath.Join(dir, name)
+	if existingTokenFileMatches(path, tok) {
+		d.debug("reusing existing token file", "path", path)
+		return path, nil
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+name+".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("%w in %s: %w", ErrCannotWriteToken, dir, err)
+	}
+	tmpName := tmp.Name()
+	cleanup := func(err error) (string, error) {
+		tmp.Close()
+		os.Remove(tmpName)
+		return "", fmt.Errorf("%w %s: %w", ErrCannotWriteToken, path, err)
+	}
+
+	// os.CreateTemp already uses mode 0600, but be explicit since this is a security property
+	if err := tmp.Chmod(0600); err != nil {
+		return cleanup(err)
+	}
+	if _, err := tmp.Write(tok); err != nil {
+		return cleanup(err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return cleanup(err)
+	}
+	if err := tmp.Close(); err != nil {
+		return cleanup(err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return "", fmt.Errorf("%w %s: %w", ErrCannotWriteToken, path, err)
+	}
+	d.debug("wrote token file", "path", path)
+	return path, nil
+}
+
+// isPrivateFile reports whether the file at path is inaccessible to group and other. Files are assumed to be private on
+// platforms where permission bits do not reflect who can access them.
+func (d *Discoverer) isPrivateFile(path string) (bool, error) {
+	if d.fsys == nil && !hasFileModes {
+		return true, nil
+	}
+	info, err := d.stat(path)
+	if err != nil {
+		return false, fmt.Errorf("cannot check permissions of token file: %w", err)
+	}
+	return info.Mode().Perm()&0o077 == 0, nil
+}
+
+// existingTokenFileMatches reports whether path is a regular file, inaccessible to group and other, holding exactly tok
+func existingTokenFileMatches(path string, tok []byte) bool {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0077 != 0 {
+		return false
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(contents, tok)
+}
@@ -0,0 +1,424 @@
+package tokendiscovery_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestFindTokenFile(t *testing.T) {
+	t.Run(
+		"Token found in a file returns that file",
+		func(t *testing.T) {
+			tokenFile := filepath.Join(t.TempDir(), "bt_test_file")
+			if err := os.WriteFile(tokenFile, []byte("12345"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			d, err := disc.New(disc.WithEnvMap(map[string]string{"BEARER_TOKEN_FILE": tokenFile}))
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			path, err := d.FindTokenFile()
+			if err != nil {
+				t.Fatalf("Expected nil error, got %s", err)
+			}
+			if path != tokenFile {
+				t.Errorf("Token paths do not match. Expected path %s, got %s", tokenFile, path)
+			}
+		},
+	)
+
+	t.Run(
+		"Token file readable by others is copied",
+		func(t *testing.T) {
+			if runtime.GOOS == "windows" {
+				t.Skip("file modes do not reflect who can access files on Windows")
+			}
+			tokenFile := filepath.Join(t.TempDir(), "bt_test_file")
+			if err := os.WriteFile(tokenFile, []byte("12345"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			// Set the mode explicitly, since os.WriteFile applies the umask
+			if err := os.Chmod(tokenFile, 0644); err != nil {
+				t.Fatal(err)
+			}
+			runtimeDir := t.TempDir()
+			env := map[string]string{"BEARER_TOKEN_FILE": tokenFile, "XDG_RUNTIME_DIR": runtimeDir}
+			d, err := disc.New(disc.WithEnvMap(env), disc.WithUID("4242"))
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			path, err := d.FindTokenFile()
+			if err != nil {
+				t.Fatalf("Expected nil error, got %s", err)
+			}
+			if filepath.Dir(path) != runtimeDir {
+				t.Errorf("Expected token file in %s, got %s", runtimeDir, path)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if perm := info.Mode().Perm(); perm != 0600 {
+				t.Errorf("Expected token file mode 0600, got %o", perm)
+			}
+			contents, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(contents) != "12345" {
+				t.Errorf("Token strings do not match.  Expected 12345, got %s", contents)
+			}
+		},
+	)
+
+	t.Run(
+		"Token from environment is materialized and reused",
+		func(t *testing.T) {
+			runtimeDir := t.TempDir()
+			env := map[string]string{"BEARER_TOKEN": "env_token", "XDG_RUNTIME_DIR": runtimeDir}
+			d, err := disc.New(disc.WithEnvMap(env), disc.WithUID("4242"))
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+
+			path, err := d.FindTokenFile()
+			if err != nil {
+				t.Fatalf("Expected nil error, got %s", err)
+			}
+			if filepath.Dir(path) != runtimeDir {
+				t.Errorf("Expected token file in %s, got %s", runtimeDir, path)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if perm := info.Mode().Perm(); perm != 0600 {
+				t.Errorf("Expected token file mode 0600, got %o", perm)
+			}
+			contents, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(contents) != "env_token" {
+				t.Errorf("Token strings do not match.  Expected env_token, got %s", contents)
+			}
+
+			path2, err := d.FindTokenFile()
+			if err != nil {
+				t.Fatalf("Expected nil error, got %s", err)
+			}
+			if path2 != path {
+				t.Errorf("Expected unchanged token to reuse %s, got %s", path, path2)
+			}
+			info2, err := os.Stat(path2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !os.SameFile(info, info2) {
+				t.Error("Expected unchanged token file to be left untouched, but it was replaced")
+			}
+		},
+	)
+
+	t.Run(
+		"World-readable existing file is replaced",
+		func(t *testing.T) {
+			runtimeDir := t.TempDir()
+			env := map[string]string{"BEARER_TOKEN": "env_token", "XDG_RUNTIME_DIR": runtimeDir}
+			d, err := disc.New(disc.WithEnvMap(env), disc.WithUID("4242"))
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			path, err := d.FindTokenFile()
+			if err != nil {
+				t.Fatalf("Expected nil error, got %s", err)
+			}
+			if err := os.Chmod(path, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			path2, err := d.FindTokenFile()
+			if err != nil {
+				t.Fatalf("Expected nil error, got %s", err)
+			}
+			info, err := os.Stat(path2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if perm := info.Mode().Perm(); perm != 0600 {
+				t.Errorf("Expected token file mode 0600, got %o", perm)
+			}
+		},
+	)
+
+	t.Run(
+		"Injected filesystem cannot be written",
+		func(t *testing.T) {
+			d, err := disc.New(
+				disc.WithEnvMap(map[string]string{"BEARER_TOKEN": "env_token"}),
+				disc.WithFS(fstest.MapFS{}),
+				disc.WithUID("4242"),
+			)
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			_, err = d.FindTokenFile()
+			if !errors.Is(err, disc.ErrCannotWriteToken) {
+				t.Errorf("Expected error %s, got %v", disc.ErrCannotWriteToken, err)
+			}
+		},
+	)
+}
+
+func TestMaterializeToken(t *testing.T) {
+	t.Run(
+		"Token from environment is written to XDG_RUNTIME_DIR",
+		func(t *testing.T) {
+			runtimeDir := t.TempDir()
+			env := map[string]string{"BEARER_TOKEN": "env_token", "XDG_RUNTIME_DIR": runtimeDir}
+			d, err := disc.New(disc.WithEnvMap(env), disc.WithUID("4242"))
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			path, err := d.MaterializeToken(context.Background())
+			if err != nil {
+				t.Fatalf("Expected nil error, got %s", err)
+			}
+			expectedPath := filepath.Join(runtimeDir, "bt_u4242")
+			if path != expectedPath {
+				t.Errorf("Token paths do not match. Expected path %s, got %s", expectedPath, path)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if perm := info.Mode().Perm(); perm != 0600 {
+				t.Errorf("Expected token file mode 0600, got %o", perm)
+			}
+
+			// The materialized file must itself be discoverable by programs using the bt_u$ID convention
+			d2, err := disc.New(disc.WithEnvMap(map[string]string{"XDG_RUNTIME_DIR": runtimeDir}), disc.WithUID("4242"))
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			tok, err := d2.FindToken()
+			if err != nil {
+				t.Fatalf("Expected nil error, got %s", err)
+			}
+			if string(tok) != "env_token" {
+				t.Errorf("Token strings do not match.  Expected env_token, got %s", tok)
+			}
+
+			// Running again with the same token leaves the file alone
+			if _, err := d.MaterializeToken(context.Background()); err != nil {
+				t.Fatalf("Expected nil error, got %s", err)
+			}
+			info2, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !os.SameFile(info, info2) {
+				t.Error("Expected unchanged token file to be left untouched, but it was replaced")
+			}
+		},
+	)
+
+	t.Run(
+		"Token from environment falls back to the fallback directory",
+		func(t *testing.T) {
+			fallbackDir := t.TempDir()
+			d, err := disc.New(
+				disc.WithEnvMap(map[string]string{"BEARER_TOKEN": "env_token"}),
+				disc.WithFallbackDir(fallbackDir),
+				disc.WithUID("4242"),
+			)
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			path, err := d.MaterializeToken(context.Background())
+			if err != nil {
+				t.Fatalf("Expected nil error, got %s", err)
+			}
+			if expectedPath := filepath.Join(fallbackDir, "bt_u4242"); path != expectedPath {
+				t.Errorf("Token paths do not match. Expected path %s, got %s", expectedPath, path)
+			}
+		},
+	)
+
+	t.Run(
+		"Token from oidc-agent is written to XDG_RUNTIME_DIR",
+		func(t *testing.T) {
+			sock := fakeOIDCAgent(t, map[string]string{"wlcg": "agent_token"}, false)
+			runtimeDir := t.TempDir()
+			d, err := disc.New(
+				disc.WithEnvMap(map[string]string{"OIDC_SOCK": sock, "XDG_RUNTIME_DIR": runtimeDir}),
+				disc.WithOIDCAgent("wlcg"),
+				disc.WithUID("4242"),
+			)
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			path, err := d.MaterializeToken(context.Background())
+			if err != nil {
+				t.Fatalf("Expected nil error, got %s", err)
+			}
+			expectedPath := filepath.Join(runtimeDir, "bt_u4242")
+			if path != expectedPath {
+				t.Errorf("Token paths do not match. Expected path %s, got %s", expectedPath, path)
+			}
+			contents, err := os.ReadFile(expectedPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(contents) != "agent_token" {
+				t.Errorf("Token strings do not match.  Expected agent_token, got %s", contents)
+			}
+		},
+	)
+
+	t.Run(
+		"Token already in a file is not rewritten",
+		func(t *testing.T) {
+			tokenFile := filepath.Join(t.TempDir(), "bt_test_file")
+			if err := os.WriteFile(tokenFile, []byte("12345"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			d, err := disc.New(disc.WithEnvMap(map[string]string{"BEARER_TOKEN_FILE": tokenFile}))
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			path, err := d.MaterializeToken(context.Background())
+			if err != nil {
+				t.Fatalf("Expected nil error, got %s", err)
+			}
+			if path != tokenFile {
+				t.Errorf("Token paths do not match. Expected path %s, got %s", tokenFile, path)
+			}
+		},
+	)
+
+	t.Run(
+		"Unwritable runtime directory",
+		func(t *testing.T) {
+			runtimeDir := filepath.Join(t.TempDir(), "does_not_exist")
+			env := map[string]string{"BEARER_TOKEN": "env_token", "XDG_RUNTIME_DIR": runtimeDir}
+			d, err := disc.New(disc.WithEnvMap(env), disc.WithUID("4242"))
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			_, err = d.MaterializeToken(context.Background())
+			if !errors.Is(err, disc.ErrCannotWriteToken) {
+				t.Errorf("Expected error %s, got %v", disc.ErrCannotWriteToken, err)
+			}
+			if errors.Is(err, disc.ErrNoTokenFound) {
+				t.Errorf("Expected write failure not to be reported as %s", disc.ErrNoTokenFound)
+			}
+		},
+	)
+}
+
+func TestMaterializeTokenWithoutFile(t *testing.T) {
+	type testCase struct {
+		description string
+		opt         disc.Option
+		expectedTok string
+	}
+
+	testCases := []testCase{
+		{"Token command", helperCommand("print", "command_token"), "command_token"},
+		{"Custom step", disc.WithSteps(&rotatingStep{token: "custom_token"}), "custom_token"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				fallbackDir := t.TempDir()
+				d, err := disc.New(
+					disc.WithEnvMap(map[string]string{}),
+					disc.WithFallbackDir(fallbackDir),
+					disc.WithUID("4242"),
+					tc.opt,
+				)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				path, err := d.MaterializeToken(context.Background())
+				if err != nil {
+					t.Fatalf("Expected nil error, got %s", err)
+				}
+				expectedPath := filepath.Join(fallbackDir, "bt_u4242")
+				if path != expectedPath {
+					t.Errorf("Token paths do not match. Expected path %s, got %s", expectedPath, path)
+				}
+				contents, err := os.ReadFile(expectedPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(contents) != tc.expectedTok {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedTok, contents)
+				}
+			},
+		)
+	}
+}
+
+func TestFindTokenFileRewritten(t *testing.T) {
+	type testCase struct {
+		description string
+		contents    string
+		expectCopy  bool
+	}
+
+	testCases := []testCase{
+		{"Token with trailing newline", "12345\n", false},
+		{"JSON token response", `{"access_token": "12345", "token_type": "Bearer"}`, true},
+		{"Bearer prefix", "Bearer 12345\n", true},
+		{"Comment lines", "# Written by htgettoken\n12345\n", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				tokenFile := filepath.Join(t.TempDir(), "bt_test_file")
+				if err := os.WriteFile(tokenFile, []byte(tc.contents), 0600); err != nil {
+					t.Fatal(err)
+				}
+				runtimeDir := t.TempDir()
+				env := map[string]string{"BEARER_TOKEN_FILE": tokenFile, "XDG_RUNTIME_DIR": runtimeDir}
+				d, err := disc.New(disc.WithEnvMap(env), disc.WithUID("4242"))
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				path, err := d.FindTokenFile()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %s", err)
+				}
+				if !tc.expectCopy {
+					if path != tokenFile {
+						t.Errorf("Token paths do not match. Expected path %s, got %s", tokenFile, path)
+					}
+					return
+				}
+				if filepath.Dir(path) != runtimeDir {
+					t.Errorf("Expected token file in %s, got %s", runtimeDir, path)
+				}
+				contents, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(contents) != "12345" {
+					t.Errorf("Token strings do not match.  Expected 12345, got %s", contents)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,106 @@
+package tokendiscovery
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTokenTooOld indicates that a token was issued longer ago than allowed with WithMaxTokenAge or CheckMaxAge. If no
+// token qualifies, the error returned by discovery wraps both it and ErrNoTokenFound.
+var ErrTokenTooOld = errors.New("token is too old")
+
+// ErrIssueTimeUnknown indicates that the age of a token cannot be determined because it has no iat claim, or is not a
+// JWT
+var ErrIssueTimeUnknown = errors.New("token issue time is unknown")
+
+// WithMaxTokenAge makes discovery skip tokens issued more than max ago according to their iat claim, whatever their exp
+// claim says, in the same way as WithSkipExpired, for sites whose policy forbids using tokens that predate a
+// revocation window. allowUnknown sets whether tokens whose issue time is not known, such as those without an iat claim
+// or that are not JWTs, are accepted or skipped. Clock skew is tolerated up to the leeway set with WithLeeway. Tokens
+// are NOT verified, as described for ParseClaims.
+func WithMaxTokenAge(max time.Duration, allowUnknown bool) Option {
+	return func(d *Discoverer) error {
+		if max <= 0 {
+			return fmt.Errorf("%w: maximum token age must be positive", ErrInvalidOption)
+		}
+		d.maxTokenAge = max
+		d.allowUnknownAge = allowUnknown
+		return nil
+	}
+}
+
+// CheckMaxAge returns an error wrapping ErrTokenTooOld if claims were issued more than max before now according to
+// their iat claim, tolerating clock skew of up to leeway. If they have no iat claim, the returned error wraps
+// ErrIssueTimeUnknown, so that callers can decide whether to accept them.
+func CheckMaxAge(claims Claims, max time.Duration, now time.Time, leeway time.Duration) error {
+	iat, ok := claims.IssuedAt()
+	if !ok {
+		return &ageError{max: max, unknown: true}
+	}
+	if age := now.Sub(iat); age > max+leeway {
+		return &ageError{age: age, max: max}
+	}
+	return nil
+}
+
+// ageError records that a token was skipped because it is older than allowed
+type ageError struct {
+	age     time.Duration
+	max     time.Duration
+	unknown bool
+}
+
+func (e *ageError) Error() string {
+	if e.unknown {
+		return fmt.Sprintf("%s: %s", ErrTokenTooOld, ErrIssueTimeUnknown)
+	}
+	return fmt.Sprintf("%s: issued %s ago, at most %s allowed", ErrTokenTooOld, e.age.Round(time.Second), e.max)
+}
+
+func (e *ageError) Unwrap() []error {
+	if e.unknown {
+		return []error{ErrTokenTooOld, ErrIssueTimeUnknown}
+	}
+	return []error{ErrTokenTooOld}
+}
+
+// checkMaxAge returns an error wrapping ErrTokenTooOld if tok should be skipped according to WithMaxTokenAge
+func (d *Discoverer) checkMaxAge(tok []byte) error {
+	if d.maxTokenAge == 0 {
+		return nil
+	}
+	claims, err := parseClaimsCached(tok)
+	if err != nil {
+		if d.allowUnknownAge {
+			return nil
+		}
+		return &ageError{max: d.maxTokenAge, unknown: true}
+	}
+	err = CheckMaxAge(claims, d.maxTokenAge, d.now(), d.clockLeeway())
+	if errors.Is(err, ErrIssueTimeUnknown) && d.allowUnknownAge {
+		return nil
+	}
+	return err
+}
+
+// tokenAgeError returns the error summarizing why the tokens in rejected skipped by checkMaxAge were skipped, for
+// discovery to return when no token qualified. It names the youngest token found. It returns nil if no token was
+// skipped for its age.
+func tokenAgeError(rejected []error) error {
+	var youngest *ageError
+	for _, err := range rejected {
+		var aerr *ageError
+		if errors.As(err, &aerr) && (youngest == nil || youngest.unknown || !aerr.unknown && aerr.age < youngest.age) {
+			youngest = aerr
+		}
+	}
+	switch {
+	case youngest == nil:
+		return nil
+	case youngest.unknown:
+		return fmt.Errorf("%w: no token with a known issue time was found", ErrTokenTooOld)
+	}
+	return fmt.Errorf("%w: the youngest token found was issued %s ago, but at most %s is allowed", ErrTokenTooOld,
+		youngest.age.Round(time.Second), youngest.max)
+}
@@ -0,0 +1,142 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestCheckMaxAge(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	const maxAge = 24 * time.Hour
+
+	type testCase struct {
+		description string
+		claims      disc.Claims
+		leeway      time.Duration
+		expectedErr error
+	}
+
+	testCases := []testCase{
+		{"Just inside the window", disc.Claims{"iat": now.Add(-maxAge).Unix()}, 0, nil},
+		{"Just outside the window", disc.Claims{"iat": now.Add(-maxAge - time.Second).Unix()}, 0, disc.ErrTokenTooOld},
+		{
+			"Just outside the window, within leeway",
+			disc.Claims{"iat": now.Add(-maxAge - time.Second).Unix()},
+			time.Minute,
+			nil,
+		},
+		{
+			"Outside the window and leeway",
+			disc.Claims{"iat": now.Add(-maxAge - time.Minute - time.Second).Unix()},
+			time.Minute,
+			disc.ErrTokenTooOld,
+		},
+		{"Issued in the future", disc.Claims{"iat": now.Add(time.Hour).Unix()}, 0, nil},
+		{"No iat claim", disc.Claims{"exp": now.Add(time.Hour).Unix()}, 0, disc.ErrIssueTimeUnknown},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				if err := disc.CheckMaxAge(tc.claims, maxAge, now, tc.leeway); !errors.Is(err, tc.expectedErr) {
+					t.Errorf("Errors do not match.  Expected %v, got %v", tc.expectedErr, err)
+				}
+			},
+		)
+	}
+}
+
+func TestMaxTokenAge(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	const maxAge = 24 * time.Hour
+	justInside := makeJWT(t, map[string]any{"iat": now.Add(-maxAge).Unix(), "exp": now.Add(time.Hour).Unix()})
+	justOutside := makeJWT(t, map[string]any{"iat": now.Add(-maxAge - time.Second).Unix(), "exp": now.Add(time.Hour).Unix()})
+	muchOlder := makeJWT(t, map[string]any{"iat": now.Add(-3 * maxAge).Unix(), "exp": now.Add(time.Hour).Unix()})
+	noIat := makeJWT(t, map[string]any{"exp": now.Add(time.Hour).Unix()})
+	fileEnv := map[string]string{"BEARER_TOKEN_FILE": "/home/user/token"}
+
+	type testCase struct {
+		description   string
+		env           map[string]string
+		fileToken     string
+		allowUnknown  bool
+		leeway        time.Duration
+		expectedToken string
+		expectedErr   error
+	}
+
+	testCases := []testCase{
+		{
+			"Just outside, falls through to file",
+			map[string]string{"BEARER_TOKEN": justOutside, "BEARER_TOKEN_FILE": "/home/user/token"},
+			justInside,
+			false,
+			0,
+			justInside,
+			nil,
+		},
+		{
+			"Just outside, within leeway",
+			map[string]string{"BEARER_TOKEN": justOutside, "BEARER_TOKEN_FILE": "/home/user/token"},
+			justInside,
+			false,
+			disc.DefaultLeeway,
+			justOutside,
+			nil,
+		},
+		{"Just inside", map[string]string{"BEARER_TOKEN": justInside}, "", false, 0, justInside, nil},
+		{
+			"All too old",
+			map[string]string{"BEARER_TOKEN": muchOlder, "BEARER_TOKEN_FILE": "/home/user/token"},
+			justOutside,
+			false,
+			0,
+			"",
+			disc.ErrTokenTooOld,
+		},
+		{"No iat claim allowed", fileEnv, noIat, true, 0, noIat, nil},
+		{"No iat claim rejected", fileEnv, noIat, false, 0, "", disc.ErrIssueTimeUnknown},
+		{"Opaque token allowed", fileEnv, "opaque_token", true, 0, "opaque_token", nil},
+		{"Opaque token rejected", fileEnv, "opaque_token", false, 0, "", disc.ErrIssueTimeUnknown},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				d, err := disc.New(
+					disc.WithEnvMap(tc.env),
+					disc.WithFS(fstest.MapFS{"home/user/token": {Data: []byte(tc.fileToken + "\n")}}),
+					disc.WithClock(func() time.Time { return now }),
+					disc.WithLeeway(tc.leeway),
+					disc.WithMaxTokenAge(maxAge, tc.allowUnknown),
+				)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				res, err := d.Discover()
+				if tc.expectedErr != nil {
+					if !errors.Is(err, tc.expectedErr) || !errors.Is(err, disc.ErrNoTokenFound) {
+						t.Fatalf("Expected error wrapping %s and %s, got %v", tc.expectedErr, disc.ErrNoTokenFound, err)
+					}
+					if tc.expectedErr == disc.ErrTokenTooOld && !strings.Contains(err.Error(), "youngest token found was issued 24h0m1s ago") {
+						t.Errorf("Expected error to name the age of the youngest token, 24h0m1s, got %v", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if tok := string(res.Bytes()); tok != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, tok)
+				}
+			},
+		)
+	}
+}
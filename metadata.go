@@ -0,0 +1,131 @@
+package tokendiscovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMetadataTTL is how long FetchIssuerMetadata keeps the metadata of an issuer
+const DefaultMetadataTTL = time.Hour
+
+// ErrIssuerUnreachable indicates that a request to a token issuer failed before any response was received
+var ErrIssuerUnreachable = errors.New("token issuer is unreachable")
+
+// ErrUnexpectedStatus indicates that a token issuer responded to a request with a status other than 200 OK
+var ErrUnexpectedStatus = errors.New("unexpected response status from token issuer")
+
+// ErrIssuerMismatch indicates that the metadata served for a token issuer names another issuer, which OpenID Connect
+// Discovery requires to be rejected
+var ErrIssuerMismatch = errors.New("issuer metadata is for another issuer")
+
+// IssuerMetadata holds the OpenID Connect Discovery metadata of a token issuer, as returned by FetchIssuerMetadata
+type IssuerMetadata struct {
+	Issuer                      string   `json:"issuer"`
+	AuthorizationEndpoint       string   `json:"authorization_endpoint"`
+	TokenEndpoint               string   `json:"token_endpoint"`
+	UserinfoEndpoint            string   `json:"userinfo_endpoint"`
+	JWKSURI                     string   `json:"jwks_uri"`
+	RegistrationEndpoint        string   `json:"registration_endpoint"`
+	IntrospectionEndpoint       string   `json:"introspection_endpoint"`
+	RevocationEndpoint          string   `json:"revocation_endpoint"`
+	DeviceAuthorizationEndpoint string   `json:"device_authorization_endpoint"`
+	ScopesSupported             []string `json:"scopes_supported"`
+	ResponseTypesSupported      []string `json:"response_types_supported"`
+	GrantTypesSupported         []string `json:"grant_types_supported"`
+	SigningAlgValuesSupported   []string `json:"id_token_signing_alg_values_supported"`
+	ClaimsSupported             []string `json:"claims_supported"`
+}
+
+// metadataCacheSize is the number of issuer and client pairs whose metadata FetchIssuerMetadata keeps
+const metadataCacheSize = 256
+
+// metadataCache holds the metadata fetched by FetchIssuerMetadata, by issuer and the client used to fetch it
+var metadataCache = struct {
+	sync.Mutex
+	entries map[metadataKey]metadataEntry
+}{entries: make(map[metadataKey]metadataEntry)}
+
+// metadataKey is the key of an entry of metadataCache. The metadata is only reused with the client that fetched it,
+// as clients may reach issuers differently, such as through a proxy or with other trusted certificates.
+type metadataKey struct {
+	issuer string
+	client *http.Client
+}
+
+// metadataEntry is an entry of metadataCache
+type metadataEntry struct {
+	metadata  IssuerMetadata
+	fetchedAt time.Time
+}
+
+// expired reports whether e must be forgotten at now
+func (e metadataEntry) expired(now time.Time) bool {
+	return now.Sub(e.fetchedAt) >= DefaultMetadataTTL
+}
+
+// cachedMetadata returns the metadata held by metadataCache for key, if it has not expired
+func cachedMetadata(key metadataKey) (IssuerMetadata, bool) {
+	metadataCache.Lock()
+	defer metadataCache.Unlock()
+	entry, ok := metadataCache.entries[key]
+	if ok && entry.expired(time.Now()) {
+		delete(metadataCache.entries, key)
+		return IssuerMetadata{}, false
+	}
+	return entry.metadata, ok
+}
+
+// cacheMetadata records metadata for key in metadataCache, removing expired entries, then arbitrary ones, to keep at
+// most metadataCacheSize
+func cacheMetadata(key metadataKey, metadata IssuerMetadata) {
+	metadataCache.Lock()
+	defer metadataCache.Unlock()
+	now := time.Now()
+	if _, ok := metadataCache.entries[key]; !ok && len(metadataCache.entries) >= metadataCacheSize {
+		for k, entry := range metadataCache.entries {
+			if entry.expired(now) {
+				delete(metadataCache.entries, k)
+			}
+		}
+		for k := range metadataCache.entries {
+			if len(metadataCache.entries) < metadataCacheSize {
+				break
+			}
+			delete(metadataCache.entries, k)
+		}
+	}
+	metadataCache.entries[key] = metadataEntry{metadata: metadata, fetchedAt: now}
+}
+
+// FetchIssuerMetadata fetches the metadata of issuer from its /.well-known/openid-configuration document, for example
+// to find its token endpoint. client is used for the request, or http.DefaultClient if it is nil. The metadata is kept
+// for DefaultMetadataTTL, and later calls for the same issuer with the same client return it without fetching it again.
+// Metadata is kept for a bounded number of issuer and client pairs, so it may be fetched again sooner. If the request
+// fails, the returned error wraps ErrIssuerUnreachable; if the response status is not 200 OK, ErrUnexpectedStatus; and
+// if the document is for another issuer, ErrIssuerMismatch. Trailing slashes are ignored when comparing issuers.
+func FetchIssuerMetadata(ctx context.Context, issuer string, client *http.Client) (IssuerMetadata, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	key := metadataKey{issuer: issuer, client: client}
+	if metadata, ok := cachedMetadata(key); ok {
+		return metadata, nil
+	}
+
+	var metadata IssuerMetadata
+	configURL := strings.TrimRight(issuer, "/") + "/.well-known/openid-configuration"
+	if err := fetchJSON(ctx, client, configURL, &metadata); err != nil {
+		return IssuerMetadata{}, err
+	}
+	if normalizeIssuer(metadata.Issuer) != normalizeIssuer(issuer) {
+		return IssuerMetadata{}, fmt.Errorf("%w: requested %q, got %q", ErrIssuerMismatch, issuer, metadata.Issuer)
+	}
+
+	cacheMetadata(key, metadata)
+	return metadata, nil
+}
@@ -0,0 +1,137 @@
+package tokendiscovery_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestFetchIssuerMetadata(t *testing.T) {
+	type testCase struct {
+		description string
+		// serve writes the metadata of the issuer at url
+		serve       func(w http.ResponseWriter, url string)
+		expectedErr error
+	}
+
+	testCases := []testCase{
+		{
+			"Matching issuer",
+			func(w http.ResponseWriter, url string) {
+				fmt.Fprintf(w, `{"issuer":%q,"token_endpoint":%q,"introspection_endpoint":%q,"jwks_uri":%q}`, url+"/",
+					url+"/token", url+"/introspect", url+"/jwk")
+			},
+			nil,
+		},
+		{
+			"Mismatching issuer",
+			func(w http.ResponseWriter, url string) {
+				fmt.Fprintf(w, `{"issuer":"https://evil.example","token_endpoint":"https://evil.example/token"}`)
+			},
+			disc.ErrIssuerMismatch,
+		},
+		{
+			"Not found",
+			func(w http.ResponseWriter, url string) { http.NotFound(w, nil) },
+			disc.ErrUnexpectedStatus,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				var requests atomic.Int32
+				var srv *httptest.Server
+				srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					requests.Add(1)
+					if r.URL.Path != "/.well-known/openid-configuration" {
+						http.NotFound(w, r)
+						return
+					}
+					tc.serve(w, srv.URL)
+				}))
+				defer srv.Close()
+
+				for i := 0; i < 2; i++ {
+					metadata, err := disc.FetchIssuerMetadata(context.Background(), srv.URL, srv.Client())
+					if !errors.Is(err, tc.expectedErr) {
+						t.Fatalf("Expected error %v, got %v", tc.expectedErr, err)
+					}
+					if err != nil {
+						continue
+					}
+					if metadata.TokenEndpoint != srv.URL+"/token" {
+						t.Errorf("Token endpoints do not match.  Expected %s/token, got %s", srv.URL, metadata.TokenEndpoint)
+					}
+					if metadata.IntrospectionEndpoint != srv.URL+"/introspect" {
+						t.Errorf("Introspection endpoints do not match.  Expected %s/introspect, got %s", srv.URL,
+							metadata.IntrospectionEndpoint)
+					}
+				}
+				expectedRequests := int32(2)
+				if tc.expectedErr == nil {
+					// The metadata is cached
+					expectedRequests = 1
+				}
+				if n := requests.Load(); n != expectedRequests {
+					t.Errorf("Expected %d requests, got %d", expectedRequests, n)
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"Unreachable issuer",
+		func(t *testing.T) {
+			srv := httptest.NewServer(http.NotFoundHandler())
+			url := srv.URL
+			srv.Close()
+			if _, err := disc.FetchIssuerMetadata(context.Background(), url, nil); !errors.Is(err, disc.ErrIssuerUnreachable) {
+				t.Errorf("Expected error %s, got %v", disc.ErrIssuerUnreachable, err)
+			}
+		},
+	)
+}
+
+func TestFetchIssuerMetadataCache(t *testing.T) {
+	var requests atomic.Int32
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprintf(w, `{"issuer":%q,"token_endpoint":%q}`, srv.URL, srv.URL+"/token")
+	}))
+	defer srv.Close()
+
+	// Metadata fetched with one client is not reused for another
+	clients := make([]*http.Client, disc.MetadataCacheSize+10)
+	for i := range clients {
+		clients[i] = &http.Client{Transport: srv.Client().Transport}
+	}
+	for _, client := range clients[:2] {
+		for range 2 {
+			if _, err := disc.FetchIssuerMetadata(context.Background(), srv.URL, client); err != nil {
+				t.Fatalf("Expected nil error, got %v", err)
+			}
+		}
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("Expected 2 requests, got %d", n)
+	}
+
+	// The cache does not grow beyond its size
+	for _, client := range clients {
+		if _, err := disc.FetchIssuerMetadata(context.Background(), srv.URL, client); err != nil {
+			t.Fatalf("Expected nil error, got %v", err)
+		}
+	}
+	if n := disc.MetadataCacheLen(); n > disc.MetadataCacheSize {
+		t.Errorf("Expected at most %d cached entries, got %d", disc.MetadataCacheSize, n)
+	}
+}
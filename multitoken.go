@@ -0,0 +1,86 @@
+package tokendiscovery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+)
+
+// TokenLine is a token read from one line of a token file holding several tokens
+type TokenLine struct {
+	// Token is the token, with surrounding whitespace removed
+	Token []byte
+	// Line is the number of the line the token was read from, counting from 1. It is 0 for a token that was not read
+	// from a file.
+	Line int
+}
+
+// ReadAllTokensFromFile reads every token in the file at path, for files that hold one token per line, such as an
+// access token followed by a refresh token. Blank lines and comments starting with # are skipped. If the file has no
+// tokens, the returned error wraps ErrEmptyToken.
+func ReadAllTokensFromFile(path string) ([][]byte, error) {
+	lines, err := defaultDiscoverer.readAllTokens(context.Background(), path, true)
+	if err != nil {
+		return nil, err
+	}
+	toks := make([][]byte, 0, len(lines))
+	for _, line := range lines {
+		toks = append(toks, line.Token)
+	}
+	return toks, nil
+}
+
+// FindAllTokensInFile follows the WLCG Bearer Token Discovery procedure like FindTokenAndFile, and if the token was
+// read from a file, returns every token in that file, as read by ReadAllTokensFromFile, along with the path of the
+// file. The first token is the one FindToken returns. If the token was not read from a file, it is returned alone.
+func FindAllTokensInFile() ([]TokenLine, string, error) {
+	return defaultDiscoverer.FindAllTokensInFile()
+}
+
+// FindAllTokensInFileContext is like FindAllTokensInFile, but abandons discovery when ctx is done. In that case, the
+// returned error wraps ctx.Err().
+func FindAllTokensInFileContext(ctx context.Context) ([]TokenLine, string, error) {
+	return defaultDiscoverer.FindAllTokensInFileContext(ctx)
+}
+
+// FindAllTokensInFile is like the package-level FindAllTokensInFile, but uses the discovery procedure configured on d
+func (d *Discoverer) FindAllTokensInFile() ([]TokenLine, string, error) {
+	return d.FindAllTokensInFileContext(context.Background())
+}
+
+// FindAllTokensInFileContext is like FindAllTokensInFile, but abandons discovery when ctx is done
+func (d *Discoverer) FindAllTokensInFileContext(ctx context.Context) ([]TokenLine, string, error) {
+	res, err := d.DiscoverContext(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	if res.path == "" {
+		return []TokenLine{{Token: res.token}}, "", nil
+	}
+	lines, err := d.readAllTokens(ctx, res.path, res.source != SourceTmpFallback || d.followSymlinks)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot read tokens in %s: %w", res.path, err)
+	}
+	return lines, res.path, nil
+}
+
+// readAllTokens reads every token in the file at path, as described for ReadAllTokensFromFile
+func (d *Discoverer) readAllTokens(ctx context.Context, path string, followSymlinks bool) ([]TokenLine, error) {
+	contents, err := d.readFile(ctx, path, followSymlinks)
+	if err != nil {
+		return nil, err
+	}
+	var lines []TokenLine
+	rest := normalizeLineEndings(contents)
+	for n := 1; len(rest) > 0; n++ {
+		var line []byte
+		line, rest, _ = bytes.Cut(rest, []byte("\n"))
+		if line = bytes.TrimSpace(line); len(line) > 0 && line[0] != '#' {
+			lines = append(lines, TokenLine{Token: line, Line: n})
+		}
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("%s: %w", path, ErrEmptyToken)
+	}
+	return lines, nil
+}
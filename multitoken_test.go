@@ -0,0 +1,94 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestFindAllTokensInFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"home/user/tokens": {Data: []byte("\n# access token\naccess_token\n\nrefresh_token\n")},
+	}
+
+	type testCase struct {
+		description   string
+		env           map[string]string
+		expectedLines []disc.TokenLine
+		expectedPath  string
+	}
+
+	testCases := []testCase{
+		{
+			"Two-token file",
+			map[string]string{"BEARER_TOKEN_FILE": "/home/user/tokens"},
+			[]disc.TokenLine{{Token: []byte("access_token"), Line: 3}, {Token: []byte("refresh_token"), Line: 5}},
+			"/home/user/tokens",
+		},
+		{
+			"Token not read from a file",
+			map[string]string{"BEARER_TOKEN": "env_token"},
+			[]disc.TokenLine{{Token: []byte("env_token"), Line: 0}},
+			"",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				d, err := disc.New(disc.WithEnvMap(tc.env), disc.WithFS(fsys), disc.WithUID("4242"))
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				lines, path, err := d.FindAllTokensInFile()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if !reflect.DeepEqual(lines, tc.expectedLines) {
+					t.Errorf("Tokens do not match.  Expected %q, got %q", tc.expectedLines, lines)
+				}
+				if path != tc.expectedPath {
+					t.Errorf("Token paths do not match. Expected path %s, got %s", tc.expectedPath, path)
+				}
+
+				tok, err := d.FindToken()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if string(tok) != string(tc.expectedLines[0].Token) {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedLines[0].Token, string(tok))
+				}
+			},
+		)
+	}
+}
+
+func TestReadAllTokensFromFile(t *testing.T) {
+	dir := t.TempDir()
+	twoTokens := filepath.Join(dir, "two")
+	if err := os.WriteFile(twoTokens, []byte("access_token\r\nrefresh_token\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	blank := filepath.Join(dir, "blank")
+	if err := os.WriteFile(blank, []byte("\n\n# nothing\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	toks, err := disc.ReadAllTokensFromFile(twoTokens)
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	if expected := [][]byte{[]byte("access_token"), []byte("refresh_token")}; !reflect.DeepEqual(toks, expected) {
+		t.Errorf("Tokens do not match.  Expected %q, got %q", expected, toks)
+	}
+
+	if _, err := disc.ReadAllTokensFromFile(blank); !errors.Is(err, disc.ErrEmptyToken) {
+		t.Errorf("Expected error %s, got %v", disc.ErrEmptyToken, err)
+	}
+}
@@ -0,0 +1,132 @@
+package tokendiscovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidTokenName indicates that a token name is not suitable for building environment variable and file names
+var ErrInvalidTokenName = errors.New("invalid token name")
+
+// FindNamedToken is like FindToken, but looks for the token called name, as kept by users who hold several tokens, for
+// example one per experiment. The discovery procedure is the same, with the name appended to each location:
+// BEARER_TOKEN_<NAME>, BEARER_TOKEN_FILE_<NAME>, $XDG_RUNTIME_DIR/bt_u$ID_<name>, and /tmp/bt_u$ID_<name>. In the
+// environment variable names, the name is upper-cased and dashes are replaced with underscores. Names may only contain
+// letters, digits, dashes, and underscores, and must start with a letter or digit; otherwise, the returned error wraps
+// ErrInvalidTokenName.
+func FindNamedToken(name string) ([]byte, error) {
+	return defaultDiscoverer.FindNamedToken(name)
+}
+
+// FindNamedTokenContext is like FindNamedToken, but abandons discovery when ctx is done. In that case, the returned
+// error wraps ctx.Err().
+func FindNamedTokenContext(ctx context.Context, name string) ([]byte, error) {
+	return defaultDiscoverer.FindNamedTokenContext(ctx, name)
+}
+
+// FindNamedToken is like the package-level FindNamedToken, but uses the discovery procedure as configured on d
+func (d *Discoverer) FindNamedToken(name string) ([]byte, error) {
+	return d.FindNamedTokenContext(context.Background(), name)
+}
+
+// FindNamedTokenContext is like FindNamedToken, but abandons discovery when ctx is done
+func (d *Discoverer) FindNamedTokenContext(ctx context.Context, name string) ([]byte, error) {
+	if err := validateTokenName(name); err != nil {
+		return nil, err
+	}
+	return d.withTokenName(name).FindTokenContext(ctx)
+}
+
+// WithTokenName makes every lookup of the Discoverer look for the token called name, as described for FindNamedToken
+func WithTokenName(name string) Option {
+	return func(d *Discoverer) error {
+		if err := validateTokenName(name); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidOption, err)
+		}
+		d.tokenName = name
+		return nil
+	}
+}
+
+// WithNamedTokenFallback makes the lookup of a named token fall back to the standard, unnamed locations if no step
+// finds a token with the name
+func WithNamedTokenFallback() Option {
+	return func(d *Discoverer) error {
+		d.namedFallback = true
+		return nil
+	}
+}
+
+// validateTokenName checks that name can safely be made part of environment variable and file names
+func validateTokenName(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: name cannot be empty", ErrInvalidTokenName)
+	}
+	for i, r := range name {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		case (r == '-' || r == '_') && i > 0:
+		default:
+			return fmt.Errorf("%w %q: names may only contain letters, digits, dashes, and underscores, and must start with a letter or digit", ErrInvalidTokenName, name)
+		}
+	}
+	return nil
+}
+
+// withTokenName returns a copy of d that looks for the token called name, or for the unnamed token if name is empty
+func (d *Discoverer) withTokenName(name string) *Discoverer {
+	named := *d
+	named.tokenName = name
+	return &named
+}
+
+// tokenEnvVars returns the names of the environment variables consulted in step 1 of the discovery procedure, in order
+func (d *Discoverer) tokenEnvVars() []string {
+	return d.namedEnvVars(d.tokenEnvNames, "BEARER_TOKEN")
+}
+
+// tokenFileEnvVars returns the names of the environment variables consulted in step 2 of the discovery procedure, in
+// order
+func (d *Discoverer) tokenFileEnvVars() []string {
+	return d.namedEnvVars(d.tokenFileEnvNames, "BEARER_TOKEN_FILE")
+}
+
+// namedEnvVars returns keys, or def if keys is empty, with the token name appended to each
+func (d *Discoverer) namedEnvVars(keys []string, def string) []string {
+	if len(keys) == 0 {
+		keys = []string{def}
+	}
+	if d.tokenName == "" {
+		return keys
+	}
+	suffix := "_" + strings.ToUpper(strings.ReplaceAll(d.tokenName, "-", "_"))
+	named := make([]string, 0, len(keys))
+	for _, key := range keys {
+		named = append(named, key+suffix)
+	}
+	return named
+}
+
+// tokenFileName returns the name of the bt_u$ID file for uid consulted in steps 3 and 4 of the discovery procedure
+func (d *Discoverer) tokenFileName(uid string) string {
+	prefix := d.tokenFilePrefix
+	if prefix == "" {
+		prefix = defaultTokenFilePrefix
+	}
+	if d.tokenName == "" {
+		return prefix + uid
+	}
+	return prefix + uid + "_" + d.tokenName
+}
+
+// discoverNamedFallback looks for the unnamed token after discovery of the named one failed with err
+func (d *Discoverer) discoverNamedFallback(ctx context.Context, err error) (Result, error) {
+	d.debug("no named token found, looking for unnamed token", "name", d.tokenName)
+	res, unnamedErr := d.withTokenName("").discover(ctx)
+	if !errors.Is(unnamedErr, ErrNoTokenFound) {
+		return res, unnamedErr
+	}
+	return Result{}, &noTokenError{append(skipReasons(err), skipReasons(unnamedErr)...)}
+}
@@ -0,0 +1,164 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestFindNamedToken(t *testing.T) {
+	fsys := fstest.MapFS{
+		"run/user/4242/bt_u4242_cms":   {Data: []byte("xdg_cms_token")},
+		"run/user/4242/bt_u4242":       {Data: []byte("xdg_token")},
+		"tmp/bt_u4242_atlas":           {Data: []byte("tmp_atlas_token")},
+		"tmp/bt_u4242":                 {Data: []byte("tmp_token")},
+		"scratch/token_dune-nd":        {Data: []byte("file_dune_token")},
+		"scratch/token_without_a_name": {Data: []byte("file_token")},
+	}
+
+	type testCase struct {
+		description string
+		env         map[string]string
+		opts        []disc.Option
+		name        string
+		expectedTok string
+		expectedErr error
+	}
+
+	testCases := []testCase{
+		{
+			"Named environment variable",
+			map[string]string{"BEARER_TOKEN": "env_token", "BEARER_TOKEN_CMS": "env_cms_token"},
+			nil,
+			"cms",
+			"env_cms_token",
+			nil,
+		},
+		{
+			"Named token file variable, with dash in name",
+			map[string]string{"BEARER_TOKEN_FILE": "/scratch/token_without_a_name", "BEARER_TOKEN_FILE_DUNE_ND": "/scratch/token_dune-nd"},
+			nil,
+			"dune-nd",
+			"file_dune_token",
+			nil,
+		},
+		{
+			"Named XDG_RUNTIME_DIR file",
+			map[string]string{"XDG_RUNTIME_DIR": "/run/user/4242"},
+			nil,
+			"cms",
+			"xdg_cms_token",
+			nil,
+		},
+		{
+			"Named fallback file",
+			nil,
+			nil,
+			"atlas",
+			"tmp_atlas_token",
+			nil,
+		},
+		{
+			"Unnamed environment variable is ignored",
+			map[string]string{"BEARER_TOKEN": "env_token"},
+			nil,
+			"atlas",
+			"tmp_atlas_token",
+			nil,
+		},
+		{
+			"Named miss without fallback",
+			map[string]string{"BEARER_TOKEN": "env_token"},
+			nil,
+			"lhcb",
+			"",
+			disc.ErrNoTokenFound,
+		},
+		{
+			"Named miss falls back to unnamed token",
+			map[string]string{"BEARER_TOKEN": "env_token"},
+			[]disc.Option{disc.WithNamedTokenFallback()},
+			"lhcb",
+			"env_token",
+			nil,
+		},
+		{
+			"Named miss in XDG_RUNTIME_DIR falls back to unnamed token",
+			map[string]string{"XDG_RUNTIME_DIR": "/run/user/4242"},
+			[]disc.Option{disc.WithNamedTokenFallback()},
+			"atlas",
+			"xdg_token",
+			nil,
+		},
+		{
+			"Named hit does not fall back",
+			map[string]string{"BEARER_TOKEN": "env_token"},
+			[]disc.Option{disc.WithNamedTokenFallback()},
+			"atlas",
+			"tmp_atlas_token",
+			nil,
+		},
+		{
+			"Named and unnamed miss",
+			nil,
+			[]disc.Option{disc.WithNamedTokenFallback(), disc.WithoutTmpFallback()},
+			"lhcb",
+			"",
+			disc.ErrFallbackDisabled,
+		},
+		{"Name with path separator", nil, nil, "../bt_u0", "", disc.ErrInvalidTokenName},
+		{"Name with shell metacharacter", nil, nil, "cms;rm", "", disc.ErrInvalidTokenName},
+		{"Name with command substitution", nil, nil, "$(id)", "", disc.ErrInvalidTokenName},
+		{"Name starting with dash", nil, nil, "-cms", "", disc.ErrInvalidTokenName},
+		{"Empty name", nil, nil, "", "", disc.ErrInvalidTokenName},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := append([]disc.Option{disc.WithEnvMap(tc.env), disc.WithFS(fsys), disc.WithUID("4242")}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, err := d.FindNamedToken(tc.name)
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("Expected error %v, got %v", tc.expectedErr, err)
+				}
+				if string(tok) != tc.expectedTok {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedTok, tok)
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"WithTokenName",
+		func(t *testing.T) {
+			d, err := disc.New(disc.WithEnvMap(nil), disc.WithFS(fsys), disc.WithUID("4242"), disc.WithTokenName("atlas"))
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			res, err := d.Discover()
+			if err != nil {
+				t.Fatalf("Expected nil error, got %s", err)
+			}
+			if res.Path() != "/tmp/bt_u4242_atlas" {
+				t.Errorf("Token paths do not match. Expected path %s, got %s", "/tmp/bt_u4242_atlas", res.Path())
+			}
+		},
+	)
+
+	t.Run(
+		"WithTokenName invalid name",
+		func(t *testing.T) {
+			_, err := disc.New(disc.WithTokenName("cms/atlas"))
+			if !errors.Is(err, disc.ErrInvalidOption) || !errors.Is(err, disc.ErrInvalidTokenName) {
+				t.Errorf("Expected error wrapping %s and %s, got %v", disc.ErrInvalidOption, disc.ErrInvalidTokenName, err)
+			}
+		},
+	)
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package tokendiscovery
+
+import (
+	"io/fs"
+	"os"
+)
+
+// openNoFollow opens the named file for reading, failing if it is a symlink. Without O_NOFOLLOW, the file is checked
+// before it is opened, so a symlink swapped in between is not detected.
+func openNoFollow(name string) (*os.File, error) {
+	info, err := os.Lstat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: ErrSymlinkRejected}
+	}
+	return os.Open(name)
+}
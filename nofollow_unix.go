@@ -0,0 +1,13 @@
+//go:build unix
+
+package tokendiscovery
+
+import (
+	"os"
+	"syscall"
+)
+
+// openNoFollow opens the named file for reading, failing if it is a symlink
+func openNoFollow(name string) (*os.File, error) {
+	return os.OpenFile(name, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+}
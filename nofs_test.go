@@ -0,0 +1,69 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestDiscovererWithoutFilesystem(t *testing.T) {
+	fsys := fstest.MapFS{
+		"run/user/4242/bt_u4242": {Data: []byte("xdg_token")},
+	}
+	failingLookup := disc.WithUserLookup(failingUserLookup)
+	noUID := disc.WithGetuid(func() int { return -1 })
+
+	type testCase struct {
+		description string
+		env         map[string]string
+		opts        []disc.Option
+		expectedTok string
+		expectedErr error
+	}
+
+	testCases := []testCase{
+		{
+			"BEARER_TOKEN is consulted",
+			map[string]string{"BEARER_TOKEN": "env_token"},
+			nil,
+			"env_token",
+			nil,
+		},
+		{
+			"File steps are skipped without looking up the user",
+			map[string]string{"BEARER_TOKEN_FILE": "/home/user/token", "XDG_RUNTIME_DIR": "/run/user/4242"},
+			nil,
+			"",
+			disc.ErrNoTokenFound,
+		},
+		{
+			"Injected filesystem is used",
+			map[string]string{"XDG_RUNTIME_DIR": "/run/user/4242"},
+			[]disc.Option{disc.WithFS(fsys), disc.WithUID("4242")},
+			"xdg_token",
+			nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := append([]disc.Option{disc.WithEnvMap(tc.env), disc.WithoutOSFilesystem(), failingLookup, noUID}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, err := d.FindToken()
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("Expected error %v, got %v", tc.expectedErr, err)
+				}
+				if string(tok) != tc.expectedTok {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedTok, tok)
+				}
+			},
+		)
+	}
+}
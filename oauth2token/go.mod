@@ -0,0 +1,10 @@
+module github.com/shreyb/wlcg-bearer-token-discovery-go/oauth2token
+
+go 1.23.3
+
+require (
+	github.com/shreyb/wlcg-bearer-token-discovery-go v0.0.0-00010101000000-000000000000
+	golang.org/x/oauth2 v0.30.0
+)
+
+replace github.com/shreyb/wlcg-bearer-token-discovery-go => ../
@@ -0,0 +1,77 @@
+// Package oauth2token adapts the WLCG Bearer Token Discovery procedure to golang.org/x/oauth2, so that discovered
+// tokens can be used by clients that take an oauth2.TokenSource. It is a module of its own, so that users of the
+// discovery package alone do not depend on golang.org/x/oauth2.
+package oauth2token
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+// DefaultOpaqueLifetime is how long tokens without an exp claim are considered valid, unless set otherwise with
+// WithOpaqueLifetime
+const DefaultOpaqueLifetime = time.Minute
+
+// Option configures TokenSource
+type Option func(*tokenSource)
+
+// WithOpaqueLifetime sets how long tokens without an exp claim, such as opaque tokens and macaroons, are considered
+// valid after discovery, so that oauth2.ReuseTokenSource runs discovery again to pick up renewed tokens. 0 makes them
+// expire immediately, so that every call to a reusing source runs discovery.
+func WithOpaqueLifetime(lifetime time.Duration) Option {
+	return func(s *tokenSource) {
+		s.opaqueLifetime = max(lifetime, 0)
+	}
+}
+
+// WithClock sets the function used to get the current time when computing the expiry of tokens without an exp claim,
+// time.Now by default. A nil clock is ignored.
+func WithClock(now func() time.Time) Option {
+	return func(s *tokenSource) {
+		if now != nil {
+			s.now = now
+		}
+	}
+}
+
+// tokenSource is the oauth2.TokenSource returned by TokenSource
+type tokenSource struct {
+	ctx            context.Context
+	d              *disc.Discoverer
+	opaqueLifetime time.Duration
+	now            func() time.Time
+}
+
+// TokenSource returns an oauth2.TokenSource whose Token method runs discovery with d, or the default discovery
+// procedure if d is nil, under ctx. The token returned is of type Bearer. Its Expiry is the exp claim if the token is a
+// JWT with one, and DefaultOpaqueLifetime, or the lifetime set with WithOpaqueLifetime, after discovery otherwise, so
+// that wrapping the source with oauth2.ReuseTokenSource caches the token until it expires. The token is NOT verified,
+// as described for tokendiscovery.ParseClaims.
+func TokenSource(ctx context.Context, d *disc.Discoverer, opts ...Option) oauth2.TokenSource {
+	s := &tokenSource{ctx: ctx, d: d, opaqueLifetime: DefaultOpaqueLifetime, now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Token implements oauth2.TokenSource
+func (s *tokenSource) Token() (*oauth2.Token, error) {
+	discover := disc.DiscoverContext
+	if s.d != nil {
+		discover = s.d.DiscoverContext
+	}
+	res, err := discover(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+	expiry, ok := res.ExpiresAt()
+	if !ok {
+		expiry = s.now().Add(s.opaqueLifetime)
+	}
+	return &oauth2.Token{AccessToken: string(res.Trimmed()), TokenType: "Bearer", Expiry: expiry}, nil
+}
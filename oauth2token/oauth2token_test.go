@@ -0,0 +1,178 @@
+package oauth2token_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+	"github.com/shreyb/wlcg-bearer-token-discovery-go/oauth2token"
+)
+
+// countingStep is a step producing a fixed token, that counts how often it runs
+type countingStep struct {
+	token   string
+	lookups atomic.Int32
+}
+
+func (c *countingStep) Name() string { return "counting" }
+
+func (c *countingStep) Lookup(context.Context, disc.Environ, disc.FileReader) (disc.Result, error) {
+	c.lookups.Add(1)
+	return disc.NewResult([]byte(c.token), ""), nil
+}
+
+// makeJWT returns an unsigned JWT with claims
+func makeJWT(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"none"}`)) + "." + enc.EncodeToString(payload) + "."
+}
+
+func TestTokenSource(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	exp := now.Add(time.Hour)
+	jwt := makeJWT(t, map[string]any{"sub": "user", "exp": exp.Unix()})
+
+	type testCase struct {
+		description    string
+		token          string
+		opts           []oauth2token.Option
+		expectedExpiry time.Time
+	}
+
+	testCases := []testCase{
+		{"JWT", jwt, nil, exp},
+		{"JWT without exp", makeJWT(t, map[string]any{"sub": "user"}), nil, now.Add(oauth2token.DefaultOpaqueLifetime)},
+		{"Opaque token", "opaque_token", nil, now.Add(oauth2token.DefaultOpaqueLifetime)},
+		{
+			"Opaque token with lifetime",
+			"opaque_token",
+			[]oauth2token.Option{oauth2token.WithOpaqueLifetime(time.Hour)},
+			now.Add(time.Hour),
+		},
+		{
+			"Nil clock ignored",
+			"opaque_token",
+			[]oauth2token.Option{oauth2token.WithClock(nil)},
+			now.Add(oauth2token.DefaultOpaqueLifetime),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				d, err := disc.New(disc.WithSteps(&countingStep{token: tc.token}))
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				opts := append([]oauth2token.Option{oauth2token.WithClock(func() time.Time { return now })}, tc.opts...)
+				tok, err := oauth2token.TokenSource(context.Background(), d, opts...).Token()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if tok.AccessToken != tc.token {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.token, tok.AccessToken)
+				}
+				if tok.Type() != "Bearer" {
+					t.Errorf("Token types do not match.  Expected Bearer, got %s", tok.Type())
+				}
+				if !tok.Expiry.Equal(tc.expectedExpiry) {
+					t.Errorf("Expiry times do not match.  Expected %s, got %s", tc.expectedExpiry, tok.Expiry)
+				}
+			},
+		)
+	}
+}
+
+func TestTokenSourceReuse(t *testing.T) {
+	// ReuseTokenSource treats tokens expiring within 10 seconds as expired
+	type testCase struct {
+		description     string
+		token           string
+		opts            []oauth2token.Option
+		expectedLookups int32
+	}
+
+	testCases := []testCase{
+		{"JWT reused until expiry", makeJWT(t, map[string]any{"exp": time.Now().Add(time.Hour).Unix()}), nil, 1},
+		{"Expired JWT", makeJWT(t, map[string]any{"exp": time.Now().Add(-time.Minute).Unix()}), nil, 3},
+		{"JWT about to expire", makeJWT(t, map[string]any{"exp": time.Now().Add(5 * time.Second).Unix()}), nil, 3},
+		{"Opaque token reused", "opaque_token", nil, 1},
+		{"Opaque token without lifetime", "opaque_token", []oauth2token.Option{oauth2token.WithOpaqueLifetime(0)}, 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				step := &countingStep{token: tc.token}
+				d, err := disc.New(disc.WithSteps(step))
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				src := oauth2.ReuseTokenSource(nil, oauth2token.TokenSource(context.Background(), d, tc.opts...))
+				for range 3 {
+					tok, err := src.Token()
+					if err != nil {
+						t.Fatalf("Expected nil error, got %v", err)
+					}
+					if tok.AccessToken != tc.token {
+						t.Errorf("Token strings do not match.  Expected %s, got %s", tc.token, tok.AccessToken)
+					}
+				}
+				if n := step.lookups.Load(); n != tc.expectedLookups {
+					t.Errorf("Expected %d discoveries, got %d", tc.expectedLookups, n)
+				}
+			},
+		)
+	}
+}
+
+func TestTokenSourceRediscoveryAfterExpiry(t *testing.T) {
+	// With almost no early expiry, the token is reused until its exp claim has passed
+	exp := time.Now().Truncate(time.Second).Add(2 * time.Second)
+	step := &countingStep{token: makeJWT(t, map[string]any{"exp": exp.Unix()})}
+	d, err := disc.New(disc.WithSteps(step))
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	src := oauth2.ReuseTokenSourceWithExpiry(nil, oauth2token.TokenSource(context.Background(), d), time.Nanosecond)
+	for range 2 {
+		if _, err := src.Token(); err != nil {
+			t.Fatalf("Expected nil error, got %v", err)
+		}
+	}
+	if n := step.lookups.Load(); n != 1 {
+		t.Errorf("Expected 1 discovery before expiry, got %d", n)
+	}
+	time.Sleep(time.Until(exp.Add(10 * time.Millisecond)))
+	if _, err := src.Token(); err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	if n := step.lookups.Load(); n != 2 {
+		t.Errorf("Expected 2 discoveries after expiry, got %d", n)
+	}
+}
+
+func TestTokenSourceNoToken(t *testing.T) {
+	d, err := disc.New(disc.WithEnvMap(nil), disc.WithFS(fstest.MapFS{}), disc.WithUID("4242"))
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	if _, err := oauth2token.TokenSource(context.Background(), d).Token(); !errors.Is(err, disc.ErrNoTokenFound) {
+		t.Errorf("Expected error %s, got %v", disc.ErrNoTokenFound, err)
+	}
+}
@@ -0,0 +1,119 @@
+package tokendiscovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// defaultOIDCAgentTimeout bounds how long discovery waits for oidc-agent to answer a token request
+const defaultOIDCAgentTimeout = 5 * time.Second
+
+// WithOIDCAgent adds a step, after step 1, that requests an access token for the oidc-agent account shortname from the
+// agent listening on the UNIX socket named by the OIDC_SOCK environment variable. The token is treated as if it came
+// from BEARER_TOKEN. If OIDC_SOCK is unset, or the agent cannot be reached or does not return a token, the failure is
+// recorded and discovery continues with the next step.
+func WithOIDCAgent(shortname string) Option {
+	return func(d *Discoverer) error {
+		if shortname == "" {
+			return fmt.Errorf("%w: oidc-agent account shortname cannot be empty", ErrInvalidOption)
+		}
+		d.oidcAgentAccount = shortname
+		return nil
+	}
+}
+
+// WithOIDCAgentTimeout sets how long discovery waits for oidc-agent to answer a token request, 5 seconds by default
+func WithOIDCAgentTimeout(timeout time.Duration) Option {
+	return func(d *Discoverer) error {
+		if timeout <= 0 {
+			return fmt.Errorf("%w: oidc-agent timeout must be positive", ErrInvalidOption)
+		}
+		d.oidcAgentTimeout = timeout
+		return nil
+	}
+}
+
+// oidcAgentStep requests a token from oidc-agent
+type oidcAgentStep struct{}
+
+func (oidcAgentStep) Name() string { return SourceOIDCAgent.String() }
+
+func (oidcAgentStep) Lookup(ctx context.Context, env Environ, fsys FileReader) (Result, error) {
+	d := stepDiscoverer(fsys)
+	if d.skipEnvironmentSources() || d.oidcAgentAccount == "" {
+		return Result{}, SkipStep(nil)
+	}
+	sock := lookupValue(env, "OIDC_SOCK")
+	if sock == "" {
+		return Result{}, envUnset(SourceOIDCAgent, "OIDC_SOCK")
+	}
+
+	tok, err := d.oidcAgentToken(ctx, sock)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return Result{}, fmt.Errorf("token discovery abandoned: %w", ctxErr)
+		}
+		return Result{}, SkipStep(&DiscoveryError{Step: SourceOIDCAgent, Path: sock, Err: fmt.Errorf("cannot get token for account %s from oidc-agent at %s: %w", d.oidcAgentAccount, sock, err)})
+	}
+	return Result{token: tok, source: SourceOIDCAgent}, nil
+}
+
+// oidcAgentRequest is an access token request in the oidc-agent IPC protocol
+type oidcAgentRequest struct {
+	Request string `json:"request"`
+	Account string `json:"account"`
+}
+
+// oidcAgentResponse is the reply of oidc-agent to an oidcAgentRequest
+type oidcAgentResponse struct {
+	Status      string `json:"status"`
+	AccessToken string `json:"access_token"`
+	Error       string `json:"error"`
+}
+
+// oidcAgentToken requests an access token from the oidc-agent listening on sock. The request is abandoned when ctx is
+// done or the configured timeout expires.
+func (d *Discoverer) oidcAgentToken(ctx context.Context, sock string) ([]byte, error) {
+	timeout := d.oidcAgentTimeout
+	if timeout == 0 {
+		timeout = defaultOIDCAgentTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", sock)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// Unblock the exchange below once ctx is done. A deadline taken from ctx could expire before ctx reports it, and
+	// the failure would then be mistaken for a problem with oidc-agent.
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	d.debug("requesting token from oidc-agent", "socket", sock, "account", d.oidcAgentAccount)
+	if err := json.NewEncoder(conn).Encode(oidcAgentRequest{Request: "access_token", Account: d.oidcAgentAccount}); err != nil {
+		return nil, err
+	}
+	var resp oidcAgentResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	if resp.Status != "success" {
+		if resp.Error == "" {
+			resp.Error = fmt.Sprintf("request failed with status %q", resp.Status)
+		}
+		return nil, errors.New(resp.Error)
+	}
+	tok := strings.TrimSpace(resp.AccessToken)
+	if tok == "" {
+		return nil, errors.New("response does not contain an access token")
+	}
+	return []byte(tok), nil
+}
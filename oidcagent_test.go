@@ -0,0 +1,203 @@
+package tokendiscovery_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+// fakeOIDCAgent serves the oidc-agent IPC protocol on a UNIX socket, answering access token requests for the accounts
+// in tokens. If hang is set, requests are never answered.
+func fakeOIDCAgent(t *testing.T, tokens map[string]string, hang bool) string {
+	t.Helper()
+	// UNIX socket paths are limited to about 100 bytes, which t.TempDir() can exceed
+	dir, err := os.MkdirTemp("", "oidc-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	sock := filepath.Join(dir, "oidc-agent.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("Cannot listen on UNIX socket: %s", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var req struct {
+					Request string `json:"request"`
+					Account string `json:"account"`
+				}
+				if err := json.NewDecoder(conn).Decode(&req); err != nil {
+					return
+				}
+				if hang {
+					time.Sleep(time.Minute)
+					return
+				}
+				resp := map[string]any{"status": "failure", "error": "No account configured with that short name"}
+				if tok, ok := tokens[req.Account]; ok && req.Request == "access_token" {
+					resp = map[string]any{"status": "success", "access_token": tok, "issuer": "https://example.com/", "expires_at": 0}
+				}
+				json.NewEncoder(conn).Encode(resp)
+			}()
+		}
+	}()
+	return sock
+}
+
+func TestWithOIDCAgent(t *testing.T) {
+	sock := fakeOIDCAgent(t, map[string]string{"wlcg": "agent_token"}, false)
+	hungSock := fakeOIDCAgent(t, map[string]string{"wlcg": "agent_token"}, true)
+	fsys := fstest.MapFS{
+		"run/user/4242/bt_u4242": {Data: []byte("xdg_token")},
+		"scratch/token":          {Data: []byte("file_token")},
+	}
+
+	type testCase struct {
+		description    string
+		env            map[string]string
+		opts           []disc.Option
+		expectedTok    string
+		expectedSource disc.Source
+		expectedReason string
+	}
+
+	testCases := []testCase{
+		{
+			"Agent returns token",
+			map[string]string{"OIDC_SOCK": sock, "BEARER_TOKEN_FILE": "/scratch/token"},
+			[]disc.Option{disc.WithOIDCAgent("wlcg")},
+			"agent_token",
+			disc.SourceOIDCAgent,
+			"",
+		},
+		{
+			"BEARER_TOKEN takes precedence",
+			map[string]string{"OIDC_SOCK": sock, "BEARER_TOKEN": "env_token"},
+			[]disc.Option{disc.WithOIDCAgent("wlcg")},
+			"env_token",
+			disc.SourceBearerTokenEnv,
+			"",
+		},
+		{
+			"Not enabled",
+			map[string]string{"OIDC_SOCK": sock, "BEARER_TOKEN_FILE": "/scratch/token"},
+			nil,
+			"file_token",
+			disc.SourceBearerTokenFile,
+			"",
+		},
+		{
+			"OIDC_SOCK unset",
+			map[string]string{"XDG_RUNTIME_DIR": "/run/user/4242"},
+			[]disc.Option{disc.WithOIDCAgent("wlcg")},
+			"xdg_token",
+			disc.SourceXDGRuntimeDir,
+			"",
+		},
+		{
+			"Unknown account falls through",
+			map[string]string{"OIDC_SOCK": sock, "XDG_RUNTIME_DIR": "/run/user/4242"},
+			[]disc.Option{disc.WithOIDCAgent("other")},
+			"xdg_token",
+			disc.SourceXDGRuntimeDir,
+			"No account configured",
+		},
+		{
+			"Missing socket falls through",
+			map[string]string{"OIDC_SOCK": filepath.Join(t.TempDir(), "missing.sock"), "XDG_RUNTIME_DIR": "/run/user/4242"},
+			[]disc.Option{disc.WithOIDCAgent("wlcg")},
+			"xdg_token",
+			disc.SourceXDGRuntimeDir,
+			"missing.sock",
+		},
+		{
+			"Unresponsive agent times out",
+			map[string]string{"OIDC_SOCK": hungSock, "XDG_RUNTIME_DIR": "/run/user/4242"},
+			[]disc.Option{disc.WithOIDCAgent("wlcg"), disc.WithOIDCAgentTimeout(50 * time.Millisecond)},
+			"xdg_token",
+			disc.SourceXDGRuntimeDir,
+			"timeout",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := append([]disc.Option{disc.WithEnvMap(tc.env), disc.WithFS(fsys), disc.WithUID("4242")}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				res, err := d.Discover()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %s", err)
+				}
+				if string(res.Bytes()) != tc.expectedTok {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedTok, res.Bytes())
+				}
+				if res.Source() != tc.expectedSource {
+					t.Errorf("Token sources do not match. Expected source %s, got %s", tc.expectedSource, res.Source())
+				}
+			},
+		)
+	}
+
+	// When no step produces a token, the agent failure is reported in the error
+	for _, tc := range testCases {
+		if tc.expectedReason == "" {
+			continue
+		}
+		t.Run(
+			tc.description+" is recorded",
+			func(t *testing.T) {
+				env := map[string]string{"OIDC_SOCK": tc.env["OIDC_SOCK"]}
+				opts := append([]disc.Option{disc.WithEnvMap(env), disc.WithFS(fstest.MapFS{}), disc.WithUID("4242")}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				_, err = d.Discover()
+				if !errors.Is(err, disc.ErrNoTokenFound) {
+					t.Fatalf("Expected error %s, got %v", disc.ErrNoTokenFound, err)
+				}
+				if !strings.Contains(err.Error(), tc.expectedReason) {
+					t.Errorf("Expected error to contain %q, got %s", tc.expectedReason, err)
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"Cancelled context abandons discovery",
+		func(t *testing.T) {
+			d, err := disc.New(disc.WithEnvMap(map[string]string{"OIDC_SOCK": hungSock}), disc.WithFS(fsys), disc.WithOIDCAgent("wlcg"))
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			if _, err := d.DiscoverContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Expected error %s, got %v", context.DeadlineExceeded, err)
+			}
+		},
+	)
+}
@@ -0,0 +1,36 @@
+package tokendiscovery
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrWrongOwner indicates that a token file was not used because it is not owned by the user it is named for. Since
+// /tmp is world-writable, anyone can create /tmp/bt_u$ID before the user with that uid does, so step 4 of the discovery
+// procedure skips a token file owned by any other user, unless WithoutOwnershipCheck is given.
+var ErrWrongOwner = errors.New("token file is not owned by the expected user")
+
+// WithoutOwnershipCheck makes step 4 of the discovery procedure use /tmp/bt_u$ID regardless of which user owns it, for
+// setups where a service account writes token files on behalf of users
+func WithoutOwnershipCheck() Option {
+	return func(d *Discoverer) error {
+		d.skipOwnerCheck = true
+		return nil
+	}
+}
+
+// checkOwner returns an error wrapping ErrWrongOwner if the token file at path is not owned by uid. Where file
+// ownership is not available, as on Windows or on most injected filesystems, the file is assumed to be owned by uid.
+func (d *Discoverer) checkOwner(path, uid string) error {
+	if d.skipOwnerCheck {
+		return nil
+	}
+	info, err := d.stat(path)
+	if err != nil {
+		return fmt.Errorf("cannot check owner of token file: %w", err)
+	}
+	if owner, ok := d.fileOwner(info); ok && owner != uid {
+		return fmt.Errorf("%w: %s is owned by uid %s, not %s", ErrWrongOwner, path, owner, uid)
+	}
+	return nil
+}
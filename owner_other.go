@@ -0,0 +1,11 @@
+//go:build !unix
+
+package tokendiscovery
+
+import "io/fs"
+
+// fileOwner returns the uid of the owner of the file described by info. File ownership is not available on this
+// platform.
+func fileOwner(fs.FileInfo) (string, bool) {
+	return "", false
+}
@@ -0,0 +1,94 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestFallbackOwnershipCheck(t *testing.T) {
+	fsys := fstest.MapFS{"tmp/bt_u4242": {Data: []byte("tmp_token")}}
+	ownedBy := func(uid string) func(fs.FileInfo) (string, bool) {
+		return func(fs.FileInfo) (string, bool) { return uid, uid != "" }
+	}
+
+	type testCase struct {
+		description   string
+		owner         string
+		opts          []disc.Option
+		expectedToken string
+		expectedErr   error
+	}
+
+	testCases := []testCase{
+		{
+			"Token file owned by target uid",
+			"4242",
+			nil,
+			"tmp_token",
+			nil,
+		},
+		{
+			"Token file owned by another uid",
+			"1234",
+			nil,
+			"",
+			disc.ErrWrongOwner,
+		},
+		{
+			"Token file owned by another uid, ownership check disabled",
+			"1234",
+			[]disc.Option{disc.WithoutOwnershipCheck()},
+			"tmp_token",
+			nil,
+		},
+		{
+			"Owner not available",
+			"",
+			nil,
+			"tmp_token",
+			nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := append([]disc.Option{
+					disc.WithEnvMap(map[string]string{}),
+					disc.WithFS(fsys),
+					disc.WithUID("4242"),
+					disc.WithFileOwner(ownedBy(tc.owner)),
+				}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, err := d.FindToken()
+				if tc.expectedErr != nil {
+					if !errors.Is(err, tc.expectedErr) {
+						t.Errorf("Expected error %s, got %v", tc.expectedErr, err)
+					}
+					if !errors.Is(err, disc.ErrNoTokenFound) {
+						t.Errorf("Expected error %s, got %v", disc.ErrNoTokenFound, err)
+					}
+					if expected := "owned by uid 1234"; err == nil || !strings.Contains(err.Error(), expected) {
+						t.Errorf("Expected error to mention %q, got %v", expected, err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if string(tok) != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, string(tok))
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package tokendiscovery
+
+import (
+	"io/fs"
+	"strconv"
+	"syscall"
+)
+
+// fileOwner returns the uid of the owner of the file described by info, if the platform provides it
+func fileOwner(info fs.FileInfo) (string, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", false
+	}
+	return strconv.FormatUint(uint64(st.Uid), 10), true
+}
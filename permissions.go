@@ -0,0 +1,90 @@
+package tokendiscovery
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// ErrInsecurePermissions indicates that a token file can be read or written by users other than its owner. The WLCG
+// Bearer Token Discovery specification recommends that token files have mode 0600.
+var ErrInsecurePermissions = errors.New("token file permissions are too permissive")
+
+// PermissionPolicy decides what discovery does with a token file whose mode grants access to its group or to other
+// users
+type PermissionPolicy int
+
+const (
+	// PermissionsWarn uses the token file, but reports it to the hook set with WithInsecurePermissionsHook, and logs a
+	// warning to the logger set with WithLogger. This is the default.
+	PermissionsWarn PermissionPolicy = iota
+	// PermissionsIgnore uses the token file without checking its mode
+	PermissionsIgnore
+	// PermissionsReject skips the token file, and records an error wrapping ErrInsecurePermissions for the step
+	PermissionsReject
+)
+
+func (p PermissionPolicy) String() string {
+	switch p {
+	case PermissionsWarn:
+		return "PermissionsWarn"
+	case PermissionsIgnore:
+		return "PermissionsIgnore"
+	case PermissionsReject:
+		return "PermissionsReject"
+	default:
+		return fmt.Sprintf("PermissionPolicy(%d)", int(p))
+	}
+}
+
+// WithPermissionPolicy sets what discovery does with token files whose mode has group or other permission bits set. The
+// mode is not checked on Windows, where it does not reflect who can access the file, unless WithFS is given.
+func WithPermissionPolicy(policy PermissionPolicy) Option {
+	return func(d *Discoverer) error {
+		switch policy {
+		case PermissionsWarn, PermissionsIgnore, PermissionsReject:
+		default:
+			return fmt.Errorf("%w: unknown permission policy %s", ErrInvalidOption, policy)
+		}
+		d.permissionPolicy = policy
+		return nil
+	}
+}
+
+// WithInsecurePermissionsHook sets a function that is called with the path and mode of each token file that discovery
+// uses despite its mode having group or other permission bits set, under the PermissionsWarn policy
+func WithInsecurePermissionsHook(hook func(path string, mode fs.FileMode)) Option {
+	return func(d *Discoverer) error {
+		if hook == nil {
+			return fmt.Errorf("%w: insecure permissions hook cannot be nil", ErrInvalidOption)
+		}
+		d.insecurePermissionsHook = hook
+		return nil
+	}
+}
+
+// checkPermissions applies the permission policy of d to the token file at path, which has just been read. It returns
+// an error wrapping ErrInsecurePermissions if the file must not be used.
+func (d *Discoverer) checkPermissions(path string) error {
+	if d.permissionPolicy == PermissionsIgnore || (d.fsys == nil && !hasFileModes) {
+		return nil
+	}
+	info, err := d.stat(path)
+	if err != nil {
+		return fmt.Errorf("cannot check permissions of token file: %w", err)
+	}
+	mode := info.Mode().Perm()
+	if mode&0o077 == 0 {
+		return nil
+	}
+	if d.permissionPolicy == PermissionsReject {
+		return fmt.Errorf("%w: %s has mode %#o", ErrInsecurePermissions, path, mode)
+	}
+	if d.logger != nil {
+		d.logger.Warn("token file is accessible by other users", "path", path, "mode", fmt.Sprintf("%#o", mode))
+	}
+	if d.insecurePermissionsHook != nil {
+		d.insecurePermissionsHook(path, mode)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestPermissionPolicy(t *testing.T) {
+	type testCase struct {
+		description   string
+		policy        disc.PermissionPolicy
+		mode          fs.FileMode
+		expectedToken string
+		expectedWarn  bool
+		expectedErr   error
+	}
+
+	testCases := []testCase{
+		{"Ignore, mode 0600", disc.PermissionsIgnore, 0o600, "tmp_token", false, nil},
+		{"Ignore, mode 0640", disc.PermissionsIgnore, 0o640, "tmp_token", false, nil},
+		{"Ignore, mode 0666", disc.PermissionsIgnore, 0o666, "tmp_token", false, nil},
+		{"Warn, mode 0600", disc.PermissionsWarn, 0o600, "tmp_token", false, nil},
+		{"Warn, mode 0640", disc.PermissionsWarn, 0o640, "tmp_token", true, nil},
+		{"Warn, mode 0666", disc.PermissionsWarn, 0o666, "tmp_token", true, nil},
+		{"Reject, mode 0600", disc.PermissionsReject, 0o600, "tmp_token", false, nil},
+		{"Reject, mode 0640", disc.PermissionsReject, 0o640, "", false, disc.ErrInsecurePermissions},
+		{"Reject, mode 0666", disc.PermissionsReject, 0o666, "", false, disc.ErrInsecurePermissions},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				fsys := fstest.MapFS{"tmp/bt_u4242": {Data: []byte("tmp_token"), Mode: tc.mode}}
+				var warnedPath string
+				var warnedMode fs.FileMode
+				d, err := disc.New(
+					disc.WithEnvMap(map[string]string{}),
+					disc.WithFS(fsys),
+					disc.WithUID("4242"),
+					disc.WithPermissionPolicy(tc.policy),
+					disc.WithInsecurePermissionsHook(func(path string, mode fs.FileMode) {
+						warnedPath, warnedMode = path, mode
+					}),
+				)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, err := d.FindToken()
+				if tc.expectedErr != nil {
+					if !errors.Is(err, tc.expectedErr) {
+						t.Errorf("Expected error %s, got %v", tc.expectedErr, err)
+					}
+					if !errors.Is(err, disc.ErrNoTokenFound) {
+						t.Errorf("Expected rejected token file to be skipped, and error to wrap %s, got %v", disc.ErrNoTokenFound, err)
+					}
+				} else {
+					if err != nil {
+						t.Fatalf("Expected nil error, got %v", err)
+					}
+					if string(tok) != tc.expectedToken {
+						t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, string(tok))
+					}
+				}
+				if warned := warnedPath != ""; warned != tc.expectedWarn {
+					t.Fatalf("Expected warning to be %t, got %t", tc.expectedWarn, warned)
+				}
+				if tc.expectedWarn {
+					if warnedPath != "/tmp/bt_u4242" {
+						t.Errorf("Warned paths do not match. Expected /tmp/bt_u4242, got %s", warnedPath)
+					}
+					if warnedMode != tc.mode {
+						t.Errorf("Warned modes do not match. Expected %#o, got %#o", tc.mode, warnedMode)
+					}
+				}
+			},
+		)
+	}
+}
+
+func TestPermissionPolicyRejectFallsThrough(t *testing.T) {
+	fsys := fstest.MapFS{
+		"home/user/token": {Data: []byte("file_token"), Mode: 0o644},
+		"tmp/bt_u4242":    {Data: []byte("tmp_token"), Mode: 0o600},
+	}
+	d, err := disc.New(
+		disc.WithEnvMap(map[string]string{"BEARER_TOKEN_FILE": "/home/user/token"}),
+		disc.WithFS(fsys),
+		disc.WithUID("4242"),
+		disc.WithPermissionPolicy(disc.PermissionsReject),
+	)
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	tok, err := d.FindToken()
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	if string(tok) != "tmp_token" {
+		t.Errorf("Token strings do not match.  Expected tmp_token, got %s", string(tok))
+	}
+}
@@ -0,0 +1,135 @@
+package tokendiscovery
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TrustedJWKSEnv is the environment variable NewVerifierFromJWKSFile consults when given no path
+const TrustedJWKSEnv = "WLCG_TRUSTED_JWKS"
+
+// ErrUnknownIssuer indicates that a Verifier made by NewVerifierFromJWKSFile for a directory has no JWKS file for the
+// issuer of a token
+var ErrUnknownIssuer = errors.New("no trusted keys for token issuer")
+
+// NewVerifierFromJWKSFile returns a Verifier that verifies tokens offline, with keys read from path instead of fetched
+// from their issuer, as on worker nodes that get the keys of their issuers from CVMFS. If path is empty, the
+// WLCG_TRUSTED_JWKS environment variable names it. path may be a JWKS file, whose keys are then trusted for tokens from
+// any issuer, or a directory holding a JWKS file per issuer. The file for an issuer is named after its URL without the
+// scheme, with slashes replaced by underscores, and with the .json extension: wlcg.cloud.cnaf.infn.it.json for
+// https://wlcg.cloud.cnaf.infn.it/, or cilogon.org_fermilab.json for https://cilogon.org/fermilab. If a directory has
+// no file for the issuer of a token, the error returned by Verify wraps ErrUnknownIssuer. Files are checked whenever a
+// token is verified, and read again if their modification time or size changed, so that updates are picked up.
+func NewVerifierFromJWKSFile(path string, opts ...VerifierOption) (*Verifier, error) {
+	if path == "" {
+		path = os.Getenv(TrustedJWKSEnv)
+		if path == "" {
+			return nil, fmt.Errorf("%w: no JWKS path given and %s is not set", ErrInvalidOption, TrustedJWKSEnv)
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOption, err)
+	}
+	v := &Verifier{jwksPath: path, jwksDir: info.IsDir(), algs: DefaultAlgorithms}
+	for _, opt := range opts {
+		if err := opt(v); err != nil {
+			return nil, err
+		}
+	}
+	if !v.jwksDir {
+		// Reports malformed files early
+		if _, err := v.readJWKSFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// jwksFileName returns the name of the JWKS file for issuer in a directory given to NewVerifierFromJWKSFile
+func jwksFileName(issuer string) (string, error) {
+	u, err := url.Parse(normalizeIssuer(issuer))
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("%w: invalid issuer %q", ErrUnknownIssuer, issuer)
+	}
+	name := strings.ReplaceAll(u.Host+u.EscapedPath(), "/", "_")
+	if strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("%w: invalid issuer %q", ErrUnknownIssuer, issuer)
+	}
+	return name + ".json", nil
+}
+
+// pinnedKeys returns the keys for tok of a Verifier made by NewVerifierFromJWKSFile
+func (v *Verifier) pinnedKeys(tok []byte) (*JWKSet, error) {
+	if !v.jwksDir {
+		return v.readJWKSFile(v.jwksPath)
+	}
+	claims, err := parseClaimsCached(tok)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Issuer() == "" {
+		return nil, fmt.Errorf("%w: token has no iss claim", ErrUnknownIssuer)
+	}
+	name, err := jwksFileName(claims.Issuer())
+	if err != nil {
+		return nil, err
+	}
+	keys, err := v.readJWKSFile(filepath.Join(v.jwksPath, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w %q: %s has no file %s", ErrUnknownIssuer, claims.Issuer(), v.jwksPath, name)
+	}
+	return keys, err
+}
+
+// pinnedJWKS holds the keys read from a JWKS file by a Verifier made by NewVerifierFromJWKSFile, with the version of
+// the file they were read from
+type pinnedJWKS struct {
+	modTime time.Time
+	size    int64
+	keys    *JWKSet
+}
+
+// readJWKSFile returns the keys in the JWKS file at path. The keys read before are returned while the modification time
+// and size of the file are unchanged, so that the file is not parsed for every token, and so that tokens verified with
+// the same keys are found in the cache of parsed claims.
+func (v *Verifier) readJWKSFile(path string) (*JWKSet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	v.mu.Lock()
+	cached := v.pinned[path]
+	v.mu.Unlock()
+	if cached != nil && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.keys, nil
+	}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.pinned == nil {
+		v.pinned = make(map[string]*pinnedJWKS)
+	}
+	v.pinned[path] = &pinnedJWKS{modTime: info.ModTime(), size: info.Size(), keys: keys}
+	return keys, nil
+}
@@ -0,0 +1,198 @@
+package tokendiscovery_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestNewVerifierFromJWKSFile(t *testing.T) {
+	cnafKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fermilabKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"wlcg.cloud.cnaf.infn.it.json": jwksJSON(map[string]*rsa.PrivateKey{"cnaf": cnafKey}),
+		"cilogon.org_fermilab.json":    jwksJSON(map[string]*rsa.PrivateKey{"fermilab": fermilabKey}),
+		"cilogon.org_broken.json":      []byte(`{"keys": [`),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	singleFile := filepath.Join(dir, "wlcg.cloud.cnaf.infn.it.json")
+
+	token := func(key *rsa.PrivateKey, kid, iss string) string {
+		claims := map[string]any{"sub": "user", "exp": time.Now().Add(time.Hour).Unix()}
+		if iss != "" {
+			claims["iss"] = iss
+		}
+		return signJWT(t, key, map[string]any{"alg": "RS256", "kid": kid}, claims)
+	}
+
+	type testCase struct {
+		description string
+		path        string
+		tok         string
+		expectedErr error
+	}
+
+	testCases := []testCase{
+		{"Directory, first issuer", dir, token(cnafKey, "cnaf", "https://wlcg.cloud.cnaf.infn.it/"), nil},
+		{"Directory, second issuer", dir, token(fermilabKey, "fermilab", "https://cilogon.org/fermilab"), nil},
+		{"Directory, third issuer", dir, token(otherKey, "other", "https://other.example"), disc.ErrUnknownIssuer},
+		{"Directory, no issuer", dir, token(cnafKey, "cnaf", ""), disc.ErrUnknownIssuer},
+		{"Directory, key of another issuer", dir, token(fermilabKey, "cnaf", "https://wlcg.cloud.cnaf.infn.it/"), disc.ErrInvalidSignature},
+		{"Directory, malformed file", dir, token(otherKey, "other", "https://cilogon.org/broken"), disc.ErrInvalidJWKS},
+		{"Directory, issuer escaping directory", dir, token(otherKey, "other", "https://../x"), disc.ErrUnknownIssuer},
+		{"File", singleFile, token(cnafKey, "cnaf", "https://any.example"), nil},
+		{"File, unknown key", singleFile, token(fermilabKey, "fermilab", "https://cilogon.org/fermilab"), disc.ErrUnknownKey},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				v, err := disc.NewVerifierFromJWKSFile(tc.path)
+				if err != nil {
+					t.Fatalf("Could not construct Verifier: %s", err)
+				}
+				_, err = v.Verify(context.Background(), []byte(tc.tok))
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("Errors do not match.  Expected %v, got %v", tc.expectedErr, err)
+				}
+			},
+		)
+	}
+}
+
+func TestNewVerifierFromJWKSFileInvalid(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "broken.json")
+	if err := os.WriteFile(broken, []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	type testCase struct {
+		description string
+		path        string
+		expectedErr error
+	}
+
+	testCases := []testCase{
+		{"No path", "", disc.ErrInvalidOption},
+		{"Missing file", filepath.Join(dir, "missing.json"), disc.ErrInvalidOption},
+		{"Malformed file", broken, disc.ErrInvalidJWKS},
+	}
+
+	t.Setenv(disc.TrustedJWKSEnv, "")
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				if _, err := disc.NewVerifierFromJWKSFile(tc.path); !errors.Is(err, tc.expectedErr) {
+					t.Errorf("Errors do not match.  Expected %v, got %v", tc.expectedErr, err)
+				}
+			},
+		)
+	}
+}
+
+func TestNewVerifierFromJWKSFileEnv(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "issuer.example.json"), jwksJSON(map[string]*rsa.PrivateKey{"rsa1": key}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(disc.TrustedJWKSEnv, dir)
+
+	v, err := disc.NewVerifierFromJWKSFile("")
+	if err != nil {
+		t.Fatalf("Could not construct Verifier: %s", err)
+	}
+	now := time.Now()
+	tok := signJWT(t, key, map[string]any{"alg": "RS256", "kid": "rsa1"}, map[string]any{
+		"iss":   "https://issuer.example",
+		"sub":   "user",
+		"aud":   "https://storage.example",
+		"scope": "storage.read:/",
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	claims, err := v.Validate(context.Background(), []byte(tok), disc.ValidationOptions{
+		Audience:       "https://storage.example",
+		Issuers:        []string{"https://issuer.example"},
+		RequiredScopes: []string{"storage.read:/"},
+	})
+	if err != nil {
+		t.Fatalf("Could not validate token offline: %s", err)
+	}
+	if claims.Sub != "user" {
+		t.Errorf("Subjects do not match.  Expected user, got %s", claims.Sub)
+	}
+}
+
+func TestNewVerifierFromJWKSFileReread(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "issuer.example.json")
+	if err := os.WriteFile(path, jwksJSON(map[string]*rsa.PrivateKey{"rsa1": key}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	v, err := disc.NewVerifierFromJWKSFile(path)
+	if err != nil {
+		t.Fatalf("Could not construct Verifier: %s", err)
+	}
+	claims := map[string]any{"sub": "user", "exp": time.Now().Add(time.Hour).Unix()}
+	tok := []byte(signJWT(t, key, map[string]any{"alg": "RS256", "kid": "rsa1"}, claims))
+
+	keys, err := v.PinnedKeys(tok)
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	if again, err := v.PinnedKeys(tok); err != nil || again != keys {
+		t.Errorf("Expected the keys of an unchanged file to be reused, got %p and %v", again, err)
+	}
+
+	// Rotate the key, making sure the modification time changes even on filesystems with coarse timestamps
+	if err := os.WriteFile(path, jwksJSON(map[string]*rsa.PrivateKey{"rsa2": newKey}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if again, err := v.PinnedKeys(tok); err != nil || again == keys {
+		t.Errorf("Expected the keys of a changed file to be read again, got %p and %v", again, err)
+	}
+	newTok := signJWT(t, newKey, map[string]any{"alg": "RS256", "kid": "rsa2"}, claims)
+	if _, err := v.Verify(context.Background(), []byte(newTok)); err != nil {
+		t.Errorf("Expected nil error with the rotated key, got %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package tokendiscovery
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Location is a place where discovery would look for a token, as reported by PlannedLocations
+type Location struct {
+	// Step is the name of the discovery step that consults the location
+	Step string
+	// Source is the Source of a token found at the location
+	Source Source
+	// EnvVar is the environment variable the step depends on, if any
+	EnvVar string
+	// EnvSet reports whether EnvVar is set to a non-empty value. If it is not, the step is skipped.
+	EnvSet bool
+	// Path is the file, or for oidc-agent the socket, that would be read, if it can be determined
+	Path string
+}
+
+// String describes l without revealing the value of a token environment variable
+func (l Location) String() string {
+	switch {
+	case l.EnvVar != "" && !l.EnvSet:
+		return fmt.Sprintf("%s (not set)", l.EnvVar)
+	case l.EnvVar != "" && l.Path == "":
+		return fmt.Sprintf("%s (set, non-empty)", l.EnvVar)
+	case l.EnvVar != "":
+		return fmt.Sprintf("%s (from %s)", l.Path, l.EnvVar)
+	case l.Path != "":
+		return l.Path
+	default:
+		return l.Step
+	}
+}
+
+// planner is implemented by the standard steps, to describe where they would look for a token
+type planner interface {
+	plan(d *Discoverer, env Environ) ([]Location, error)
+}
+
+// PlannedLocations follows the WLCG Bearer Token Discovery procedure, without reading any token files, and returns the
+// locations that would be consulted, in order. This explains where discovery looks for a token in the current
+// environment. Steps that are disabled by options are left out, and steps configured with WithSteps that are not part
+// of this package are only identified by name.
+func PlannedLocations() ([]Location, error) {
+	return defaultDiscoverer.PlannedLocations()
+}
+
+// PlannedLocations is like the package-level PlannedLocations, but uses the discovery procedure as configured on d
+func (d *Discoverer) PlannedLocations() ([]Location, error) {
+	var locations []Location
+	for _, step := range d.steps {
+		if d.noFilesystem() && readsFiles(step) {
+			continue
+		}
+		p, ok := step.(planner)
+		if !ok {
+			locations = append(locations, Location{Step: step.Name(), Source: SourceCustom})
+			continue
+		}
+		stepLocations, err := p.plan(d, d.lookupEnv)
+		if err != nil {
+			return nil, err
+		}
+		for i := range stepLocations {
+			stepLocations[i].Step = step.Name()
+		}
+		locations = append(locations, stepLocations...)
+	}
+	return locations, nil
+}
+
+// envLocation returns the Location of a step that depends on the environment variable key, with the path that is
+// derived from its value by toPath, if toPath is not nil
+func envLocation(env Environ, source Source, key string, toPath func(val string) string) Location {
+	l := Location{Source: source, EnvVar: key}
+	val := lookupValue(env, key)
+	if strings.TrimSpace(val) == "" {
+		return l
+	}
+	l.EnvSet = true
+	if toPath != nil {
+		l.Path = toPath(val)
+	}
+	return l
+}
+
+func (bearerTokenEnvStep) plan(d *Discoverer, env Environ) ([]Location, error) {
+	if d.skipEnvironmentSources() {
+		return nil, nil
+	}
+	var locations []Location
+	for _, key := range d.tokenEnvVars() {
+		locations = append(locations, envLocation(env, SourceBearerTokenEnv, key, nil))
+	}
+	return locations, nil
+}
+
+func (bearerTokenFileStep) plan(d *Discoverer, env Environ) ([]Location, error) {
+	if d.skipEnvironmentSources() {
+		return nil, nil
+	}
+	var locations []Location
+	for _, key := range d.tokenFileEnvVars() {
+		val := lookupValue(env, key)
+		if d.expandPaths && val != "" {
+			if expanded, err := d.expandPath(val, env); err == nil {
+				val = expanded
+			}
+		}
+		if !d.fileList || val == "" {
+			locations = append(locations, Location{Source: SourceBearerTokenFile, EnvVar: key, EnvSet: val != "", Path: val})
+			if val != "" {
+				// Only the first variable that is set is consulted
+				break
+			}
+			continue
+		}
+		for _, fname := range filepath.SplitList(val) {
+			if fname != "" {
+				locations = append(locations, Location{Source: SourceBearerTokenFile, EnvVar: key, EnvSet: true, Path: fname})
+			}
+		}
+		break
+	}
+	return locations, nil
+}
+
+func (xdgRuntimeDirStep) plan(d *Discoverer, env Environ) ([]Location, error) {
+	xdgDir := lookupValue(env, "XDG_RUNTIME_DIR")
+	if xdgDir == "" {
+		return []Location{{Source: SourceXDGRuntimeDir, EnvVar: "XDG_RUNTIME_DIR"}}, nil
+	}
+	uid, err := d.currentUID()
+	if err != nil {
+		return nil, err
+	}
+	return []Location{{Source: SourceXDGRuntimeDir, EnvVar: "XDG_RUNTIME_DIR", EnvSet: true, Path: filepath.Join(xdgDir, d.tokenFileName(uid))}}, nil
+}
+
+func (tmpFallbackStep) plan(d *Discoverer, _ Environ) ([]Location, error) {
+	if d.noFallback {
+		return nil, nil
+	}
+	uid, err := d.currentUID()
+	if err != nil {
+		return nil, err
+	}
+	return []Location{{Source: SourceTmpFallback, Path: filepath.Join(d.fallbackDirectory(), d.tokenFileName(uid))}}, nil
+}
+
+func (implicitRuntimeDirStep) plan(d *Discoverer, env Environ) ([]Location, error) {
+	if lookupValue(env, "XDG_RUNTIME_DIR") != "" {
+		return nil, nil
+	}
+	base := d.implicitRuntimeDir
+	if base == "" {
+		base = defaultRuntimeDirBase
+	}
+	uid, err := d.currentUID()
+	if err != nil {
+		return nil, err
+	}
+	return []Location{{Source: SourceImplicitRuntimeDir, Path: filepath.Join(base, uid, d.tokenFileName(uid))}}, nil
+}
+
+func (credentialsDirectoryStep) plan(d *Discoverer, env Environ) ([]Location, error) {
+	if d.skipEnvironmentSources() {
+		return nil, nil
+	}
+	name := d.credentialName
+	if name == "" {
+		name = DefaultCredentialName
+	}
+	return []Location{envLocation(env, SourceCredentialsDirectory, "CREDENTIALS_DIRECTORY", func(dir string) string {
+		return filepath.Join(dir, name)
+	})}, nil
+}
+
+func (condorCredsStep) plan(d *Discoverer, env Environ) ([]Location, error) {
+	if d.skipEnvironmentSources() {
+		return nil, nil
+	}
+	name := d.condorCredName
+	if name == "" {
+		name = DefaultCondorCredName
+	}
+	return []Location{envLocation(env, SourceCondorCreds, "_CONDOR_CREDS", func(dir string) string {
+		return filepath.Join(dir, name)
+	})}, nil
+}
+
+func (k kubernetesStep) plan(*Discoverer, Environ) ([]Location, error) {
+	return []Location{{Source: SourceKubernetes, Path: k.path}}, nil
+}
+
+func (oidcAgentStep) plan(d *Discoverer, env Environ) ([]Location, error) {
+	if d.skipEnvironmentSources() || d.oidcAgentAccount == "" {
+		return nil, nil
+	}
+	return []Location{envLocation(env, SourceOIDCAgent, "OIDC_SOCK", func(sock string) string { return sock })}, nil
+}
+
+func (commandStep) plan(d *Discoverer, _ Environ) ([]Location, error) {
+	if len(d.command) == 0 {
+		return nil, nil
+	}
+	return []Location{{Source: SourceCommand}}, nil
+}
@@ -0,0 +1,130 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestPlannedLocations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"home/user/token":        {Data: []byte("file_token")},
+		"run/user/4242/bt_u4242": {Data: []byte("xdg_token")},
+		"tmp/bt_u4242":           {Data: []byte("tmp_token")},
+	}
+
+	type testCase struct {
+		description string
+		env         map[string]string
+		opts        []disc.Option
+		expected    []string
+	}
+
+	testCases := []testCase{
+		{
+			"Empty environment",
+			nil,
+			nil,
+			[]string{"BEARER_TOKEN (not set)", "BEARER_TOKEN_FILE (not set)", "XDG_RUNTIME_DIR (not set)", "/tmp/bt_u4242"},
+		},
+		{
+			"Everything set",
+			map[string]string{"BEARER_TOKEN": "env_token", "BEARER_TOKEN_FILE": "/home/user/token", "XDG_RUNTIME_DIR": "/run/user/4242"},
+			nil,
+			[]string{
+				"BEARER_TOKEN (set, non-empty)",
+				"/home/user/token (from BEARER_TOKEN_FILE)",
+				"/run/user/4242/bt_u4242 (from XDG_RUNTIME_DIR)",
+				"/tmp/bt_u4242",
+			},
+		},
+		{
+			"Missing token file",
+			map[string]string{"BEARER_TOKEN_FILE": "/home/user/missing", "XDG_RUNTIME_DIR": "/run/user/4242"},
+			nil,
+			[]string{
+				"BEARER_TOKEN (not set)",
+				"/home/user/missing (from BEARER_TOKEN_FILE)",
+				"/run/user/4242/bt_u4242 (from XDG_RUNTIME_DIR)",
+				"/tmp/bt_u4242",
+			},
+		},
+		{
+			"Blank BEARER_TOKEN",
+			map[string]string{"BEARER_TOKEN": "  ", "XDG_RUNTIME_DIR": "/run/user/4242"},
+			nil,
+			[]string{"BEARER_TOKEN (not set)", "BEARER_TOKEN_FILE (not set)", "/run/user/4242/bt_u4242 (from XDG_RUNTIME_DIR)", "/tmp/bt_u4242"},
+		},
+		{
+			"Without environment sources or fallback",
+			map[string]string{"BEARER_TOKEN": "env_token", "XDG_RUNTIME_DIR": "/run/user/4242"},
+			[]disc.Option{disc.WithoutEnvironmentSources(), disc.WithoutTmpFallback()},
+			[]string{"/run/user/4242/bt_u4242 (from XDG_RUNTIME_DIR)"},
+		},
+		{
+			"Custom fallback directory",
+			nil,
+			[]disc.Option{disc.WithFallbackDir("/scratch")},
+			[]string{"BEARER_TOKEN (not set)", "BEARER_TOKEN_FILE (not set)", "XDG_RUNTIME_DIR (not set)", "/scratch/bt_u4242"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := append([]disc.Option{disc.WithEnvMap(tc.env), disc.WithFS(fsys), disc.WithUID("4242")}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				locations, err := d.PlannedLocations()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %s", err)
+				}
+				got := make([]string, 0, len(locations))
+				for _, l := range locations {
+					got = append(got, l.String())
+					if strings.Contains(l.String(), "env_token") {
+						t.Errorf("Location %s reveals the token", l)
+					}
+				}
+				if !reflect.DeepEqual(got, tc.expected) {
+					t.Errorf("Planned locations do not match.  Expected %q, got %q", tc.expected, got)
+				}
+
+				// Discovery must find the token at the first planned location that has one
+				res, err := d.Discover()
+				for _, l := range locations {
+					if l.EnvVar != "" && !l.EnvSet {
+						continue
+					}
+					if l.Path == "" {
+						if err != nil || res.Source() != l.Source {
+							t.Errorf("Expected token from %s, got %v, %v", l, res, err)
+						}
+						return
+					}
+					if _, statErr := fs.Stat(fsys, strings.TrimPrefix(l.Path, "/")); statErr == nil {
+						if err != nil || res.Source() != l.Source || res.Path() != l.Path {
+							t.Errorf("Expected token from %s, got %v, %v", l, res, err)
+						}
+						return
+					}
+					if l.Source == disc.SourceBearerTokenFile || l.Source == disc.SourceXDGRuntimeDir {
+						// A missing file in steps 2 and 3 ends discovery
+						break
+					}
+				}
+				if !errors.Is(err, disc.ErrNoTokenFound) {
+					t.Errorf("Expected error %s, got %v", disc.ErrNoTokenFound, err)
+				}
+			},
+		)
+	}
+}
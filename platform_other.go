@@ -0,0 +1,17 @@
+//go:build !windows
+
+package tokendiscovery
+
+// hasFileModes reports whether the permission bits of files on the OS filesystem reflect who can access them
+const hasFileModes = true
+
+// defaultFallbackDirectory returns the directory consulted in step 4 of the discovery procedure
+func defaultFallbackDirectory() string {
+	return "/tmp"
+}
+
+// userFileID returns the identifier used to build the bt_u$ID filename for the user with the given uid, which is the
+// numeric uid itself
+func userFileID(uid string) string {
+	return uid
+}
@@ -0,0 +1,30 @@
+//go:build windows
+
+package tokendiscovery
+
+import (
+	"os"
+	"strings"
+)
+
+// hasFileModes reports whether the permission bits of files on the OS filesystem reflect who can access them
+const hasFileModes = false
+
+// defaultFallbackDirectory returns the directory consulted in step 4 of the discovery procedure. Windows has no /tmp,
+// so the temporary directory of the user is used instead.
+func defaultFallbackDirectory() string {
+	return os.TempDir()
+}
+
+// userFileID returns the identifier used to build the bt_u$ID filename for the user with the given uid. On Windows, the
+// uid is the SID of the user, and any character in it that does not belong in a filename is replaced.
+func userFileID(uid string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '-', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, uid)
+}
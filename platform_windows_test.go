@@ -0,0 +1,54 @@
+//go:build windows
+
+package tokendiscovery_test
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestWindowsFallbackDirectory(t *testing.T) {
+	curUser, err := user.Current()
+	if err != nil {
+		t.Fatalf("Could not get current user from OS: %s", err)
+	}
+	tempDir := t.TempDir()
+	t.Setenv("TMP", tempDir)
+	t.Setenv("TEMP", tempDir)
+	fname := filepath.Join(os.TempDir(), "bt_u"+disc.UserFileID(curUser))
+	if err := os.WriteFile(fname, []byte("windows_token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := disc.New(disc.WithEnvMap(nil))
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	res, err := d.Discover()
+	if err != nil {
+		t.Fatalf("Expected nil error, got %s", err)
+	}
+	if string(res.Bytes()) != "windows_token" {
+		t.Errorf("Token strings do not match.  Expected windows_token, got %s", res.Bytes())
+	}
+	if res.Path() != fname {
+		t.Errorf("Token paths do not match. Expected path %s, got %s", fname, res.Path())
+	}
+}
+
+func TestWindowsUserFileID(t *testing.T) {
+	testCases := map[string]string{
+		"S-1-5-21-3623811015-3361044348-30300820-1013": "S-1-5-21-3623811015-3361044348-30300820-1013",
+		`DOMAIN\user`: "DOMAIN_user",
+		"a:b*c":       "a_b_c",
+	}
+	for uid, expected := range testCases {
+		if got := disc.UserFileID(&user.User{Uid: uid}); got != expected {
+			t.Errorf("User file IDs do not match.  Expected %s, got %s", expected, got)
+		}
+	}
+}
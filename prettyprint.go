@@ -0,0 +1,106 @@
+package tokendiscovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// redacted replaces the claims PrettyPrint redacts
+const redacted = "REDACTED"
+
+// PrettyPrintOptions configures PrettyPrint
+type PrettyPrintOptions struct {
+	// Redact replaces the sub and jti claims, which identify the user and the token, so that the output can be shared,
+	// for example in tickets
+	Redact bool
+	// Now is the time relative to which the exp, iat and nbf claims are described, or time.Now if zero
+	Now time.Time
+}
+
+// PrettyPrint writes the header and claims of tok, a JWT, to w as indented JSON, followed by the exp, iat and nbf
+// claims as times with how far they are from now, such as "expires in 37m", so that tokens can be read without pasting
+// them into websites. The token is NOT verified, as described for ParseClaims. Neither the signature nor the token
+// itself are written: the token is identified by its Fingerprint. If tok is not a JWT, nothing is written, and the
+// returned error wraps ErrNotAJWT.
+func PrettyPrint(w io.Writer, tok []byte, opts PrettyPrintOptions) error {
+	header, payload, _, err := splitJWT(tok)
+	if err != nil {
+		return err
+	}
+	h, err := decodeSegment(header)
+	if err != nil {
+		return fmt.Errorf("%w: invalid header: %w", ErrNotAJWT, err)
+	}
+	claims, err := decodeSegment(payload)
+	if err != nil {
+		return fmt.Errorf("%w: invalid payload: %w", ErrNotAJWT, err)
+	}
+	if opts.Redact {
+		for _, key := range []string{"sub", "jti"} {
+			if _, ok := claims[key]; ok {
+				claims[key] = redacted
+			}
+		}
+	}
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	// Claims such as scope hold characters that would otherwise be escaped
+	enc.SetEscapeHTML(false)
+	for _, part := range []struct {
+		name string
+		obj  map[string]any
+	}{{"Header", h}, {"Claims", claims}} {
+		if _, err := fmt.Fprintf(w, "%s:\n", part.name); err != nil {
+			return err
+		}
+		if err := enc.Encode(part.obj); err != nil {
+			return err
+		}
+	}
+	c := Claims(claims)
+	for _, t := range []struct {
+		claim        string
+		future, past string
+	}{
+		{claim: "exp", future: "expires in %s", past: "expired %s ago"},
+		{claim: "iat", future: "issued %s in the future", past: "issued %s ago"},
+		{claim: "nbf", future: "valid in %s", past: "valid since %s ago"},
+	} {
+		at, ok := c.Time(t.claim)
+		if !ok {
+			continue
+		}
+		note := fmt.Sprintf(t.past, humanDuration(now.Sub(at)))
+		if at.After(now) {
+			note = fmt.Sprintf(t.future, humanDuration(at.Sub(now)))
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s (%s)\n", t.claim, at.UTC().Format(time.RFC3339), note); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "Fingerprint: %s\nSignature: omitted\n", Fingerprint(tok))
+	return err
+}
+
+// humanDuration renders d, which must not be negative, to the precision a person reading a token cares about, such as
+// 37m or 2h5m
+func humanDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd%dh", d/(24*time.Hour), d%(24*time.Hour)/time.Hour)
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%dm", d/time.Hour, d%time.Hour/time.Minute)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+}
@@ -0,0 +1,144 @@
+package tokendiscovery_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestPrettyPrint(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tok := encodeJWT(
+		`{"alg":"RS256","kid":"rsa1","typ":"at+jwt"}`,
+		`{"iss":"https://issuer.example","sub":"a1b2-c3d4","aud":"https://storage.example:1094","jti":"5e6f",`+
+			`"scope":"storage.read:/ storage.create:/home/<user>","wlcg.ver":"1.0","exp":1714569420,"iat":1714564800,`+
+			`"nbf":1714564800}`,
+		false,
+	)
+	fingerprint := disc.Fingerprint(tok)
+
+	type testCase struct {
+		description string
+		opts        disc.PrettyPrintOptions
+		expected    string
+	}
+
+	testCases := []testCase{
+		{
+			"Full",
+			disc.PrettyPrintOptions{Now: now},
+			`Header:
+{
+  "alg": "RS256",
+  "kid": "rsa1",
+  "typ": "at+jwt"
+}
+Claims:
+{
+  "aud": "https://storage.example:1094",
+  "exp": 1714569420,
+  "iat": 1714564800,
+  "iss": "https://issuer.example",
+  "jti": "5e6f",
+  "nbf": 1714564800,
+  "scope": "storage.read:/ storage.create:/home/<user>",
+  "sub": "a1b2-c3d4",
+  "wlcg.ver": "1.0"
+}
+exp: 2024-05-01T13:17:00Z (expires in 1h17m)
+iat: 2024-05-01T12:00:00Z (issued 0s ago)
+nbf: 2024-05-01T12:00:00Z (valid since 0s ago)
+Fingerprint: ` + fingerprint + `
+Signature: omitted
+`,
+		},
+		{
+			"Redacted, later",
+			disc.PrettyPrintOptions{Redact: true, Now: now.Add(2 * time.Hour)},
+			`Header:
+{
+  "alg": "RS256",
+  "kid": "rsa1",
+  "typ": "at+jwt"
+}
+Claims:
+{
+  "aud": "https://storage.example:1094",
+  "exp": 1714569420,
+  "iat": 1714564800,
+  "iss": "https://issuer.example",
+  "jti": "REDACTED",
+  "nbf": 1714564800,
+  "scope": "storage.read:/ storage.create:/home/<user>",
+  "sub": "REDACTED",
+  "wlcg.ver": "1.0"
+}
+exp: 2024-05-01T13:17:00Z (expired 43m ago)
+iat: 2024-05-01T12:00:00Z (issued 2h0m ago)
+nbf: 2024-05-01T12:00:00Z (valid since 2h0m ago)
+Fingerprint: ` + fingerprint + `
+Signature: omitted
+`,
+		},
+		{
+			"Earlier",
+			disc.PrettyPrintOptions{Now: now.Add(-37 * time.Minute)},
+			`Header:
+{
+  "alg": "RS256",
+  "kid": "rsa1",
+  "typ": "at+jwt"
+}
+Claims:
+{
+  "aud": "https://storage.example:1094",
+  "exp": 1714569420,
+  "iat": 1714564800,
+  "iss": "https://issuer.example",
+  "jti": "5e6f",
+  "nbf": 1714564800,
+  "scope": "storage.read:/ storage.create:/home/<user>",
+  "sub": "a1b2-c3d4",
+  "wlcg.ver": "1.0"
+}
+exp: 2024-05-01T13:17:00Z (expires in 1h54m)
+iat: 2024-05-01T12:00:00Z (issued 37m in the future)
+nbf: 2024-05-01T12:00:00Z (valid in 37m)
+Fingerprint: ` + fingerprint + `
+Signature: omitted
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				var b bytes.Buffer
+				if err := disc.PrettyPrint(&b, tok, tc.opts); err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if got := b.String(); got != tc.expected {
+					t.Errorf("Outputs do not match.  Expected:\n%s\ngot:\n%s", tc.expected, got)
+				}
+				if strings.Contains(b.String(), string(tok[:20])) || strings.Contains(b.String(), "c2lnbmF0dXJl") {
+					t.Error("Output contains the token or its signature")
+				}
+			},
+		)
+	}
+}
+
+func TestPrettyPrintNotAJWT(t *testing.T) {
+	var b bytes.Buffer
+	if err := disc.PrettyPrint(&b, []byte("opaque_token"), disc.PrettyPrintOptions{}); !errors.Is(err, disc.ErrNotAJWT) {
+		t.Errorf("Expected error %s, got %v", disc.ErrNotAJWT, err)
+	}
+	if b.Len() != 0 {
+		t.Errorf("Expected no output, got %q", b.String())
+	}
+}
@@ -0,0 +1,94 @@
+package tokendiscovery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The token profile families told apart by Claims.ProfileFamily
+const (
+	// ProfileWLCG is the family of tokens following the WLCG Common JWT Profile, which have a wlcg.ver claim
+	ProfileWLCG = "wlcg"
+	// ProfileSciTokens is the family of tokens following the SciTokens profile, which have a ver claim such as
+	// scitoken:2.0
+	ProfileSciTokens = "scitoken"
+)
+
+// ErrProfileMismatch indicates that a token was skipped because its wlcg.ver claim is missing or does not match the
+// version required with WithRequiredProfile. If no token qualifies, the error returned by discovery wraps both it and
+// ErrNoTokenFound, and lists the versions of the tokens that were found.
+var ErrProfileMismatch = errors.New("token profile version does not match")
+
+// ProfileFamily returns ProfileWLCG if c has a wlcg.ver claim, ProfileSciTokens if it has a ver claim starting with
+// scitoken:, or the empty string otherwise
+func (c Claims) ProfileFamily() string {
+	if _, ok := c.wlcgVersion(); ok {
+		return ProfileWLCG
+	}
+	if strings.HasPrefix(c.String("ver"), ProfileSciTokens+":") {
+		return ProfileSciTokens
+	}
+	return ""
+}
+
+// ProfileVersion returns the version of the token profile followed by c: the wlcg.ver claim for the WLCG Common JWT
+// Profile, such as 1.0, or the version in the ver claim for SciTokens, such as 2.0 for scitoken:2.0. ProfileFamily
+// tells which. It reports false if c has neither claim.
+func (c Claims) ProfileVersion() (string, bool) {
+	if ver, ok := c.wlcgVersion(); ok {
+		return ver, true
+	}
+	if ver, ok := strings.CutPrefix(c.String("ver"), ProfileSciTokens+":"); ok && ver != "" {
+		return ver, true
+	}
+	return "", false
+}
+
+// wlcgVersion returns the wlcg.ver claim, which some issuers send as a number
+func (c Claims) wlcgVersion() (string, bool) {
+	switch v := c["wlcg.ver"].(type) {
+	case string:
+		return v, v != ""
+	case json.Number:
+		return v.String(), true
+	}
+	return "", false
+}
+
+// WithRequiredProfile makes discovery skip tokens whose wlcg.ver claim is missing or is not version, such as 1.0, for
+// endpoints that only accept tokens following the WLCG Common JWT Profile. Tokens that are not JWTs are skipped.
+func WithRequiredProfile(version string) Option {
+	return func(d *Discoverer) error {
+		if version == "" {
+			return fmt.Errorf("%w: profile version cannot be empty", ErrInvalidOption)
+		}
+		d.requiredProfile = version
+		return nil
+	}
+}
+
+// checkProfile returns an error wrapping ErrProfileMismatch if tok should be skipped according to WithRequiredProfile
+func (d *Discoverer) checkProfile(tok []byte) error {
+	if d.requiredProfile == "" {
+		return nil
+	}
+	claims, err := parseClaimsCached(tok)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrProfileMismatch, err)
+	}
+	ver, _ := claims.wlcgVersion()
+	if ver == d.requiredProfile {
+		return nil
+	}
+	return &claimError{sentinel: ErrProfileMismatch, claim: "wlcg.ver claim", value: ver}
+}
+
+// profileMismatchError returns the error summarizing the profile versions of the tokens in rejected skipped by
+// checkProfile, for discovery to return when no token qualified. It returns nil if no token was skipped for its
+// profile.
+func (d *Discoverer) profileMismatchError(rejected []error) error {
+	want := fmt.Sprintf("%q", d.requiredProfile)
+	return claimMismatchError(rejected, ErrProfileMismatch, "wlcg.ver claim", want, "the versions found")
+}
@@ -0,0 +1,101 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestProfileVersion(t *testing.T) {
+	type testCase struct {
+		description     string
+		claims          map[string]any
+		expectedFamily  string
+		expectedVersion string
+	}
+
+	testCases := []testCase{
+		{"wlcg.ver present", map[string]any{"wlcg.ver": "1.0"}, disc.ProfileWLCG, "1.0"},
+		{"wlcg.ver as a number", map[string]any{"wlcg.ver": 1.0}, disc.ProfileWLCG, "1"},
+		{"SciTokens ver claim", map[string]any{"ver": "scitoken:2.0"}, disc.ProfileSciTokens, "2.0"},
+		{"Other ver claim", map[string]any{"ver": "other:1.0"}, "", ""},
+		{"Both claims", map[string]any{"wlcg.ver": "1.0", "ver": "scitoken:2.0"}, disc.ProfileWLCG, "1.0"},
+		{"Absent", map[string]any{"sub": "user"}, "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				claims, err := disc.ParseClaims([]byte(makeJWT(t, tc.claims)))
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if family := claims.ProfileFamily(); family != tc.expectedFamily {
+					t.Errorf("Profile families do not match.  Expected %q, got %q", tc.expectedFamily, family)
+				}
+				ver, ok := claims.ProfileVersion()
+				if ver != tc.expectedVersion || ok != (tc.expectedVersion != "") {
+					t.Errorf("Profile versions do not match.  Expected %q, got %q (%t)", tc.expectedVersion, ver, ok)
+				}
+			},
+		)
+	}
+}
+
+func TestRequiredProfile(t *testing.T) {
+	wlcg := makeJWT(t, map[string]any{"wlcg.ver": "1.0"})
+	scitoken := makeJWT(t, map[string]any{"ver": "scitoken:2.0"})
+	absent := makeJWT(t, map[string]any{"sub": "user"})
+	future := makeJWT(t, map[string]any{"wlcg.ver": "2.0"})
+
+	type testCase struct {
+		description   string
+		envToken      string
+		fileToken     string
+		expectedToken string
+	}
+
+	testCases := []testCase{
+		{"wlcg.ver present", wlcg, scitoken, wlcg},
+		{"SciToken falls through", scitoken, wlcg, wlcg},
+		{"Absent claim falls through", absent, wlcg, wlcg},
+		{"Mismatched version falls through", future, wlcg, wlcg},
+		{"No matching token", scitoken, future, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				d, err := disc.New(
+					disc.WithEnvMap(map[string]string{"BEARER_TOKEN": tc.envToken, "BEARER_TOKEN_FILE": "/home/user/token"}),
+					disc.WithFS(fstest.MapFS{"home/user/token": {Data: []byte(tc.fileToken + "\n")}}),
+					disc.WithRequiredProfile("1.0"),
+				)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, err := d.FindToken()
+				if tc.expectedToken == "" {
+					if !errors.Is(err, disc.ErrProfileMismatch) || !errors.Is(err, disc.ErrNoTokenFound) {
+						t.Fatalf("Expected error wrapping %s and %s, got %v", disc.ErrProfileMismatch, disc.ErrNoTokenFound, err)
+					}
+					if !strings.Contains(err.Error(), `"2.0"`) {
+						t.Errorf("Expected error to list version 2.0, got %v", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if string(tok) != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, tok)
+				}
+			},
+		)
+	}
+}
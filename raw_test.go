@@ -0,0 +1,81 @@
+package tokendiscovery_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestRawContents(t *testing.T) {
+	fsys := fstest.MapFS{
+		"home/user/token": {Data: []byte("  \tfile_token\n\n")},
+		"home/user/blank": {Data: []byte(" \n\t\n")},
+		"tmp/bt_u4242":    {Data: []byte("tmp_token\n")},
+	}
+
+	type testCase struct {
+		description     string
+		env             map[string]string
+		expectedDefault string
+		expectedRaw     string
+		expectedTrimmed string
+	}
+
+	testCases := []testCase{
+		{
+			"Token file with surrounding whitespace",
+			map[string]string{"BEARER_TOKEN_FILE": "/home/user/token"},
+			"file_token",
+			"  \tfile_token\n\n",
+			"file_token",
+		},
+		{
+			"BEARER_TOKEN with surrounding whitespace",
+			map[string]string{"BEARER_TOKEN": " env_token\n"},
+			"env_token",
+			" env_token\n",
+			"env_token",
+		},
+		{
+			"Whitespace-only token file falls through",
+			map[string]string{"BEARER_TOKEN_FILE": "/home/user/blank"},
+			"tmp_token",
+			"tmp_token\n",
+			"tmp_token",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				for _, raw := range []bool{false, true} {
+					opts := []disc.Option{disc.WithEnvMap(tc.env), disc.WithFS(fsys), disc.WithUID("4242")}
+					expected := tc.expectedDefault
+					if raw {
+						opts = append(opts, disc.WithRawContents())
+						expected = tc.expectedRaw
+					}
+					d, err := disc.New(opts...)
+					if err != nil {
+						t.Fatalf("Could not construct Discoverer: %s", err)
+					}
+					res, err := d.Discover()
+					if err != nil {
+						t.Fatalf("Expected nil error, got %v", err)
+					}
+					if string(res.Bytes()) != expected {
+						t.Errorf("Token strings do not match (raw %t).  Expected %q, got %q", raw, expected, string(res.Bytes()))
+					}
+					if string(res.Raw()) != expected {
+						t.Errorf("Raw token strings do not match (raw %t).  Expected %q, got %q", raw, expected, string(res.Raw()))
+					}
+					if string(res.Trimmed()) != tc.expectedTrimmed {
+						t.Errorf("Trimmed token strings do not match (raw %t).  Expected %q, got %q", raw, tc.expectedTrimmed, string(res.Trimmed()))
+					}
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,88 @@
+package tokendiscovery
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrExpiryUnknown indicates that whether a token needs refreshing cannot be told, because it is not a JWT or has no
+// exp claim
+var ErrExpiryUnknown = errors.New("token expiry is unknown")
+
+// DefaultLeeway is the clock skew tolerated by expiry checks unless set otherwise with WithLeeway
+const DefaultLeeway = 60 * time.Second
+
+// WithClock sets the function used to get the current time when checking token expiry, such as for NeedsRefresh,
+// WithSkipExpired and WithMinimumLifetime, in place of time.Now
+func WithClock(now func() time.Time) Option {
+	return func(d *Discoverer) error {
+		if now == nil {
+			return fmt.Errorf("%w: clock cannot be nil", ErrInvalidOption)
+		}
+		d.clock = now
+		return nil
+	}
+}
+
+// WithLeeway sets how much clock skew between the token issuer and the local host is tolerated when checking the exp,
+// nbf and iat claims of tokens, and the maximum token age, for WithSkipExpired, WithMinimumLifetime, WithMaxTokenAge,
+// WithVerification (unless its ValidationOptions set a Leeway), CheckValidity and SuitableFor. It defaults to
+// DefaultLeeway; 0 disables it.
+func WithLeeway(leeway time.Duration) Option {
+	return func(d *Discoverer) error {
+		if leeway < 0 {
+			return fmt.Errorf("%w: leeway cannot be negative", ErrInvalidOption)
+		}
+		d.leeway = leeway
+		d.leewaySet = true
+		return nil
+	}
+}
+
+// clockLeeway returns the leeway set with WithLeeway, or DefaultLeeway
+func (d *Discoverer) clockLeeway() time.Duration {
+	if !d.leewaySet {
+		return DefaultLeeway
+	}
+	return d.leeway
+}
+
+// now returns the current time according to the clock of d
+func (d *Discoverer) now() time.Time {
+	if d.clock == nil {
+		return time.Now()
+	}
+	return d.clock()
+}
+
+// NeedsRefresh reports whether tok, a JWT, expires within threshold of now, or has already expired, according to its
+// exp claim. The token is NOT verified, as described for ParseClaims. If tok has no exp claim, or is not a JWT, the
+// returned error wraps ErrExpiryUnknown.
+func NeedsRefresh(tok []byte, threshold time.Duration) (bool, error) {
+	return defaultDiscoverer.NeedsRefresh(tok, threshold)
+}
+
+// NeedsRefresh is like the package-level NeedsRefresh, but uses the clock set with WithClock
+func (d *Discoverer) NeedsRefresh(tok []byte, threshold time.Duration) (bool, error) {
+	exp, ok := tokenExpiry(tok)
+	return needsRefresh(exp, ok, d.now(), threshold)
+}
+
+// NeedsRefresh is like the package-level NeedsRefresh, for the token of r, using the clock of the Discoverer that found
+// it. The expiry of the token is only parsed once, so this is cheap to call repeatedly.
+func (r Result) NeedsRefresh(threshold time.Duration) (bool, error) {
+	exp, ok := r.ExpiresAt()
+	now := r.now
+	if now == nil {
+		now = time.Now
+	}
+	return needsRefresh(exp, ok, now(), threshold)
+}
+
+func needsRefresh(exp time.Time, ok bool, now time.Time, threshold time.Duration) (bool, error) {
+	if !ok {
+		return false, ErrExpiryUnknown
+	}
+	return exp.Sub(now) <= threshold, nil
+}
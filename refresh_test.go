@@ -0,0 +1,115 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestNeedsRefresh(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	type testCase struct {
+		description string
+		tok         string
+		threshold   time.Duration
+		expected    bool
+		expectedErr error
+	}
+
+	testCases := []testCase{
+		{
+			"Expired token",
+			makeJWT(t, map[string]any{"exp": now.Add(-time.Second).Unix()}),
+			0,
+			true,
+			nil,
+		},
+		{
+			"Expires within threshold",
+			makeJWT(t, map[string]any{"exp": now.Add(5 * time.Minute).Unix()}),
+			10 * time.Minute,
+			true,
+			nil,
+		},
+		{
+			"Expires exactly at threshold",
+			makeJWT(t, map[string]any{"exp": now.Add(10 * time.Minute).Unix()}),
+			10 * time.Minute,
+			true,
+			nil,
+		},
+		{
+			"Expires after threshold",
+			makeJWT(t, map[string]any{"exp": now.Add(time.Hour).Unix()}),
+			10 * time.Minute,
+			false,
+			nil,
+		},
+		{
+			"JWT without exp",
+			makeJWT(t, map[string]any{"sub": "user"}),
+			10 * time.Minute,
+			false,
+			disc.ErrExpiryUnknown,
+		},
+		{
+			"Opaque token",
+			"opaque_token",
+			10 * time.Minute,
+			false,
+			disc.ErrExpiryUnknown,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				d, err := disc.New(disc.WithEnvMap(map[string]string{"BEARER_TOKEN": tc.tok}), disc.WithClock(clock))
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				res, err := d.Discover()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %s", err)
+				}
+				checks := map[string]func() (bool, error){
+					"Discoverer": func() (bool, error) { return d.NeedsRefresh([]byte(tc.tok), tc.threshold) },
+					"Result":     func() (bool, error) { return res.NeedsRefresh(tc.threshold) },
+				}
+				for name, check := range checks {
+					refresh, err := check()
+					if !errors.Is(err, tc.expectedErr) {
+						t.Errorf("%s: expected error %v, got %v", name, tc.expectedErr, err)
+					}
+					if refresh != tc.expected {
+						t.Errorf("%s: expected NeedsRefresh to return %t, got %t", name, tc.expected, refresh)
+					}
+				}
+			},
+		)
+	}
+}
+
+func BenchmarkResultNeedsRefresh(b *testing.B) {
+	tok := makeJWT(b, map[string]any{"exp": time.Now().Add(time.Hour).Unix()})
+	d, err := disc.New(disc.WithEnvMap(map[string]string{"BEARER_TOKEN": tok}))
+	if err != nil {
+		b.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	res, err := d.Discover()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := res.NeedsRefresh(10 * time.Minute); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package tokendiscovery
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+)
+
+// WithRequireJWT makes discovery skip tokens that are not structurally JWTs, in the same way as WithSkipExpired, so
+// that garbage in a token file, such as a truncated copy, is noticed during discovery rather than at the server. A JWT
+// has three non-empty base64url-encoded segments, the first two of which decode to JSON objects; the signature is NOT
+// verified. The reasons recorded for skipped tokens wrap ErrNotAJWT. It is off by default, since other kinds of bearer
+// tokens, such as macaroons, are legal too.
+func WithRequireJWT() Option {
+	return func(d *Discoverer) error {
+		d.requireJWT = true
+		return nil
+	}
+}
+
+// checkJWT returns an error wrapping ErrNotAJWT if tok should be skipped according to WithRequireJWT
+func (d *Discoverer) checkJWT(tok []byte) error {
+	if !d.requireJWT {
+		return nil
+	}
+	if _, err := parseClaimsCached(tok); err != nil {
+		return err
+	}
+	_, _, signature, _ := splitJWT(tok)
+	if len(signature) == 0 {
+		return fmt.Errorf("%w: empty signature segment", ErrNotAJWT)
+	}
+	if _, err := base64.RawURLEncoding.DecodeString(string(bytes.TrimRight(signature, "="))); err != nil {
+		return fmt.Errorf("%w: invalid signature: %w", ErrNotAJWT, err)
+	}
+	return nil
+}
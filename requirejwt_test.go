@@ -0,0 +1,75 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestRequireJWT(t *testing.T) {
+	valid := makeJWT(t, map[string]any{"sub": "user"})
+	truncated := valid[:len(valid)/2]
+	unsigned := string(encodeJWT(`{"alg":"none"}`, `{"sub":"user"}`, false))
+	unsigned = unsigned[:len(unsigned)-len("c2lnbmF0dXJl")]
+
+	type testCase struct {
+		description   string
+		envToken      string
+		fileToken     string
+		expectedToken string
+	}
+
+	testCases := []testCase{
+		{"Valid JWT in env", valid, "opaque_token", valid},
+		{"Truncated JWT falls through", truncated, valid, valid},
+		{"Two segments fall through", "eyJhbGciOiJub25lIn0.e30", valid, valid},
+		{"Empty signature falls through", unsigned, valid, valid},
+		{"Opaque token falls through", "opaque_token", valid, valid},
+		{"Binary junk falls through", "\x89PNG\x1a\x00junk", valid, valid},
+		{"No JWT found", truncated, "eyJhbGciOiJub25lIn0.e30", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				d, err := disc.New(
+					disc.WithEnvMap(map[string]string{"BEARER_TOKEN": tc.envToken, "BEARER_TOKEN_FILE": "/home/user/token"}),
+					disc.WithFS(fstest.MapFS{"home/user/token": {Data: []byte(tc.fileToken + "\n")}}),
+					disc.WithRequireJWT(),
+				)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, err := d.FindToken()
+				if tc.expectedToken == "" {
+					if !errors.Is(err, disc.ErrNotAJWT) || !errors.Is(err, disc.ErrNoTokenFound) {
+						t.Errorf("Expected error wrapping %s and %s, got %v", disc.ErrNotAJWT, disc.ErrNoTokenFound, err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if string(tok) != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, tok)
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"Off by default",
+		func(t *testing.T) {
+			d, err := disc.New(disc.WithEnvMap(map[string]string{"BEARER_TOKEN": "opaque_token"}))
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			if tok, err := d.FindToken(); err != nil || string(tok) != "opaque_token" {
+				t.Errorf("Token strings do not match.  Expected opaque_token, got %s (%v)", tok, err)
+			}
+		},
+	)
+}
@@ -0,0 +1,243 @@
+package tokendiscovery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Result describes a bearer token found by the WLCG Bearer Token Discovery procedure. Its contents are only available
+// through accessor methods, and its String and GoString methods never include the token itself, so a Result can be
+// logged safely.
+type Result struct {
+	token    []byte
+	path     string
+	source   Source
+	step     string
+	warnings []string
+	// rewritten reports that token differs from the contents of the file at path by more than surrounding whitespace
+	rewritten bool
+
+	cache *resultCache
+	now   func() time.Time
+}
+
+// NewResult returns a Result for a token found by a custom Step. tok is copied, with surrounding whitespace removed.
+// path is the file the token was read from, if any. The Source of the Result is SourceCustom.
+func NewResult(tok []byte, path string) Result {
+	return Result{token: append([]byte(nil), bytes.TrimSpace(tok)...), path: path, source: SourceCustom, cache: &resultCache{}}
+}
+
+// Source identifies the step of the discovery procedure that produced a token
+type Source int
+
+const (
+	// SourceUnknown is the Source of a zero Result
+	SourceUnknown Source = iota
+	// SourceBearerTokenEnv indicates that the token was taken from the BEARER_TOKEN environment variable (step 1)
+	SourceBearerTokenEnv
+	// SourceBearerTokenFile indicates that the token was read from the file named by BEARER_TOKEN_FILE (step 2)
+	SourceBearerTokenFile
+	// SourceXDGRuntimeDir indicates that the token was read from $XDG_RUNTIME_DIR/bt_u$ID (step 3)
+	SourceXDGRuntimeDir
+	// SourceTmpFallback indicates that the token was read from the fallback location, /tmp/bt_u$ID by default (step 4)
+	SourceTmpFallback
+	// SourceCustom indicates that the token was produced by a Step configured with WithSteps. Result.StepName
+	// identifies which one.
+	SourceCustom
+	// SourceImplicitRuntimeDir indicates that the token was read from /run/user/$ID/bt_u$ID while XDG_RUNTIME_DIR was
+	// unset. See WithImplicitRuntimeDir.
+	SourceImplicitRuntimeDir
+	// SourceCredentialsDirectory indicates that the token was read from a systemd credential in
+	// $CREDENTIALS_DIRECTORY. See WithCredentialsDirectory.
+	SourceCredentialsDirectory
+	// SourceKubernetes indicates that the token was read from a Kubernetes projected volume. See KubernetesTokenStep.
+	SourceKubernetes
+	// SourceCondorCreds indicates that the token was read from the HTCondor credentials directory named by
+	// _CONDOR_CREDS. See WithCondorCreds.
+	SourceCondorCreds
+	// SourceOIDCAgent indicates that the token was requested from oidc-agent. See WithOIDCAgent.
+	SourceOIDCAgent
+	// SourceCommand indicates that the token was printed by a helper command. See WithCommandSource.
+	SourceCommand
+)
+
+// String returns a short, human-readable name for s
+func (s Source) String() string {
+	switch s {
+	case SourceBearerTokenEnv:
+		return "BEARER_TOKEN"
+	case SourceBearerTokenFile:
+		return "BEARER_TOKEN_FILE"
+	case SourceXDGRuntimeDir:
+		return "XDG_RUNTIME_DIR"
+	case SourceTmpFallback:
+		return "fallback directory"
+	case SourceCustom:
+		return "custom step"
+	case SourceImplicitRuntimeDir:
+		return "implicit runtime directory"
+	case SourceCredentialsDirectory:
+		return "CREDENTIALS_DIRECTORY"
+	case SourceKubernetes:
+		return "Kubernetes projected volume"
+	case SourceCondorCreds:
+		return "_CONDOR_CREDS"
+	case SourceOIDCAgent:
+		return "oidc-agent"
+	case SourceCommand:
+		return "command"
+	case SourceUnknown:
+		return "unknown"
+	default:
+		return fmt.Sprintf("Source(%d)", int(s))
+	}
+}
+
+// Bytes returns a copy of the token contents, with surrounding whitespace removed unless the Discoverer was configured
+// with WithRawContents
+func (r Result) Bytes() []byte {
+	if r.token == nil {
+		return nil
+	}
+	return append([]byte(nil), r.token...)
+}
+
+// Raw returns a copy of the token contents exactly as found, if the Discoverer was configured with WithRawContents.
+// Otherwise, it returns the same as Bytes.
+func (r Result) Raw() []byte {
+	return r.Bytes()
+}
+
+// Trimmed returns a copy of the token contents with surrounding whitespace removed, even if the Discoverer was
+// configured with WithRawContents
+func (r Result) Trimmed() []byte {
+	if r.token == nil {
+		return nil
+	}
+	return append([]byte(nil), bytes.TrimSpace(r.token)...)
+}
+
+// Path returns the path of the file the token was read from, or the empty string if the token did not come from a file
+func (r Result) Path() string {
+	return r.path
+}
+
+// Source returns the step of the discovery procedure that produced the token
+func (r Result) Source() Source {
+	return r.source
+}
+
+// StepName returns the name of the Step that produced the token
+func (r Result) StepName() string {
+	return r.step
+}
+
+// Warnings returns messages about anything unusual discovery noticed, and corrected, about the token, such as a
+// "Bearer " prefix that was stripped. They are also logged at warning level to the logger set with WithLogger.
+func (r Result) Warnings() []string {
+	return append([]string(nil), r.warnings...)
+}
+
+// resultCache holds what is derived from the token of a Result once it has been computed, shared by copies of the
+// Result
+type resultCache struct {
+	fingerprintOnce sync.Once
+	fingerprint     string
+
+	expiryOnce sync.Once
+	expiry     time.Time
+	hasExpiry  bool
+
+	headerOnce sync.Once
+	header     Header
+	headerErr  error
+
+	tokenTypeOnce sync.Once
+	tokenType     TokenType
+}
+
+// ExpiresAt returns the time in the exp claim of the token, if it is a JWT with one. The token is NOT verified, as
+// described for ParseClaims. It is parsed the first time it is needed, and the result shared by copies of r.
+func (r Result) ExpiresAt() (time.Time, bool) {
+	if r.cache == nil {
+		return tokenExpiry(r.token)
+	}
+	r.cache.expiryOnce.Do(func() { r.cache.expiry, r.cache.hasExpiry = tokenExpiry(r.token) })
+	return r.cache.expiry, r.cache.hasExpiry
+}
+
+// RemainingLifetime returns how long the token remains valid after now, according to ExpiresAt. It is negative if the
+// token has expired, and 0 if its expiry is not known.
+func (r Result) RemainingLifetime(now time.Time) time.Duration {
+	exp, ok := r.ExpiresAt()
+	if !ok {
+		return 0
+	}
+	return exp.Sub(now)
+}
+
+// warningsKey is the context key under which discovery collects warnings while a step runs
+type warningsKey struct{}
+
+// warningCollector collects warnings about the token being read by a step, for the step's Result, and whether the token
+// was rewritten from the contents of its file
+type warningCollector struct {
+	mu        sync.Mutex
+	msgs      []string
+	rewritten bool
+}
+
+// withWarnings returns a context under which addWarning records warnings in the returned collector
+func withWarnings(ctx context.Context) (context.Context, *warningCollector) {
+	c := &warningCollector{}
+	return context.WithValue(ctx, warningsKey{}, c), c
+}
+
+// addWarning records a warning in the collector of ctx, if it has one
+func addWarning(ctx context.Context, format string, args ...any) {
+	if c, ok := ctx.Value(warningsKey{}).(*warningCollector); ok {
+		c.mu.Lock()
+		c.msgs = append(c.msgs, fmt.Sprintf(format, args...))
+		c.mu.Unlock()
+	}
+}
+
+// markRewritten records in the collector of ctx, if it has one, that the token being read differs from the contents of
+// its file
+func markRewritten(ctx context.Context) {
+	if c, ok := ctx.Value(warningsKey{}).(*warningCollector); ok {
+		c.mu.Lock()
+		c.rewritten = true
+		c.mu.Unlock()
+	}
+}
+
+// isRewritten reports whether markRewritten was called with the context of c
+func (c *warningCollector) isRewritten() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rewritten
+}
+
+// messages returns the warnings collected so far
+func (c *warningCollector) messages() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.msgs...)
+}
+
+// String returns a description of where the token was found. It does not include the token contents.
+func (r Result) String() string {
+	if r.path == "" {
+		return fmt.Sprintf("bearer token from %s", r.source)
+	}
+	return fmt.Sprintf("bearer token from %s (%s)", r.path, r.source)
+}
+
+// GoString implements fmt.GoStringer so that formatting a Result with %#v does not reveal the token contents
+func (r Result) GoString() string {
+	return fmt.Sprintf("tokendiscovery.Result{path: %q, source: %s}", r.path, r.source)
+}
@@ -0,0 +1,128 @@
+package tokendiscovery_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestResultRedaction(t *testing.T) {
+	const secret = "super_secret_token"
+	d, err := disc.New(disc.WithEnvMap(map[string]string{"BEARER_TOKEN": secret}))
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	res, err := d.Discover()
+	if err != nil {
+		t.Fatalf("Expected nil error, got %s", err)
+	}
+
+	for _, format := range []string{"%v", "%s", "%+v", "%#v"} {
+		if out := fmt.Sprintf(format, res); strings.Contains(out, secret) {
+			t.Errorf("Formatting Result with %s revealed the token: %s", format, out)
+		}
+	}
+}
+
+func TestResultBytesIsCopy(t *testing.T) {
+	d, err := disc.New(disc.WithEnvMap(map[string]string{"BEARER_TOKEN": "abcde"}))
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	res, err := d.Discover()
+	if err != nil {
+		t.Fatalf("Expected nil error, got %s", err)
+	}
+
+	tok := res.Bytes()
+	tok[0] = 'X'
+	if got := string(res.Bytes()); got != "abcde" {
+		t.Errorf("Modifying the slice returned by Bytes changed the Result.  Expected abcde, got %s", got)
+	}
+	if path := res.Path(); path != "" {
+		t.Errorf("Expected empty path for environment token, got %s", path)
+	}
+}
+
+func TestSourceString(t *testing.T) {
+	testCases := map[disc.Source]string{
+		disc.SourceUnknown:         "unknown",
+		disc.SourceBearerTokenEnv:  "BEARER_TOKEN",
+		disc.SourceBearerTokenFile: "BEARER_TOKEN_FILE",
+		disc.SourceXDGRuntimeDir:   "XDG_RUNTIME_DIR",
+		disc.SourceTmpFallback:     "fallback directory",
+		disc.SourceCustom:          "custom step",
+		disc.Source(100):           "Source(100)",
+	}
+	for source, expected := range testCases {
+		if got := source.String(); got != expected {
+			t.Errorf("Source strings do not match.  Expected %s, got %s", expected, got)
+		}
+	}
+}
+
+func TestResultExpiry(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	type testCase struct {
+		description      string
+		tok              string
+		expectedExpiry   time.Time
+		expectedLifetime time.Duration
+	}
+
+	testCases := []testCase{
+		{
+			"Expired token",
+			makeJWT(t, map[string]any{"exp": now.Add(-time.Minute).Unix()}),
+			now.Add(-time.Minute),
+			-time.Minute,
+		},
+		{
+			"Far-future token",
+			makeJWT(t, map[string]any{"exp": now.AddDate(10, 0, 0).Unix()}),
+			now.AddDate(10, 0, 0),
+			now.AddDate(10, 0, 0).Sub(now),
+		},
+		{
+			"JWT without exp",
+			makeJWT(t, map[string]any{"sub": "user"}),
+			time.Time{},
+			0,
+		},
+		{
+			"Opaque token",
+			"opaque_token",
+			time.Time{},
+			0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				d, err := disc.New(disc.WithEnvMap(map[string]string{"BEARER_TOKEN": tc.tok}))
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				res, err := d.Discover()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %s", err)
+				}
+				for i := 0; i < 2; i++ {
+					exp, ok := res.ExpiresAt()
+					if ok != !tc.expectedExpiry.IsZero() || !exp.Equal(tc.expectedExpiry) {
+						t.Errorf("Expiry times do not match.  Expected %s, got %s (%t)", tc.expectedExpiry, exp, ok)
+					}
+					if lifetime := res.RemainingLifetime(now); lifetime != tc.expectedLifetime {
+						t.Errorf("Remaining lifetimes do not match.  Expected %s, got %s", tc.expectedLifetime, lifetime)
+					}
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,72 @@
+package tokendiscovery
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// defaultReadAttempts and defaultReadBackoff configure the retry of transient read errors when WithReadRetry is not
+// given
+const (
+	defaultReadAttempts = 3
+	defaultReadBackoff  = 20 * time.Millisecond
+)
+
+// WithReadRetry sets how many times discovery attempts to read a token file that fails with a transient error, such as
+// ESTALE or EIO from a network filesystem whose file was just replaced, and the delay before the first retry. The delay
+// doubles after each retry, and the path is stat'ed again before each retry, so that a file that has gone away is
+// reported as missing. Errors that are not transient, such as a missing or unreadable file, are never retried, and
+// neither is any error on platforms other than Unix. By default, a read is attempted 3 times, starting with a 20ms
+// delay; WithReadRetry(1, 0) disables retries.
+func WithReadRetry(attempts int, backoff time.Duration) Option {
+	return func(d *Discoverer) error {
+		if attempts < 1 {
+			return fmt.Errorf("%w: read attempts must be at least 1", ErrInvalidOption)
+		}
+		if backoff < 0 {
+			return fmt.Errorf("%w: read retry backoff cannot be negative", ErrInvalidOption)
+		}
+		d.readAttempts = attempts
+		d.readBackoff = backoff
+		return nil
+	}
+}
+
+// readFileRetrying reads the named file as described for readFileOnce, retrying transient errors as described for
+// WithReadRetry
+func (d *Discoverer) readFileRetrying(ctx context.Context, name string, followSymlinks bool) ([]byte, error) {
+	attempts, backoff := d.readAttempts, d.readBackoff
+	if attempts == 0 {
+		attempts, backoff = defaultReadAttempts, defaultReadBackoff
+	}
+	for attempt := 1; ; attempt++ {
+		b, err := d.readFileOnce(ctx, name, followSymlinks)
+		if err == nil || attempt >= attempts || !isTransient(err) {
+			return b, err
+		}
+		d.debug("retrying token file read", "path", name, "attempt", attempt, "error", err)
+		if err := sleepContext(ctx, backoff); err != nil {
+			return nil, err
+		}
+		backoff *= 2
+		if _, err := d.stat(name); err != nil && !isTransient(err) {
+			return nil, err
+		}
+	}
+}
+
+// sleepContext waits for d, or until ctx is done, in which case it returns ctx.Err()
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
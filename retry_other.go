@@ -0,0 +1,9 @@
+//go:build !unix
+
+package tokendiscovery
+
+// isTransient reports whether err is a filesystem error that may go away if the operation is repeated. Reads are not
+// retried on platforms without the errno values of network filesystems.
+func isTransient(error) bool {
+	return false
+}
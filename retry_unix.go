@@ -0,0 +1,14 @@
+//go:build unix
+
+package tokendiscovery
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isTransient reports whether err is a filesystem error that may go away if the operation is repeated
+func isTransient(err error) bool {
+	return errors.Is(err, syscall.ESTALE) || errors.Is(err, syscall.EIO) || errors.Is(err, syscall.EINTR) ||
+		errors.Is(err, syscall.EAGAIN)
+}
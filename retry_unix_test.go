@@ -0,0 +1,155 @@
+//go:build unix
+
+package tokendiscovery_test
+
+import (
+	"errors"
+	"io/fs"
+	"sync"
+	"syscall"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+// flakyFS is an fs.FS whose first failures opens fail with err, after which it serves files
+type flakyFS struct {
+	files    fstest.MapFS
+	err      error
+	failures int
+
+	mu    sync.Mutex
+	opens int
+}
+
+func (f *flakyFS) Open(name string) (fs.File, error) {
+	f.mu.Lock()
+	f.opens++
+	fail := f.opens <= f.failures
+	f.mu.Unlock()
+	if fail {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: f.err}
+	}
+	return f.files.Open(name)
+}
+
+func (f *flakyFS) Stat(name string) (fs.FileInfo, error) {
+	return f.files.Stat(name)
+}
+
+func TestReadRetry(t *testing.T) {
+	type testCase struct {
+		description   string
+		err           error
+		failures      int
+		opts          []disc.Option
+		expectedToken string
+		expectedOpens int
+		expectedErr   error
+	}
+
+	testCases := []testCase{
+		{
+			"ESTALE once, then success",
+			syscall.ESTALE,
+			1,
+			nil,
+			"12345",
+			2,
+			nil,
+		},
+		{
+			"EIO twice, then success",
+			syscall.EIO,
+			2,
+			nil,
+			"12345",
+			3,
+			nil,
+		},
+		{
+			"EIO more often than the default attempts",
+			syscall.EIO,
+			3,
+			nil,
+			"",
+			3,
+			syscall.EIO,
+		},
+		{
+			"EIO more often than the default attempts, more attempts configured",
+			syscall.EIO,
+			3,
+			[]disc.Option{disc.WithReadRetry(5, 0)},
+			"12345",
+			4,
+			nil,
+		},
+		{
+			"Retries disabled",
+			syscall.ESTALE,
+			1,
+			[]disc.Option{disc.WithReadRetry(1, 0)},
+			"",
+			1,
+			syscall.ESTALE,
+		},
+		{
+			"Missing file is not retried",
+			fs.ErrNotExist,
+			1,
+			nil,
+			"",
+			1,
+			disc.ErrBearerTokenFileMissing,
+		},
+		{
+			"Permission denied is not retried",
+			fs.ErrPermission,
+			1,
+			[]disc.Option{disc.WithFatalPermissionErrors()},
+			"",
+			1,
+			disc.ErrPermissionDenied,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				fsys := &flakyFS{
+					files:    fstest.MapFS{"home/user/token": {Data: []byte("12345")}},
+					err:      tc.err,
+					failures: tc.failures,
+				}
+				opts := append([]disc.Option{
+					disc.WithEnvMap(map[string]string{"BEARER_TOKEN_FILE": "/home/user/token"}),
+					disc.WithFS(fsys),
+					disc.WithUID("1000"),
+				}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, err := d.FindToken()
+				if fsys.opens != tc.expectedOpens {
+					t.Errorf("Expected %d reads of the token file, got %d", tc.expectedOpens, fsys.opens)
+				}
+				if tc.expectedErr != nil {
+					if !errors.Is(err, tc.expectedErr) {
+						t.Errorf("Expected error %s, got %v", tc.expectedErr, err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if string(tok) != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, string(tok))
+				}
+			},
+		)
+	}
+}
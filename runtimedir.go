@@ -0,0 +1,68 @@
+package tokendiscovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// defaultRuntimeDirBase is the parent of per-user runtime directories on systemd systems
+const defaultRuntimeDirBase = "/run/user"
+
+// WithImplicitRuntimeDir adds a step, after step 3 and before the fallback step, that reads /run/user/$ID/bt_u$ID when
+// the XDG_RUNTIME_DIR environment variable is unset. On systemd systems, that is where the runtime directory almost
+// always is, but cron jobs and some ssh sessions lose the variable. The directory is only consulted if it exists and is
+// owned by the uid the token is being looked up for.
+func WithImplicitRuntimeDir() Option {
+	return func(d *Discoverer) error {
+		d.implicitRuntimeDir = defaultRuntimeDirBase
+		return nil
+	}
+}
+
+// implicitRuntimeDirStep looks for the token in the systemd runtime directory when XDG_RUNTIME_DIR is unset
+type implicitRuntimeDirStep struct{}
+
+func (implicitRuntimeDirStep) Name() string { return SourceImplicitRuntimeDir.String() }
+
+func (implicitRuntimeDirStep) Lookup(ctx context.Context, env Environ, fsys FileReader) (Result, error) {
+	if lookupValue(env, "XDG_RUNTIME_DIR") != "" {
+		// Step 3 already consulted the runtime directory
+		return Result{}, SkipStep(nil)
+	}
+	d := stepDiscoverer(fsys)
+	base := d.implicitRuntimeDir
+	if base == "" {
+		base = defaultRuntimeDirBase
+	}
+	uid, err := d.currentUID()
+	if err != nil {
+		return Result{}, &DiscoveryError{Step: SourceImplicitRuntimeDir, Err: err}
+	}
+
+	dir := filepath.Join(base, uid)
+	info, err := d.stat(dir)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return Result{}, SkipStep(nil)
+	case err != nil:
+		return Result{}, SkipStep(&DiscoveryError{Step: SourceImplicitRuntimeDir, Path: dir, Err: fmt.Errorf("cannot check runtime directory %s: %w", dir, err)})
+	case !info.IsDir():
+		return Result{}, SkipStep(&DiscoveryError{Step: SourceImplicitRuntimeDir, Path: dir, Err: fmt.Errorf("runtime directory %s is not a directory", dir)})
+	}
+	if owner, ok := d.fileOwner(info); !ok || owner != uid {
+		return Result{}, SkipStep(&DiscoveryError{Step: SourceImplicitRuntimeDir, Path: dir, Err: fmt.Errorf("runtime directory %s is not owned by uid %s", dir, uid)})
+	}
+
+	fname := filepath.Join(dir, d.tokenFileName(uid))
+	tok, err := fsys.ReadTokenFile(ctx, fname)
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, ErrEmptyToken):
+		return Result{}, SkipStep(&DiscoveryError{Step: SourceImplicitRuntimeDir, Path: fname, Err: err})
+	case err != nil:
+		return Result{}, d.readFailure(SourceImplicitRuntimeDir, fname, err)
+	}
+	return Result{token: tok, path: fname, source: SourceImplicitRuntimeDir}, nil
+}
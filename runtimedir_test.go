@@ -0,0 +1,103 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestWithImplicitRuntimeDir(t *testing.T) {
+	curUser, err := user.Current()
+	if err != nil {
+		t.Fatal("Could not get current user from OS")
+	}
+	base := t.TempDir()
+	runtimeDir := filepath.Join(base, curUser.Uid)
+	if err := os.Mkdir(runtimeDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	runtimeTokenFile := filepath.Join(runtimeDir, "bt_u"+curUser.Uid)
+	if err := os.WriteFile(runtimeTokenFile, []byte("runtime_token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// A runtime directory for another uid, which the current user owns instead
+	if err := os.Mkdir(filepath.Join(base, "4242"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "4242", "bt_u4242"), []byte("planted_token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fallbackDir := t.TempDir()
+	fallbackTokenFile := filepath.Join(fallbackDir, "bt_u"+curUser.Uid)
+	if err := os.WriteFile(fallbackTokenFile, []byte("tmp_token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	type testCase struct {
+		description    string
+		opts           []disc.Option
+		expectedTok    string
+		expectedPath   string
+		expectedSource disc.Source
+	}
+
+	testCases := []testCase{
+		{
+			"Default ignores the runtime directory",
+			nil,
+			"tmp_token",
+			fallbackTokenFile,
+			disc.SourceTmpFallback,
+		},
+		{
+			"XDG_RUNTIME_DIR unset but file present",
+			[]disc.Option{disc.WithImplicitRuntimeDirBase(base)},
+			"runtime_token",
+			runtimeTokenFile,
+			disc.SourceImplicitRuntimeDir,
+		},
+		{
+			"Runtime directory owned by another uid is not consulted",
+			[]disc.Option{disc.WithImplicitRuntimeDirBase(base), disc.WithUID("4242")},
+			"",
+			"",
+			disc.SourceUnknown,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := append([]disc.Option{disc.WithEnvMap(map[string]string{}), disc.WithFallbackDir(fallbackDir)}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				res, err := d.Discover()
+				if tc.expectedTok == "" {
+					if !errors.Is(err, disc.ErrNoTokenFound) {
+						t.Errorf("Expected error %s, got %v", disc.ErrNoTokenFound, err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected nil error, got %s", err)
+				}
+				if string(res.Bytes()) != tc.expectedTok {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedTok, res.Bytes())
+				}
+				if res.Path() != tc.expectedPath {
+					t.Errorf("Token paths do not match. Expected path %s, got %s", tc.expectedPath, res.Path())
+				}
+				if res.Source() != tc.expectedSource {
+					t.Errorf("Token sources do not match. Expected source %s, got %s", tc.expectedSource, res.Source())
+				}
+			},
+		)
+	}
+}
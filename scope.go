@@ -0,0 +1,102 @@
+package tokendiscovery
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrMissingScopes indicates that a token was skipped because its scope claim lacks some of the scopes required with
+// WithRequiredScopes. If no token qualifies, the error returned by discovery wraps both it and ErrNoTokenFound, and
+// names the scopes unmet by the token that came closest.
+var ErrMissingScopes = errors.New("token lacks required scopes")
+
+// HasScope reports whether the space-separated scope claim of tok, a JWT, includes scope. Scopes are compared as exact
+// strings, so storage.read:/ does not include storage.read:/data. A token without a scope claim has no scopes. If tok
+// is not a JWT, the returned error wraps ErrNotAJWT. The token is NOT verified, as described for ParseClaims.
+func HasScope(tok []byte, scope string) (bool, error) {
+	claims, err := parseClaimsCached(tok)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(claims.Scope(), scope), nil
+}
+
+// WithRequiredScopes makes discovery skip tokens whose scope claim lacks any of scopes, in the same way as
+// WithSkipExpired, so that the token found can do what the caller is about to attempt. Scopes are compared as for
+// HasScope. Tokens that are not JWTs are skipped.
+func WithRequiredScopes(scopes ...string) Option {
+	return func(d *Discoverer) error {
+		if len(scopes) == 0 {
+			return fmt.Errorf("%w: at least one scope must be required", ErrInvalidOption)
+		}
+		for _, scope := range scopes {
+			if scope == "" || strings.ContainsAny(scope, " \t\n") {
+				return fmt.Errorf("%w: invalid scope %q", ErrInvalidOption, scope)
+			}
+		}
+		d.requiredScopes = append([]string(nil), scopes...)
+		return nil
+	}
+}
+
+// scopeError records that a token was skipped because it lacks some required scopes
+type scopeError struct {
+	missing []string
+}
+
+func (e *scopeError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrMissingScopes, quoteAll(e.missing))
+}
+
+func (e *scopeError) Unwrap() error { return ErrMissingScopes }
+
+// checkScopes returns an error wrapping ErrMissingScopes if tok should be skipped according to WithRequiredScopes
+func (d *Discoverer) checkScopes(tok []byte) error {
+	if len(d.requiredScopes) == 0 {
+		return nil
+	}
+	claims, err := parseClaimsCached(tok)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrMissingScopes, err)
+	}
+	return claims.checkScopes(d.requiredScopes)
+}
+
+// checkScopes returns an error wrapping ErrMissingScopes if the scope claim of c lacks any of required
+func (c Claims) checkScopes(required []string) error {
+	scope := c.Scope()
+	var missing []string
+	for _, s := range required {
+		if !slices.Contains(scope, s) {
+			missing = append(missing, s)
+		}
+	}
+	if len(missing) > 0 {
+		return &scopeError{missing: missing}
+	}
+	return nil
+}
+
+// missingScopesError returns the error naming the scopes unmet by the token in rejected, skipped by checkScopes, that
+// lacked the fewest, for discovery to return when no token qualified. It returns nil if no token was skipped for its
+// scopes.
+func (d *Discoverer) missingScopesError(rejected []error) error {
+	var lacking bool
+	var best *scopeError
+	for _, err := range rejected {
+		lacking = lacking || errors.Is(err, ErrMissingScopes)
+		var serr *scopeError
+		if errors.As(err, &serr) && (best == nil || len(serr.missing) < len(best.missing)) {
+			best = serr
+		}
+	}
+	switch {
+	case !lacking:
+		return nil
+	case best == nil:
+		return fmt.Errorf("%w %s: no JWT was found", ErrMissingScopes, quoteAll(d.requiredScopes))
+	}
+	return fmt.Errorf("%w: the closest token found lacked %s", ErrMissingScopes, quoteAll(best.missing))
+}
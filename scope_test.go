@@ -0,0 +1,119 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestHasScope(t *testing.T) {
+	tok := []byte(makeJWT(t, map[string]any{"scope": "storage.read:/ storage.create:/data compute.read"}))
+
+	type testCase struct {
+		description string
+		tok         []byte
+		scope       string
+		expected    bool
+		expectedErr error
+	}
+
+	testCases := []testCase{
+		{"First scope", tok, "storage.read:/", true, nil},
+		{"Last scope", tok, "compute.read", true, nil},
+		{"Comparison is exact", tok, "storage.create:/data/user", false, nil},
+		{"Missing scope", tok, "storage.modify:/", false, nil},
+		{"No scope claim", []byte(makeJWT(t, map[string]any{"sub": "user"})), "storage.read:/", false, nil},
+		{"Opaque token", []byte("opaque_token"), "storage.read:/", false, disc.ErrNotAJWT},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				ok, err := disc.HasScope(tc.tok, tc.scope)
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("Expected error %v, got %v", tc.expectedErr, err)
+				}
+				if ok != tc.expected {
+					t.Errorf("Expected HasScope to return %t, got %t", tc.expected, ok)
+				}
+			},
+		)
+	}
+}
+
+func TestRequiredScopes(t *testing.T) {
+	const storage = "https://storage.example:1094"
+	readWrite := makeJWT(t, map[string]any{"scope": "storage.read:/ storage.modify:/", "aud": storage})
+	readOnly := makeJWT(t, map[string]any{"scope": "storage.read:/", "aud": storage})
+	readWriteOther := makeJWT(t, map[string]any{"scope": "storage.read:/ storage.modify:/", "aud": "https://other.example"})
+	noScope := makeJWT(t, map[string]any{"sub": "user", "aud": storage})
+	required := []string{"storage.read:/", "storage.modify:/"}
+
+	type testCase struct {
+		description     string
+		envToken        string
+		fileToken       string
+		opts            []disc.Option
+		expectedToken   string
+		expectedMissing string
+	}
+
+	testCases := []testCase{
+		{"All scopes present", readWrite, readOnly, []disc.Option{disc.WithRequiredScopes(required...)}, readWrite, ""},
+		{"Missing scope falls through", readOnly, readWrite, []disc.Option{disc.WithRequiredScopes(required...)}, readWrite, ""},
+		{"No scope claim falls through", noScope, readWrite, []disc.Option{disc.WithRequiredScopes(required...)}, readWrite, ""},
+		{"Opaque token falls through", "opaque_token", readWrite, []disc.Option{disc.WithRequiredScopes(required...)}, readWrite, ""},
+		{
+			"Combined with audience",
+			readWriteOther,
+			readWrite,
+			[]disc.Option{disc.WithRequiredScopes(required...), disc.WithRequiredAudience(storage)},
+			readWrite,
+			"",
+		},
+		{
+			"Closest token is named",
+			noScope,
+			readOnly,
+			[]disc.Option{disc.WithRequiredScopes(required...)},
+			"",
+			`lacked "storage.modify:/"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := append([]disc.Option{
+					disc.WithEnvMap(map[string]string{"BEARER_TOKEN": tc.envToken, "BEARER_TOKEN_FILE": "/home/user/token"}),
+					disc.WithFS(fstest.MapFS{"home/user/token": {Data: []byte(tc.fileToken + "\n")}}),
+				}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, err := d.FindToken()
+				if tc.expectedMissing != "" {
+					if !errors.Is(err, disc.ErrMissingScopes) || !errors.Is(err, disc.ErrNoTokenFound) {
+						t.Fatalf("Expected error wrapping %s and %s, got %v", disc.ErrMissingScopes, disc.ErrNoTokenFound, err)
+					}
+					if !strings.Contains(err.Error(), tc.expectedMissing) {
+						t.Errorf("Expected error to contain %s, got %v", tc.expectedMissing, err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if string(tok) != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, tok)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,107 @@
+package tokendiscovery
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SelectionPolicy decides which of several discovered tokens DiscoverBest returns
+type SelectionPolicy int
+
+const (
+	// PreferSpecOrder selects the token found by the earliest step of the discovery procedure, as Discover does
+	PreferSpecOrder SelectionPolicy = iota
+	// PreferLatestExpiry selects the token whose exp claim is latest. Tokens without a parseable exp claim rank below
+	// those with one. The claim is read without verifying the token's signature.
+	PreferLatestExpiry
+	// PreferNewestFile selects the token read from the most recently modified file. Tokens not read from a file, such
+	// as the value of BEARER_TOKEN, rank below those that were.
+	PreferNewestFile
+)
+
+func (p SelectionPolicy) String() string {
+	switch p {
+	case PreferSpecOrder:
+		return "PreferSpecOrder"
+	case PreferLatestExpiry:
+		return "PreferLatestExpiry"
+	case PreferNewestFile:
+		return "PreferNewestFile"
+	default:
+		return fmt.Sprintf("SelectionPolicy(%d)", int(p))
+	}
+}
+
+// DiscoverBest runs every step of the discovery procedure, as DiscoverAll does, and returns the token selected by
+// policy. Among equally ranked tokens, the one found by the earliest step is returned. Steps that fail do not cause an
+// error as long as some step finds a token.
+func DiscoverBest(policy SelectionPolicy) (Result, error) {
+	return defaultDiscoverer.DiscoverBest(policy)
+}
+
+// DiscoverBestContext is like DiscoverBest, but abandons discovery when ctx is done. In that case, the returned error
+// wraps ctx.Err().
+func DiscoverBestContext(ctx context.Context, policy SelectionPolicy) (Result, error) {
+	return defaultDiscoverer.DiscoverBestContext(ctx, policy)
+}
+
+// DiscoverBest is like the package-level DiscoverBest, but uses the discovery procedure as configured on d
+func (d *Discoverer) DiscoverBest(policy SelectionPolicy) (Result, error) {
+	return d.DiscoverBestContext(context.Background(), policy)
+}
+
+// DiscoverBestContext is like DiscoverBest, but abandons discovery when ctx is done
+func (d *Discoverer) DiscoverBestContext(ctx context.Context, policy SelectionPolicy) (Result, error) {
+	var rank func(Result) (time.Time, bool)
+	switch policy {
+	case PreferSpecOrder:
+		return d.DiscoverContext(ctx)
+	case PreferLatestExpiry:
+		rank = Result.ExpiresAt
+	case PreferNewestFile:
+		rank = d.fileModTime
+	default:
+		return Result{}, fmt.Errorf("unknown token selection policy %s", policy)
+	}
+
+	results, err := d.DiscoverAllContext(ctx)
+	if len(results) == 0 {
+		return Result{}, err
+	}
+	if err != nil {
+		d.debug("some discovery steps failed", "error", err)
+	}
+
+	best := results[0]
+	bestTime, bestRanked := rank(best)
+	for _, res := range results[1:] {
+		t, ranked := rank(res)
+		if ranked && (!bestRanked || t.After(bestTime)) {
+			best, bestTime, bestRanked = res, t, true
+		}
+	}
+	d.debug("selected token", "policy", policy, "step", best.step, "path", best.path)
+	return best, nil
+}
+
+// fileModTime returns the modification time of the file res was read from, if there is one
+func (d *Discoverer) fileModTime(res Result) (time.Time, bool) {
+	if res.path == "" {
+		return time.Time{}, false
+	}
+	info, err := d.stat(res.path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return info.ModTime(), true
+}
+
+// tokenExpiry returns the time in the exp claim of tok, if tok is a JWT with one. The signature is not verified.
+func tokenExpiry(tok []byte) (time.Time, bool) {
+	claims, err := parseClaimsCached(tok)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return claims.Expiry()
+}
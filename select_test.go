@@ -0,0 +1,99 @@
+package tokendiscovery_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+// makeJWT returns an unsigned JWT with the given claims
+func makeJWT(t testing.TB, claims map[string]any) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"none"}`)) + "." + enc.EncodeToString(payload) + "." + enc.EncodeToString([]byte("sig"))
+}
+
+func TestDiscoverBest(t *testing.T) {
+	now := time.Now()
+	stale := makeJWT(t, map[string]any{"sub": "env", "exp": now.Add(time.Minute).Unix()})
+	fresh := makeJWT(t, map[string]any{"sub": "xdg", "exp": now.Add(time.Hour).Unix()})
+	noExp := makeJWT(t, map[string]any{"sub": "tmp"})
+
+	fsys := fstest.MapFS{
+		"run/user/4242/bt_u4242": {Data: []byte(fresh), ModTime: now.Add(-time.Hour)},
+		"tmp/bt_u4242":           {Data: []byte(noExp), ModTime: now},
+	}
+
+	type testCase struct {
+		description string
+		env         map[string]string
+		policy      disc.SelectionPolicy
+		expectedTok string
+	}
+
+	testCases := []testCase{
+		{
+			"Spec order",
+			map[string]string{"BEARER_TOKEN": stale, "XDG_RUNTIME_DIR": "/run/user/4242"},
+			disc.PreferSpecOrder,
+			stale,
+		},
+		{
+			"Latest expiry",
+			map[string]string{"BEARER_TOKEN": stale, "XDG_RUNTIME_DIR": "/run/user/4242"},
+			disc.PreferLatestExpiry,
+			fresh,
+		},
+		{
+			"Latest expiry ranks parseable exp above missing exp",
+			map[string]string{"BEARER_TOKEN": stale},
+			disc.PreferLatestExpiry,
+			stale,
+		},
+		{
+			"Latest expiry with only unparseable tokens keeps spec order",
+			map[string]string{"BEARER_TOKEN": "opaque_token"},
+			disc.PreferLatestExpiry,
+			"opaque_token",
+		},
+		{
+			"Newest file",
+			map[string]string{"BEARER_TOKEN": stale, "XDG_RUNTIME_DIR": "/run/user/4242"},
+			disc.PreferNewestFile,
+			noExp,
+		},
+		{
+			"Newest file ranks files above the environment",
+			map[string]string{"BEARER_TOKEN": stale, "XDG_RUNTIME_DIR": "/run/user/4242", "TMPDIR": "/missing"},
+			disc.PreferNewestFile,
+			fresh,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				d, err := disc.New(disc.WithEnvMap(tc.env), disc.WithFS(fsys), disc.WithUID("4242"), disc.WithTMPDIRFallback())
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				res, err := d.DiscoverBest(tc.policy)
+				if err != nil {
+					t.Fatalf("Expected nil error, got %s", err)
+				}
+				if string(res.Bytes()) != tc.expectedTok {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedTok, res.Bytes())
+				}
+			},
+		)
+	}
+}
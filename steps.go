@@ -0,0 +1,337 @@
+package tokendiscovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// ErrSkipStep is returned, possibly wrapped, by a Step that did not produce a token, to have discovery continue with
+// the next step. Any other error from a Step ends discovery.
+var ErrSkipStep = errors.New("discovery step did not produce a token")
+
+// Step is one step of the discovery procedure. Discovery runs each configured Step in order until one of them returns a
+// token, or an error other than one wrapping ErrSkipStep.
+type Step interface {
+	// Name returns a short name for the step, used in logs and errors
+	Name() string
+	// Lookup attempts to find a token. env looks up environment variables, and fsys reads token files, applying the
+	// Discoverer's settings, such as an injected filesystem. If the step cannot produce a token, Lookup returns an
+	// error created by SkipStep.
+	Lookup(ctx context.Context, env Environ, fsys FileReader) (Result, error)
+}
+
+// FileReader reads token files on behalf of a Step. A *Discoverer is a FileReader.
+type FileReader interface {
+	// ReadTokenFile returns the contents of the file at path with surrounding whitespace removed. It returns an error
+	// wrapping ErrEmptyToken if the file is empty or only contains whitespace.
+	ReadTokenFile(ctx context.Context, path string) ([]byte, error)
+}
+
+// SkipStep returns an error that makes discovery continue with the next step. reason explains why the step did not
+// produce a token, and is reported in the final error if no step does; it may be nil.
+func SkipStep(reason error) error {
+	if reason == nil {
+		return ErrSkipStep
+	}
+	return &skipError{reason}
+}
+
+// skipError records why a Step was skipped
+type skipError struct {
+	reason error
+}
+
+func (e *skipError) Error() string { return e.reason.Error() }
+
+func (e *skipError) Unwrap() error { return e.reason }
+
+func (e *skipError) Is(target error) bool { return target == ErrSkipStep }
+
+// StandardSteps returns the four steps of the WLCG Bearer Token Discovery procedure, in order. The slice is newly
+// allocated, so it can be modified and passed to WithSteps.
+func StandardSteps() []Step {
+	return []Step{bearerTokenEnvStep{}, bearerTokenFileStep{}, xdgRuntimeDirStep{}, tmpFallbackStep{}}
+}
+
+// WithSteps replaces the steps of the discovery procedure. Use it with StandardSteps to append site-specific sources
+// to the standard procedure, or to drop steps that should not be trusted.
+func WithSteps(steps ...Step) Option {
+	return func(d *Discoverer) error {
+		if len(steps) == 0 {
+			return fmt.Errorf("%w: at least one discovery step is required", ErrInvalidOption)
+		}
+		for i, step := range steps {
+			if step == nil {
+				return fmt.Errorf("%w: discovery step %d is nil", ErrInvalidOption, i)
+			}
+		}
+		d.steps = append([]Step(nil), steps...)
+		return nil
+	}
+}
+
+// insertBefore returns steps with step inserted before the first occurrence of anchor, or appended if anchor is not
+// one of steps
+func insertBefore(steps []Step, step Step, anchor Step) []Step {
+	for i, s := range steps {
+		if s == anchor {
+			return append(steps[:i:i], append([]Step{step}, steps[i:]...)...)
+		}
+	}
+	return append(steps, step)
+}
+
+// insertAfter returns steps with step inserted after the first occurrence of anchor, or appended if anchor is not one
+// of steps
+func insertAfter(steps []Step, step Step, anchor Step) []Step {
+	for i, s := range steps {
+		if s == anchor {
+			return append(steps[:i+1:i+1], append([]Step{step}, steps[i+1:]...)...)
+		}
+	}
+	return append(steps, step)
+}
+
+// stepDiscoverer returns the Discoverer whose settings a standard step should use. Discovery always passes the
+// Discoverer itself as fsys; if a standard step is called some other way, the default settings apply.
+func stepDiscoverer(fsys FileReader) *Discoverer {
+	if d, ok := fsys.(*Discoverer); ok {
+		return d
+	}
+	return defaultDiscoverer
+}
+
+// lookupValue returns the value of the environment variable key, or the empty string if it is not set
+func lookupValue(env Environ, key string) string {
+	val, _ := env(key)
+	return val
+}
+
+// errUnset is wrapped by the reasons recorded for steps skipped because the environment variables they depend on are
+// not set
+var errUnset = errors.New("not set")
+
+// envUnset returns the error skipping the step source because none of the environment variables keys is set
+func envUnset(source Source, keys ...string) error {
+	if len(keys) == 1 && keys[0] == source.String() {
+		// The step is named after the variable
+		return SkipStep(&DiscoveryError{Step: source, Err: errUnset})
+	}
+	return SkipStep(&DiscoveryError{Step: source, Err: fmt.Errorf("%s %w", strings.Join(keys, ", "), errUnset)})
+}
+
+// readFailure returns the error for the step source when reading its token file at path failed with err for a reason
+// other than the file being missing or empty. Permission errors skip the step, unless WithFatalPermissionErrors is
+// given, as do paths naming a directory, files rejected by the permission policy, and malformed token files; any other
+// error ends discovery.
+func (d *Discoverer) readFailure(source Source, path string, err error) error {
+	if errors.Is(err, ErrInsecurePermissions) || errors.Is(err, ErrMalformedToken) || errors.Is(err, ErrNotRegularFile) {
+		return SkipStep(&DiscoveryError{Step: source, Path: path, Err: err})
+	}
+	if isPathError(err) && d.isDirectory(path) {
+		return SkipStep(&DiscoveryError{Step: source, Path: path, Err: fmt.Errorf("%s is a directory", path)})
+	}
+	if errors.Is(err, ErrPermissionDenied) {
+		discErr := &DiscoveryError{Step: source, Path: path, Err: err}
+		if d.fatalPermissions {
+			return discErr
+		}
+		return SkipStep(discErr)
+	}
+	return &DiscoveryError{Step: source, Path: path, Err: fmt.Errorf("cannot read token file located at %s: %w", path, err)}
+}
+
+// checkPathValue returns an error if val, the value of an environment variable naming a file or directory, cannot be a
+// usable path
+func checkPathValue(val string) error {
+	switch {
+	case strings.TrimSpace(val) == "":
+		return fmt.Errorf("value %q is blank", val)
+	case strings.ContainsRune(val, 0):
+		return fmt.Errorf("value %q contains a NUL byte", val)
+	}
+	return nil
+}
+
+// bearerTokenEnvStep is step 1 of the discovery procedure
+type bearerTokenEnvStep struct{}
+
+func (bearerTokenEnvStep) Name() string { return SourceBearerTokenEnv.String() }
+
+// Lookup implements step 1: if the BEARER_TOKEN environment variable is set, then the value is taken to be the token
+// contents.
+func (bearerTokenEnvStep) Lookup(_ context.Context, env Environ, fsys FileReader) (Result, error) {
+	d := stepDiscoverer(fsys)
+	if d.skipEnvironmentSources() {
+		return Result{}, SkipStep(nil)
+	}
+	keys := d.tokenEnvVars()
+	for _, key := range keys {
+		val, ok := env(key)
+		if retVal := strings.TrimSpace(val); retVal != "" {
+			if d.rawContents {
+				retVal = val
+			}
+			return Result{token: []byte(retVal), source: SourceBearerTokenEnv}, nil
+		}
+		if ok && d.strictSpec {
+			return Result{}, endDiscovery(SourceBearerTokenEnv, "", fmt.Errorf("%s is set but empty", key))
+		}
+	}
+	return Result{}, envUnset(SourceBearerTokenEnv, keys...)
+}
+
+// bearerTokenFileStep is step 2 of the discovery procedure
+type bearerTokenFileStep struct{}
+
+func (bearerTokenFileStep) Name() string { return SourceBearerTokenFile.String() }
+
+// Lookup implements step 2: if the BEARER_TOKEN_FILE environment variable is set, then its value is interpreted as a
+// filename. The contents of the specified file are taken to be the token contents.
+func (bearerTokenFileStep) Lookup(ctx context.Context, env Environ, fsys FileReader) (Result, error) {
+	d := stepDiscoverer(fsys)
+	if d.skipEnvironmentSources() {
+		return Result{}, SkipStep(nil)
+	}
+	var fname string
+	keys := d.tokenFileEnvVars()
+	for _, key := range keys {
+		val, ok := env(key)
+		if fname = val; fname != "" {
+			break
+		}
+		if ok && d.strictSpec {
+			return Result{}, endDiscovery(SourceBearerTokenFile, "", fmt.Errorf("%s is set but empty", key))
+		}
+	}
+	if fname == "" {
+		return Result{}, envUnset(SourceBearerTokenFile, keys...)
+	}
+	if d.expandPaths {
+		expanded, err := d.expandPath(fname, env)
+		if err != nil {
+			if d.strictSpec {
+				return Result{}, endDiscovery(SourceBearerTokenFile, fname, err)
+			}
+			return Result{}, SkipStep(&DiscoveryError{Step: SourceBearerTokenFile, Path: fname, Err: err})
+		}
+		fname = expanded
+	}
+	if err := checkPathValue(fname); err != nil {
+		if d.strictSpec {
+			return Result{}, endDiscovery(SourceBearerTokenFile, "", err)
+		}
+		return Result{}, SkipStep(&DiscoveryError{Step: SourceBearerTokenFile, Err: err})
+	}
+	if d.fileList {
+		return lookupFileList(ctx, fname, fsys)
+	}
+	tok, err := fsys.ReadTokenFile(ctx, fname)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return Result{}, tokenFileMissing(SourceBearerTokenFile, fname, ErrBearerTokenFileMissing, err)
+	case errors.Is(err, ErrEmptyToken) && d.strictSpec:
+		return Result{}, endDiscovery(SourceBearerTokenFile, fname, err)
+	case errors.Is(err, ErrEmptyToken):
+		return Result{}, SkipStep(&DiscoveryError{Step: SourceBearerTokenFile, Path: fname, Err: err})
+	case err != nil:
+		return Result{}, d.readFailure(SourceBearerTokenFile, fname, err)
+	}
+	return Result{token: tok, path: fname, source: SourceBearerTokenFile}, nil
+}
+
+// xdgRuntimeDirStep is step 3 of the discovery procedure
+type xdgRuntimeDirStep struct{}
+
+func (xdgRuntimeDirStep) Name() string { return SourceXDGRuntimeDir.String() }
+
+// Lookup implements step 3: if the XDG_RUNTIME_DIR environment variable is set, then take the token from the contents
+// of $XDG_RUNTIME_DIR/bt_u$ID.
+func (xdgRuntimeDirStep) Lookup(ctx context.Context, env Environ, fsys FileReader) (Result, error) {
+	xdgDir := lookupValue(env, "XDG_RUNTIME_DIR")
+	if xdgDir == "" {
+		return Result{}, envUnset(SourceXDGRuntimeDir, "XDG_RUNTIME_DIR")
+	}
+	if err := checkPathValue(xdgDir); err != nil {
+		return Result{}, SkipStep(&DiscoveryError{Step: SourceXDGRuntimeDir, Err: err})
+	}
+	// The uid is only resolved from here on, since looking up the current user can be slow or fail outright
+	d := stepDiscoverer(fsys)
+	uid, err := d.currentUID()
+	if err != nil {
+		return Result{}, &DiscoveryError{Step: SourceXDGRuntimeDir, Err: err}
+	}
+	fname := filepath.Join(xdgDir, d.tokenFileName(uid))
+	tok, err := fsys.ReadTokenFile(ctx, fname)
+	switch {
+	case isPathError(err) && d.notDirectory(xdgDir):
+		// Reading fails with ENOTDIR or ENOENT depending on the filesystem; either way, the step cannot produce a token
+		return Result{}, SkipStep(&DiscoveryError{Step: SourceXDGRuntimeDir, Path: xdgDir, Err: fmt.Errorf("%s is not a directory", xdgDir)})
+	case errors.Is(err, fs.ErrNotExist):
+		return Result{}, tokenFileMissing(SourceXDGRuntimeDir, fname, ErrXDGTokenFileMissing, err)
+	case errors.Is(err, ErrEmptyToken) && d.strictSpec:
+		return Result{}, endDiscovery(SourceXDGRuntimeDir, fname, err)
+	case errors.Is(err, ErrEmptyToken):
+		return Result{}, SkipStep(&DiscoveryError{Step: SourceXDGRuntimeDir, Path: fname, Err: err})
+	case err != nil:
+		return Result{}, d.readFailure(SourceXDGRuntimeDir, fname, err)
+	}
+	return Result{token: tok, path: fname, source: SourceXDGRuntimeDir}, nil
+}
+
+// isPathError reports whether err was returned by the filesystem, rather than, for example, because discovery was
+// abandoned
+func isPathError(err error) bool {
+	var pathErr *fs.PathError
+	return errors.As(err, &pathErr)
+}
+
+// isDirectory reports whether the file at path is a directory
+func (d *Discoverer) isDirectory(path string) bool {
+	info, err := d.stat(path)
+	return err == nil && info.IsDir()
+}
+
+// notDirectory reports whether the file at path exists but is not a directory
+func (d *Discoverer) notDirectory(path string) bool {
+	info, err := d.stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// tmpFallbackStep is step 4 of the discovery procedure
+type tmpFallbackStep struct{}
+
+func (tmpFallbackStep) Name() string { return SourceTmpFallback.String() }
+
+// Lookup implements step 4: otherwise, take the token from /tmp/bt_u$ID
+func (tmpFallbackStep) Lookup(ctx context.Context, _ Environ, fsys FileReader) (Result, error) {
+	d := stepDiscoverer(fsys)
+	if d.noFallback {
+		return Result{}, SkipStep(&DiscoveryError{Step: SourceTmpFallback, Err: ErrFallbackDisabled})
+	}
+	uid, err := d.currentUID()
+	if err != nil {
+		return Result{}, &DiscoveryError{Step: SourceTmpFallback, Err: err}
+	}
+	fname := filepath.Join(d.fallbackDirectory(), d.tokenFileName(uid))
+	tok, err := readTokenFileNoFollow(ctx, fsys, fname)
+	switch {
+	case errors.Is(err, ErrSymlinkRejected):
+		return Result{}, SkipStep(&DiscoveryError{Step: SourceTmpFallback, Path: fname, Err: err})
+	case errors.Is(err, fs.ErrNotExist):
+		return Result{}, SkipStep(&DiscoveryError{Step: SourceTmpFallback, Path: fname, Err: fmt.Errorf("token file does not exist: %w", err)})
+	case errors.Is(err, ErrEmptyToken):
+		return Result{}, SkipStep(&DiscoveryError{Step: SourceTmpFallback, Path: fname, Err: fmt.Errorf("token file is empty: %w", err)})
+	case err != nil:
+		return Result{}, d.readFailure(SourceTmpFallback, fname, err)
+	}
+	// Checked once the file has been read, so that a blocked read can still be abandoned
+	if err := d.checkOwner(fname, uid); err != nil {
+		return Result{}, SkipStep(&DiscoveryError{Step: SourceTmpFallback, Path: fname, Err: err})
+	}
+	return Result{token: tok, path: fname, source: SourceTmpFallback}, nil
+}
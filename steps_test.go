@@ -0,0 +1,159 @@
+package tokendiscovery_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+// mountStep is a site-specific step that reads a token from a fixed path, like a Kubernetes secret mount
+type mountStep struct {
+	path string
+}
+
+func (m mountStep) Name() string { return "secret mount" }
+
+func (m mountStep) Lookup(ctx context.Context, _ disc.Environ, fsys disc.FileReader) (disc.Result, error) {
+	tok, err := fsys.ReadTokenFile(ctx, m.path)
+	if err != nil {
+		return disc.Result{}, disc.SkipStep(err)
+	}
+	return disc.NewResult(tok, m.path), nil
+}
+
+// failingStep is a step that ends discovery with err
+type failingStep struct {
+	err error
+}
+
+func (f failingStep) Name() string { return "failing" }
+
+func (f failingStep) Lookup(context.Context, disc.Environ, disc.FileReader) (disc.Result, error) {
+	return disc.Result{}, f.err
+}
+
+func TestWithSteps(t *testing.T) {
+	fsys := fstest.MapFS{
+		"var/run/secrets/token": {Data: []byte("mounted_token\n")},
+		"tmp/bt_u4242":          {Data: []byte("tmp_token")},
+	}
+	errBroken := errors.New("secret store is broken")
+
+	type testCase struct {
+		description    string
+		env            map[string]string
+		steps          []disc.Step
+		expectedTok    []byte
+		expectedPath   string
+		expectedSource disc.Source
+		expectedStep   string
+		expectedErr    error
+	}
+
+	testCases := []testCase{
+		{
+			"Standard steps are the default",
+			map[string]string{},
+			disc.StandardSteps(),
+			[]byte("tmp_token"),
+			"/tmp/bt_u4242",
+			disc.SourceTmpFallback,
+			"fallback directory",
+			nil,
+		},
+		{
+			"Standard steps find a token before the custom step",
+			map[string]string{"BEARER_TOKEN": "env_token"},
+			append(disc.StandardSteps(), mountStep{"/var/run/secrets/token"}),
+			[]byte("env_token"),
+			"",
+			disc.SourceBearerTokenEnv,
+			"BEARER_TOKEN",
+			nil,
+		},
+		{
+			"Custom step appended after dropping the fallback",
+			map[string]string{},
+			append(disc.StandardSteps()[:3], mountStep{"/var/run/secrets/token"}),
+			[]byte("mounted_token"),
+			"/var/run/secrets/token",
+			disc.SourceCustom,
+			"secret mount",
+			nil,
+		},
+		{
+			"Custom step skipped, chain exhausted",
+			map[string]string{},
+			append(disc.StandardSteps()[:3], mountStep{"/var/run/secrets/missing"}),
+			nil,
+			"",
+			disc.SourceUnknown,
+			"",
+			disc.ErrNoTokenFound,
+		},
+		{
+			"Custom step ends discovery",
+			map[string]string{},
+			[]disc.Step{failingStep{errBroken}, mountStep{"/var/run/secrets/token"}},
+			nil,
+			"",
+			disc.SourceUnknown,
+			"",
+			errBroken,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				d, err := disc.New(disc.WithEnvMap(tc.env), disc.WithFS(fsys), disc.WithUID("4242"), disc.WithSteps(tc.steps...))
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				res, err := d.Discover()
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("Got different errors: expected %v, got %v", tc.expectedErr, err)
+				}
+				if !reflect.DeepEqual(res.Bytes(), tc.expectedTok) {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedTok, res.Bytes())
+				}
+				if res.Path() != tc.expectedPath {
+					t.Errorf("Token paths do not match. Expected path %s, got %s", tc.expectedPath, res.Path())
+				}
+				if res.Source() != tc.expectedSource {
+					t.Errorf("Token sources do not match. Expected source %s, got %s", tc.expectedSource, res.Source())
+				}
+				if res.StepName() != tc.expectedStep {
+					t.Errorf("Step names do not match. Expected step %s, got %s", tc.expectedStep, res.StepName())
+				}
+			},
+		)
+	}
+}
+
+func TestWithStepsInvalid(t *testing.T) {
+	for _, opt := range []disc.Option{disc.WithSteps(), disc.WithSteps(nil)} {
+		if _, err := disc.New(opt); !errors.Is(err, disc.ErrInvalidOption) {
+			t.Errorf("Expected error %s, got %v", disc.ErrInvalidOption, err)
+		}
+	}
+}
+
+func TestSkipStep(t *testing.T) {
+	if err := disc.SkipStep(nil); !errors.Is(err, disc.ErrSkipStep) {
+		t.Errorf("Expected error %s, got %v", disc.ErrSkipStep, err)
+	}
+	reason := errors.New("not configured")
+	err := disc.SkipStep(reason)
+	if !errors.Is(err, disc.ErrSkipStep) || !errors.Is(err, reason) {
+		t.Errorf("Expected error to wrap both %s and %s, got %v", disc.ErrSkipStep, reason, err)
+	}
+	if err.Error() != reason.Error() {
+		t.Errorf("Expected error message %q, got %q", reason.Error(), err.Error())
+	}
+}
@@ -0,0 +1,130 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestStrictSpec(t *testing.T) {
+	fsys := fstest.MapFS{
+		"home/user/token":        {Data: []byte("file_token")},
+		"home/user/empty":        {Data: []byte(" \n")},
+		"run/user/4242/bt_u4242": {Data: []byte("\n")},
+		"tmp/bt_u4242":           {Data: []byte("tmp_token")},
+	}
+
+	type testCase struct {
+		description   string
+		env           map[string]string
+		expectedToken string
+		lenientErr    error
+		strictErr     error
+	}
+
+	testCases := []testCase{
+		{
+			"BEARER_TOKEN set",
+			map[string]string{"BEARER_TOKEN": "env_token"},
+			"env_token",
+			nil,
+			nil,
+		},
+		{
+			"BEARER_TOKEN set but empty",
+			map[string]string{"BEARER_TOKEN": ""},
+			"tmp_token",
+			nil,
+			disc.ErrNoTokenFound,
+		},
+		{
+			"BEARER_TOKEN set to whitespace",
+			map[string]string{"BEARER_TOKEN": " \t"},
+			"tmp_token",
+			nil,
+			disc.ErrNoTokenFound,
+		},
+		{
+			"BEARER_TOKEN_FILE set",
+			map[string]string{"BEARER_TOKEN_FILE": "/home/user/token"},
+			"file_token",
+			nil,
+			nil,
+		},
+		{
+			"BEARER_TOKEN_FILE set but empty",
+			map[string]string{"BEARER_TOKEN_FILE": ""},
+			"tmp_token",
+			nil,
+			disc.ErrNoTokenFound,
+		},
+		{
+			"BEARER_TOKEN_FILE names an empty file",
+			map[string]string{"BEARER_TOKEN_FILE": "/home/user/empty"},
+			"tmp_token",
+			nil,
+			disc.ErrEmptyToken,
+		},
+		{
+			"BEARER_TOKEN_FILE names a missing file",
+			map[string]string{"BEARER_TOKEN_FILE": "/home/user/missing"},
+			"",
+			disc.ErrBearerTokenFileMissing,
+			disc.ErrBearerTokenFileMissing,
+		},
+		{
+			"XDG_RUNTIME_DIR token file is empty",
+			map[string]string{"XDG_RUNTIME_DIR": "/run/user/4242"},
+			"tmp_token",
+			nil,
+			disc.ErrEmptyToken,
+		},
+		{
+			"Nothing set",
+			map[string]string{},
+			"tmp_token",
+			nil,
+			nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		for _, strict := range []bool{false, true} {
+			expectedErr := tc.lenientErr
+			opts := []disc.Option{disc.WithEnvMap(tc.env), disc.WithFS(fsys), disc.WithUID("4242")}
+			mode := "lenient"
+			if strict {
+				expectedErr = tc.strictErr
+				opts = append(opts, disc.WithStrictSpec())
+				mode = "strict"
+			}
+			t.Run(
+				tc.description+", "+mode,
+				func(t *testing.T) {
+					d, err := disc.New(opts...)
+					if err != nil {
+						t.Fatalf("Could not construct Discoverer: %s", err)
+					}
+					tok, err := d.FindToken()
+					if expectedErr != nil {
+						if !errors.Is(err, expectedErr) {
+							t.Errorf("Expected error %s, got %v", expectedErr, err)
+						}
+						if !errors.Is(err, disc.ErrNoTokenFound) {
+							t.Errorf("Expected error %s, got %v", disc.ErrNoTokenFound, err)
+						}
+						return
+					}
+					if err != nil {
+						t.Fatalf("Expected nil error, got %v", err)
+					}
+					if string(tok) != tc.expectedToken {
+						t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, string(tok))
+					}
+				},
+			)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package tokendiscovery
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrSubjectMismatch indicates that a token was skipped because its sub claim does not match the subject required with
+// WithRequiredSubject or WithRequiredSubjectPrefix. If no token qualifies, the error returned by discovery wraps both
+// it and ErrNoTokenFound, and lists the subjects of the tokens that were found.
+var ErrSubjectMismatch = errors.New("token subject does not match")
+
+// WithRequiredSubject makes discovery skip tokens whose sub claim is not exactly sub, so that a service acting for a
+// mapped account only uses a token for that identity. Tokens that are not JWTs are skipped.
+func WithRequiredSubject(sub string) Option {
+	return func(d *Discoverer) error {
+		if sub == "" {
+			return fmt.Errorf("%w: subject cannot be empty", ErrInvalidOption)
+		}
+		d.requiredSubject = sub
+		d.subjectPrefix = false
+		return nil
+	}
+}
+
+// WithRequiredSubjectPrefix is like WithRequiredSubject, but accepts tokens whose sub claim starts with prefix
+func WithRequiredSubjectPrefix(prefix string) Option {
+	return func(d *Discoverer) error {
+		if prefix == "" {
+			return fmt.Errorf("%w: subject prefix cannot be empty", ErrInvalidOption)
+		}
+		d.requiredSubject = prefix
+		d.subjectPrefix = true
+		return nil
+	}
+}
+
+// checkSubject returns an error wrapping ErrSubjectMismatch if tok should be skipped according to WithRequiredSubject
+// or WithRequiredSubjectPrefix
+func (d *Discoverer) checkSubject(tok []byte) error {
+	if d.requiredSubject == "" {
+		return nil
+	}
+	claims, err := parseClaimsCached(tok)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSubjectMismatch, err)
+	}
+	sub := claims.Subject()
+	if sub == d.requiredSubject || d.subjectPrefix && strings.HasPrefix(sub, d.requiredSubject) {
+		return nil
+	}
+	return &claimError{sentinel: ErrSubjectMismatch, claim: "sub claim", value: sub}
+}
+
+// subjectMismatchError returns the error summarizing the subjects of the tokens in rejected skipped by checkSubject,
+// for discovery to return when no token qualified. It returns nil if no token was skipped for its subject.
+func (d *Discoverer) subjectMismatchError(rejected []error) error {
+	want := fmt.Sprintf("%q", d.requiredSubject)
+	if d.subjectPrefix {
+		want = "starting with " + want
+	}
+	return claimMismatchError(rejected, ErrSubjectMismatch, "sub claim", want, "the subjects found")
+}
@@ -0,0 +1,129 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestRequiredSubject(t *testing.T) {
+	const (
+		storage = "https://storage.example:1094"
+		alice   = "alice@experiment.example"
+	)
+	aliceStorage := makeJWT(t, map[string]any{"sub": alice, "aud": storage})
+	aliceOther := makeJWT(t, map[string]any{"sub": alice, "aud": "https://other.example"})
+	bobStorage := makeJWT(t, map[string]any{"sub": "bob@experiment.example", "aud": storage})
+	robotStorage := makeJWT(t, map[string]any{"sub": "robot@other.example", "aud": storage})
+
+	type testCase struct {
+		description   string
+		envToken      string
+		fileToken     string
+		opts          []disc.Option
+		expectedToken string
+		expectedErr   error
+	}
+
+	testCases := []testCase{
+		{
+			"Matching subject",
+			aliceStorage,
+			bobStorage,
+			[]disc.Option{disc.WithRequiredSubject(alice)},
+			aliceStorage,
+			nil,
+		},
+		{
+			"Mismatched subject falls through",
+			bobStorage,
+			aliceStorage,
+			[]disc.Option{disc.WithRequiredSubject(alice)},
+			aliceStorage,
+			nil,
+		},
+		{
+			"Prefix is not an exact match",
+			aliceStorage,
+			"",
+			[]disc.Option{disc.WithRequiredSubject("alice")},
+			"",
+			disc.ErrSubjectMismatch,
+		},
+		{
+			"Prefix match",
+			robotStorage,
+			bobStorage,
+			[]disc.Option{disc.WithRequiredSubjectPrefix("bob@")},
+			bobStorage,
+			nil,
+		},
+		{
+			"Subject matches but audience does not",
+			aliceOther,
+			aliceStorage,
+			[]disc.Option{disc.WithRequiredSubject(alice), disc.WithRequiredAudience(storage)},
+			aliceStorage,
+			nil,
+		},
+		{
+			"Audience matches but subject does not",
+			bobStorage,
+			aliceStorage,
+			[]disc.Option{disc.WithRequiredSubject(alice), disc.WithRequiredAudience(storage)},
+			aliceStorage,
+			nil,
+		},
+		{
+			"Each filter rejects one token",
+			bobStorage,
+			aliceOther,
+			[]disc.Option{disc.WithRequiredSubject(alice), disc.WithRequiredAudience(storage)},
+			"",
+			disc.ErrSubjectMismatch,
+		},
+		{
+			"No matching subject",
+			bobStorage,
+			robotStorage,
+			[]disc.Option{disc.WithRequiredSubject(alice)},
+			"",
+			disc.ErrSubjectMismatch,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := append([]disc.Option{
+					disc.WithEnvMap(map[string]string{"BEARER_TOKEN": tc.envToken, "BEARER_TOKEN_FILE": "/home/user/token"}),
+					disc.WithFS(fstest.MapFS{"home/user/token": {Data: []byte(tc.fileToken + "\n")}}),
+				}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, err := d.FindToken()
+				if tc.expectedErr != nil {
+					if !errors.Is(err, tc.expectedErr) || !errors.Is(err, disc.ErrNoTokenFound) {
+						t.Fatalf("Expected error wrapping %s and %s, got %v", tc.expectedErr, disc.ErrNoTokenFound, err)
+					}
+					if !strings.Contains(err.Error(), "subjects found were") {
+						t.Errorf("Expected error to list the subjects found, got %v", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if string(tok) != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, tok)
+				}
+			},
+		)
+	}
+}
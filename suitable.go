@@ -0,0 +1,135 @@
+package tokendiscovery
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// defaultPorts are the ports implied by the URL schemes of storage endpoints when none is given
+var defaultPorts = map[string]string{
+	"http": "80", "https": "443", "dav": "80", "davs": "443",
+	"root": "1094", "roots": "1094", "xroot": "1094", "xroots": "1094",
+}
+
+// SuitableFor reports whether a token with claims can be used for the storage operation op, such as OperationCreate,
+// on path at the storage endpoint, such as https://se.example.org:2880/store. If it cannot, the reasons are returned:
+//   - The aud claim must include AudienceAny or the origin of endpoint. Origins are compared with the scheme and host
+//     in lower case and default ports made explicit, so https://se.example.org matches
+//     https://se.example.org:443/store but not https://se.example.org:2880. Audiences that are not URLs are compared
+//     with the host and port of endpoint.
+//   - A storage scope must allow op on path, as described for Scope.Allows. path is relative to endpoint.Path unless
+//     it is absolute; if it is empty, endpoint.Path itself is used.
+//   - The exp claim, if any, must not have passed at now, and the nbf claim, if any, must have, tolerating clock skew
+//     of up to leeway as CheckValidity does.
+//
+// claims are NOT verified, so they should come from Verifier.Validate for authorization decisions.
+func SuitableFor(
+	claims WLCGClaims,
+	endpoint *url.URL,
+	op string,
+	path string,
+	now time.Time,
+	leeway time.Duration,
+) (bool, []string) {
+	var reasons []string
+	if !audienceMatchesEndpoint(claims.Aud, endpoint) {
+		reason := fmt.Sprintf("audience %s does not include %s or %s", quoteAll(claims.Aud), endpointOrigin(endpoint),
+			AudienceAny)
+		if len(claims.Aud) == 0 {
+			reason = fmt.Sprintf("token has no audience, expected %s or %s", endpointOrigin(endpoint), AudienceAny)
+		}
+		reasons = append(reasons, reason)
+	}
+
+	target := joinScopePath(endpoint.Path, path)
+	allowed := false
+	for _, field := range claims.Scope {
+		if s, err := parseScope(field); err == nil && s.Allows(op, target) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		reason := fmt.Sprintf("no storage scope allows %s on %s", op, target)
+		if len(claims.Scope) > 0 {
+			reason += fmt.Sprintf(" (scopes: %s)", quoteAll(claims.Scope))
+		}
+		reasons = append(reasons, reason)
+	}
+
+	if !claims.Exp.IsZero() && !claims.Exp.Add(leeway).After(now) {
+		reasons = append(reasons, fmt.Sprintf("token expired at %s", claims.Exp.UTC().Format(time.RFC3339)))
+	}
+	if !claims.Nbf.IsZero() && claims.Nbf.Add(-leeway).After(now) {
+		reasons = append(reasons, fmt.Sprintf("token is not valid until %s", claims.Nbf.UTC().Format(time.RFC3339)))
+	}
+	return len(reasons) == 0, reasons
+}
+
+// SuitableFor is like the package-level SuitableFor, using the clock set with WithClock and the leeway set with
+// WithLeeway
+func (d *Discoverer) SuitableFor(claims WLCGClaims, endpoint *url.URL, op string, path string) (bool, []string) {
+	return SuitableFor(claims, endpoint, op, path, d.now(), d.clockLeeway())
+}
+
+// endpointOrigin returns the origin of u, as scheme://host:port in lower case, with the default port of the scheme if u
+// has none. WebDAV schemes are replaced by the HTTP schemes they stand for.
+func endpointOrigin(u *url.URL) string {
+	scheme := strings.ToLower(u.Scheme)
+	switch scheme {
+	case "dav":
+		scheme = "http"
+	case "davs":
+		scheme = "https"
+	}
+	return scheme + "://" + hostPort(scheme, u.Host)
+}
+
+// hostPort returns host in lower case, with the default port of scheme if it has none
+func hostPort(scheme, host string) string {
+	host = strings.ToLower(host)
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		return net.JoinHostPort(h, port)
+	}
+	if port, ok := defaultPorts[scheme]; ok {
+		return net.JoinHostPort(strings.Trim(host, "[]"), port)
+	}
+	return host
+}
+
+// audienceMatchesEndpoint reports whether auds includes AudienceAny or the origin of endpoint
+func audienceMatchesEndpoint(auds []string, endpoint *url.URL) bool {
+	origin := endpointOrigin(endpoint)
+	for _, aud := range auds {
+		if aud == AudienceAny {
+			return true
+		}
+		if u, err := url.Parse(aud); err == nil && u.Scheme != "" && u.Host != "" {
+			if endpointOrigin(u) == origin {
+				return true
+			}
+			continue
+		}
+		// Audiences such as se.example.org:2880 name the endpoint without a scheme
+		if hostPort(strings.ToLower(endpoint.Scheme), aud) == hostPort(strings.ToLower(endpoint.Scheme), endpoint.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinScopePath returns p, resolved against base unless it is absolute, or base if p is empty
+func joinScopePath(base, p string) string {
+	switch {
+	case p == "":
+		return cleanScopePath(base)
+	case strings.HasPrefix(p, "/"):
+		return cleanScopePath(p)
+	default:
+		return cleanScopePath(path.Join(base, p))
+	}
+}
@@ -0,0 +1,190 @@
+package tokendiscovery_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestSuitableFor(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	claims := func(aud []string, scopes ...string) disc.WLCGClaims {
+		return disc.WLCGClaims{Aud: aud, Scope: scopes, Exp: now.Add(time.Hour)}
+	}
+
+	type testCase struct {
+		description string
+		claims      disc.WLCGClaims
+		endpoint    string
+		op          string
+		path        string
+		reasons     []string
+	}
+
+	testCases := []testCase{
+		{
+			"Suitable",
+			claims([]string{"https://se.example.org:2880"}, "storage.create:/store/user"),
+			"https://se.example.org:2880/store/user/x", disc.OperationCreate, "", nil,
+		},
+		{
+			"Modify implies create",
+			claims([]string{"https://se.example.org:2880"}, "storage.modify:/store"),
+			"https://se.example.org:2880/store/user/x", disc.OperationCreate, "", nil,
+		},
+		{
+			"Mismatched port",
+			claims([]string{"https://se.example.org:2881"}, "storage.create:/store"),
+			"https://se.example.org:2880/store/user/x", disc.OperationCreate, "",
+			[]string{"audience"},
+		},
+		{
+			"Default port in audience",
+			claims([]string{"https://SE.example.org:443"}, "storage.read:/"),
+			"https://se.example.org/store/file", disc.OperationRead, "", nil,
+		},
+		{
+			"Default port in endpoint",
+			claims([]string{"https://se.example.org"}, "storage.read:/"),
+			"davs://se.example.org:443/store/file", disc.OperationRead, "", nil,
+		},
+		{
+			"Default port is not another port",
+			claims([]string{"https://se.example.org"}, "storage.read:/"),
+			"https://se.example.org:2880/store/file", disc.OperationRead, "",
+			[]string{"audience"},
+		},
+		{
+			"Mismatched scheme",
+			claims([]string{"http://se.example.org:2880"}, "storage.read:/"),
+			"https://se.example.org:2880/store/file", disc.OperationRead, "",
+			[]string{"audience"},
+		},
+		{
+			"Audience without scheme",
+			claims([]string{"se.example.org:2880"}, "storage.read:/"),
+			"https://se.example.org:2880/store/file", disc.OperationRead, "", nil,
+		},
+		{
+			"Any audience",
+			claims([]string{"https://other.example", disc.AudienceAny}, "storage.read:/"),
+			"root://xrootd.example.org//store/file", disc.OperationRead, "", nil,
+		},
+		{
+			"No audience",
+			claims(nil, "storage.read:/"),
+			"https://se.example.org/store/file", disc.OperationRead, "",
+			[]string{"no audience"},
+		},
+		{
+			"Relative path",
+			claims([]string{"https://se.example.org:2880"}, "storage.create:/store/user/x"),
+			"https://se.example.org:2880/store/user", disc.OperationCreate, "x/file", nil,
+		},
+		{
+			"Absolute path",
+			claims([]string{"https://se.example.org:2880"}, "storage.create:/user/x"),
+			"https://se.example.org:2880/webdav", disc.OperationCreate, "/user/x/file", nil,
+		},
+		{
+			"Path escaping the scope",
+			claims([]string{"https://se.example.org:2880"}, "storage.create:/store/user/x"),
+			"https://se.example.org:2880/store/user/x", disc.OperationCreate, "../y",
+			[]string{"no storage scope allows create on /store/user/y"},
+		},
+		{
+			"Read-only token",
+			claims([]string{"https://se.example.org:2880"}, "storage.read:/store"),
+			"https://se.example.org:2880/store/user/x", disc.OperationCreate, "",
+			[]string{"no storage scope allows create"},
+		},
+		{
+			"Expired, without scopes, for another endpoint",
+			disc.WLCGClaims{Aud: []string{"https://other.example"}, Exp: now.Add(-time.Minute)},
+			"https://se.example.org:2880/store/user/x", disc.OperationRead, "",
+			[]string{"audience", "no storage scope", "expired"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				endpoint, err := url.Parse(tc.endpoint)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ok, reasons := disc.SuitableFor(tc.claims, endpoint, tc.op, tc.path, now, 0)
+				if ok != (len(tc.reasons) == 0) {
+					t.Errorf("Expected suitable to be %t, got %t", len(tc.reasons) == 0, ok)
+				}
+				if len(reasons) != len(tc.reasons) {
+					t.Fatalf("Reasons do not match.  Expected %q, got %q", tc.reasons, reasons)
+				}
+				for i := range reasons {
+					if !strings.Contains(reasons[i], tc.reasons[i]) {
+						t.Errorf("Reasons do not match.  Expected %q, got %q", tc.reasons[i], reasons[i])
+					}
+				}
+			},
+		)
+	}
+}
+
+func TestSuitableForTimes(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	endpoint, err := url.Parse("https://se.example.org/store")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type testCase struct {
+		description string
+		exp         time.Time
+		nbf         time.Time
+		leeway      time.Duration
+		reason      string
+	}
+
+	testCases := []testCase{
+		{"Valid", now.Add(time.Hour), now.Add(-time.Hour), 0, ""},
+		{"Expiring now", now, time.Time{}, 0, "expired"},
+		{"Expired within leeway", now.Add(-30 * time.Second), time.Time{}, time.Minute, ""},
+		{"Expired beyond leeway", now.Add(-time.Minute), time.Time{}, time.Minute, "expired"},
+		{"Not yet valid", now.Add(time.Hour), now.Add(time.Second), 0, "not valid until"},
+		{"Not yet valid within leeway", now.Add(time.Hour), now.Add(30 * time.Second), time.Minute, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				claims := disc.WLCGClaims{
+					Aud:   []string{disc.AudienceAny},
+					Scope: []string{"storage.read:/"},
+					Exp:   tc.exp,
+					Nbf:   tc.nbf,
+				}
+				ok, reasons := disc.SuitableFor(claims, endpoint, disc.OperationRead, "", now, tc.leeway)
+				if tc.reason == "" && !ok {
+					t.Errorf("Expected token to be suitable, got reasons %q", reasons)
+				}
+				if tc.reason != "" && (ok || len(reasons) != 1 || !strings.Contains(reasons[0], tc.reason)) {
+					t.Errorf("Reasons do not match.  Expected %q, got %q", tc.reason, reasons)
+				}
+
+				// The Discoverer uses its own clock and leeway
+				d, err := disc.New(disc.WithClock(func() time.Time { return now }), disc.WithLeeway(tc.leeway))
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				if dOK, _ := d.SuitableFor(claims, endpoint, disc.OperationRead, ""); dOK != ok {
+					t.Errorf("Expected the Discoverer to report suitable %t, got %t", ok, dOK)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,45 @@
+package tokendiscovery
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// ErrSymlinkRejected indicates that a token file was not read because it is a symlink. Since /tmp is world-writable,
+// any local user can plant /tmp/bt_u$ID as a symlink to some other file readable by the victim, whose contents would
+// then be used as the token. Step 4 of the discovery procedure therefore does not follow symlinks, unless
+// WithFollowSymlinks is given, and continues as if the token file were missing.
+var ErrSymlinkRejected = errors.New("token file is a symlink")
+
+// WithFollowSymlinks makes step 4 of the discovery procedure follow a symlink at /tmp/bt_u$ID, as the other steps do.
+// The other steps read from locations controlled by the user, so they always follow symlinks.
+func WithFollowSymlinks() Option {
+	return func(d *Discoverer) error {
+		d.followSymlinks = true
+		return nil
+	}
+}
+
+// readTokenFileNoFollow reads the token file at path through fsys, without following a symlink at path unless the
+// Discoverer is configured to. Symlinks are only detected on the OS filesystem, since fs.FS does not expose them.
+func readTokenFileNoFollow(ctx context.Context, fsys FileReader, path string) ([]byte, error) {
+	if d, ok := fsys.(*Discoverer); ok {
+		return d.readTokenFile(ctx, path, d.followSymlinks)
+	}
+	return fsys.ReadTokenFile(ctx, path)
+}
+
+// openRejectingSymlinks opens the named file for reading, failing with an error wrapping ErrSymlinkRejected if it is a
+// symlink
+func openRejectingSymlinks(name string) (*os.File, error) {
+	f, err := openNoFollow(name)
+	if err != nil {
+		if info, lstatErr := os.Lstat(name); lstatErr == nil && info.Mode()&fs.ModeSymlink != 0 {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: ErrSymlinkRejected}
+		}
+		return nil, err
+	}
+	return f, nil
+}
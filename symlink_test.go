@@ -0,0 +1,96 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestSymlinkedTokenFile(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "secret")
+	if err := os.WriteFile(target, []byte("secret_contents"), 0o600); err != nil {
+		t.Fatalf("Could not create file: %s", err)
+	}
+	tmpDir := filepath.Join(dir, "tmp")
+	xdgDir := filepath.Join(dir, "run")
+	for _, d := range []string{tmpDir, xdgDir} {
+		if err := os.Mkdir(d, 0o700); err != nil {
+			t.Fatalf("Could not create directory: %s", err)
+		}
+		if err := os.Symlink(target, filepath.Join(d, "bt_u4242")); err != nil {
+			t.Skipf("Could not create symlink: %s", err)
+		}
+	}
+
+	type testCase struct {
+		description   string
+		env           map[string]string
+		opts          []disc.Option
+		expectedToken string
+		expectedErr   error
+	}
+
+	testCases := []testCase{
+		{
+			"Symlink in fallback directory is rejected",
+			map[string]string{},
+			nil,
+			"",
+			disc.ErrSymlinkRejected,
+		},
+		{
+			"Symlink in fallback directory is followed with WithFollowSymlinks",
+			map[string]string{},
+			[]disc.Option{disc.WithFollowSymlinks()},
+			"secret_contents",
+			nil,
+		},
+		{
+			"Symlink in XDG_RUNTIME_DIR is followed",
+			map[string]string{"XDG_RUNTIME_DIR": xdgDir},
+			nil,
+			"secret_contents",
+			nil,
+		},
+		{
+			"Symlink named by BEARER_TOKEN_FILE is followed",
+			map[string]string{"BEARER_TOKEN_FILE": filepath.Join(tmpDir, "bt_u4242")},
+			nil,
+			"secret_contents",
+			nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := append([]disc.Option{disc.WithEnvMap(tc.env), disc.WithUID("4242"), disc.WithFallbackDir(tmpDir), disc.WithoutOwnershipCheck()}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, err := d.FindToken()
+				if tc.expectedErr != nil {
+					if !errors.Is(err, tc.expectedErr) {
+						t.Errorf("Expected error %s, got %v", tc.expectedErr, err)
+					}
+					if !errors.Is(err, disc.ErrNoTokenFound) {
+						t.Errorf("Expected error %s, got %v", disc.ErrNoTokenFound, err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if string(tok) != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, string(tok))
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,77 @@
+package tokendiscovery
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ErrMalformedToken indicates that a discovered token does not follow the b64token syntax of RFC 6750, and so cannot be
+// sent in an Authorization header
+var ErrMalformedToken = errors.New("token is not a valid RFC 6750 bearer token")
+
+// WithSyntaxValidation makes discovery check every token it finds against the b64token syntax of RFC 6750: letters,
+// digits, and the characters "-._~+/", followed by any number of "=". A token that does not match, for example because
+// it contains interior spaces or control characters, is treated like an empty one: the step is skipped and discovery
+// continues with the next step. If no step produces a valid token, the error returned by discovery wraps both
+// ErrMalformedToken and ErrNoTokenFound, and gives the offset of the first offending byte. Without this option, tokens
+// are returned as found.
+func WithSyntaxValidation() Option {
+	return func(d *Discoverer) error {
+		d.validateSyntax = true
+		return nil
+	}
+}
+
+// WithoutBearerPrefixStripping keeps a leading "Bearer " on discovered tokens. By default, since users often copy the
+// whole value of an Authorization header into BEARER_TOKEN or a token file, a case-insensitive "Bearer" followed by
+// whitespace is removed from the start of the token, and a warning is recorded on the Result. A token consisting only
+// of "Bearer" is then empty, so discovery continues with the next step.
+func WithoutBearerPrefixStripping() Option {
+	return func(d *Discoverer) error {
+		d.keepBearerPrefix = true
+		return nil
+	}
+}
+
+// bearerScheme is the authentication scheme of RFC 6750, which precedes the token in an Authorization header
+const bearerScheme = "Bearer"
+
+// stripBearerPrefix returns tok without a leading "Bearer" authentication scheme, and reports whether there was one
+func stripBearerPrefix(tok []byte) ([]byte, bool) {
+	if len(tok) < len(bearerScheme) || !bytes.EqualFold(tok[:len(bearerScheme)], []byte(bearerScheme)) {
+		return tok, false
+	}
+	rest := tok[len(bearerScheme):]
+	if len(rest) > 0 && rest[0] != ' ' && rest[0] != '\t' {
+		return tok, false
+	}
+	return bytes.TrimSpace(rest), true
+}
+
+// checkTokenSyntax returns an error wrapping ErrMalformedToken if tok does not match the b64token syntax of RFC 6750.
+// The token itself is not included in the error.
+func checkTokenSyntax(tok []byte) error {
+	padding := false
+	for i, b := range tok {
+		switch {
+		case b == '=' && i > 0:
+			padding = true
+		case !padding && isB64TokenChar(b):
+		default:
+			return fmt.Errorf("%w: unexpected byte at offset %d", ErrMalformedToken, i)
+		}
+	}
+	return nil
+}
+
+// isB64TokenChar reports whether b may appear before the padding of a b64token
+func isB64TokenChar(b byte) bool {
+	switch {
+	case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9':
+		return true
+	case b == '-', b == '.', b == '_', b == '~', b == '+', b == '/':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestSyntaxValidation(t *testing.T) {
+	fsys := fstest.MapFS{"tmp/bt_u4242": {Data: []byte("tmp_token")}}
+
+	type testCase struct {
+		description    string
+		token          string
+		validate       bool
+		expectedToken  string
+		expectedOffset string
+	}
+
+	testCases := []testCase{
+		{"Valid token", "abc.DEF-123_~+/", true, "abc.DEF-123_~+/", ""},
+		{"Valid token with padding", "abc==", true, "abc==", ""},
+		{"Interior space, lenient", "4 2", false, "4 2", ""},
+		{"Interior space", "4 2", true, "tmp_token", "offset 1"},
+		{"Control character", "a\x01b", true, "tmp_token", "offset 1"},
+		{"Character after padding", "ab=c", true, "tmp_token", "offset 3"},
+		{"Padding only", "==", true, "tmp_token", "offset 0"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := []disc.Option{
+					disc.WithEnvMap(map[string]string{"BEARER_TOKEN": tc.token}),
+					disc.WithFS(fsys),
+					disc.WithUID("4242"),
+				}
+				if tc.validate {
+					opts = append(opts, disc.WithSyntaxValidation())
+				}
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, err := d.FindToken()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if string(tok) != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %q, got %q", tc.expectedToken, string(tok))
+				}
+
+				if tc.expectedOffset == "" {
+					return
+				}
+				// Without the fallback token, the malformed token is reported in the final error
+				d, err = disc.New(append(opts, disc.WithoutTmpFallback())...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				_, err = d.FindToken()
+				if !errors.Is(err, disc.ErrMalformedToken) {
+					t.Errorf("Expected error %s, got %v", disc.ErrMalformedToken, err)
+				}
+				if !errors.Is(err, disc.ErrNoTokenFound) {
+					t.Errorf("Expected error %s, got %v", disc.ErrNoTokenFound, err)
+				}
+				if err != nil && !strings.Contains(err.Error(), tc.expectedOffset) {
+					t.Errorf("Expected error to mention %q, got %s", tc.expectedOffset, err)
+				}
+				if err != nil && strings.Contains(err.Error(), tc.token) {
+					t.Errorf("Expected error not to contain the token, got %s", err)
+				}
+			},
+		)
+	}
+}
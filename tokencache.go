@@ -0,0 +1,145 @@
+package tokendiscovery
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// DefaultTokenCacheSize is the number of tokens whose parsed claims and verification outcomes are kept unless set
+// otherwise with SetTokenCacheSize
+const DefaultTokenCacheSize = 1024
+
+// SetTokenCacheSize sets the number of tokens whose parsed claims are kept, so that functions such as HasScope,
+// CheckValidity and Result.ExpiresAt, as well as Verify, do not parse or verify the same token again each time they
+// are called with it. Tokens are identified by the SHA-256 digest of their contents, and forgotten when their exp
+// claim passes, or to make room for others. A size of 0 or less disables the cache, for programs that cannot spare
+// the memory. It is DefaultTokenCacheSize by default.
+func SetTokenCacheSize(size int) {
+	tokenCache.setSize(size)
+}
+
+// tokenCache holds the parsed claims and verification outcomes of tokens
+var tokenCache = &claimsCache{size: DefaultTokenCacheSize, entries: make(map[[sha256.Size]byte]claimsCacheEntry)}
+
+// claimsCache holds the parsed claims and verification outcomes of tokens, by the SHA-256 digest of their contents
+type claimsCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[[sha256.Size]byte]claimsCacheEntry
+}
+
+// claimsCacheEntry is an entry of a claimsCache. Its claims are shared, so they must not be modified.
+type claimsCacheEntry struct {
+	claims Claims
+	err    error
+	// exp is when the entry must be forgotten, or zero if never
+	exp time.Time
+	// verifiedWith is the key set that Verify found the signature of the token to be valid with, using alg
+	verifiedWith *JWKSet
+	alg          string
+}
+
+// claimsCacheKey returns the key of tok in a claimsCache
+func claimsCacheKey(tok []byte) [sha256.Size]byte {
+	return sha256.Sum256(bytes.TrimSpace(tok))
+}
+
+// get returns the entry for key, if c has one that has not expired
+func (c *claimsCache) get(key [sha256.Size]byte) (claimsCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if ok && entry.expired(time.Now()) {
+		delete(c.entries, key)
+		return claimsCacheEntry{}, false
+	}
+	return entry, ok
+}
+
+// put records entry for key, unless c is disabled or entry has expired
+func (c *claimsCache) put(key [sha256.Size]byte, entry claimsCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size <= 0 || entry.expired(time.Now()) {
+		return
+	}
+	if _, ok := c.entries[key]; !ok {
+		c.shrink(c.size - 1)
+	}
+	c.entries[key] = entry
+}
+
+// setSize sets the number of entries kept by c, removing those that no longer fit
+func (c *claimsCache) setSize(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size = size
+	c.shrink(max(size, 0))
+}
+
+// shrink removes entries from c until it holds at most n, expired ones first, then arbitrary ones. c.mu must be held.
+func (c *claimsCache) shrink(n int) {
+	if len(c.entries) <= n {
+		return
+	}
+	now := time.Now()
+	for key, entry := range c.entries {
+		if entry.expired(now) {
+			delete(c.entries, key)
+		}
+	}
+	for key := range c.entries {
+		if len(c.entries) <= n {
+			break
+		}
+		delete(c.entries, key)
+	}
+}
+
+// expired reports whether e must be forgotten at now
+func (e claimsCacheEntry) expired(now time.Time) bool {
+	return !e.exp.IsZero() && !now.Before(e.exp)
+}
+
+// parseClaimsCached is like ParseClaims, but returns claims shared through tokenCache, which must not be modified
+func parseClaimsCached(tok []byte) (Claims, error) {
+	key := claimsCacheKey(tok)
+	if entry, ok := tokenCache.get(key); ok {
+		return entry.claims, entry.err
+	}
+	claims, err := ParseClaims(tok)
+	entry := claimsCacheEntry{claims: claims, err: err}
+	entry.exp, _ = claims.Expiry()
+	tokenCache.put(key, entry)
+	return claims, err
+}
+
+// clone returns a copy of c that shares nothing with it, for returning claims held by tokenCache to callers
+func (c Claims) clone() Claims {
+	if c == nil {
+		return nil
+	}
+	return cloneJSON(map[string]any(c)).(map[string]any)
+}
+
+// cloneJSON returns a deep copy of v, a value decoded from JSON
+func cloneJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, val := range v {
+			m[key] = cloneJSON(val)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, val := range v {
+			s[i] = cloneJSON(val)
+		}
+		return s
+	default:
+		return v
+	}
+}
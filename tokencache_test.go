@@ -0,0 +1,273 @@
+package tokendiscovery_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+// withTokenCacheSize sets the size of the token cache, emptying it, until the end of the test
+func withTokenCacheSize(tb testing.TB, size int) {
+	disc.SetTokenCacheSize(0)
+	disc.SetTokenCacheSize(size)
+	tb.Cleanup(func() { disc.SetTokenCacheSize(disc.DefaultTokenCacheSize) })
+}
+
+func TestTokenCache(t *testing.T) {
+	now := time.Now()
+	tok := func(i int, exp time.Time) []byte {
+		return []byte(makeJWT(t, map[string]any{"sub": fmt.Sprint(i), "scope": "storage.read:/", "exp": exp.Unix()}))
+	}
+
+	t.Run(
+		"Bounded size",
+		func(t *testing.T) {
+			withTokenCacheSize(t, 2)
+			for i := 0; i < 3; i++ {
+				if _, err := disc.HasScope(tok(i, now.Add(time.Hour)), "storage.read:/"); err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+			}
+			if n := disc.TokenCacheLen(); n != 2 {
+				t.Errorf("Cache sizes do not match.  Expected 2, got %d", n)
+			}
+		},
+	)
+	t.Run(
+		"Expired tokens are not kept",
+		func(t *testing.T) {
+			withTokenCacheSize(t, 2)
+			if _, err := disc.HasScope(tok(0, now.Add(-time.Hour)), "storage.read:/"); err != nil {
+				t.Fatalf("Expected nil error, got %v", err)
+			}
+			if n := disc.TokenCacheLen(); n != 0 {
+				t.Errorf("Cache sizes do not match.  Expected 0, got %d", n)
+			}
+		},
+	)
+	t.Run(
+		"Tokens are forgotten when they expire",
+		func(t *testing.T) {
+			withTokenCacheSize(t, 2)
+			exp := time.Unix(time.Now().Unix()+1, 0)
+			expiring := tok(0, exp)
+			if _, ok := disc.NewResult(expiring, "").ExpiresAt(); !ok {
+				t.Fatal("Expected the token to have an expiry")
+			}
+			if n := disc.TokenCacheLen(); n != 1 {
+				t.Fatalf("Cache sizes do not match.  Expected 1, got %d", n)
+			}
+			time.Sleep(time.Until(exp))
+			// The expired entry makes way for a new one
+			if _, err := disc.HasScope(tok(1, now.Add(time.Hour)), "storage.read:/"); err != nil {
+				t.Fatalf("Expected nil error, got %v", err)
+			}
+			if _, err := disc.HasScope(tok(2, now.Add(time.Hour)), "storage.read:/"); err != nil {
+				t.Fatalf("Expected nil error, got %v", err)
+			}
+			if ok, err := disc.HasScope(tok(1, now.Add(time.Hour)), "storage.read:/"); !ok || err != nil {
+				t.Fatalf("Expected true and nil error, got %t and %v", ok, err)
+			}
+			if n := disc.TokenCacheLen(); n != 2 {
+				t.Errorf("Cache sizes do not match.  Expected 2, got %d", n)
+			}
+		},
+	)
+	t.Run(
+		"Disabled",
+		func(t *testing.T) {
+			withTokenCacheSize(t, 0)
+			if ok, err := disc.HasScope(tok(0, now.Add(time.Hour)), "storage.read:/"); !ok || err != nil {
+				t.Fatalf("Expected true and nil error, got %t and %v", ok, err)
+			}
+			if n := disc.TokenCacheLen(); n != 0 {
+				t.Errorf("Cache sizes do not match.  Expected 0, got %d", n)
+			}
+		},
+	)
+}
+
+func TestVerifyCached(t *testing.T) {
+	withTokenCacheSize(t, disc.DefaultTokenCacheSize)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := disc.ParseJWKS(jwksJSON(map[string]*rsa.PrivateKey{"rsa1": key}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKeys, err := disc.ParseJWKS(jwksJSON(map[string]*rsa.PrivateKey{"rsa1": otherKey}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	tok := []byte(signJWT(t, key, map[string]any{"alg": "RS256", "kid": "rsa1"}, map[string]any{
+		"sub": "user",
+		"aud": []string{"https://storage.example"},
+		"nbf": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}))
+
+	claims, err := disc.Verify(tok, keys)
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	// Changes to the claims returned must not reach the cache
+	claims["sub"] = "attacker"
+	claims["aud"].([]any)[0] = "https://attacker.example"
+
+	type testCase struct {
+		description string
+		keys        *disc.JWKSet
+		opts        []disc.VerifyOption
+		expectedErr error
+	}
+
+	testCases := []testCase{
+		{"Same keys", keys, nil, nil},
+		{"Other keys", otherKeys, nil, disc.ErrInvalidSignature},
+		{"Algorithm no longer allowed", keys, []disc.VerifyOption{disc.VerifyAlgorithms("ES256")}, disc.ErrAlgorithmNotAllowed},
+		{"Expired by then", keys, []disc.VerifyOption{disc.VerifyAt(now.Add(2 * time.Hour))}, disc.ErrTokenExpired},
+		{"Not yet valid then", keys, []disc.VerifyOption{disc.VerifyAt(now.Add(-time.Hour))}, disc.ErrTokenNotYetValid},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				claims, err := disc.Verify(tok, tc.keys, tc.opts...)
+				if !errors.Is(err, tc.expectedErr) {
+					t.Fatalf("Errors do not match.  Expected %v, got %v", tc.expectedErr, err)
+				}
+				if err != nil {
+					return
+				}
+				if claims.Subject() != "user" {
+					t.Errorf("Subjects do not match.  Expected user, got %s", claims.Subject())
+				}
+				if !claims.HasAudience("https://storage.example") {
+					t.Errorf("Expected audience https://storage.example, got %v", claims.Audience())
+				}
+			},
+		)
+	}
+}
+
+// TestTokenCacheConcurrent is meant to be run with the race detector
+func TestTokenCacheConcurrent(t *testing.T) {
+	withTokenCacheSize(t, 8)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := disc.ParseJWKS(jwksJSON(map[string]*rsa.PrivateKey{"rsa1": key}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	var toks [][]byte
+	for i := 0; i < 16; i++ {
+		toks = append(toks, []byte(signJWT(t, key, map[string]any{"alg": "RS256", "kid": "rsa1"}, map[string]any{
+			"sub":   fmt.Sprint(i),
+			"scope": "storage.read:/",
+			"aud":   []string{"https://storage.example"},
+			"exp":   now.Add(time.Hour).Unix(),
+		})))
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				tok := toks[(g+i)%len(toks)]
+				if ok, err := disc.HasScope(tok, "storage.read:/"); !ok || err != nil {
+					t.Errorf("Expected true and nil error, got %t and %v", ok, err)
+				}
+				if _, ok := disc.NewResult(tok, "").ExpiresAt(); !ok {
+					t.Error("Expected the token to have an expiry")
+				}
+				claims, err := disc.Verify(tok, keys)
+				if err != nil {
+					t.Errorf("Expected nil error, got %v", err)
+					continue
+				}
+				claims["sub"] = "changed"
+				claims["aud"].([]any)[0] = "changed"
+				if i%10 == 0 {
+					disc.SetTokenCacheSize(4 + i%8)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkHasScope(b *testing.B) {
+	tok := []byte(makeJWT(b, map[string]any{
+		"sub":   "user",
+		"scope": "storage.read:/ storage.create:/data compute.read",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}))
+	for _, bc := range []struct {
+		description string
+		size        int
+	}{
+		{"Cached", disc.DefaultTokenCacheSize},
+		{"Uncached", 0},
+	} {
+		b.Run(bc.description, func(b *testing.B) {
+			withTokenCacheSize(b, bc.size)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if ok, err := disc.HasScope(tok, "compute.read"); !ok || err != nil {
+					b.Fatalf("Expected true and nil error, got %t and %v", ok, err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkVerify(b *testing.B) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		b.Fatal(err)
+	}
+	keys, err := disc.ParseJWKS(jwksJSON(map[string]*rsa.PrivateKey{"rsa1": key}))
+	if err != nil {
+		b.Fatal(err)
+	}
+	tok := []byte(signJWT(b, key, map[string]any{"alg": "RS256", "kid": "rsa1"}, map[string]any{
+		"sub": "user",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}))
+	for _, bc := range []struct {
+		description string
+		size        int
+	}{
+		{"Cached", disc.DefaultTokenCacheSize},
+		{"Uncached", 0},
+	} {
+		b.Run(bc.description, func(b *testing.B) {
+			withTokenCacheSize(b, bc.size)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := disc.Verify(tok, keys); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package tokendiscovery
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// WithoutTokenResponseExtraction makes discovery use token files containing a JSON OAuth token response as they are. By
+// default, since tools such as htgettoken and oidc-agent can save the whole token response, a token file that parses
+// as a JSON object with an access_token string field yields the value of that field, and a warning is recorded on the
+// Result. Files that merely start with "{" but are not valid JSON are used as they are either way.
+func WithoutTokenResponseExtraction() Option {
+	return func(d *Discoverer) error {
+		d.keepTokenResponse = true
+		return nil
+	}
+}
+
+// accessTokenFromResponse returns the access_token field of contents, if contents is a JSON OAuth token response
+func accessTokenFromResponse(contents []byte) ([]byte, bool) {
+	if len(contents) == 0 || contents[0] != '{' {
+		return nil, false
+	}
+	var resp struct {
+		AccessToken *string `json:"access_token"`
+	}
+	if err := json.Unmarshal(contents, &resp); err != nil || resp.AccessToken == nil {
+		return nil, false
+	}
+	return bytes.TrimSpace([]byte(*resp.AccessToken)), true
+}
@@ -0,0 +1,91 @@
+package tokendiscovery_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+const tokenResponse = `{
+  "access_token": "eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiJ1c2VyIn0.c2ln",
+  "token_type": "Bearer",
+  "expires_in": 10800,
+  "refresh_token": "eyJhbGciOiJub25lIn0.eyJyZWZyZXNoIjp0cnVlfQ.",
+  "scope": "openid storage.read:/"
+}
+`
+
+func TestTokenResponseExtraction(t *testing.T) {
+	type testCase struct {
+		description   string
+		contents      string
+		opts          []disc.Option
+		expectedToken string
+		expectedWarn  bool
+	}
+
+	testCases := []testCase{
+		{
+			"Token response",
+			tokenResponse,
+			nil,
+			"eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiJ1c2VyIn0.c2ln",
+			true,
+		},
+		{
+			"Token response, extraction disabled",
+			tokenResponse,
+			[]disc.Option{disc.WithoutTokenResponseExtraction(), disc.WithWholeFileContents()},
+			tokenResponse[:len(tokenResponse)-1],
+			false,
+		},
+		{
+			"Malformed JSON is an opaque token",
+			`{"access_token": "abc"`,
+			nil,
+			`{"access_token": "abc"`,
+			false,
+		},
+		{
+			"JSON without access_token is an opaque token",
+			`{"id_token":"abc"}`,
+			nil,
+			`{"id_token":"abc"}`,
+			false,
+		},
+		{
+			"Plain token",
+			"eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiJ1c2VyIn0.c2ln\n",
+			nil,
+			"eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiJ1c2VyIn0.c2ln",
+			false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := append([]disc.Option{
+					disc.WithEnvMap(map[string]string{"BEARER_TOKEN_FILE": "/home/user/token.json"}),
+					disc.WithFS(fstest.MapFS{"home/user/token.json": {Data: []byte(tc.contents)}}),
+				}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				res, err := d.Discover()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if string(res.Bytes()) != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %q, got %q", tc.expectedToken, string(res.Bytes()))
+				}
+				if warned := len(res.Warnings()) > 0; warned != tc.expectedWarn {
+					t.Errorf("Expected warning to be %t, got warnings %q", tc.expectedWarn, res.Warnings())
+				}
+			},
+		)
+	}
+}
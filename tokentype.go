@@ -0,0 +1,113 @@
+package tokendiscovery
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+)
+
+// TokenType is the format of a bearer token, as returned by DetectTokenType
+type TokenType int
+
+const (
+	// TypeOpaque is the TokenType of tokens in no format known to DetectTokenType, which only their issuer can make
+	// sense of, for example with Introspect
+	TypeOpaque TokenType = iota
+	// TypeJWT is the TokenType of JWTs, whose claims can be read with ParseClaims
+	TypeJWT
+	// TypeMacaroon is the TokenType of macaroons, such as those issued by dCache
+	TypeMacaroon
+)
+
+// String returns the name of t
+func (t TokenType) String() string {
+	switch t {
+	case TypeJWT:
+		return "JWT"
+	case TypeMacaroon:
+		return "macaroon"
+	default:
+		return "opaque"
+	}
+}
+
+// DetectTokenType returns the format of tok, with surrounding whitespace removed: TypeJWT if it has three
+// dot-separated base64url segments, the first of which is a JSON object; TypeMacaroon if it is base64-encoded in the
+// version 1 or 2 binary format of libmacaroons; or TypeOpaque otherwise. Only the structure of tok is examined, so
+// that, for example, a JWT may still have claims ParseClaims rejects.
+func DetectTokenType(tok []byte) TokenType {
+	tok = bytes.TrimSpace(tok)
+	if header, _, _, err := splitJWT(tok); err == nil {
+		if _, err := decodeSegment(header); err == nil {
+			return TypeJWT
+		}
+		return TypeOpaque
+	}
+	if isMacaroon(tok) {
+		return TypeMacaroon
+	}
+	return TypeOpaque
+}
+
+// isMacaroon reports whether tok is a base64-encoded macaroon in the version 1 or 2 binary format. Both the standard
+// and URL-safe alphabets are accepted, with or without padding.
+func isMacaroon(tok []byte) bool {
+	tok = bytes.TrimRight(tok, "=")
+	data := make([]byte, base64.RawURLEncoding.DecodedLen(len(tok)))
+	n, err := base64.RawURLEncoding.Decode(data, tok)
+	if err != nil {
+		if n, err = base64.RawStdEncoding.Decode(data, tok); err != nil {
+			return false
+		}
+	}
+	data = data[:n]
+
+	if len(data) > 0 && data[0] == 2 {
+		return isMacaroonV2(data[1:])
+	}
+	// Version 1 is a sequence of packets, each starting with its length as four hex digits, the first of which is the
+	// location or the identifier
+	if len(data) < 4 {
+		return false
+	}
+	for _, c := range data[:4] {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	rest := data[4:]
+	return bytes.HasPrefix(rest, []byte("location ")) || bytes.HasPrefix(rest, []byte("identifier "))
+}
+
+// isMacaroonV2 reports whether data, following the version byte, starts like a macaroon in the version 2 binary format:
+// with the optional location field (type 1), then the identifier field (type 2), each with its length as a varint
+func isMacaroonV2(data []byte) bool {
+	for _, field := range []uint64{1, 2} {
+		typ, n := binary.Uvarint(data)
+		if n <= 0 {
+			return false
+		}
+		if typ != field {
+			if field == 1 {
+				continue
+			}
+			return false
+		}
+		size, m := binary.Uvarint(data[n:])
+		if m <= 0 || size > uint64(len(data)-n-m) {
+			return false
+		}
+		data = data[n+m+int(size):]
+	}
+	return true
+}
+
+// TokenType returns the format of the token of r, as described for DetectTokenType. It is detected the first time it
+// is needed, and the result shared by copies of r.
+func (r Result) TokenType() TokenType {
+	if r.cache == nil {
+		return DetectTokenType(r.token)
+	}
+	r.cache.tokenTypeOnce.Do(func() { r.cache.tokenType = DetectTokenType(r.token) })
+	return r.cache.tokenType
+}
@@ -0,0 +1,110 @@
+package tokendiscovery_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"math/rand/v2"
+	"testing"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+// macaroonV2 returns a macaroon in the version 2 binary format, with a location unless it is empty, an identifier and
+// a signature
+func macaroonV2(location, id string) []byte {
+	field := func(typ byte, data string) []byte {
+		return append([]byte{typ, byte(len(data))}, data...)
+	}
+	m := []byte{2}
+	if location != "" {
+		m = append(m, field(1, location)...)
+	}
+	m = append(m, field(2, id)...)
+	m = append(m, 0, 0)
+	return append(m, field(6, string(make([]byte, 32)))...)
+}
+
+func TestDetectTokenType(t *testing.T) {
+	type testCase struct {
+		description string
+		tok         []byte
+		expected    disc.TokenType
+	}
+
+	testCases := []testCase{
+		{"JWT", encodeJWT(`{"alg":"RS256","kid":"rsa1"}`, `{"sub":"user"}`, false), disc.TypeJWT},
+		{"Padded JWT", encodeJWT(`{"alg":"ES256"}`, `{"sub":"user"}`, true), disc.TypeJWT},
+		{"JWT without signature", bytes.TrimSuffix(encodeJWT(`{"alg":"none"}`, `{"sub":"user"}`, false), []byte("c2lnbmF0dXJl")), disc.TypeJWT},
+		{"JWT with surrounding whitespace", append(append([]byte("\n "), encodeJWT(`{"typ":"at+jwt"}`, `{}`, false)...), '\n'), disc.TypeJWT},
+		{"Three segments without JSON header", []byte("abc.def.ghi"), disc.TypeOpaque},
+		{"Version 1 macaroon", []byte("MDAxY2xvY2F0aW9uIGh0dHA6Ly9teWJhbmsvCjAwMjZpZGVudGlmaWVyIHdlIHVzZWQgb3VyIHNlY3JldCBrZXkKMDAyZnNpZ25hdHVyZSDj2eApCFJsTAA5rhURQRXZf91ovyujebNCqvD2F9BVLwo"), disc.TypeMacaroon},
+		{"Version 2 macaroon", []byte(base64.RawURLEncoding.EncodeToString(macaroonV2("https://dcache.example:2880", "a1b2c3d4"))), disc.TypeMacaroon},
+		{"Version 2 macaroon, standard base64", []byte(base64.StdEncoding.EncodeToString(macaroonV2("https://dcache.example:2880", "a1b2c3d4+/"))), disc.TypeMacaroon},
+		{"Version 2 macaroon without location", []byte(base64.RawURLEncoding.EncodeToString(macaroonV2("", "a1b2c3d4"))), disc.TypeMacaroon},
+		{"Unknown macaroon version", []byte(base64.RawURLEncoding.EncodeToString(append([]byte{3}, macaroonV2("https://dcache.example:2880", "a1b2c3d4")[1:]...))), disc.TypeOpaque},
+		{"Truncated version 2 macaroon", []byte(base64.RawURLEncoding.EncodeToString(macaroonV2("https://dcache.example:2880", "a1b2c3d4")[:20])), disc.TypeOpaque},
+		{"Opaque token", []byte("2YotnFZFEjr1zCsicMWpAA"), disc.TypeOpaque},
+		{"Empty token", nil, disc.TypeOpaque},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				if got := disc.DetectTokenType(tc.tok); got != tc.expected {
+					t.Errorf("Token types do not match.  Expected %s, got %s", tc.expected, got)
+				}
+			},
+		)
+	}
+}
+
+func TestDetectTokenTypeRandom(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := 0; i < 10000; i++ {
+		tok := make([]byte, rng.IntN(256))
+		for j := range tok {
+			tok[j] = byte(rng.Uint32())
+		}
+		// Random bytes are almost never valid base64, let alone a JWT or a macaroon
+		if got := disc.DetectTokenType(tok); got != disc.TypeOpaque && len(tok) > 8 {
+			t.Errorf("Token types do not match for %q.  Expected %s, got %s", tok, disc.TypeOpaque, got)
+		}
+		// Base64-encoded random bytes must not cause a panic either
+		disc.DetectTokenType([]byte(base64.RawURLEncoding.EncodeToString(tok)))
+		disc.DetectTokenType([]byte("e30." + base64.RawURLEncoding.EncodeToString(tok) + ".x"))
+	}
+}
+
+func FuzzDetectTokenType(f *testing.F) {
+	f.Add(encodeJWT(`{"alg":"RS256"}`, `{"sub":"user"}`, false))
+	f.Add([]byte(base64.RawURLEncoding.EncodeToString(macaroonV2("https://dcache.example:2880", "a1b2c3d4"))))
+	f.Add([]byte("AgGAgICAgICAgICAAQ"))
+	f.Fuzz(func(t *testing.T, tok []byte) {
+		if typ := disc.DetectTokenType(tok); typ == disc.TypeJWT {
+			if _, err := disc.ParseHeader(tok); err != nil {
+				t.Errorf("Detected a JWT whose header cannot be parsed: %v", err)
+			}
+		}
+	})
+}
+
+func TestResultTokenType(t *testing.T) {
+	tok := string(encodeJWT(`{"alg":"RS256","kid":"rsa1"}`, `{"sub":"user"}`, false))
+	d, err := disc.New(disc.WithEnvMap(map[string]string{"BEARER_TOKEN": tok}))
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	res, err := d.Discover()
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if got := res.TokenType(); got != disc.TypeJWT {
+			t.Errorf("Token types do not match.  Expected %s, got %s", disc.TypeJWT, got)
+		}
+	}
+	if got := disc.NewResult([]byte("2YotnFZFEjr1zCsicMWpAA"), "").TokenType(); got != disc.TypeOpaque {
+		t.Errorf("Token types do not match.  Expected %s, got %s", disc.TypeOpaque, got)
+	}
+}
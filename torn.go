@@ -0,0 +1,40 @@
+package tokendiscovery
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+)
+
+// maxTornReadRetries is how many times a token file that changes while it is read is read again
+const maxTornReadRetries = 3
+
+// errFileChanged is returned with the contents read by readFileBlocking if the file changed while it was read
+var errFileChanged = errors.New("file changed while being read")
+
+// readFile reads the named file as described for readFileRetrying. Since a token file rewritten in place, rather than
+// replaced with a rename, can be read while only partly written, the file is read again if its size or modification
+// time changed during the read. Re-reads are reported as warnings on ctx. If the file is still changing after
+// maxTornReadRetries re-reads, the contents of the last read are returned.
+func (d *Discoverer) readFile(ctx context.Context, name string, followSymlinks bool) ([]byte, error) {
+	for retries := 0; ; retries++ {
+		b, err := d.readFileRetrying(ctx, name, followSymlinks)
+		switch {
+		case !errors.Is(err, errFileChanged):
+			if retries > 0 && err == nil {
+				addWarning(ctx, "re-read %s %d time(s) because it changed while being read", name, retries)
+			}
+			return b, err
+		case retries == maxTornReadRetries:
+			addWarning(ctx, "%s kept changing while being read; using the contents of the last of %d reads", name,
+				retries+1)
+			return b, nil
+		}
+		d.debug("token file changed while being read", "path", name)
+	}
+}
+
+// sameVersion reports whether before and after, taken around a read of a file, show the file unchanged
+func sameVersion(before, after fs.FileInfo) bool {
+	return before.Size() == after.Size() && before.ModTime().Equal(after.ModTime())
+}
@@ -0,0 +1,139 @@
+package tokendiscovery_test
+
+import (
+	"bytes"
+	"io/fs"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+// rewritingFS is an fs.FS serving a single token file that is rewritten in place while the first rewrites reads of it
+// are in progress, as when a token file is truncated and written while discovery reads it
+type rewritingFS struct {
+	rewrites int
+
+	mu      sync.Mutex
+	reads   int
+	version int
+}
+
+func (r *rewritingFS) Open(name string) (fs.File, error) {
+	return &rewrittenFile{fsys: r}, nil
+}
+
+// rewrittenFile is a file of rewritingFS
+type rewrittenFile struct {
+	fsys *rewritingFS
+	r    *bytes.Reader
+}
+
+func (f *rewrittenFile) Read(p []byte) (int, error) {
+	if f.r == nil {
+		f.fsys.mu.Lock()
+		f.fsys.reads++
+		if f.fsys.reads <= f.fsys.rewrites {
+			f.r = bytes.NewReader([]byte("eyJhbGciOi"))
+			f.fsys.version++
+		} else {
+			f.r = bytes.NewReader([]byte("eyJhbGciOiJub25lIn0.e30."))
+		}
+		f.fsys.mu.Unlock()
+	}
+	return f.r.Read(p)
+}
+
+func (f *rewrittenFile) Stat() (fs.FileInfo, error) {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+	return versionInfo(f.fsys.version), nil
+}
+
+func (f *rewrittenFile) Close() error { return nil }
+
+// versionInfo is the fs.FileInfo of a rewrittenFile, whose size and modification time change with every rewrite
+type versionInfo int
+
+func (v versionInfo) Name() string       { return "token" }
+func (v versionInfo) Size() int64        { return int64(v) }
+func (v versionInfo) Mode() fs.FileMode  { return 0o600 }
+func (v versionInfo) ModTime() time.Time { return time.Unix(int64(v), 0) }
+func (v versionInfo) IsDir() bool        { return false }
+func (v versionInfo) Sys() any           { return nil }
+
+func TestTornRead(t *testing.T) {
+	type testCase struct {
+		description     string
+		rewrites        int
+		expectedToken   string
+		expectedReads   int
+		expectedWarning string
+	}
+
+	testCases := []testCase{
+		{
+			"File unchanged during read",
+			0,
+			"eyJhbGciOiJub25lIn0.e30.",
+			1,
+			"",
+		},
+		{
+			"File rewritten during first read",
+			1,
+			"eyJhbGciOiJub25lIn0.e30.",
+			2,
+			"re-read /home/user/token 1 time(s)",
+		},
+		{
+			"File rewritten during three reads",
+			3,
+			"eyJhbGciOiJub25lIn0.e30.",
+			4,
+			"re-read /home/user/token 3 time(s)",
+		},
+		{
+			"File keeps changing",
+			10,
+			"eyJhbGciOi",
+			4,
+			"kept changing while being read",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				fsys := &rewritingFS{rewrites: tc.rewrites}
+				d, err := disc.New(
+					disc.WithEnvMap(map[string]string{"BEARER_TOKEN_FILE": "/home/user/token"}),
+					disc.WithFS(fsys),
+				)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				res, err := d.Discover()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if string(res.Bytes()) != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, res.Bytes())
+				}
+				if fsys.reads != tc.expectedReads {
+					t.Errorf("Expected %d reads of the token file, got %d", tc.expectedReads, fsys.reads)
+				}
+				warnings := strings.Join(res.Warnings(), "\n")
+				if tc.expectedWarning == "" && warnings != "" {
+					t.Errorf("Expected no warnings, got %q", warnings)
+				}
+				if !strings.Contains(warnings, tc.expectedWarning) {
+					t.Errorf("Expected a warning containing %q, got %q", tc.expectedWarning, warnings)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,225 @@
+package tokendiscovery
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultRediscoveryInterval is how long the RoundTripper returned by NewTransport reuses a token before running
+// discovery again, unless set otherwise with TransportRediscoveryInterval
+const DefaultRediscoveryInterval = time.Minute
+
+// TransportOption configures NewTransport
+type TransportOption func(*transport)
+
+// TransportRediscoveryInterval sets how long the RoundTripper returned by NewTransport reuses a token before running
+// discovery again, to pick up tokens that were renewed. 0 runs discovery for every request.
+func TransportRediscoveryInterval(interval time.Duration) TransportOption {
+	return func(t *transport) {
+		t.interval = max(interval, 0)
+	}
+}
+
+// RetryHook is called by the RoundTripper returned by NewTransport before it retries req, whose response resp was a 401
+// rejecting the token as invalid, with a newly discovered token. Returning false returns resp to the caller instead.
+// The hook must not read the body of resp.
+type RetryHook func(req *http.Request, resp *http.Response) bool
+
+// TransportRetryHook sets a hook called before each retry of a request whose token was rejected, to record or prevent
+// it. A nil hook allows every retry, which is the default.
+func TransportRetryHook(hook RetryHook) TransportOption {
+	return func(t *transport) {
+		t.retryHook = hook
+	}
+}
+
+// TransportWithoutRetry disables retrying requests whose token was rejected
+func TransportWithoutRetry() TransportOption {
+	return TransportRetryHook(func(*http.Request, *http.Response) bool { return false })
+}
+
+// maxDrainSize bounds how much of the body of a rejected response is read before it is closed, so that its connection
+// can be reused without reading an arbitrarily large body
+const maxDrainSize = 4 << 10
+
+// transport is the http.RoundTripper returned by NewTransport
+type transport struct {
+	base      http.RoundTripper
+	interval  time.Duration
+	retryHook RetryHook
+	cache     *CachedDiscovery
+}
+
+// NewTransport returns an http.RoundTripper that sends requests with base, or http.DefaultTransport if it is nil, with
+// an "Authorization: Bearer" header holding the token found by d, or by the default discovery procedure if d is nil.
+// Requests that already have an Authorization header are sent as they are. Requests are cloned rather than modified, as
+// http.RoundTripper requires. The token is reused for DefaultRediscoveryInterval, or until it expires, before discovery
+// runs again, so that renewed tokens are picked up. If discovery fails, the request is not sent, and the error returned
+// wraps the reason, such as ErrNoTokenFound. Requests do not wait for discovery beyond the end of their context, even
+// when discovery started for another request is still running.
+//
+// Since tokens may be renewed while requests are in flight, a request answered with a 401 whose WWW-Authenticate
+// header has a Bearer challenge with error="invalid_token" is retried once: the token is dropped, discovery runs again,
+// and if it finds a different token the request is sent again with it. Only requests that can be sent twice are
+// retried: those with a body that can be replayed through GetBody, as set by http.NewRequest for common body types,
+// and bodyless ones with an idempotent method. Retries can be observed or prevented with TransportRetryHook, and
+// disabled with TransportWithoutRetry.
+func NewTransport(base http.RoundTripper, d *Discoverer, opts ...TransportOption) http.RoundTripper {
+	return newTransport(base, d, opts)
+}
+
+// newTransport returns the transport described for NewTransport
+func newTransport(base http.RoundTripper, d *Discoverer, opts []TransportOption) *transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t := &transport{base: base, interval: DefaultRediscoveryInterval}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.cache = NewCachedDiscovery(d, t.interval)
+	return t
+}
+
+// NewHTTPClient returns an http.Client sending requests through NewTransport with http.DefaultTransport, d, and opts.
+// Requests are thus sent with the token found by d, or by the default discovery procedure if d is nil, and retried
+// once with a newly discovered token if it was rejected as invalid.
+func NewHTTPClient(d *Discoverer, opts ...TransportOption) *http.Client {
+	return &http.Client{Transport: newTransport(nil, d, opts)}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" {
+		return t.base.RoundTrip(req)
+	}
+	tok, err := t.cache.Token(req.Context())
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("could not find a bearer token for %s %s: %w", req.Method, req.URL.Redacted(), err)
+	}
+	resp, err := t.base.RoundTrip(authorize(req, tok))
+	if err != nil || !invalidToken(resp) || !replayable(req) {
+		return resp, err
+	}
+	t.cache.Invalidate(tok)
+	renewed, err := t.cache.Token(req.Context())
+	if err != nil || bytes.Equal(renewed, tok) {
+		// The rejection is returned, rather than why no other token could be found
+		return resp, nil
+	}
+	if t.retryHook != nil && !t.retryHook(req, resp) {
+		return resp, nil
+	}
+	retry := authorize(req, renewed)
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	// Drain the body so that the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainSize))
+	resp.Body.Close()
+	return t.base.RoundTrip(retry)
+}
+
+// authorize returns a copy of req with an Authorization header holding tok
+func authorize(req *http.Request, tok []byte) *http.Request {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", bearerScheme+" "+string(tok))
+	return req
+}
+
+// invalidToken reports whether resp rejects the token it was sent with as invalid, as described in RFC 6750, section
+// 3.1
+func invalidToken(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+	for _, challenges := range resp.Header.Values("WWW-Authenticate") {
+		if bearerErrorCode(challenges) == "invalid_token" {
+			return true
+		}
+	}
+	return false
+}
+
+// replayable reports whether req can be sent again: its body can be obtained again through GetBody, or it has none and
+// an idempotent method
+func replayable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody {
+		return req.GetBody != nil
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// bearerErrorCode returns the error parameter of the Bearer challenge among challenges, the value of a WWW-Authenticate
+// header as described in RFC 9110, section 11.6.1, or "" if there is none or challenges is malformed
+func bearerErrorCode(challenges string) string {
+	s, bearer := challenges, false
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		name := s[:tokenLen(s)]
+		if name == "" {
+			return ""
+		}
+		s = strings.TrimLeft(s[len(name):], " \t")
+		if !strings.HasPrefix(s, "=") {
+			// Anything but a parameter starts a new challenge with its scheme
+			bearer = strings.EqualFold(name, bearerScheme)
+			continue
+		}
+		// Trimming further "=" skips the padding of a token68
+		s = strings.TrimLeft(s, "= \t")
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			value, s = unquote(s)
+		} else {
+			n := tokenLen(s)
+			value, s = s[:n], s[n:]
+		}
+		if bearer && strings.EqualFold(name, "error") {
+			return value
+		}
+	}
+}
+
+// tokenLen returns the length of the token, as defined in RFC 9110, section 5.6.2, at the start of s
+func tokenLen(s string) int {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		alnum := 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+		if !alnum && strings.IndexByte("!#$%&'*+-.^_`|~", c) < 0 {
+			return i
+		}
+	}
+	return len(s)
+}
+
+// unquote returns the value of the quoted string at the start of s, and the rest of s. An unterminated quoted string
+// extends to the end of s.
+func unquote(s string) (string, string) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), s[i+1:]
+		case '\\':
+			if i+1 < len(s) {
+				i++
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String(), ""
+}
@@ -0,0 +1,479 @@
+package tokendiscovery_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+// rotatingStep is a step whose token can be changed, and that counts how often it runs. While block is set, lookups
+// wait for it to be closed, ignoring their context.
+type rotatingStep struct {
+	mu      sync.Mutex
+	token   string
+	block   chan struct{}
+	lookups atomic.Int32
+}
+
+func (r *rotatingStep) Name() string { return "rotating" }
+
+func (r *rotatingStep) Lookup(context.Context, disc.Environ, disc.FileReader) (disc.Result, error) {
+	r.lookups.Add(1)
+	r.mu.Lock()
+	block := r.block
+	r.mu.Unlock()
+	if block != nil {
+		<-block
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.token == "" {
+		return disc.Result{}, disc.ErrSkipStep
+	}
+	return disc.NewResult([]byte(r.token), ""), nil
+}
+
+func (r *rotatingStep) set(tok string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.token = tok
+}
+
+// newEchoServer returns a server that responds with the Authorization header of each request, and counts them
+func newEchoServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		io.WriteString(w, r.Header.Get("Authorization"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+// get sends a GET request for url with client, with the given Authorization header unless it is empty, and returns the
+// response body
+func get(t *testing.T, client *http.Client, url, authorization string) (string, error) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authorization == "" && req.Header.Get("Authorization") != "" {
+		t.Error("Expected the request of the caller not to be modified")
+	}
+	return string(body), nil
+}
+
+func TestNewTransport(t *testing.T) {
+	srv, _ := newEchoServer(t)
+
+	type testCase struct {
+		description   string
+		authorization string
+		expected      string
+	}
+
+	testCases := []testCase{
+		{"Token added", "", "Bearer env_token"},
+		{"Existing header kept", "Basic dXNlcjpwYXNz", "Basic dXNlcjpwYXNz"},
+		{"Existing bearer token kept", "Bearer other_token", "Bearer other_token"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				d, err := disc.New(disc.WithEnvMap(map[string]string{"BEARER_TOKEN": " env_token\n"}))
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				client := &http.Client{Transport: disc.NewTransport(srv.Client().Transport, d)}
+				got, err := get(t, client, srv.URL, tc.authorization)
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if got != tc.expected {
+					t.Errorf("Authorization headers do not match.  Expected %q, got %q", tc.expected, got)
+				}
+			},
+		)
+	}
+}
+
+func TestNewTransportNoToken(t *testing.T) {
+	srv, requests := newEchoServer(t)
+	d, err := disc.New(disc.WithEnvMap(nil), disc.WithFS(fstest.MapFS{}), disc.WithUID("4242"))
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	client := &http.Client{Transport: disc.NewTransport(srv.Client().Transport, d)}
+	if _, err := get(t, client, srv.URL, ""); !errors.Is(err, disc.ErrNoTokenFound) {
+		t.Errorf("Expected error %s, got %v", disc.ErrNoTokenFound, err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("Expected no request to be sent, got %d", n)
+	}
+}
+
+func TestNewTransportRediscovery(t *testing.T) {
+	srv, _ := newEchoServer(t)
+
+	type testCase struct {
+		description     string
+		opts            []disc.TransportOption
+		expectedToken   string
+		expectedLookups int32
+	}
+
+	testCases := []testCase{
+		{"Token reused", nil, "Bearer first_token", 1},
+		{
+			"Discovery for every request",
+			[]disc.TransportOption{disc.TransportRediscoveryInterval(0)},
+			"Bearer second_token",
+			2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				step := &rotatingStep{token: "first_token"}
+				d, err := disc.New(disc.WithSteps(step))
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				client := &http.Client{Transport: disc.NewTransport(srv.Client().Transport, d, tc.opts...)}
+				if got, err := get(t, client, srv.URL, ""); err != nil || got != "Bearer first_token" {
+					t.Fatalf("Expected Bearer first_token and nil error, got %q and %v", got, err)
+				}
+				step.set("second_token")
+				got, err := get(t, client, srv.URL, "")
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if got != tc.expectedToken {
+					t.Errorf("Authorization headers do not match.  Expected %q, got %q", tc.expectedToken, got)
+				}
+				if n := step.lookups.Load(); n != tc.expectedLookups {
+					t.Errorf("Expected %d discoveries, got %d", tc.expectedLookups, n)
+				}
+			},
+		)
+	}
+}
+
+func TestNewTransportBlockedDiscovery(t *testing.T) {
+	srv, requests := newEchoServer(t)
+	block := make(chan struct{})
+	step := &rotatingStep{token: "token", block: block}
+	d, err := disc.New(disc.WithSteps(step))
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	client := &http.Client{Transport: disc.NewTransport(srv.Client().Transport, d)}
+
+	// The second request waits for the discovery started by the first, which is still blocked
+	for _, description := range []string{"Blocked discovery", "Waiting for blocked discovery"} {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		_, err = client.Do(req)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: expected error %s, got %v", description, context.DeadlineExceeded, err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: expected the request to end with its context, took %s", description, elapsed)
+		}
+	}
+
+	close(block)
+	if got, err := get(t, client, srv.URL, ""); err != nil || got != "Bearer token" {
+		t.Errorf("Expected Bearer token and nil error once discovery is unblocked, got %q and %v", got, err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Expected 1 request to reach the server, got %d", n)
+	}
+}
+
+func TestNewTransportClosesBody(t *testing.T) {
+	d, err := disc.New(disc.WithSteps(&rotatingStep{}))
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	body := &trackingBody{Reader: strings.NewReader("payload")}
+	req, err := http.NewRequest(http.MethodPut, "http://storage.example/file", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := disc.NewTransport(nil, d).RoundTrip(req); !errors.Is(err, disc.ErrNoTokenFound) {
+		t.Errorf("Expected error %s, got %v", disc.ErrNoTokenFound, err)
+	}
+	if !body.closed {
+		t.Error("Expected the request body to be closed")
+	}
+}
+
+// trackingBody is a request body that records whether it was closed
+type trackingBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *trackingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+// newRotationServer returns a server that rejects requests with old_token as invalid, after which step produces
+// new_token, and responds to others with the Authorization header and body of the request. It also counts requests.
+func newRotationServer(t *testing.T, step *rotatingStep, challenge string) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Authorization") == "Bearer old_token" {
+			step.set("new_token")
+			w.Header().Set("WWW-Authenticate", challenge)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, r.Header.Get("Authorization")+" "+string(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestNewHTTPClientRetry(t *testing.T) {
+	const invalidToken = `Bearer realm="storage", error="invalid_token", error_description="The token expired"`
+
+	type testCase struct {
+		description      string
+		method           string
+		body             func() io.Reader
+		challenge        string
+		hookAllows       bool
+		expectedStatus   int
+		expectedBody     string
+		expectedRequests int32
+		expectedHookRuns int32
+	}
+
+	testCases := []testCase{
+		{"GET retried", http.MethodGet, nil, invalidToken, true, http.StatusOK, "Bearer new_token ", 2, 1},
+		{
+			"PUT with replayable body retried",
+			http.MethodPut,
+			func() io.Reader { return strings.NewReader("payload") },
+			invalidToken,
+			true,
+			http.StatusOK,
+			"Bearer new_token payload",
+			2,
+			1,
+		},
+		{
+			"POST with replayable body retried",
+			http.MethodPost,
+			func() io.Reader { return strings.NewReader("payload") },
+			invalidToken,
+			true,
+			http.StatusOK,
+			"Bearer new_token payload",
+			2,
+			1,
+		},
+		{
+			"Body not replayable",
+			http.MethodPut,
+			func() io.Reader { return io.MultiReader(strings.NewReader("payload")) },
+			invalidToken,
+			true,
+			http.StatusUnauthorized,
+			"",
+			1,
+			0,
+		},
+		{"POST without body not retried", http.MethodPost, nil, invalidToken, true, http.StatusUnauthorized, "", 1, 0},
+		{"Retry prevented by hook", http.MethodGet, nil, invalidToken, false, http.StatusUnauthorized, "", 1, 1},
+		{"Other error", http.MethodGet, nil, `Bearer error="insufficient_scope"`, true, http.StatusUnauthorized, "", 1, 0},
+		{"Other scheme", http.MethodGet, nil, `Basic error="invalid_token"`, true, http.StatusUnauthorized, "", 1, 0},
+		{"No error", http.MethodGet, nil, `Bearer realm="storage"`, true, http.StatusUnauthorized, "", 1, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				step := &rotatingStep{token: "old_token"}
+				srv, requests := newRotationServer(t, step, tc.challenge)
+				d, err := disc.New(disc.WithSteps(step))
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				var hookRuns atomic.Int32
+				hook := func(req *http.Request, resp *http.Response) bool {
+					hookRuns.Add(1)
+					if resp.StatusCode != http.StatusUnauthorized {
+						t.Errorf("Expected the hook to get the rejection, got status %d", resp.StatusCode)
+					}
+					return tc.hookAllows
+				}
+				client := disc.NewHTTPClient(d, disc.TransportRetryHook(hook))
+
+				var body io.Reader
+				if tc.body != nil {
+					body = tc.body()
+				}
+				req, err := http.NewRequest(tc.method, srv.URL, body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// The client of the test server is not needed, as it does not use TLS
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				defer resp.Body.Close()
+				got, _ := io.ReadAll(resp.Body)
+
+				if resp.StatusCode != tc.expectedStatus {
+					t.Errorf("Status codes do not match.  Expected %d, got %d", tc.expectedStatus, resp.StatusCode)
+				}
+				if tc.expectedStatus == http.StatusOK && string(got) != tc.expectedBody {
+					t.Errorf("Response bodies do not match.  Expected %q, got %q", tc.expectedBody, got)
+				}
+				if n := requests.Load(); n != tc.expectedRequests {
+					t.Errorf("Expected %d requests, got %d", tc.expectedRequests, n)
+				}
+				if n := hookRuns.Load(); n != tc.expectedHookRuns {
+					t.Errorf("Expected the hook to run %d times, got %d", tc.expectedHookRuns, n)
+				}
+			},
+		)
+	}
+}
+
+func TestNewHTTPClientRetryOnce(t *testing.T) {
+	// The server keeps rejecting tokens, and once rotate is set, makes another one available for each request, so that
+	// a second retry would show
+	step := &rotatingStep{token: "old_token"}
+	var requests atomic.Int32
+	var rotate atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		if rotate.Load() {
+			step.set(fmt.Sprintf("token_%d", n))
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	t.Cleanup(srv.Close)
+
+	d, err := disc.New(disc.WithSteps(step))
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	client := disc.NewHTTPClient(d)
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Status codes do not match.  Expected %d, got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Expected 1 request when discovery finds the rejected token again, got %d", n)
+	}
+
+	rotate.Store(true)
+	resp, err = client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	resp.Body.Close()
+	if n := requests.Load(); n != 3 {
+		t.Errorf("Expected 3 requests after a single retry, got %d", n)
+	}
+}
+
+func TestNewHTTPClientWithoutRetry(t *testing.T) {
+	step := &rotatingStep{token: "old_token"}
+	srv, requests := newRotationServer(t, step, `Bearer error="invalid_token"`)
+	d, err := disc.New(disc.WithSteps(step))
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	resp, err := disc.NewHTTPClient(d, disc.TransportWithoutRetry()).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Status codes do not match.  Expected %d, got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Expected 1 request, got %d", n)
+	}
+}
+
+func TestBearerErrorCode(t *testing.T) {
+	type testCase struct {
+		description string
+		challenges  string
+		expected    string
+	}
+
+	testCases := []testCase{
+		{"Bearer challenge", `Bearer error="invalid_token"`, "invalid_token"},
+		{"Token value", `Bearer error=invalid_token`, "invalid_token"},
+		{"Case-insensitive", `bearer ERROR = "invalid_token"`, "invalid_token"},
+		{"Several parameters", `Bearer realm="a, b", scope="x\"y", error="invalid_token"`, "invalid_token"},
+		{"After other challenges", `Basic realm="x", Negotiate abc==, Bearer error="invalid_token"`, "invalid_token"},
+		{"Other challenge", `Basic error="invalid_token", Bearer realm="x"`, ""},
+		{"No parameters", `Bearer`, ""},
+		{"Empty", ``, ""},
+		{"Malformed", `"Bearer" error="invalid_token"`, ""},
+		{"Unterminated", `Bearer error="invalid_token`, "invalid_token"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				if got := disc.BearerErrorCode(tc.challenges); got != tc.expected {
+					t.Errorf("Error codes do not match.  Expected %q, got %q", tc.expected, got)
+				}
+			},
+		)
+	}
+}
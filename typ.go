@@ -0,0 +1,66 @@
+package tokendiscovery
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TypeAccessToken is the typ header of JWT access tokens defined by RFC 9068
+const TypeAccessToken = "at+jwt"
+
+// ErrTypeMismatch indicates that the typ header of a token is not the one required, as when an ID token is used in
+// place of an access token. If no token qualifies during discovery with WithRequiredType, the error returned wraps both
+// it and ErrNoTokenFound, and lists the types of the tokens that were found.
+var ErrTypeMismatch = errors.New("token type does not match")
+
+// CheckType returns an error wrapping ErrTypeMismatch unless the typ header of tok, a JWT, is typ, such as
+// TypeAccessToken. Types are compared case-insensitively, and the application/ prefix is optional, as RFC 7515 allows.
+// If allowLegacy is true, the bare JWT type that issuers used before RFC 9068 is accepted as well. If tok is not a JWT,
+// the returned error wraps both ErrTypeMismatch and ErrNotAJWT. The token is NOT verified, as described for
+// ParseClaims.
+func CheckType(tok []byte, typ string, allowLegacy bool) error {
+	h, err := ParseHeader(tok)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrTypeMismatch, err)
+	}
+	got := normalizeType(h.Typ)
+	if got == normalizeType(typ) || allowLegacy && got == "jwt" {
+		return nil
+	}
+	return &claimError{sentinel: ErrTypeMismatch, claim: "typ header", value: h.Typ}
+}
+
+// normalizeType returns typ in lower case without the application/ prefix
+func normalizeType(typ string) string {
+	typ = strings.ToLower(typ)
+	return strings.TrimPrefix(typ, "application/")
+}
+
+// WithRequiredType makes discovery skip tokens for which CheckType with typ and allowLegacy fails, for relying parties
+// that refuse anything but access tokens
+func WithRequiredType(typ string, allowLegacy bool) Option {
+	return func(d *Discoverer) error {
+		if typ == "" {
+			return fmt.Errorf("%w: token type cannot be empty", ErrInvalidOption)
+		}
+		d.requiredType = typ
+		d.allowLegacyType = allowLegacy
+		return nil
+	}
+}
+
+// checkType returns an error wrapping ErrTypeMismatch if tok should be skipped according to WithRequiredType
+func (d *Discoverer) checkType(tok []byte) error {
+	if d.requiredType == "" {
+		return nil
+	}
+	return CheckType(tok, d.requiredType, d.allowLegacyType)
+}
+
+// typeMismatchError returns the error summarizing the types of the tokens in rejected skipped by checkType, for
+// discovery to return when no token qualified. It returns nil if no token was skipped for its type.
+func (d *Discoverer) typeMismatchError(rejected []error) error {
+	want := fmt.Sprintf("%q", d.requiredType)
+	return claimMismatchError(rejected, ErrTypeMismatch, "typ header", want, "the types found")
+}
@@ -0,0 +1,101 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestCheckType(t *testing.T) {
+	type testCase struct {
+		description string
+		header      string
+		allowLegacy bool
+		expectedErr error
+	}
+
+	testCases := []testCase{
+		{"at+jwt", `{"alg":"RS256","typ":"at+jwt"}`, false, nil},
+		{"Upper case", `{"alg":"RS256","typ":"AT+JWT"}`, false, nil},
+		{"Media type with prefix", `{"alg":"RS256","typ":"application/at+jwt"}`, false, nil},
+		{"Legacy JWT refused", `{"alg":"RS256","typ":"JWT"}`, false, disc.ErrTypeMismatch},
+		{"Legacy JWT allowed", `{"alg":"RS256","typ":"JWT"}`, true, nil},
+		{"ID token refused", `{"alg":"RS256","typ":"id_token+jwt"}`, true, disc.ErrTypeMismatch},
+		{"Missing typ", `{"alg":"RS256"}`, true, disc.ErrTypeMismatch},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				tok := encodeJWT(tc.header, `{"sub":"user"}`, false)
+				if err := disc.CheckType(tok, disc.TypeAccessToken, tc.allowLegacy); !errors.Is(err, tc.expectedErr) {
+					t.Errorf("Expected error %v, got %v", tc.expectedErr, err)
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"Opaque token",
+		func(t *testing.T) {
+			err := disc.CheckType([]byte("opaque_token"), disc.TypeAccessToken, true)
+			if !errors.Is(err, disc.ErrTypeMismatch) || !errors.Is(err, disc.ErrNotAJWT) {
+				t.Errorf("Expected error wrapping %s and %s, got %v", disc.ErrTypeMismatch, disc.ErrNotAJWT, err)
+			}
+		},
+	)
+}
+
+func TestRequiredType(t *testing.T) {
+	accessToken := string(encodeJWT(`{"alg":"RS256","typ":"at+jwt"}`, `{"sub":"user"}`, false))
+	legacy := string(encodeJWT(`{"alg":"RS256","typ":"JWT"}`, `{"sub":"user"}`, false))
+	idToken := string(encodeJWT(`{"alg":"RS256","typ":"id_token+jwt"}`, `{"sub":"user","nonce":"n"}`, false))
+
+	type testCase struct {
+		description   string
+		envToken      string
+		fileToken     string
+		allowLegacy   bool
+		expectedToken string
+	}
+
+	testCases := []testCase{
+		{"Access token in env", accessToken, legacy, false, accessToken},
+		{"ID token falls through", idToken, accessToken, false, accessToken},
+		{"Legacy token falls through", legacy, accessToken, false, accessToken},
+		{"Legacy token allowed", legacy, accessToken, true, legacy},
+		{"No access token", idToken, legacy, false, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				d, err := disc.New(
+					disc.WithEnvMap(map[string]string{"BEARER_TOKEN": tc.envToken, "BEARER_TOKEN_FILE": "/home/user/token"}),
+					disc.WithFS(fstest.MapFS{"home/user/token": {Data: []byte(tc.fileToken + "\n")}}),
+					disc.WithRequiredType(disc.TypeAccessToken, tc.allowLegacy),
+				)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, err := d.FindToken()
+				if tc.expectedToken == "" {
+					if !errors.Is(err, disc.ErrTypeMismatch) || !errors.Is(err, disc.ErrNoTokenFound) {
+						t.Errorf("Expected error wrapping %s and %s, got %v", disc.ErrTypeMismatch, disc.ErrNoTokenFound, err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if string(tok) != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, tok)
+				}
+			},
+		)
+	}
+}
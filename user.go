@@ -0,0 +1,62 @@
+package tokendiscovery
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// ErrCannotDetermineUser indicates that the current user, whose uid is needed for the bt_u$ID filename in steps 3 and 4
+// of the discovery procedure, could not be determined. The error returned by discovery in that case also wraps the
+// error from the user database lookup. Since the uid is only looked up once those steps are reached, this error never
+// prevents a token from being found in the environment.
+var ErrCannotDetermineUser = errors.New("cannot determine current user")
+
+// currentUID returns the uid used to build the bt_u$ID filename: either the one configured on d, or that of the current
+// user. The current user is only looked up the first time it is needed, and the result is cached for the lifetime of d.
+// Looking up the current user fails routinely in minimal containers where the uid has no passwd entry, and since
+// only the numeric uid is needed, the uid of the process is used in that case. Only on platforms without numeric uids
+// is the lookup failure returned, wrapped with ErrCannotDetermineUser; on Windows, where the SID of the user takes the
+// place of the uid, that means always.
+func (d *Discoverer) currentUID() (string, error) {
+	if d.uid != "" {
+		return d.uid, nil
+	}
+
+	d.resolvedUID.mu.Lock()
+	defer d.resolvedUID.mu.Unlock()
+	if d.resolvedUID.uid != "" {
+		return d.resolvedUID.uid, nil
+	}
+	uid, err := d.lookupCurrentUID()
+	if err != nil {
+		// Not cached, so that a transient failure of the user database can recover
+		return "", err
+	}
+	d.resolvedUID.uid = uid
+	return uid, nil
+}
+
+// uidCache holds the uid of the current user once it has been looked up. It is shared by a Discoverer and the copies
+// made of it for named tokens.
+type uidCache struct {
+	mu  sync.Mutex
+	uid string
+}
+
+func (d *Discoverer) lookupCurrentUID() (string, error) {
+	if d.skipSetuid && d.runningSetuid() {
+		// The user database reports the real user, but a setuid program acts as the effective one
+		return strconv.Itoa(d.geteuid()), nil
+	}
+	uid, err := d.lookupUser()
+	if err == nil {
+		return uid, nil
+	}
+	if uid := d.getuid(); uid >= 0 {
+		d.debug("could not look up current user, using process uid", "uid", uid, "error", err)
+		return strconv.Itoa(uid), nil
+	}
+	return "", fmt.Errorf("%w (process uid %d): %w", ErrCannotDetermineUser, d.getuid(), err)
+}
@@ -0,0 +1,15 @@
+//go:build js
+
+package tokendiscovery
+
+import "errors"
+
+// currentUserID reports that there is no user database to look up the current user in
+func currentUserID() (string, error) {
+	return "", errors.New("user lookup is not supported on this platform")
+}
+
+// userHomeDir reports that there is no user database to look up home directories in
+func userHomeDir(string) (string, error) {
+	return "", errors.New("user lookup is not supported on this platform")
+}
@@ -0,0 +1,44 @@
+//go:build !js
+
+package tokendiscovery
+
+import (
+	"fmt"
+	"os/user"
+)
+
+// WithUser is like WithUID, using the uid of u
+func WithUser(u *user.User) Option {
+	return func(d *Discoverer) error {
+		if u == nil {
+			return fmt.Errorf("%w: user cannot be nil", ErrInvalidOption)
+		}
+		return WithUID(userFileID(u.Uid))(d)
+	}
+}
+
+// currentUserID looks up the current user in the user database, and returns the identifier used to build the bt_u$ID
+// filename
+func currentUserID() (string, error) {
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return userFileID(u.Uid), nil
+}
+
+// userHomeDir looks up the home directory of the user with the given uid in the user database, or that of the current
+// user if uid is empty
+func userHomeDir(uid string) (string, error) {
+	var u *user.User
+	var err error
+	if uid == "" {
+		u, err = user.Current()
+	} else {
+		u, err = user.LookupId(uid)
+	}
+	if err != nil {
+		return "", err
+	}
+	return u.HomeDir, nil
+}
@@ -0,0 +1,45 @@
+//go:build !js
+
+package tokendiscovery_test
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestWithUser(t *testing.T) {
+	fallbackDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(fallbackDir, "bt_u4242"), []byte("token_for_4242"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := disc.New(disc.WithEnvMap(nil), disc.WithFallbackDir(fallbackDir), disc.WithUser(&user.User{Uid: "4242"}), disc.WithoutOwnershipCheck())
+	if err != nil {
+		t.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	tok, path, err := d.FindTokenAndFile()
+	if err != nil {
+		t.Fatalf("Expected nil error, got %s", err)
+	}
+	if string(tok) != "token_for_4242" {
+		t.Errorf("Token strings do not match.  Expected token_for_4242, got %s", tok)
+	}
+	if expectedPath := filepath.Join(fallbackDir, "bt_u4242"); path != expectedPath {
+		t.Errorf("Token paths do not match. Expected path %s, got %s", expectedPath, path)
+	}
+
+	invalidCases := map[string][]disc.Option{
+		"nil user":         {disc.WithUser(nil)},
+		"conflicting uids": {disc.WithUID("1000"), disc.WithUser(&user.User{Uid: "1001"})},
+	}
+	for description, opts := range invalidCases {
+		if _, err := disc.New(opts...); !errors.Is(err, disc.ErrInvalidOption) {
+			t.Errorf("%s: expected error %s, got %v", description, disc.ErrInvalidOption, err)
+		}
+	}
+}
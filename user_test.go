@@ -0,0 +1,146 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"os/user"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+var errNoPasswdEntry = errors.New("user: unknown userid 4242")
+
+func failingUserLookup() (*user.User, error) {
+	return nil, errNoPasswdEntry
+}
+
+func TestCurrentUIDFallback(t *testing.T) {
+	fsys := fstest.MapFS{"tmp/bt_u4242": {Data: []byte("56789")}}
+
+	t.Run(
+		"User lookup fails, process uid is used",
+		func(t *testing.T) {
+			d, err := disc.New(
+				disc.WithEnvMap(map[string]string{}),
+				disc.WithFS(fsys),
+				disc.WithUserLookup(failingUserLookup),
+				disc.WithGetuid(func() int { return 4242 }),
+			)
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			tok, path, err := d.FindTokenAndFile()
+			if err != nil {
+				t.Fatalf("Expected nil error, got %s", err)
+			}
+			if string(tok) != "56789" {
+				t.Errorf("Token strings do not match.  Expected 56789, got %s", tok)
+			}
+			if path != "/tmp/bt_u4242" {
+				t.Errorf("Token paths do not match. Expected path /tmp/bt_u4242, got %s", path)
+			}
+		},
+	)
+
+	t.Run(
+		"User lookup fails and there is no process uid",
+		func(t *testing.T) {
+			d, err := disc.New(
+				disc.WithEnvMap(map[string]string{}),
+				disc.WithFS(fsys),
+				disc.WithUserLookup(failingUserLookup),
+				disc.WithGetuid(func() int { return -1 }),
+			)
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			_, _, err = d.FindTokenAndFile()
+			if !errors.Is(err, disc.ErrCannotDetermineUser) {
+				t.Errorf("Expected error to wrap %s, got %v", disc.ErrCannotDetermineUser, err)
+			}
+			if !errors.Is(err, errNoPasswdEntry) {
+				t.Errorf("Expected error to wrap %s, got %v", errNoPasswdEntry, err)
+			}
+			if expected := "process uid -1"; err == nil || !strings.Contains(err.Error(), expected) {
+				t.Errorf("Expected error to mention %q, got %v", expected, err)
+			}
+		},
+	)
+}
+
+func TestCurrentUIDLazyLookup(t *testing.T) {
+	t.Run(
+		"Environment token found even though user lookup fails",
+		func(t *testing.T) {
+			for _, env := range []map[string]string{
+				{"BEARER_TOKEN": "42"},
+				{"BEARER_TOKEN_FILE": "/home/user/token"},
+			} {
+				d, err := disc.New(
+					disc.WithEnvMap(env),
+					disc.WithFS(fstest.MapFS{"home/user/token": {Data: []byte("42")}}),
+					disc.WithUserLookup(failingUserLookup),
+					disc.WithGetuid(func() int { return -1 }),
+				)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				tok, err := d.FindToken()
+				if err != nil {
+					t.Errorf("Expected nil error, got %s", err)
+				}
+				if string(tok) != "42" {
+					t.Errorf("Token strings do not match.  Expected 42, got %s", tok)
+				}
+			}
+		},
+	)
+
+	t.Run(
+		"User is looked up once and cached",
+		func(t *testing.T) {
+			var lookups int
+			d, err := disc.New(
+				disc.WithEnvMap(map[string]string{}),
+				disc.WithFS(fstest.MapFS{"tmp/bt_u4242": {Data: []byte("56789")}}),
+				disc.WithUserLookup(func() (*user.User, error) {
+					lookups++
+					return &user.User{Uid: "4242"}, nil
+				}),
+			)
+			if err != nil {
+				t.Fatalf("Could not construct Discoverer: %s", err)
+			}
+			for i := 0; i < 3; i++ {
+				if _, err := d.FindToken(); err != nil {
+					t.Fatalf("Expected nil error, got %s", err)
+				}
+			}
+			if lookups != 1 {
+				t.Errorf("Expected 1 user lookup, got %d", lookups)
+			}
+		},
+	)
+}
+
+func BenchmarkFindTokenFallback(b *testing.B) {
+	d, err := disc.New(
+		disc.WithEnvMap(map[string]string{}),
+		disc.WithFS(fstest.MapFS{"tmp/bt_u4242": {Data: []byte("56789")}}),
+		disc.WithUserLookup(func() (*user.User, error) {
+			return &user.User{Uid: "4242"}, nil
+		}),
+	)
+	if err != nil {
+		b.Fatalf("Could not construct Discoverer: %s", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := d.FindToken(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package tokendiscovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ErrMissingClaims indicates that a token lacks claims required with ValidationOptions.RequiredClaims
+var ErrMissingClaims = errors.New("token lacks required claims")
+
+// ValidationOptions sets what Verifier.Validate checks beyond the signature of a token
+type ValidationOptions struct {
+	// Audience, if set, must be in the aud claim, or AudienceAny must be unless NoAnyAudience is set
+	Audience string
+	// NoAnyAudience makes Audience required in the aud claim itself, rejecting tokens for AudienceAny, as
+	// WithoutAnyAudience does for discovery
+	NoAnyAudience bool
+	// Issuers, if set, lists the issuers allowed, ignoring trailing slashes. It narrows the issuers the Verifier
+	// accepts rather than adding to them: a Verifier for an issuer only accepts tokens from that issuer, while one with
+	// pinned keys accepts those from any issuer it has keys for.
+	Issuers []string
+	// RequiredScopes lists scopes the scope claim must include, as described for HasScope
+	RequiredScopes []string
+	// RequiredClaims lists claims that must be present and not null, such as jti
+	RequiredClaims []string
+	// Leeway is the clock skew tolerated when checking the exp, nbf and iat claims. Zero means DefaultLeeway; a
+	// negative value means none.
+	Leeway time.Duration
+	// Now is the time the token must be valid at. The zero time means the current time.
+	Now time.Time
+}
+
+// Validate verifies tok as described for Verify, then checks its exp, nbf and iat claims as described for
+// CheckValidity, its issuer, its audience, its scopes and the presence of other claims, as set in opts. It returns the
+// claims of tok if every check passes, or else the first failure, wrapping ErrInvalidSignature, ErrUnknownKey,
+// ErrAlgorithmNotAllowed, ErrUnsupportedAlgorithm, ErrTokenExpired, ErrTokenNotYetValid, ErrIssuedInFuture,
+// ErrNoTrustedIssuer, ErrNoMatchingAudience, ErrMissingScopes or ErrMissingClaims.
+func (v *Verifier) Validate(ctx context.Context, tok []byte, opts ValidationOptions) (WLCGClaims, error) {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	leeway := opts.Leeway
+	switch {
+	case leeway == 0:
+		leeway = DefaultLeeway
+	case leeway < 0:
+		leeway = 0
+	}
+	claims, err := v.Verify(ctx, tok, VerifyAt(now), VerifyLeeway(leeway))
+	if err != nil {
+		return WLCGClaims{}, err
+	}
+	if len(opts.Issuers) > 0 && !slices.ContainsFunc(opts.Issuers, func(iss string) bool {
+		return normalizeIssuer(iss) == normalizeIssuer(claims.Issuer())
+	}) {
+		return WLCGClaims{}, issuerError(claims.Issuer())
+	}
+	if auds := claims.Audience(); opts.Audience != "" && !slices.Contains(auds, opts.Audience) &&
+		(opts.NoAnyAudience || !slices.Contains(auds, AudienceAny)) {
+		return WLCGClaims{}, &audienceError{required: opts.Audience, seen: auds}
+	}
+	if err := claims.checkScopes(opts.RequiredScopes); err != nil {
+		return WLCGClaims{}, err
+	}
+	var missing []string
+	for _, name := range opts.RequiredClaims {
+		if claims[name] == nil {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return WLCGClaims{}, fmt.Errorf("%w: %s", ErrMissingClaims, quoteAll(missing))
+	}
+	return claims.AsWLCG(), nil
+}
@@ -0,0 +1,121 @@
+package tokendiscovery_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestValidate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := newTestIssuer(t, map[string]*rsa.PrivateKey{"rsa1": key})
+	v, err := disc.NewVerifier(iss.URL, disc.WithHTTPClient(iss.Client()))
+	if err != nil {
+		t.Fatalf("Could not construct Verifier: %s", err)
+	}
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	const storage = "https://storage.example:1094"
+	opts := disc.ValidationOptions{
+		Audience:       storage,
+		Issuers:        []string{iss.URL + "/"},
+		RequiredScopes: []string{"storage.read:/"},
+		RequiredClaims: []string{"jti"},
+		Now:            now,
+	}
+	// claims returns valid claims, with the given ones changed or, if nil, removed
+	claims := func(changes map[string]any) map[string]any {
+		c := map[string]any{
+			"iss":   iss.URL,
+			"sub":   "user",
+			"aud":   storage,
+			"scope": "storage.read:/ storage.create:/data",
+			"jti":   "1234",
+			"iat":   now.Add(-time.Minute).Unix(),
+			"nbf":   now.Add(-time.Minute).Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+		}
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+	header := map[string]any{"alg": "RS256", "kid": "rsa1", "typ": "at+jwt"}
+	noAnyAudience := opts
+	noAnyAudience.NoAnyAudience = true
+
+	type testCase struct {
+		description string
+		tok         string
+		opts        disc.ValidationOptions
+		expectedErr error
+	}
+
+	testCases := []testCase{
+		{"Valid token", signJWT(t, key, header, claims(nil)), opts, nil},
+		{"Any audience", signJWT(t, key, header, claims(map[string]any{"aud": disc.AudienceAny})), opts, nil},
+		{
+			"Any audience rejected",
+			signJWT(t, key, header, claims(map[string]any{"aud": disc.AudienceAny})),
+			noAnyAudience,
+			disc.ErrNoMatchingAudience,
+		},
+		{"Exact audience required", signJWT(t, key, header, claims(nil)), noAnyAudience, nil},
+		{"Bad signature", signJWT(t, otherKey, header, claims(nil)), opts, disc.ErrInvalidSignature},
+		{"Unknown key", signJWT(t, key, map[string]any{"alg": "RS256", "kid": "rsa2"}, claims(nil)), opts, disc.ErrUnknownKey},
+		{"Algorithm not allowed", signJWT(t, key, map[string]any{"alg": "RS512", "kid": "rsa1"}, claims(nil)), opts, disc.ErrAlgorithmNotAllowed},
+		{"Expired", signJWT(t, key, header, claims(map[string]any{"exp": now.Add(-time.Hour).Unix()})), opts, disc.ErrTokenExpired},
+		{"Not yet valid", signJWT(t, key, header, claims(map[string]any{"nbf": now.Add(time.Hour).Unix()})), opts, disc.ErrTokenNotYetValid},
+		{"Issued in the future", signJWT(t, key, header, claims(map[string]any{"iat": now.Add(time.Hour).Unix()})), opts, disc.ErrIssuedInFuture},
+		{"Untrusted issuer", signJWT(t, key, header, claims(map[string]any{"iss": "https://other.example"})), opts, disc.ErrNoTrustedIssuer},
+		{"Wrong audience", signJWT(t, key, header, claims(map[string]any{"aud": "https://other.example"})), opts, disc.ErrNoMatchingAudience},
+		{"Missing scope", signJWT(t, key, header, claims(map[string]any{"scope": "storage.create:/data"})), opts, disc.ErrMissingScopes},
+		{"Missing claim", signJWT(t, key, header, claims(map[string]any{"jti": nil})), opts, disc.ErrMissingClaims},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				w, err := v.Validate(context.Background(), []byte(tc.tok), tc.opts)
+				if !errors.Is(err, tc.expectedErr) {
+					t.Fatalf("Expected error %v, got %v", tc.expectedErr, err)
+				}
+				if err == nil && (w.Sub != "user" || w.Jti != "1234") {
+					t.Errorf("Claims do not match.  Expected sub user and jti 1234, got %+v", w)
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"Leeway",
+		func(t *testing.T) {
+			tok := signJWT(t, key, header, claims(map[string]any{"exp": now.Add(-30 * time.Second).Unix()}))
+			if _, err := v.Validate(context.Background(), []byte(tok), opts); err != nil {
+				t.Errorf("Expected nil error with default leeway, got %v", err)
+			}
+			noLeeway := opts
+			noLeeway.Leeway = -1
+			if _, err := v.Validate(context.Background(), []byte(tok), noLeeway); !errors.Is(err, disc.ErrTokenExpired) {
+				t.Errorf("Expected error %s without leeway, got %v", disc.ErrTokenExpired, err)
+			}
+		},
+	)
+}
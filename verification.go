@@ -0,0 +1,51 @@
+package tokendiscovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrVerificationFailed indicates that a token was skipped because it failed the validation set with WithVerification.
+// The error also wraps the reason, such as ErrInvalidSignature or ErrTokenExpired.
+var ErrVerificationFailed = errors.New("token failed verification")
+
+// WithVerification makes discovery skip tokens that fail v.Validate with opts, in the same way as WithSkipExpired, so
+// that a stale or forged token found early, such as in BEARER_TOKEN, does not mask a valid one found later. The reason
+// each token was skipped is recorded in the error returned when no token qualifies. If opts.Now is zero, the clock of
+// the Discoverer is used, as set with WithClock, and if opts.Leeway is zero, the leeway set with WithLeeway is. Since v
+// may fetch keys from the issuer, discovery is then subject to network delays, which the context given to discovery
+// can bound.
+func WithVerification(v *Verifier, opts ValidationOptions) Option {
+	return func(d *Discoverer) error {
+		if v == nil {
+			return fmt.Errorf("%w: verifier cannot be nil", ErrInvalidOption)
+		}
+		d.verifier = v
+		d.validationOptions = opts
+		return nil
+	}
+}
+
+// checkVerification returns an error wrapping ErrVerificationFailed if tok fails the validation set with
+// WithVerification
+func (d *Discoverer) checkVerification(ctx context.Context, tok []byte) error {
+	if d.verifier == nil {
+		return nil
+	}
+	opts := d.validationOptions
+	if opts.Now.IsZero() {
+		opts.Now = d.now()
+	}
+	if opts.Leeway == 0 {
+		opts.Leeway = d.clockLeeway()
+		if opts.Leeway == 0 {
+			// ValidationOptions takes zero to mean DefaultLeeway
+			opts.Leeway = -1
+		}
+	}
+	if _, err := d.verifier.Validate(ctx, tok, opts); err != nil {
+		return fmt.Errorf("%w: %w", ErrVerificationFailed, err)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package tokendiscovery_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestWithVerification(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgedKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := newTestIssuer(t, map[string]*rsa.PrivateKey{"rsa1": key})
+	v, err := disc.NewVerifier(iss.URL, disc.WithHTTPClient(iss.Client()))
+	if err != nil {
+		t.Fatalf("Could not construct Verifier: %s", err)
+	}
+
+	const storage = "https://storage.example:1094"
+	now := time.Now()
+	header := map[string]any{"alg": "RS256", "kid": "rsa1"}
+	// mint returns a token signed with signer, with the given claims changed
+	mint := func(signer *rsa.PrivateKey, changes map[string]any) string {
+		claims := map[string]any{"iss": iss.URL, "sub": "user", "aud": storage, "exp": now.Add(time.Hour).Unix()}
+		for k, v := range changes {
+			claims[k] = v
+		}
+		return signJWT(t, signer, header, claims)
+	}
+	valid := mint(key, nil)
+	forged := mint(forgedKey, nil)
+	expired := mint(key, map[string]any{"exp": now.Add(-time.Hour).Unix()})
+	otherIssuer := mint(key, map[string]any{"iss": "https://other.example"})
+
+	type testCase struct {
+		description   string
+		envToken      string
+		xdgToken      string
+		expectedToken string
+		expectedErrs  []error
+	}
+
+	testCases := []testCase{
+		{"Valid env token", valid, forged, valid, nil},
+		{"Invalid signature in env, valid XDG token", forged, valid, valid, nil},
+		{"Expired env token, valid XDG token", expired, valid, valid, nil},
+		{"Opaque env token, valid XDG token", "opaque_token", valid, valid, nil},
+		{
+			"No valid token",
+			otherIssuer, forged, "",
+			[]error{disc.ErrNoTokenFound, disc.ErrVerificationFailed, disc.ErrNoTrustedIssuer, disc.ErrInvalidSignature},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				d, err := disc.New(
+					disc.WithEnvMap(map[string]string{"BEARER_TOKEN": tc.envToken, "XDG_RUNTIME_DIR": "/run/user/4242"}),
+					disc.WithFS(fstest.MapFS{"run/user/4242/bt_u4242": {Data: []byte(tc.xdgToken + "\n")}}),
+					disc.WithUID("4242"),
+					disc.WithVerification(v, disc.ValidationOptions{Audience: storage}),
+				)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				res, err := d.DiscoverContext(context.Background())
+				if tc.expectedErrs != nil {
+					for _, expectedErr := range tc.expectedErrs {
+						if !errors.Is(err, expectedErr) {
+							t.Errorf("Expected error wrapping %s, got %v", expectedErr, err)
+						}
+					}
+					if err != nil {
+						for _, location := range []string{"BEARER_TOKEN", "XDG_RUNTIME_DIR"} {
+							if !strings.Contains(err.Error(), location) {
+								t.Errorf("Expected error to name %s, got %v", location, err)
+							}
+						}
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if string(res.Bytes()) != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, res.Bytes())
+				}
+				if tc.expectedToken != tc.envToken && len(res.Warnings()) == 0 {
+					t.Error("Expected a warning about the skipped env token")
+				}
+			},
+		)
+	}
+}
+
+func TestWithVerificationLeeway(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := newTestIssuer(t, map[string]*rsa.PrivateKey{"rsa1": key})
+	v, err := disc.NewVerifier(iss.URL, disc.WithHTTPClient(iss.Client()))
+	if err != nil {
+		t.Fatalf("Could not construct Verifier: %s", err)
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	header := map[string]any{"alg": "RS256", "kid": "rsa1"}
+
+	type testCase struct {
+		description string
+		exp         time.Time
+		opts        []disc.Option
+		expectedErr error
+	}
+
+	testCases := []testCase{
+		{
+			"Expired within the leeway of the Discoverer",
+			now.Add(-2 * time.Minute),
+			[]disc.Option{disc.WithLeeway(5 * time.Minute)},
+			nil,
+		},
+		{
+			"Expired beyond the leeway of the Discoverer",
+			now.Add(-10 * time.Minute),
+			[]disc.Option{disc.WithLeeway(5 * time.Minute)},
+			disc.ErrTokenExpired,
+		},
+		{"Expired within the default leeway", now.Add(-30 * time.Second), nil, nil},
+		{"Expired without leeway", now.Add(-30 * time.Second), []disc.Option{disc.WithLeeway(0)}, disc.ErrTokenExpired},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				tok := signJWT(t, key, header, map[string]any{"iss": iss.URL, "sub": "user", "exp": tc.exp.Unix()})
+				opts := append([]disc.Option{
+					disc.WithEnvMap(map[string]string{"BEARER_TOKEN": tok}),
+					disc.WithFS(fstest.MapFS{}),
+					disc.WithUID("4242"),
+					disc.WithClock(func() time.Time { return now }),
+					disc.WithVerification(v, disc.ValidationOptions{}),
+				}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				_, err = d.DiscoverContext(context.Background())
+				if tc.expectedErr == nil && err != nil {
+					t.Errorf("Expected nil error, got %v", err)
+				}
+				if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+					t.Errorf("Expected error %s, got %v", tc.expectedErr, err)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,261 @@
+package tokendiscovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultJWKSTTL is how long a Verifier keeps the keys of its issuer unless set otherwise with WithJWKSTTL
+const DefaultJWKSTTL = time.Hour
+
+// DefaultJWKSRefetchInterval is how often, at most, a Verifier fetches the keys of its issuer again for tokens naming
+// unknown keys, unless set otherwise with WithJWKSRefetchInterval
+const DefaultJWKSRefetchInterval = 5 * time.Minute
+
+// maxMetadataSize limits the size of the documents fetched from token issuers
+const maxMetadataSize = 1 << 20
+
+// Verifier verifies tokens from a single issuer, fetching its keys as described by OpenID Connect Discovery: the
+// jwks_uri in the metadata of the issuer, as returned by FetchIssuerMetadata, names the JSON Web Key Set. The keys are
+// cached for a while, and fetched again when a token names a key that is not among them, as happens when the issuer
+// rotates its keys, but no more often than the refetch interval. A Verifier is safe for concurrent use.
+type Verifier struct {
+	issuer string
+	client *http.Client
+	ttl    time.Duration
+	algs   []string
+
+	// refetchInterval is the least time between fetches of keys for tokens naming unknown keys
+	refetchInterval time.Duration
+
+	// jwksPath is the file or directory holding the keys of a Verifier made by NewVerifierFromJWKSFile
+	jwksPath string
+	jwksDir  bool
+
+	mu        sync.Mutex
+	keys      *JWKSet
+	fetchedAt time.Time
+	// refetchAt is when the keys may next be fetched for a token naming an unknown key
+	refetchAt time.Time
+	// pinned holds the keys read from the JWKS files of a Verifier made by NewVerifierFromJWKSFile, by path
+	pinned map[string]*pinnedJWKS
+}
+
+// VerifierOption configures a Verifier
+type VerifierOption func(*Verifier) error
+
+// WithHTTPClient sets the client a Verifier uses to fetch keys, in place of http.DefaultClient
+func WithHTTPClient(client *http.Client) VerifierOption {
+	return func(v *Verifier) error {
+		if client == nil {
+			return fmt.Errorf("%w: HTTP client cannot be nil", ErrInvalidOption)
+		}
+		v.client = client
+		return nil
+	}
+}
+
+// WithJWKSTTL sets how long a Verifier keeps the keys of its issuer before fetching them again, DefaultJWKSTTL by
+// default
+func WithJWKSTTL(ttl time.Duration) VerifierOption {
+	return func(v *Verifier) error {
+		if ttl <= 0 {
+			return fmt.Errorf("%w: JWKS TTL must be positive", ErrInvalidOption)
+		}
+		v.ttl = ttl
+		return nil
+	}
+}
+
+// WithJWKSRefetchInterval sets how long a Verifier waits after fetching the keys of its issuer before fetching them
+// again for a token naming an unknown key, DefaultJWKSRefetchInterval by default. Until then, such tokens fail with
+// ErrUnknownKey, so that tokens with made-up key IDs cannot make the Verifier flood the issuer with requests.
+func WithJWKSRefetchInterval(interval time.Duration) VerifierOption {
+	return func(v *Verifier) error {
+		if interval <= 0 {
+			return fmt.Errorf("%w: JWKS refetch interval must be positive", ErrInvalidOption)
+		}
+		v.refetchInterval = interval
+		return nil
+	}
+}
+
+// WithAllowedAlgorithms sets the signing algorithms a Verifier accepts, DefaultAlgorithms by default. Each must be one
+// of DefaultAlgorithms, which are the only ones supported.
+func WithAllowedAlgorithms(algs ...string) VerifierOption {
+	return func(v *Verifier) error {
+		if len(algs) == 0 {
+			return fmt.Errorf("%w: at least one algorithm must be allowed", ErrInvalidOption)
+		}
+		for _, alg := range algs {
+			if !slices.Contains(DefaultAlgorithms, alg) {
+				return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidOption, alg)
+			}
+		}
+		v.algs = slices.Clone(algs)
+		return nil
+	}
+}
+
+// NewVerifier returns a Verifier for tokens issued by issuer, an https URL such as https://wlcg.cloud.cnaf.infn.it/.
+// Nothing is fetched until a token is verified.
+func NewVerifier(issuer string, opts ...VerifierOption) (*Verifier, error) {
+	if issuer == "" {
+		return nil, fmt.Errorf("%w: issuer cannot be empty", ErrInvalidOption)
+	}
+	v := &Verifier{
+		issuer:          issuer,
+		client:          http.DefaultClient,
+		ttl:             DefaultJWKSTTL,
+		algs:            DefaultAlgorithms,
+		refetchInterval: DefaultJWKSRefetchInterval,
+	}
+	for _, opt := range opts {
+		if err := opt(v); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// Verify is like the package-level Verify, using the keys of the issuer of v, and also checks that the iss claim of tok
+// is that issuer; otherwise, the returned error wraps ErrNoTrustedIssuer. If the key named by tok is unknown, the keys
+// are fetched again once before giving up, unless they were fetched within the refetch interval set with
+// WithJWKSRefetchInterval. For a Verifier made by NewVerifierFromJWKSFile, the keys are read from files instead, as
+// described there.
+func (v *Verifier) Verify(ctx context.Context, tok []byte, opts ...VerifyOption) (Claims, error) {
+	// The algorithms of v apply, whatever opts holds, and are checked before anything is fetched
+	opts = append(slices.Clone(opts), VerifyAlgorithms(v.algs...))
+	if h, err := ParseHeader(tok); err == nil && !slices.Contains(v.algs, h.Alg) {
+		return nil, fmt.Errorf("%w: %q", ErrAlgorithmNotAllowed, h.Alg)
+	}
+	if v.jwksPath != "" {
+		keys, err := v.pinnedKeys(tok)
+		if err != nil {
+			return nil, err
+		}
+		return Verify(tok, keys, opts...)
+	}
+	keys, fresh, err := v.cachedKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := Verify(tok, keys, opts...)
+	if errors.Is(err, ErrUnknownKey) && !fresh && v.claimRefetch() {
+		if keys, err = v.fetchKeys(ctx); err != nil {
+			return nil, err
+		}
+		claims, err = Verify(tok, keys, opts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if normalizeIssuer(claims.Issuer()) != normalizeIssuer(v.issuer) {
+		return nil, issuerError(claims.Issuer())
+	}
+	return claims, nil
+}
+
+// cachedKeys returns the keys of the issuer of v, fetching them if they are missing or stale. fresh reports whether
+// they were fetched by this call.
+func (v *Verifier) cachedKeys(ctx context.Context) (keys *JWKSet, fresh bool, err error) {
+	v.mu.Lock()
+	keys, fetchedAt := v.keys, v.fetchedAt
+	v.mu.Unlock()
+	if keys != nil && time.Since(fetchedAt) < v.ttl {
+		return keys, false, nil
+	}
+	keys, err = v.fetchKeys(ctx)
+	return keys, true, err
+}
+
+// claimRefetch reports whether the keys may be fetched again for a token naming an unknown key, and if so, defers the
+// next such fetch by the refetch interval
+func (v *Verifier) claimRefetch() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := time.Now()
+	if now.Before(v.refetchAt) {
+		return false
+	}
+	v.refetchAt = now.Add(v.refetchInterval)
+	return true
+}
+
+// fetchKeys fetches the keys of the issuer of v and caches them
+func (v *Verifier) fetchKeys(ctx context.Context) (*JWKSet, error) {
+	metadata, err := FetchIssuerMetadata(ctx, v.issuer, v.client)
+	if err != nil {
+		return nil, err
+	}
+	if metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("metadata of %s has no jwks_uri", v.issuer)
+	}
+	data, err := fetch(ctx, v.client, metadata.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", metadata.JWKSURI, err)
+	}
+	v.mu.Lock()
+	v.keys, v.fetchedAt = keys, time.Now()
+	v.refetchAt = v.fetchedAt.Add(v.refetchInterval)
+	v.mu.Unlock()
+	return keys, nil
+}
+
+// fetchJSON fetches the JSON document at url and decodes it into dst
+func fetchJSON(ctx context.Context, client *http.Client, url string, dst any) error {
+	data, err := fetch(ctx, client, url)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, dst); err != nil {
+		return fmt.Errorf("%s: %w", url, err)
+	}
+	return nil
+}
+
+// fetch returns the body of the response to a GET request for url, which must have status 200
+func fetch(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	return do(client, req)
+}
+
+// do sends req with client and returns the body of the response, which must have status 200. If it does not, and the
+// body is an OAuth error response, the returned error is an *OAuthError.
+func do(client *http.Client, req *http.Request) ([]byte, error) {
+	url := req.URL.Redacted()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrIssuerUnreachable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		if err := oauthErrorFrom(resp); err != nil {
+			return nil, fmt.Errorf("%s: %w", url, err)
+		}
+		return nil, fmt.Errorf("%w: %s: %s", ErrUnexpectedStatus, url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxMetadataSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+	if len(data) > maxMetadataSize {
+		return nil, fmt.Errorf("%s: response is larger than %d bytes", url, maxMetadataSize)
+	}
+	return data, nil
+}
@@ -0,0 +1,227 @@
+package tokendiscovery_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+// testIssuer is an OIDC issuer served by httptest, whose keys can be rotated
+type testIssuer struct {
+	*httptest.Server
+	mu          sync.Mutex
+	keys        map[string]*rsa.PrivateKey
+	jwksFetches atomic.Int32
+}
+
+func newTestIssuer(t *testing.T, keys map[string]*rsa.PrivateKey) *testIssuer {
+	iss := &testIssuer{keys: keys}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"issuer":%q,"jwks_uri":%q}`, iss.URL, iss.URL+"/jwks")
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		iss.jwksFetches.Add(1)
+		iss.mu.Lock()
+		defer iss.mu.Unlock()
+		w.Write(jwksJSON(iss.keys))
+	})
+	iss.Server = httptest.NewServer(mux)
+	t.Cleanup(iss.Close)
+	return iss
+}
+
+func (iss *testIssuer) setKeys(keys map[string]*rsa.PrivateKey) {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	iss.keys = keys
+}
+
+func TestVerifier(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := newTestIssuer(t, map[string]*rsa.PrivateKey{"old": oldKey})
+	claims := map[string]any{"iss": iss.URL, "sub": "user", "exp": time.Now().Add(time.Hour).Unix()}
+
+	v, err := disc.NewVerifier(iss.URL, disc.WithHTTPClient(iss.Client()), disc.WithJWKSRefetchInterval(time.Nanosecond))
+	if err != nil {
+		t.Fatalf("Could not construct Verifier: %s", err)
+	}
+	ctx := context.Background()
+
+	tok := signJWT(t, oldKey, map[string]any{"alg": "RS256", "kid": "old"}, claims)
+	for i := 0; i < 2; i++ {
+		if _, err := v.Verify(ctx, []byte(tok)); err != nil {
+			t.Fatalf("Expected nil error, got %v", err)
+		}
+	}
+	if n := iss.jwksFetches.Load(); n != 1 {
+		t.Errorf("Expected keys to be fetched once and cached, got %d fetches", n)
+	}
+
+	t.Run(
+		"Rotation",
+		func(t *testing.T) {
+			iss.setKeys(map[string]*rsa.PrivateKey{"old": oldKey, "new": newKey})
+			tok := signJWT(t, newKey, map[string]any{"alg": "RS256", "kid": "new"}, claims)
+			claims, err := v.Verify(ctx, []byte(tok))
+			if err != nil {
+				t.Fatalf("Expected nil error, got %v", err)
+			}
+			if claims.Subject() != "user" {
+				t.Errorf("Subjects do not match.  Expected user, got %s", claims.Subject())
+			}
+			if n := iss.jwksFetches.Load(); n != 2 {
+				t.Errorf("Expected keys to be fetched again once, got %d fetches in total", n)
+			}
+		},
+	)
+
+	t.Run(
+		"Unknown key after refetch",
+		func(t *testing.T) {
+			before := iss.jwksFetches.Load()
+			tok := signJWT(t, newKey, map[string]any{"alg": "RS256", "kid": "missing"}, claims)
+			if _, err := v.Verify(ctx, []byte(tok)); !errors.Is(err, disc.ErrUnknownKey) {
+				t.Errorf("Expected error %s, got %v", disc.ErrUnknownKey, err)
+			}
+			if n := iss.jwksFetches.Load() - before; n != 1 {
+				t.Errorf("Expected keys to be fetched again once, got %d fetches", n)
+			}
+		},
+	)
+
+	t.Run(
+		"Refetch within interval",
+		func(t *testing.T) {
+			v, err := disc.NewVerifier(iss.URL, disc.WithHTTPClient(iss.Client()))
+			if err != nil {
+				t.Fatalf("Could not construct Verifier: %s", err)
+			}
+			if _, err := v.Verify(ctx, []byte(tok)); err != nil {
+				t.Fatalf("Expected nil error, got %v", err)
+			}
+			before := iss.jwksFetches.Load()
+			tok := signJWT(t, newKey, map[string]any{"alg": "RS256", "kid": "missing"}, claims)
+			for i := 0; i < 3; i++ {
+				if _, err := v.Verify(ctx, []byte(tok)); !errors.Is(err, disc.ErrUnknownKey) {
+					t.Errorf("Expected error %s, got %v", disc.ErrUnknownKey, err)
+				}
+			}
+			if n := iss.jwksFetches.Load() - before; n != 0 {
+				t.Errorf("Expected no keys to be fetched within the refetch interval, got %d fetches", n)
+			}
+		},
+	)
+
+	t.Run(
+		"Other issuer",
+		func(t *testing.T) {
+			tok := signJWT(t, oldKey, map[string]any{"alg": "RS256", "kid": "old"}, map[string]any{"iss": "https://other.example"})
+			if _, err := v.Verify(ctx, []byte(tok)); !errors.Is(err, disc.ErrNoTrustedIssuer) {
+				t.Errorf("Expected error %s, got %v", disc.ErrNoTrustedIssuer, err)
+			}
+		},
+	)
+
+	t.Run(
+		"Expired cache",
+		func(t *testing.T) {
+			v, err := disc.NewVerifier(iss.URL, disc.WithHTTPClient(iss.Client()), disc.WithJWKSTTL(time.Nanosecond))
+			if err != nil {
+				t.Fatalf("Could not construct Verifier: %s", err)
+			}
+			before := iss.jwksFetches.Load()
+			for i := 0; i < 2; i++ {
+				if _, err := v.Verify(ctx, []byte(tok)); err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+			}
+			if n := iss.jwksFetches.Load() - before; n != 2 {
+				t.Errorf("Expected keys to be fetched for each verification, got %d fetches", n)
+			}
+		},
+	)
+
+	t.Run(
+		"Algorithm not allowed by Verifier",
+		func(t *testing.T) {
+			v, err := disc.NewVerifier(iss.URL, disc.WithHTTPClient(iss.Client()), disc.WithAllowedAlgorithms("ES256"))
+			if err != nil {
+				t.Fatalf("Could not construct Verifier: %s", err)
+			}
+			before := iss.jwksFetches.Load()
+			_, err = v.Verify(ctx, []byte(tok), disc.VerifyAlgorithms("RS256"))
+			if !errors.Is(err, disc.ErrAlgorithmNotAllowed) {
+				t.Errorf("Expected error %s, got %v", disc.ErrAlgorithmNotAllowed, err)
+			}
+			if n := iss.jwksFetches.Load() - before; n != 0 {
+				t.Errorf("Expected no keys to be fetched, got %d fetches", n)
+			}
+		},
+	)
+
+	t.Run(
+		"Cancelled context",
+		func(t *testing.T) {
+			v, err := disc.NewVerifier(iss.URL, disc.WithHTTPClient(iss.Client()))
+			if err != nil {
+				t.Fatalf("Could not construct Verifier: %s", err)
+			}
+			ctx, cancel := context.WithCancel(ctx)
+			cancel()
+			if _, err := v.Verify(ctx, []byte(tok)); !errors.Is(err, context.Canceled) {
+				t.Errorf("Expected error %s, got %v", context.Canceled, err)
+			}
+		},
+	)
+}
+
+func TestNewVerifierInvalidOptions(t *testing.T) {
+	type testCase struct {
+		description string
+		issuer      string
+		opts        []disc.VerifierOption
+	}
+
+	testCases := []testCase{
+		{"empty issuer", "", nil},
+		{"nil HTTP client", "https://iam.example", []disc.VerifierOption{disc.WithHTTPClient(nil)}},
+		{"non-positive TTL", "https://iam.example", []disc.VerifierOption{disc.WithJWKSTTL(0)}},
+		{
+			"non-positive refetch interval",
+			"https://iam.example",
+			[]disc.VerifierOption{disc.WithJWKSRefetchInterval(0)},
+		},
+		{"no allowed algorithms", "https://iam.example", []disc.VerifierOption{disc.WithAllowedAlgorithms()}},
+		{"HS256 allowed", "https://iam.example", []disc.VerifierOption{disc.WithAllowedAlgorithms("RS256", "HS256")}},
+		{"none allowed", "https://iam.example", []disc.VerifierOption{disc.WithAllowedAlgorithms("none")}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				if _, err := disc.NewVerifier(tc.issuer, tc.opts...); !errors.Is(err, disc.ErrInvalidOption) {
+					t.Errorf("Expected error %s, got %v", disc.ErrInvalidOption, err)
+				}
+			},
+		)
+	}
+}
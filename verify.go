@@ -0,0 +1,156 @@
+package tokendiscovery
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"time"
+)
+
+// ErrUnknownKey indicates that the key set given to Verify holds no key identified by the kid header of the token
+var ErrUnknownKey = errors.New("no key matches the token")
+
+// ErrInvalidSignature indicates that the signature of a token does not match its contents and the key that should have
+// signed it
+var ErrInvalidSignature = errors.New("token signature is invalid")
+
+// ErrAlgorithmNotAllowed indicates that a token is signed with an algorithm that is not in the allowlist of Verify,
+// such as none or HS256. It is checked before any cryptographic work.
+var ErrAlgorithmNotAllowed = errors.New("signing algorithm is not allowed")
+
+// ErrUnsupportedAlgorithm indicates that the signing algorithm of a token does not match the key that should have
+// signed it
+var ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+
+// DefaultAlgorithms are the signing algorithms Verify accepts unless set otherwise with VerifyAlgorithms or
+// WithAllowedAlgorithms. They are also the only ones supported.
+var DefaultAlgorithms = []string{"RS256", "ES256"}
+
+// VerifyOption configures Verify
+type VerifyOption func(*verifyConfig)
+
+// verifyConfig holds the settings of Verify
+type verifyConfig struct {
+	now    func() time.Time
+	leeway time.Duration
+	algs   []string
+}
+
+// VerifyAt makes Verify check the exp and nbf claims of the token against now, in place of time.Now
+func VerifyAt(now time.Time) VerifyOption {
+	return func(c *verifyConfig) {
+		c.now = func() time.Time { return now }
+	}
+}
+
+// VerifyLeeway sets the clock skew tolerated by Verify when checking the exp and nbf claims, DefaultLeeway by default
+func VerifyLeeway(leeway time.Duration) VerifyOption {
+	return func(c *verifyConfig) {
+		c.leeway = max(leeway, 0)
+	}
+}
+
+// VerifyAlgorithms restricts the signing algorithms Verify accepts to those of algs that are among DefaultAlgorithms
+func VerifyAlgorithms(algs ...string) VerifyOption {
+	return func(c *verifyConfig) {
+		c.algs = slices.DeleteFunc(slices.Clone(algs), func(alg string) bool {
+			return !slices.Contains(DefaultAlgorithms, alg)
+		})
+	}
+}
+
+// Verify checks the signature of tok, a JWT, against the key in keys identified by its kid header, or the only key in
+// keys if it has none, and returns its claims. The exp and nbf claims are then checked as for CheckValidity. The
+// signing algorithm must be one of DefaultAlgorithms, or those set with VerifyAlgorithms; otherwise, the returned error
+// wraps ErrAlgorithmNotAllowed. If no key matches, the returned error wraps ErrUnknownKey; if the algorithm does not
+// match the key, ErrUnsupportedAlgorithm; and if the signature is wrong, ErrInvalidSignature. Once the signature of a
+// token is found to be valid with keys, it is not checked again until the token expires, as described for
+// SetTokenCacheSize.
+func Verify(tok []byte, keys *JWKSet, opts ...VerifyOption) (Claims, error) {
+	cfg := verifyConfig{now: time.Now, leeway: DefaultLeeway, algs: DefaultAlgorithms}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cacheKey := claimsCacheKey(tok)
+	if entry, ok := tokenCache.get(cacheKey); ok && keys != nil && entry.verifiedWith == keys &&
+		slices.Contains(cfg.algs, entry.alg) {
+		// The signature was found to be valid with keys before, and only the times need checking again
+		if err := entry.claims.checkTimes(cfg.now(), cfg.leeway); err != nil {
+			return nil, err
+		}
+		return entry.claims.clone(), nil
+	}
+	header, payload, signature, err := splitJWT(tok)
+	if err != nil {
+		return nil, err
+	}
+	h, err := ParseHeader(tok)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(cfg.algs, h.Alg) {
+		return nil, fmt.Errorf("%w: %q", ErrAlgorithmNotAllowed, h.Alg)
+	}
+	key, ok := keys.lookup(h.Kid)
+	if !ok {
+		return nil, fmt.Errorf("%w: kid %q", ErrUnknownKey, h.Kid)
+	}
+	if key.alg != "" && key.alg != h.Alg {
+		return nil, fmt.Errorf("%w: token is signed with %s, but key %q is for %s", ErrUnsupportedAlgorithm, h.Alg, key.kid,
+			key.alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(string(bytes.TrimRight(signature, "=")))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+	digest := sha256.Sum256(append(append(append([]byte(nil), header...), '.'), payload...))
+	if err := verifySignature(h.Alg, key, digest[:], sig); err != nil {
+		return nil, err
+	}
+	claims, err := parseClaimsCached(tok)
+	if err != nil {
+		return nil, err
+	}
+	entry := claimsCacheEntry{claims: claims, verifiedWith: keys, alg: h.Alg}
+	entry.exp, _ = claims.Expiry()
+	tokenCache.put(cacheKey, entry)
+	if err := claims.checkTimes(cfg.now(), cfg.leeway); err != nil {
+		return nil, err
+	}
+	return claims.clone(), nil
+}
+
+// verifySignature checks sig, the signature with alg of digest, against key
+func verifySignature(alg string, key jwk, digest, sig []byte) error {
+	switch pub := key.key.(type) {
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			break
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, sig); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if alg != "ES256" {
+			break
+		}
+		// JWS holds ECDSA signatures as the concatenation of r and s, rather than in ASN.1
+		if len(sig) != 64 {
+			return fmt.Errorf("%w: signature is %d bytes long, expected 64", ErrInvalidSignature, len(sig))
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: token is signed with %s, which does not match key %q", ErrUnsupportedAlgorithm, alg, key.kid)
+}
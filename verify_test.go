@@ -0,0 +1,236 @@
+package tokendiscovery_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+// signingInput returns the encoded header and claims of a JWT, joined by a dot
+func signingInput(t testing.TB, header, claims map[string]any) string {
+	t.Helper()
+	enc := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	return enc(header) + "." + enc(claims)
+}
+
+// signJWT mints an RS256 JWT with the given header and claims, signed with key
+func signJWT(t testing.TB, key *rsa.PrivateKey, header, claims map[string]any) string {
+	t.Helper()
+	input := signingInput(t, header, claims)
+	digest := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// jwksJSON returns a JWKS document holding the public keys of keys, by kid
+func jwksJSON(keys map[string]*rsa.PrivateKey) []byte {
+	var entries []string
+	for kid, key := range keys {
+		entries = append(entries, fmt.Sprintf(`{"kty":"RSA","use":"sig","alg":"RS256","kid":%q,"n":%q,"e":%q}`, kid,
+			base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())))
+	}
+	// Keys of unsupported types are ignored
+	return []byte(`{"keys":[` + strings.Join(entries, ",") + `,{"kty":"EC","crv":"P-521","kid":"ec1"},{"kty":"oct","kid":"hs"}]}`)
+}
+
+func TestVerify(t *testing.T) {
+	key1, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key2, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := disc.ParseJWKS(jwksJSON(map[string]*rsa.PrivateKey{"rsa1": key1, "rsa2": key2}))
+	if err != nil {
+		t.Fatalf("Could not parse key set: %s", err)
+	}
+	if keys.Len() != 2 {
+		t.Fatalf("Expected 2 keys in set, got %d", keys.Len())
+	}
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	claims := map[string]any{"sub": "user", "exp": now.Add(time.Hour).Unix()}
+	good := signJWT(t, key1, map[string]any{"alg": "RS256", "kid": "rsa1"}, claims)
+	segments := strings.Split(good, ".")
+	tampered := segments[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`)) + "." + segments[2]
+
+	type testCase struct {
+		description string
+		tok         string
+		expectedErr error
+	}
+
+	testCases := []testCase{
+		{"Good signature", good, nil},
+		{"Second key", signJWT(t, key2, map[string]any{"alg": "RS256", "kid": "rsa2"}, claims), nil},
+		{"Tampered payload", tampered, disc.ErrInvalidSignature},
+		{"Wrong key", signJWT(t, key2, map[string]any{"alg": "RS256", "kid": "rsa1"}, claims), disc.ErrInvalidSignature},
+		{"Unknown kid", signJWT(t, key1, map[string]any{"alg": "RS256", "kid": "rsa3"}, claims), disc.ErrUnknownKey},
+		{"No kid with several keys", signJWT(t, key1, map[string]any{"alg": "RS256"}, claims), disc.ErrUnknownKey},
+		{"Algorithm not allowed", signJWT(t, key1, map[string]any{"alg": "PS256", "kid": "rsa1"}, claims), disc.ErrAlgorithmNotAllowed},
+		{"Algorithm none", string(encodeJWT(`{"alg":"none","kid":"rsa1"}`, `{"sub":"user"}`, false)), disc.ErrAlgorithmNotAllowed},
+		{"Algorithm does not match key", signJWT(t, key1, map[string]any{"alg": "ES256", "kid": "rsa1"}, claims), disc.ErrUnsupportedAlgorithm},
+		{"Expired", signJWT(t, key1, map[string]any{"alg": "RS256", "kid": "rsa1"}, map[string]any{"exp": now.Add(-time.Hour).Unix()}), disc.ErrTokenExpired},
+		{"Not a JWT", "opaque_token", disc.ErrNotAJWT},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				verified, err := disc.Verify([]byte(tc.tok), keys, disc.VerifyAt(now))
+				if !errors.Is(err, tc.expectedErr) {
+					t.Fatalf("Expected error %v, got %v", tc.expectedErr, err)
+				}
+				if err == nil && verified.Subject() != "user" {
+					t.Errorf("Subjects do not match.  Expected user, got %s", verified.Subject())
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"Single key without kid",
+		func(t *testing.T) {
+			single, err := disc.ParseJWKS(jwksJSON(map[string]*rsa.PrivateKey{"rsa1": key1}))
+			if err != nil {
+				t.Fatalf("Could not parse key set: %s", err)
+			}
+			tok := signJWT(t, key1, map[string]any{"alg": "RS256"}, claims)
+			if _, err := disc.Verify([]byte(tok), single, disc.VerifyAt(now)); err != nil {
+				t.Errorf("Expected nil error, got %v", err)
+			}
+		},
+	)
+}
+
+func TestParseJWKSInvalid(t *testing.T) {
+	type testCase struct {
+		description string
+		data        string
+	}
+
+	testCases := []testCase{
+		{"Not JSON", "keys"},
+		{"Invalid modulus", `{"keys":[{"kty":"RSA","kid":"a","n":"!!","e":"AQAB"}]}`},
+		{"Missing exponent", `{"keys":[{"kty":"RSA","kid":"a","n":"AQAB"}]}`},
+		{"Invalid certificate", `{"keys":[{"kty":"RSA","kid":"a","x5c":["AQAB"]}]}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				if _, err := disc.ParseJWKS([]byte(tc.data)); !errors.Is(err, disc.ErrInvalidJWKS) {
+					t.Errorf("Expected error %s, got %v", disc.ErrInvalidJWKS, err)
+				}
+			},
+		)
+	}
+}
+
+// signES256 mints an ES256 JWT with the given header and claims, signed with key
+func signES256(t testing.TB, key *ecdsa.PrivateKey, header, claims map[string]any) string {
+	t.Helper()
+	input := signingInput(t, header, claims)
+	digest := sha256.Sum256([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// hmacJWT mints an HS256 JWT with the given header and claims, using secret as the HMAC key
+func hmacJWT(secret []byte, header, claims string) string {
+	signingInput := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaJWKS := string(jwksJSON(map[string]*rsa.PrivateKey{"rsa1": rsaKey}))
+	ecJWK := fmt.Sprintf(`{"kty":"EC","crv":"P-256","kid":"ec1","x":%q,"y":%q}`,
+		base64.RawURLEncoding.EncodeToString(ecKey.X.FillBytes(make([]byte, 32))),
+		base64.RawURLEncoding.EncodeToString(ecKey.Y.FillBytes(make([]byte, 32))))
+	keys, err := disc.ParseJWKS([]byte(strings.Replace(rsaJWKS, `{"keys":[`, `{"keys":[`+ecJWK+",", 1)))
+	if err != nil {
+		t.Fatalf("Could not parse key set: %s", err)
+	}
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	claims := map[string]any{"sub": "user"}
+	es256 := signES256(t, ecKey, map[string]any{"alg": "ES256", "kid": "ec1"}, claims)
+	tampered := []byte(es256)
+	tampered[len(es256)-40] ^= 'A' ^ 'B'
+	publicKey := base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes())
+
+	type testCase struct {
+		description string
+		tok         string
+		opts        []disc.VerifyOption
+		expectedErr error
+	}
+
+	testCases := []testCase{
+		{"RS256 allowed", signJWT(t, rsaKey, map[string]any{"alg": "RS256", "kid": "rsa1"}, claims), nil, nil},
+		{"ES256 allowed", es256, nil, nil},
+		{"ES256 with tampered signature", string(tampered), nil, disc.ErrInvalidSignature},
+		{"ES256 not in allowlist", es256, []disc.VerifyOption{disc.VerifyAlgorithms("RS256")}, disc.ErrAlgorithmNotAllowed},
+		{"alg none", string(encodeJWT(`{"alg":"none"}`, `{"sub":"user"}`, false)), nil, disc.ErrAlgorithmNotAllowed},
+		{"alg None", string(encodeJWT(`{"alg":"None","kid":"rsa1"}`, `{"sub":"user"}`, false)), nil, disc.ErrAlgorithmNotAllowed},
+		{"HS256 with public key as secret", hmacJWT([]byte(publicKey), `{"alg":"HS256","kid":"rsa1"}`, `{"sub":"user"}`), nil, disc.ErrAlgorithmNotAllowed},
+		{"HS256 even if requested", hmacJWT([]byte(publicKey), `{"alg":"HS256","kid":"rsa1"}`, `{"sub":"user"}`), []disc.VerifyOption{disc.VerifyAlgorithms("HS256", "RS256")}, disc.ErrAlgorithmNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				opts := append([]disc.VerifyOption{disc.VerifyAt(now)}, tc.opts...)
+				if _, err := disc.Verify([]byte(tc.tok), keys, opts...); !errors.Is(err, tc.expectedErr) {
+					t.Errorf("Expected error %v, got %v", tc.expectedErr, err)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,83 @@
+package tokendiscovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// defaultPollInterval and defaultPollJitter configure WaitForToken when WithPollInterval is not given
+const (
+	defaultPollInterval = time.Second
+	defaultPollJitter   = 100 * time.Millisecond
+)
+
+// WithPollInterval sets how often WaitForToken repeats the discovery procedure. A random delay of up to jitter is
+// added to each interval, so that many processes started together do not poll in lockstep. The default is every second,
+// with up to 100ms of jitter.
+func WithPollInterval(interval, jitter time.Duration) Option {
+	return func(d *Discoverer) error {
+		if interval <= 0 {
+			return fmt.Errorf("%w: poll interval must be positive", ErrInvalidOption)
+		}
+		if jitter < 0 {
+			return fmt.Errorf("%w: poll jitter cannot be negative", ErrInvalidOption)
+		}
+		d.pollInterval = interval
+		d.pollJitter = jitter
+		return nil
+	}
+}
+
+// WithMaxPollAttempts makes WaitForToken give up after running the discovery procedure attempts times without finding
+// a token. By default, WaitForToken polls until its context is done.
+func WithMaxPollAttempts(attempts int) Option {
+	return func(d *Discoverer) error {
+		if attempts < 1 {
+			return fmt.Errorf("%w: poll attempts must be at least 1", ErrInvalidOption)
+		}
+		d.maxPollAttempts = attempts
+		return nil
+	}
+}
+
+// WaitForToken is like FindTokenAndFileContext, but if no token is found, repeats the discovery procedure until one
+// appears, for jobs whose token is delivered some time after they start. It polls every second until ctx is done, in
+// which case the returned error wraps both ctx.Err() and the error from the last attempt. Errors other than
+// ErrNoTokenFound, such as a token file that cannot be read, are returned immediately.
+func WaitForToken(ctx context.Context) ([]byte, string, error) {
+	return defaultDiscoverer.WaitForToken(ctx)
+}
+
+// WaitForToken is like the package-level WaitForToken, but uses the discovery procedure as configured on d, and polls
+// as configured with WithPollInterval and WithMaxPollAttempts
+func (d *Discoverer) WaitForToken(ctx context.Context) ([]byte, string, error) {
+	interval, jitter := d.pollInterval, d.pollJitter
+	if interval == 0 {
+		interval, jitter = defaultPollInterval, defaultPollJitter
+	}
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		tok, path, err := d.FindTokenAndFileContext(ctx)
+		if ctxErr := ctx.Err(); err != nil && ctxErr != nil && lastErr != nil {
+			return nil, "", fmt.Errorf("gave up waiting for token: %w: %w", ctxErr, lastErr)
+		}
+		if err == nil || !errors.Is(err, ErrNoTokenFound) {
+			return tok, path, err
+		}
+		lastErr = err
+		if d.maxPollAttempts > 0 && attempt >= d.maxPollAttempts {
+			return nil, "", fmt.Errorf("no token found after %d attempts: %w", attempt, err)
+		}
+		d.debug("waiting for token", "attempt", attempt, "error", err)
+		delay := interval
+		if jitter > 0 {
+			delay += rand.N(jitter)
+		}
+		if ctxErr := sleepContext(ctx, delay); ctxErr != nil {
+			return nil, "", fmt.Errorf("gave up waiting for token: %w: %w", ctxErr, err)
+		}
+	}
+}
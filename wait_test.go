@@ -0,0 +1,118 @@
+package tokendiscovery_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestWaitForToken(t *testing.T) {
+	type testCase struct {
+		description   string
+		delay         time.Duration
+		timeout       time.Duration
+		opts          []disc.Option
+		expectedToken string
+		expectedErr   error
+	}
+
+	testCases := []testCase{
+		{
+			"Token file appears after a delay",
+			50 * time.Millisecond,
+			10 * time.Second,
+			nil,
+			"delivered_token",
+			nil,
+		},
+		{
+			"Token file already exists",
+			0,
+			10 * time.Second,
+			nil,
+			"delivered_token",
+			nil,
+		},
+		{
+			"Token file never appears",
+			-1,
+			100 * time.Millisecond,
+			nil,
+			"",
+			context.DeadlineExceeded,
+		},
+		{
+			"Token file never appears, attempts exhausted",
+			-1,
+			10 * time.Second,
+			[]disc.Option{disc.WithMaxPollAttempts(3)},
+			"",
+			disc.ErrNoTokenFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				dir := t.TempDir()
+				fname := filepath.Join(dir, "bt_u4242")
+				writeToken := func() {
+					tmp := filepath.Join(dir, "token.tmp")
+					if err := os.WriteFile(tmp, []byte("delivered_token\n"), 0o600); err != nil {
+						t.Error(err)
+						return
+					}
+					if err := os.Rename(tmp, fname); err != nil {
+						t.Error(err)
+					}
+				}
+				switch {
+				case tc.delay == 0:
+					writeToken()
+				case tc.delay > 0:
+					timer := time.AfterFunc(tc.delay, writeToken)
+					defer timer.Stop()
+				}
+
+				opts := append([]disc.Option{
+					disc.WithEnvMap(map[string]string{}),
+					disc.WithFallbackDir(dir),
+					disc.WithUID("4242"),
+					disc.WithoutOwnershipCheck(),
+					disc.WithPollInterval(10*time.Millisecond, 5*time.Millisecond),
+				}, tc.opts...)
+				d, err := disc.New(opts...)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+				defer cancel()
+				tok, path, err := d.WaitForToken(ctx)
+				if tc.expectedErr != nil {
+					if !errors.Is(err, tc.expectedErr) {
+						t.Errorf("Expected error %s, got %v", tc.expectedErr, err)
+					}
+					if !errors.Is(err, disc.ErrNoTokenFound) {
+						t.Errorf("Expected error %s, got %v", disc.ErrNoTokenFound, err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if string(tok) != tc.expectedToken {
+					t.Errorf("Token strings do not match.  Expected %s, got %s", tc.expectedToken, string(tok))
+				}
+				if path != fname {
+					t.Errorf("Token paths do not match. Expected path %s, got %s", fname, path)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,16 @@
+package tokendiscovery
+
+// WipeBytes overwrites b with zeros, for callers that hold a token, such as one returned by FindToken, and want to
+// scrub it from memory once it is no longer needed. Tokens returned as strings, by FindTokenString for example, cannot
+// be wiped, since Go strings are immutable; security-sensitive callers should use the functions returning byte slices.
+func WipeBytes(b []byte) {
+	clear(b)
+}
+
+// Wipe overwrites the token held by r with zeros and removes it from r, for long-running programs that replace tokens
+// and want to scrub the old ones from memory. Since Bytes and the other accessors return copies, those copies must be
+// wiped separately, with WipeBytes. Copies of r made before Wipe share its token, and so hold a wiped token afterwards.
+func (r *Result) Wipe() {
+	WipeBytes(r.token)
+	r.token = nil
+}
@@ -0,0 +1,66 @@
+package tokendiscovery_test
+
+import (
+	"bytes"
+	"testing"
+	"testing/fstest"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestWipe(t *testing.T) {
+	type testCase struct {
+		description string
+		env         map[string]string
+	}
+
+	testCases := []testCase{
+		{"Token from BEARER_TOKEN", map[string]string{"BEARER_TOKEN": "secret_token"}},
+		{"Token from BEARER_TOKEN_FILE", map[string]string{"BEARER_TOKEN_FILE": "/home/user/token"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				d, err := disc.New(
+					disc.WithEnvMap(tc.env),
+					disc.WithFS(fstest.MapFS{"home/user/token": {Data: []byte("secret_token\n")}}),
+				)
+				if err != nil {
+					t.Fatalf("Could not construct Discoverer: %s", err)
+				}
+				res, err := d.Discover()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				buf := res.TokenBuffer()
+				res.Wipe()
+				if !bytes.Equal(buf, make([]byte, len(buf))) {
+					t.Errorf("Expected token buffer to be zeroed, got %q", buf)
+				}
+				if tok := res.Bytes(); tok != nil {
+					t.Errorf("Expected no token after Wipe, got %q", tok)
+				}
+
+				// Discovering again reads the token afresh
+				res, err = d.Discover()
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if tok := res.Bytes(); string(tok) != "secret_token" {
+					t.Errorf("Token strings do not match.  Expected secret_token, got %q", tok)
+				}
+			},
+		)
+	}
+}
+
+func TestWipeBytes(t *testing.T) {
+	tok := []byte("secret_token")
+	disc.WipeBytes(tok)
+	if !bytes.Equal(tok, make([]byte, len("secret_token"))) {
+		t.Errorf("Expected token to be zeroed, got %q", tok)
+	}
+	disc.WipeBytes(nil)
+}
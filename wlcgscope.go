@@ -0,0 +1,196 @@
+package tokendiscovery
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+)
+
+// ErrMalformedScope indicates that a scope claim holds an entry that is not a valid WLCG scope
+var ErrMalformedScope = errors.New("malformed scope")
+
+// The operations of the storage scopes defined by the WLCG Common JWT Profile
+const (
+	OperationRead   = "read"
+	OperationCreate = "create"
+	OperationModify = "modify"
+	OperationStage  = "stage"
+)
+
+// storageOperations are the operations allowed in storage scopes
+var storageOperations = map[string]bool{
+	OperationRead: true, OperationCreate: true, OperationModify: true, OperationStage: true,
+}
+
+// Scope is an entry of the scope claim of a token, such as storage.read:/store/user/alice, split into its parts. Scopes
+// that are not of the form resource.operation, such as openid, only have a Resource.
+type Scope struct {
+	// Resource is the part before the first dot, such as storage or compute
+	Resource string
+	// Operation is the part after the first dot, such as read, create, modify, or stage
+	Operation string
+	// Path is the resource path after the colon, with URL escapes decoded, or the empty string if there is none
+	Path string
+}
+
+// ParseScopes splits claim, a space-separated scope claim, into Scopes. Storage scopes must have one of the operations
+// read, create, modify, or stage, and a path, which must be absolute. Other scopes, such as compute.read, may omit the
+// path. If an entry is malformed, the returned error wraps ErrMalformedScope and gives its position in claim, counting
+// from 1.
+func ParseScopes(claim string) ([]Scope, error) {
+	fields := strings.Fields(claim)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	scopes := make([]Scope, 0, len(fields))
+	for i, field := range fields {
+		s, err := parseScope(field)
+		if err != nil {
+			return nil, fmt.Errorf("%w at position %d (%q): %s", ErrMalformedScope, i+1, field, err)
+		}
+		scopes = append(scopes, s)
+	}
+	return scopes, nil
+}
+
+// parseScope parses a single entry of a scope claim
+func parseScope(field string) (Scope, error) {
+	authz, rawPath, hasPath := strings.Cut(field, ":")
+	var s Scope
+	s.Resource, s.Operation, _ = strings.Cut(authz, ".")
+	if s.Resource == "" {
+		return Scope{}, errors.New("missing resource")
+	}
+	for _, r := range authz {
+		if r < 0x21 || r == 0x7f || r == '"' || r == '\\' {
+			return Scope{}, fmt.Errorf("invalid character %q", r)
+		}
+	}
+	if s.Resource == "storage" && !storageOperations[s.Operation] {
+		return Scope{}, fmt.Errorf("unknown storage operation %q", s.Operation)
+	}
+	if hasPath {
+		if !strings.HasPrefix(rawPath, "/") {
+			return Scope{}, errors.New("path must be absolute")
+		}
+		path, err := url.PathUnescape(rawPath)
+		if err != nil {
+			return Scope{}, fmt.Errorf("invalid path: %w", err)
+		}
+		s.Path = path
+	} else if s.Resource == "storage" {
+		return Scope{}, errors.New("storage scopes must have a path")
+	}
+	return s, nil
+}
+
+// String returns s as it appears in a scope claim, with special characters in the path escaped
+func (s Scope) String() string {
+	str := s.Resource
+	if s.Operation != "" {
+		str += "." + s.Operation
+	}
+	if s.Path != "" {
+		str += ":" + (&url.URL{Path: s.Path}).EscapedPath()
+	}
+	return str
+}
+
+// ParsedScopes returns the scopes of w, parsed as described for ParseScopes
+func (w WLCGClaims) ParsedScopes() ([]Scope, error) {
+	return ParseScopes(strings.Join(w.Scope, " "))
+}
+
+// Allows reports whether s authorizes the storage operation op on path. Following the WLCG Common JWT Profile, a scope
+// path authorizes itself and everything beneath it, and modify implies create. Paths are cleaned before comparing, so
+// trailing slashes and "." segments do not matter.
+func (s Scope) Allows(op, path string) bool {
+	if s.Resource != "storage" || s.Path == "" {
+		return false
+	}
+	if s.Operation != op && !(s.Operation == OperationModify && op == OperationCreate) {
+		return false
+	}
+	return pathWithin(cleanScopePath(path), cleanScopePath(s.Path))
+}
+
+// cleanScopePath returns p as an absolute path with "." and ".." segments and trailing slashes removed
+func cleanScopePath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// pathWithin reports whether the cleaned path p is dir or lies beneath it
+func pathWithin(p, dir string) bool {
+	return dir == "/" || p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// Allows reports whether any of the storage scopes in the scope claim of c authorizes the storage operation op, such as
+// OperationRead, on path, as described for Scope.Allows. Malformed scopes are ignored.
+func (c Claims) Allows(op, path string) bool {
+	for _, field := range c.Scope() {
+		if s, err := parseScope(field); err == nil && s.Allows(op, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanRead reports whether the scopes of c allow reading path
+func (c Claims) CanRead(path string) bool { return c.Allows(OperationRead, path) }
+
+// CanWrite reports whether the scopes of c allow writing a new file at path, which storage.modify also allows
+func (c Claims) CanWrite(path string) bool { return c.Allows(OperationCreate, path) }
+
+// UniqueScopes returns the distinct scopes in scopes, sorted, with surrounding whitespace removed. Entries holding
+// several space-separated scopes, as in a scope claim, are split. scopes is not modified.
+func UniqueScopes(scopes []string) []string {
+	var unique []string
+	for _, entry := range scopes {
+		unique = append(unique, strings.Fields(entry)...)
+	}
+	slices.Sort(unique)
+	return slices.Compact(unique)
+}
+
+// NormalizeScopes is like UniqueScopes, but also drops storage scopes that are subsumed by another with the same
+// operation on a parent path, as described for Scope.Allows: storage.read:/ subsumes storage.read:/data, but not
+// storage.create:/data. Different operations are never merged, even though modify implies create. Callers that need
+// the scopes as they were granted should use UniqueScopes.
+func NormalizeScopes(scopes []string) []string {
+	unique := UniqueScopes(scopes)
+	parsed := make([]Scope, len(unique))
+	for i, field := range unique {
+		// Scopes that cannot be parsed are only kept
+		parsed[i], _ = parseScope(field)
+	}
+	var normalized []string
+	for i, field := range unique {
+		subsumed := false
+		for j, other := range parsed {
+			// Of scopes that subsume each other, such as storage.read:/data and storage.read:/data/, the first is kept
+			if j != i && subsumes(other, parsed[i]) && (j < i || !subsumes(parsed[i], other)) {
+				subsumed = true
+				break
+			}
+		}
+		if !subsumed {
+			normalized = append(normalized, field)
+		}
+	}
+	return normalized
+}
+
+// subsumes reports whether the storage scope s authorizes everything other does, with the same operation
+func subsumes(s, other Scope) bool {
+	return s.Resource == "storage" && other.Resource == "storage" && s.Operation == other.Operation &&
+		pathWithin(cleanScopePath(other.Path), cleanScopePath(s.Path))
+}
+
+// ScopesEqual reports whether a and b hold the same scopes once normalized with NormalizeScopes, that is, whether they
+// grant the same access whatever their order, duplicates and subsumed scopes
+func ScopesEqual(a, b []string) bool {
+	return slices.Equal(NormalizeScopes(a), NormalizeScopes(b))
+}
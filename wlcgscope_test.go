@@ -0,0 +1,282 @@
+package tokendiscovery_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	disc "github.com/shreyb/wlcg-bearer-token-discovery-go"
+)
+
+func TestParseScopes(t *testing.T) {
+	type testCase struct {
+		description string
+		claim       string
+		expected    []disc.Scope
+	}
+
+	testCases := []testCase{
+		{
+			"Every storage operation",
+			"storage.read:/ storage.create:/store/user storage.modify:/store/user/alice storage.stage:/tape",
+			[]disc.Scope{
+				{Resource: "storage", Operation: disc.OperationRead, Path: "/"},
+				{Resource: "storage", Operation: disc.OperationCreate, Path: "/store/user"},
+				{Resource: "storage", Operation: disc.OperationModify, Path: "/store/user/alice"},
+				{Resource: "storage", Operation: disc.OperationStage, Path: "/tape"},
+			},
+		},
+		{
+			"Scopes without a path",
+			"compute.read compute.create openid wlcg.groups",
+			[]disc.Scope{
+				{Resource: "compute", Operation: "read"},
+				{Resource: "compute", Operation: "create"},
+				{Resource: "openid"},
+				{Resource: "wlcg", Operation: "groups"},
+			},
+		},
+		{
+			"URL-encoded characters in path",
+			"storage.read:/store/user/alice%20smith/caf%C3%A9",
+			[]disc.Scope{{Resource: "storage", Operation: "read", Path: "/store/user/alice smith/café"}},
+		},
+		{"Extra whitespace", "  storage.read:/data \t", []disc.Scope{{Resource: "storage", Operation: "read", Path: "/data"}}},
+		{"Empty claim", "", nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				scopes, err := disc.ParseScopes(tc.claim)
+				if err != nil {
+					t.Fatalf("Expected nil error, got %v", err)
+				}
+				if !reflect.DeepEqual(scopes, tc.expected) {
+					t.Fatalf("Scopes do not match.  Expected %+v, got %+v", tc.expected, scopes)
+				}
+
+				// String round-trips
+				strs := make([]string, 0, len(scopes))
+				for _, s := range scopes {
+					strs = append(strs, s.String())
+				}
+				if claim := strings.Join(strs, " "); claim != strings.Join(strings.Fields(tc.claim), " ") {
+					t.Errorf("Scope claims do not match.  Expected %q, got %q", tc.claim, claim)
+				}
+			},
+		)
+	}
+}
+
+func TestParseScopesMalformed(t *testing.T) {
+	type testCase struct {
+		description      string
+		claim            string
+		expectedPosition string
+	}
+
+	testCases := []testCase{
+		{"Unknown storage operation", "storage.read:/ storage.delete:/data", "position 2"},
+		{"Storage scope without path", "compute.read storage.read", "position 2"},
+		{"Relative path", "storage.read:data", "position 1"},
+		{"Empty path", "storage.read:/ compute.read: openid", "position 2"},
+		{"Missing resource", ".read:/", "position 1"},
+		{"Only a path", ":/data", "position 1"},
+		{"Invalid escape", "openid storage.read:/data%zz", "position 2"},
+		{"Control character", "storage.read:/ compute\x01.read", "position 2"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				_, err := disc.ParseScopes(tc.claim)
+				if !errors.Is(err, disc.ErrMalformedScope) {
+					t.Fatalf("Expected error %s, got %v", disc.ErrMalformedScope, err)
+				}
+				if !strings.Contains(err.Error(), tc.expectedPosition) {
+					t.Errorf("Expected error to give %s, got %v", tc.expectedPosition, err)
+				}
+			},
+		)
+	}
+}
+
+func TestWLCGClaimsParsedScopes(t *testing.T) {
+	claims, err := disc.ParseClaims([]byte(makeJWT(t, map[string]any{"scope": "storage.read:/ compute.read"})))
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	scopes, err := claims.AsWLCG().ParsedScopes()
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	expected := []disc.Scope{{Resource: "storage", Operation: "read", Path: "/"}, {Resource: "compute", Operation: "read"}}
+	if !reflect.DeepEqual(scopes, expected) {
+		t.Errorf("Scopes do not match.  Expected %+v, got %+v", expected, scopes)
+	}
+}
+
+func TestClaimsAllows(t *testing.T) {
+	claims := disc.Claims{
+		"scope": "storage.read:/data storage.create:/store/user/alice/ storage.modify:/scratch/./tmp storage.stage:/tape " +
+			"compute.read storage.delete:/bogus",
+	}
+	root := disc.Claims{"scope": "storage.read:/"}
+
+	type testCase struct {
+		description string
+		claims      disc.Claims
+		op          string
+		path        string
+		expected    bool
+	}
+
+	testCases := []testCase{
+		{"Read scope path itself", claims, disc.OperationRead, "/data", true},
+		{"Read nested path", claims, disc.OperationRead, "/data/run1/file.root", true},
+		{"Read with trailing slash", claims, disc.OperationRead, "/data/", true},
+		{"Read with dot segments", claims, disc.OperationRead, "/data/./run1/../run2", true},
+		{"Dot segments escaping scope", claims, disc.OperationRead, "/data/../etc/passwd", false},
+		{"Sibling sharing a prefix string", claims, disc.OperationRead, "/database", false},
+		{"Parent of scope path", claims, disc.OperationRead, "/", false},
+		{"Read does not imply create", claims, disc.OperationCreate, "/data/new", false},
+		{"Create under scope with trailing slash", claims, disc.OperationCreate, "/store/user/alice/out.root", true},
+		{"Create scope path without trailing slash", claims, disc.OperationCreate, "/store/user/alice", true},
+		{"Create in sibling directory", claims, disc.OperationCreate, "/store/user/alicia/out.root", false},
+		{"Create does not imply modify", claims, disc.OperationModify, "/store/user/alice/out.root", false},
+		{"Modify implies create", claims, disc.OperationCreate, "/scratch/tmp/out", true},
+		{"Modify scope path with dot segment", claims, disc.OperationModify, "/scratch/tmp/out", true},
+		{"Stage is its own operation", claims, disc.OperationStage, "/tape/file", true},
+		{"Stage does not imply read", claims, disc.OperationRead, "/tape/file", false},
+		{"Malformed scope is ignored", claims, "delete", "/bogus", false},
+		{"Root scope", root, disc.OperationRead, "/any/where", true},
+		{"Root scope itself", root, disc.OperationRead, "/", true},
+		{"Relative path under root scope", root, disc.OperationRead, "relative/file", true},
+		{"No scope claim", disc.Claims{}, disc.OperationRead, "/data", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				if allowed := tc.claims.Allows(tc.op, tc.path); allowed != tc.expected {
+					t.Errorf("Expected Allows(%q, %q) to return %t, got %t", tc.op, tc.path, tc.expected, allowed)
+				}
+				var helper func(string) bool
+				switch tc.op {
+				case disc.OperationRead:
+					helper = tc.claims.CanRead
+				case disc.OperationCreate:
+					helper = tc.claims.CanWrite
+				default:
+					return
+				}
+				if allowed := helper(tc.path); allowed != tc.expected {
+					t.Errorf("Expected helper for %s on %q to return %t, got %t", tc.op, tc.path, tc.expected, allowed)
+				}
+			},
+		)
+	}
+}
+
+func TestNormalizeScopes(t *testing.T) {
+	type testCase struct {
+		description string
+		scopes      []string
+		unique      []string
+		normalized  []string
+	}
+
+	testCases := []testCase{
+		{
+			"Duplicates and whitespace",
+			[]string{" storage.read:/data", "openid", "storage.read:/data\n", "openid"},
+			[]string{"openid", "storage.read:/data"},
+			[]string{"openid", "storage.read:/data"},
+		},
+		{
+			"Space-separated entries",
+			[]string{"storage.read:/data openid", "compute.read"},
+			[]string{"compute.read", "openid", "storage.read:/data"},
+			[]string{"compute.read", "openid", "storage.read:/data"},
+		},
+		{
+			"Subsumed paths",
+			[]string{"storage.read:/data/run1", "storage.read:/data", "storage.read:/data/run1/file", "storage.read:/dataset"},
+			[]string{"storage.read:/data", "storage.read:/data/run1", "storage.read:/data/run1/file", "storage.read:/dataset"},
+			[]string{"storage.read:/data", "storage.read:/dataset"},
+		},
+		{
+			"Root path",
+			[]string{"storage.create:/store/user", "storage.create:/"},
+			[]string{"storage.create:/", "storage.create:/store/user"},
+			[]string{"storage.create:/"},
+		},
+		{
+			"Equivalent paths",
+			[]string{"storage.read:/data/", "storage.read:/data"},
+			[]string{"storage.read:/data", "storage.read:/data/"},
+			[]string{"storage.read:/data"},
+		},
+		{
+			"Operations do not collapse across each other",
+			[]string{"storage.read:/", "storage.modify:/data", "storage.create:/data/new", "storage.stage:/data"},
+			[]string{"storage.create:/data/new", "storage.modify:/data", "storage.read:/", "storage.stage:/data"},
+			[]string{"storage.create:/data/new", "storage.modify:/data", "storage.read:/", "storage.stage:/data"},
+		},
+		{
+			"Malformed and non-storage scopes are kept",
+			[]string{"storage.read", "storage.read:/", "compute.read:/queue", "compute.read:/"},
+			[]string{"compute.read:/", "compute.read:/queue", "storage.read", "storage.read:/"},
+			[]string{"compute.read:/", "compute.read:/queue", "storage.read", "storage.read:/"},
+		},
+		{"Empty", []string{" ", ""}, nil, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				if got := disc.UniqueScopes(tc.scopes); !reflect.DeepEqual(got, tc.unique) {
+					t.Errorf("Unique scopes do not match.  Expected %q, got %q", tc.unique, got)
+				}
+				if got := disc.NormalizeScopes(tc.scopes); !reflect.DeepEqual(got, tc.normalized) {
+					t.Errorf("Normalized scopes do not match.  Expected %q, got %q", tc.normalized, got)
+				}
+			},
+		)
+	}
+}
+
+func TestScopesEqual(t *testing.T) {
+	type testCase struct {
+		description string
+		a, b        []string
+		expected    bool
+	}
+
+	testCases := []testCase{
+		{"Same scopes", []string{"storage.read:/", "openid"}, []string{"storage.read:/", "openid"}, true},
+		{"Different order", []string{"openid", "storage.read:/"}, []string{"storage.read:/", "openid"}, true},
+		{"Duplicates", []string{"openid", "openid"}, []string{"openid"}, true},
+		{"Subsumed scope", []string{"storage.read:/", "storage.read:/data"}, []string{"storage.read:/"}, true},
+		{"Different paths", []string{"storage.read:/data"}, []string{"storage.read:/"}, false},
+		{"Different operations", []string{"storage.modify:/"}, []string{"storage.create:/"}, false},
+		{"Both empty", nil, []string{""}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.description,
+			func(t *testing.T) {
+				if got := disc.ScopesEqual(tc.a, tc.b); got != tc.expected {
+					t.Errorf("Expected %t, got %t", tc.expected, got)
+				}
+			},
+		)
+	}
+}